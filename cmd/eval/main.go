@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"project-yume/internal/aifunction"
+	"project-yume/internal/config"
+	"project-yume/internal/eval"
+	"project-yume/internal/service"
+)
+
+func main() {
+	datasetPath := flag.String("dataset", "config/analysis_eval.example.jsonl", "标注数据集(JSONL)")
+	profile := flag.String("profile", "", "只用这个模型配置，忽略路由与备用配置；为空按当前配置")
+	promptA := flag.String("prompt-a", "", "A 版分析规则文件，为空用内置规则")
+	promptB := flag.String("prompt-b", "", "B 版分析规则文件，设置后并排对比 A/B")
+	concurrency := flag.Int("concurrency", 4, "并发用例数")
+	limit := flag.Int("limit", 0, "只跑前 N 条，0 表示全部")
+	jsonOut := flag.String("json", "", "把完整结果写成 JSON 文件")
+	dumpPrompt := flag.Bool("dump-prompt", false, "打印内置分析规则后退出，可作为改版的起点")
+	logLevel := flag.String("log-level", "WARN", "日志级别")
+	flag.Parse()
+
+	if *dumpPrompt {
+		fmt.Print(service.AnalysisRules())
+		return
+	}
+
+	// 评测不落盘日志、不写审计、不受预算限制，避免污染线上数据。
+	os.Setenv("LOG_LEVEL", *logLevel)
+	os.Setenv("LOG_TO_FILE", "false")
+	os.Setenv("ENABLE_AI_AUDIT", "false")
+	for _, key := range []string{"AI_DAILY_TOKEN_BUDGET", "AI_MONTHLY_TOKEN_BUDGET", "AI_DAILY_COST_BUDGET", "AI_MONTHLY_COST_BUDGET"} {
+		os.Setenv(key, "0")
+	}
+	if *profile != "" {
+		cleanup, err := pinProfile(*profile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "pin profile failed: %v\n", err)
+			os.Exit(2)
+		}
+		defer cleanup()
+	}
+	if err := config.ReloadRuntimeConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "load config failed: %v\n", err)
+		os.Exit(2)
+	}
+	aifunction.ReloadClient()
+	eval.InstallMeter()
+
+	cases, err := eval.LoadDataset(*datasetPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load dataset failed: %v\n", err)
+		os.Exit(2)
+	}
+	if *limit > 0 && *limit < len(cases) {
+		cases = cases[:*limit]
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	reportA, err := runVersion(ctx, cases, *promptA, "A", *concurrency)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	reports := []*eval.Report{reportA}
+	reportA.WriteText(os.Stdout)
+
+	if *promptB != "" {
+		reportB, err := runVersion(ctx, cases, *promptB, "B", *concurrency)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		reports = append(reports, reportB)
+		fmt.Println()
+		reportB.WriteText(os.Stdout)
+		fmt.Println()
+		eval.WriteComparison(os.Stdout, reportA, reportB)
+	}
+
+	if *jsonOut != "" {
+		if err := writeJSON(*jsonOut, reports); err != nil {
+			fmt.Fprintf(os.Stderr, "write json failed: %v\n", err)
+			os.Exit(2)
+		}
+	}
+}
+
+// runVersion 换上指定规则跑一遍数据集，报告名取规则文件名。
+func runVersion(ctx context.Context, cases []eval.Case, rulesPath, fallbackName string, concurrency int) (*eval.Report, error) {
+	name := fallbackName + ":builtin"
+	rules := ""
+	if rulesPath != "" {
+		data, err := os.ReadFile(rulesPath)
+		if err != nil {
+			return nil, fmt.Errorf("read prompt %s failed: %w", fallbackName, err)
+		}
+		rules = strings.TrimRight(string(data), "\n") + "\n"
+		name = fallbackName + ":" + filepath.Base(rulesPath)
+	}
+	service.SetAnalysisRules(rules)
+	defer service.SetAnalysisRules("")
+	return eval.Run(ctx, cases, eval.Options{Name: name, Concurrency: concurrency}), nil
+}
+
+// pinProfile 生成只含指定配置的临时配置文件，让分类与回复都走同一个模型。
+func pinProfile(name string) (func(), error) {
+	set, err := config.LoadAIProfileSet(config.GetAIConfigFilePath())
+	if err != nil {
+		return nil, err
+	}
+	profile, ok := set.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("ai profile not found: %s", name)
+	}
+
+	dir, err := os.MkdirTemp("", "yume-eval-")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "ai_profiles.json")
+	pinned := config.AIProfileSet{Active: name, Profiles: map[string]config.AIProfile{name: profile}}
+	if err := config.SaveAIProfileSet(path, pinned); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	os.Setenv("AI_CONFIG_FILE", path)
+	os.Setenv("AI_PROFILE", name)
+	return func() { os.RemoveAll(dir) }, nil
+}
+
+func writeJSON(path string, reports []*eval.Report) error {
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"project-yume/internal/mockllm"
+	"project-yume/internal/utils"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:18080", "监听地址")
+	rulesFile := flag.String("rules", "", "脚本规则文件(JSON)，为空只用内置规则")
+	latency := flag.Duration("latency", 0, "每次响应前的固定延迟")
+	chunkDelay := flag.Duration("chunk-delay", 30*time.Millisecond, "流式分片之间的延迟")
+	chunkRunes := flag.Int("chunk-runes", 6, "每个流式分片的字数")
+	holdLimit := flag.Duration("hold-limit", 2*time.Minute, "timeout 故障的最长挂起时间")
+	logLevel := flag.String("log-level", "INFO", "日志级别")
+	flag.Parse()
+
+	if err := utils.ConfigureDefaultLogger(utils.ParseLogLevel(*logLevel), false, true, "", "text"); err != nil {
+		fmt.Fprintf(os.Stderr, "configure logger failed: %v\n", err)
+	}
+
+	var rules []mockllm.Rule
+	if *rulesFile != "" {
+		loaded, err := mockllm.LoadRules(*rulesFile)
+		if err != nil {
+			utils.Error("加载规则失败: %v", err)
+			os.Exit(1)
+		}
+		rules = loaded
+		utils.Info("已加载 %d 条规则: %s", len(rules), *rulesFile)
+	}
+
+	server := mockllm.NewServer(mockllm.Options{
+		Rules:      rules,
+		Latency:    *latency,
+		ChunkDelay: *chunkDelay,
+		ChunkRunes: *chunkRunes,
+		HoldLimit:  *holdLimit,
+	})
+	httpServer := &http.Server{Addr: *addr, Handler: server.Handler()}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	utils.Info("模拟模型服务已启动: http://%s/v1", *addr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		utils.Error("模拟模型服务退出: %v", err)
+		os.Exit(1)
+	}
+}
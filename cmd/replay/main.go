@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"project-yume/internal/config"
+	"project-yume/internal/replay"
+	"project-yume/internal/utils"
+)
+
+func main() {
+	settle := flag.Duration("settle", 50*time.Millisecond, "连续多久没有活动才推进假时钟")
+	logLevel := flag.String("log-level", "WARN", "日志级别")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "用法: %s [flags] <cassette.jsonl>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg := config.GetConfig()
+	cfg.LogToFile = false
+	cfg.LogLevel = *logLevel
+	if err := utils.ConfigureDefaultLogger(utils.ParseLogLevel(*logLevel), false, cfg.LogEnableColor, "", "text"); err != nil {
+		fmt.Fprintf(os.Stderr, "configure logger failed: %v\n", err)
+	}
+
+	cassette, err := replay.Load(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load cassette failed: %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	result, err := replay.Run(ctx, cassette, replay.Options{Settle: *settle})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "replay failed: %v\n", err)
+		os.Exit(2)
+	}
+
+	result.Report(os.Stdout)
+	if !result.OK() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,135 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+
+	"project-yume/internal/aifunction"
+	"project-yume/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+type aiRouteInfo struct {
+	Task     string `json:"task"`
+	Profile  string `json:"profile"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Routed   bool   `json:"routed"`
+}
+
+type aiRoutesResponse struct {
+	Active   string                     `json:"active"`
+	Profiles []string                   `json:"profiles"`
+	Routes   []aiRouteInfo              `json:"routes"`
+	Failover []string                   `json:"failover"`
+	Health   []aifunction.ProfileHealth `json:"health"`
+}
+
+type updateAIRoutesRequest struct {
+	// Routes 任务到配置名，值为空表示改回使用当前配置。
+	Routes map[string]string `json:"routes"`
+	// Failover 非空时整体替换备用配置顺序，传空数组表示清空。
+	Failover *[]string `json:"failover"`
+}
+
+func (s *server) handleGetAIRoutes(c *gin.Context) {
+	set, err := config.LoadAIProfileSet(config.GetAIConfigFilePath())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("load ai profiles failed: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, buildAIRoutesResponse(set))
+}
+
+func (s *server) handlePutAIRoutes(c *gin.Context) {
+	var req updateAIRoutesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	path := config.GetAIConfigFilePath()
+	set, err := config.LoadAIProfileSet(path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("load ai profiles failed: %v", err)})
+		return
+	}
+	for task, profileName := range req.Routes {
+		if err := config.SetAIRoute(&set, task, profileName); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Failover != nil {
+		if err := config.SetAIFailover(&set, *req.Failover); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := config.SaveAIProfileSet(path, set); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("save ai profiles failed: %v", err)})
+		return
+	}
+
+	if err := config.ReloadRuntimeConfig(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("reload config failed: %v", err)})
+		return
+	}
+	aifunction.ReloadClient()
+	c.JSON(http.StatusOK, buildAIRoutesResponse(set))
+}
+
+func buildAIRoutesResponse(set config.AIProfileSet) aiRoutesResponse {
+	routes := make([]aiRouteInfo, 0, len(config.AITasks()))
+	for _, task := range config.AITasks() {
+		name, profile, err := config.ResolveAIRoute(set, task)
+		if err != nil {
+			continue
+		}
+		_, routed := set.Routes[task]
+		routes = append(routes, aiRouteInfo{
+			Task:     task,
+			Profile:  name,
+			Provider: profile.Provider,
+			Model:    profile.AIModel,
+			Routed:   routed,
+		})
+	}
+	failover := set.Failover
+	if failover == nil {
+		failover = []string{}
+	}
+	return aiRoutesResponse{
+		Active:   set.Active,
+		Profiles: config.AIProfileNames(set),
+		Routes:   routes,
+		Failover: failover,
+		Health:   aiProfilesHealth(),
+	}
+}
+
+// aiProfilesHealth 返回各任务调用链上所有配置的熔断状态，未发过请求的配置为 closed。
+func aiProfilesHealth() []aifunction.ProfileHealth {
+	known := make(map[string]aifunction.ProfileHealth)
+	for _, health := range aifunction.ProfilesHealth() {
+		known[health.Profile] = health
+	}
+
+	seen := make(map[string]struct{})
+	result := make([]aifunction.ProfileHealth, 0)
+	for _, task := range config.AITasks() {
+		for _, target := range config.GetAIRouteChain(task) {
+			if _, ok := seen[target.Name]; ok {
+				continue
+			}
+			seen[target.Name] = struct{}{}
+			health, ok := known[target.Name]
+			if !ok {
+				health = aifunction.ProfileHealth{Profile: target.Name, State: aifunction.BreakerClosed}
+			}
+			result = append(result, health)
+		}
+	}
+	return result
+}
@@ -0,0 +1,139 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-yume/internal/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// auditSummary 列表里的一条记录，不含完整消息。
+type auditSummary struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	UserID    int64     `json:"user_id,omitempty"`
+	Task      string    `json:"task"`
+	Profile   string    `json:"profile,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	Outcome   string    `json:"outcome,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latency_ms"`
+}
+
+type auditListResponse struct {
+	Records []auditSummary `json:"records"`
+}
+
+type auditDetailResponse struct {
+	Record  audit.Record   `json:"record"`
+	Related []auditSummary `json:"related"`
+}
+
+func summarizeAudit(record audit.Record) auditSummary {
+	summary := auditSummary{
+		ID:        record.ID,
+		Kind:      record.Kind,
+		Time:      record.Time,
+		RequestID: record.RequestID,
+		SessionID: record.SessionID,
+		UserID:    record.UserID,
+		Task:      record.Task,
+		Profile:   record.Profile,
+		Model:     record.Model,
+		Error:     record.Error,
+		LatencyMs: record.LatencyMs,
+	}
+	if record.Parse != nil {
+		summary.Outcome = record.Parse.Outcome
+		summary.Error = record.Parse.Error
+	}
+	return summary
+}
+
+// handleAuditSearch 按请求 ID、会话、用户或任务搜索模型调用审计，最新的在前。
+func (s *server) handleAuditSearch(c *gin.Context) {
+	setNoCacheHeaders(c)
+
+	limit := defaultAuditLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		if parsed > maxAuditLimit {
+			parsed = maxAuditLimit
+		}
+		limit = parsed
+	}
+
+	var userID int64
+	if raw := strings.TrimSpace(c.Query("user_id")); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be an integer"})
+			return
+		}
+		userID = parsed
+	}
+
+	records, err := audit.GetManager().Search(audit.Query{
+		RequestID: strings.TrimSpace(c.Query("request_id")),
+		SessionID: strings.TrimSpace(c.Query("session_id")),
+		UserID:    userID,
+		Task:      strings.TrimSpace(c.Query("task")),
+		Limit:     limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := auditListResponse{Records: make([]auditSummary, 0, len(records))}
+	for _, record := range records {
+		response.Records = append(response.Records, summarizeAudit(record))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleGetAudit 返回一条审计记录的完整内容，以及同一请求下的其他记录。
+func (s *server) handleGetAudit(c *gin.Context) {
+	setNoCacheHeaders(c)
+
+	manager := audit.GetManager()
+	record, ok, err := manager.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "audit record not found"})
+		return
+	}
+
+	response := auditDetailResponse{Record: record, Related: []auditSummary{}}
+	if record.RequestID != "" {
+		related, err := manager.Search(audit.Query{RequestID: record.RequestID, Limit: maxAuditLimit})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, item := range related {
+			if item.ID != record.ID {
+				response.Related = append(response.Related, summarizeAudit(item))
+			}
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
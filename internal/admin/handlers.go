@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"project-yume/internal/config"
+	"project-yume/internal/handler"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultDispatchLimit = 50
+	maxDispatchLimit     = 200
+)
+
+type handlerRegistryResponse struct {
+	OnlyLongChat bool                  `json:"only_long_chat"`
+	Handlers     []handler.HandlerInfo `json:"handlers"`
+	Routes       map[string][]string   `json:"routes"`
+}
+
+type dispatchesResponse struct {
+	Dispatches []handler.DispatchRecord `json:"dispatches"`
+}
+
+func (s *server) handleMessageHandlers(c *gin.Context) {
+	registry := handler.DefaultRegistry()
+	c.JSON(http.StatusOK, handlerRegistryResponse{
+		OnlyLongChat: config.GetConfig().EnableOnlyLongChat,
+		Handlers:     registry.Handlers(),
+		Routes:       registry.Routes(),
+	})
+}
+
+func (s *server) handleHandlerDispatches(c *gin.Context) {
+	setNoCacheHeaders(c)
+
+	limit := defaultDispatchLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		if parsed > maxDispatchLimit {
+			parsed = maxDispatchLimit
+		}
+		limit = parsed
+	}
+	c.JSON(http.StatusOK, dispatchesResponse{Dispatches: handler.RecentDispatches(limit)})
+}
@@ -0,0 +1,358 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-yume/internal/memory"
+	"project-yume/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxEmotionalInteractions = 200
+
+// defaultMoodDays 情绪时间线默认返回的天数。
+const defaultMoodDays = 90
+
+type memoryUserSummary struct {
+	UserID       int64     `json:"user_id"`
+	Facts        int       `json:"facts"`
+	ActiveFacts  int       `json:"active_facts"`
+	HasProfile   bool      `json:"has_profile"`
+	Interactions int       `json:"interactions"`
+	Episodes     int       `json:"episodes"`
+	Affinity     float64   `json:"affinity"`
+	Stage        string    `json:"stage,omitempty"`
+	MoodDays     int       `json:"mood_days"`
+	LastSeen     time.Time `json:"last_seen,omitempty"`
+}
+
+type memoryUsersResponse struct {
+	Users []memoryUserSummary `json:"users"`
+}
+
+type factListResponse struct {
+	Facts []memory.FactMemory `json:"facts"`
+}
+
+// updateFactRequest 缺省字段不修改；clear_expires_at 为 true 时去掉有效期。
+type updateFactRequest struct {
+	Object         *string    `json:"object"`
+	Summary        *string    `json:"summary"`
+	Tags           []string   `json:"tags"`
+	Confidence     *float64   `json:"confidence"`
+	Status         *string    `json:"status"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	ClearExpiresAt bool       `json:"clear_expires_at"`
+}
+
+// updateProfileRequest 缺省的列表不修改，空数组表示清空。
+type updateProfileRequest struct {
+	Likes    []string `json:"likes"`
+	Dislikes []string `json:"dislikes"`
+	Taboos   []string `json:"taboos"`
+}
+
+// moodResponse Distress 为截止到今天或昨天的连续低落，没有时省略。
+type moodResponse struct {
+	memory.MoodTimeline
+	Distress *memory.MoodPattern `json:"distress,omitempty"`
+}
+
+type emotionalMemoryResponse struct {
+	UserID         int64                `json:"user_id"`
+	LastSeen       time.Time            `json:"last_seen"`
+	Total          int                  `json:"total"`
+	EmotionCount   map[string]int       `json:"emotion_count"`
+	IntentionCount map[string]int       `json:"intention_count"`
+	Interactions   []memory.Interaction `json:"interactions"`
+}
+
+// handleMemoryUsers 列出有记忆的用户及各类记忆的条数。
+func (s *server) handleMemoryUsers(c *gin.Context) {
+	setNoCacheHeaders(c)
+
+	facts := memory.GetFactManager()
+	profiles := memory.GetProfileManager()
+	emotional := memory.GetManager()
+	episodes := memory.GetEpisodeManager()
+
+	byID := make(map[int64]*memoryUserSummary)
+	ensure := func(userID int64) *memoryUserSummary {
+		if byID[userID] == nil {
+			byID[userID] = &memoryUserSummary{UserID: userID}
+		}
+		return byID[userID]
+	}
+	for _, userID := range facts.FactUserIDs() {
+		summary := ensure(userID)
+		for _, fact := range facts.ListFacts(userID) {
+			summary.Facts++
+			if fact.Status == memory.FactStatusActive {
+				summary.ActiveFacts++
+			}
+		}
+	}
+	for _, userID := range profiles.ProfileUserIDs() {
+		ensure(userID).HasProfile = true
+	}
+	for _, userID := range emotional.UserIDs() {
+		if record := emotional.GetMemory(userID); record != nil {
+			summary := ensure(userID)
+			summary.Interactions = len(record.Interactions)
+			summary.LastSeen = record.LastSeen
+		}
+	}
+	for _, userID := range episodes.EpisodeUserIDs() {
+		ensure(userID).Episodes = len(episodes.ListEpisodes(userID))
+	}
+	affinity := memory.GetAffinityManager()
+	for _, userID := range affinity.AffinityUserIDs() {
+		if record, ok := affinity.GetAffinity(userID); ok {
+			summary := ensure(userID)
+			summary.Affinity = record.Score
+			summary.Stage = record.Stage
+		}
+	}
+
+	moods := memory.GetMoodManager()
+	for _, userID := range moods.MoodUserIDs() {
+		if timeline, ok := moods.Timeline(userID, 0); ok {
+			ensure(userID).MoodDays = len(timeline.Days)
+		}
+	}
+
+	response := memoryUsersResponse{Users: make([]memoryUserSummary, 0, len(byID))}
+	for _, summary := range byID {
+		response.Users = append(response.Users, *summary)
+	}
+	sort.Slice(response.Users, func(i, j int) bool { return response.Users[i].UserID < response.Users[j].UserID })
+	c.JSON(http.StatusOK, response)
+}
+
+// handleMemoryFacts 按用户、状态、谓词和关键词筛选事实，不指定用户时搜索全部用户。
+func (s *server) handleMemoryFacts(c *gin.Context) {
+	setNoCacheHeaders(c)
+
+	manager := memory.GetFactManager()
+	userIDs := manager.FactUserIDs()
+	if raw := strings.TrimSpace(c.Query("user_id")); raw != "" {
+		userID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be an integer"})
+			return
+		}
+		userIDs = []int64{userID}
+	}
+	status := strings.TrimSpace(c.Query("status"))
+	predicate := strings.TrimSpace(c.Query("predicate"))
+	query := strings.TrimSpace(c.Query("q"))
+
+	response := factListResponse{Facts: []memory.FactMemory{}}
+	for _, userID := range userIDs {
+		for _, fact := range manager.ListFacts(userID) {
+			if status != "" && fact.Status != status {
+				continue
+			}
+			if predicate != "" && fact.Predicate != predicate {
+				continue
+			}
+			if query != "" && !factMatches(fact, query) {
+				continue
+			}
+			response.Facts = append(response.Facts, fact)
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleMemoryFactTimeline 返回用户各谓词的历次取值，按生效时间排序；predicate 为空时返回全部谓词。
+func (s *server) handleMemoryFactTimeline(c *gin.Context) {
+	setNoCacheHeaders(c)
+
+	userID, ok := memoryUserParam(c)
+	if !ok {
+		return
+	}
+	predicates := memory.FactPredicates()
+	if predicate := strings.TrimSpace(c.Query("predicate")); predicate != "" {
+		if !memory.IsKnownFactPredicate(predicate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown predicate: %q", predicate)})
+			return
+		}
+		predicates = []string{predicate}
+	}
+
+	timeline := make(map[string][]memory.FactMemory)
+	manager := memory.GetFactManager()
+	for _, predicate := range predicates {
+		if values := manager.FactTimeline(userID, predicate); len(values) > 0 {
+			timeline[predicate] = values
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "timeline": timeline})
+}
+
+func factMatches(fact memory.FactMemory, query string) bool {
+	if strings.Contains(fact.Object, query) || strings.Contains(fact.Summary, query) || strings.Contains(fact.SourceMessage, query) {
+		return true
+	}
+	for _, tag := range fact.Tags {
+		if strings.Contains(tag, query) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *server) handleUpdateMemoryFact(c *gin.Context) {
+	var req updateFactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	edit := memory.FactEdit{
+		Object:     req.Object,
+		Summary:    req.Summary,
+		Tags:       req.Tags,
+		Confidence: req.Confidence,
+		Status:     req.Status,
+		ExpiresAt:  req.ExpiresAt,
+	}
+	if req.ClearExpiresAt {
+		edit.ExpiresAt = &time.Time{}
+	}
+	fact, err := memory.GetFactManager().EditFact(c.Param("id"), edit)
+	if errors.Is(err, memory.ErrFactNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"fact": fact})
+}
+
+func (s *server) handleDeleteMemoryFact(c *gin.Context) {
+	id := c.Param("id")
+	if err := memory.GetFactManager().DeleteFact(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": id})
+}
+
+func (s *server) handleGetMemoryProfile(c *gin.Context) {
+	setNoCacheHeaders(c)
+
+	userID, ok := memoryUserParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, memory.GetProfileManager().GetProfile(userID))
+}
+
+// handleUpdateMemoryProfile 覆盖喜好、厌恶与禁忌列表，语气等由模型维护的字段不在这里改。
+func (s *server) handleUpdateMemoryProfile(c *gin.Context) {
+	userID, ok := memoryUserParam(c)
+	if !ok {
+		return
+	}
+	var req updateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, memory.GetProfileManager().SetPreferenceLists(userID, req.Likes, req.Dislikes, req.Taboos))
+}
+
+// handleGetEmotionalMemory 返回偏好计数和最近的交互，最新的在前。
+func (s *server) handleGetEmotionalMemory(c *gin.Context) {
+	setNoCacheHeaders(c)
+
+	userID, ok := memoryUserParam(c)
+	if !ok {
+		return
+	}
+	record := memory.GetManager().GetMemory(userID)
+	if record == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "emotional memory not found"})
+		return
+	}
+
+	interactions := make([]memory.Interaction, 0, min(len(record.Interactions), maxEmotionalInteractions))
+	for i := len(record.Interactions) - 1; i >= 0 && len(interactions) < maxEmotionalInteractions; i-- {
+		interactions = append(interactions, record.Interactions[i])
+	}
+	c.JSON(http.StatusOK, emotionalMemoryResponse{
+		UserID:         userID,
+		LastSeen:       record.LastSeen,
+		Total:          len(record.Interactions),
+		EmotionCount:   record.Preferences.EmotionCount,
+		IntentionCount: record.Preferences.IntentionCount,
+		Interactions:   interactions,
+	})
+}
+
+// handleGetAffinity 返回用户的好感度、关系阶段、每日分数趋势和最近的变化事件。
+func (s *server) handleGetAffinity(c *gin.Context) {
+	setNoCacheHeaders(c)
+
+	userID, ok := memoryUserParam(c)
+	if !ok {
+		return
+	}
+	record, ok := memory.GetAffinityManager().GetAffinity(userID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "affinity not found"})
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// handleGetMood 返回用户最近 days 天（默认 90）的每日情绪、当前的持续低落和关心记录。
+func (s *server) handleGetMood(c *gin.Context) {
+	setNoCacheHeaders(c)
+
+	userID, ok := memoryUserParam(c)
+	if !ok {
+		return
+	}
+	days := defaultMoodDays
+	if raw := c.Query("days"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a positive integer"})
+			return
+		}
+		days = parsed
+	}
+	timeline, ok := memory.GetMoodManager().Timeline(userID, days)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "mood not found"})
+		return
+	}
+	response := moodResponse{MoodTimeline: timeline}
+	location, _ := service.TimeContextLocation()
+	if pattern, ok := memory.GetMoodManager().DistressPattern(userID, time.Now().In(location).Format("2006-01-02")); ok {
+		response.Distress = &pattern
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func memoryUserParam(c *gin.Context) (int64, bool) {
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be a non-zero integer"})
+		return 0, false
+	}
+	return userID, true
+}
@@ -0,0 +1,62 @@
+package admin
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"project-yume/internal/privacy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handlePrivacyExport 导出用户的全部数据，format=zip 时返回附带日志原文的 zip 包。
+func (s *server) handlePrivacyExport(c *gin.Context) {
+	setNoCacheHeaders(c)
+
+	userID, ok := memoryUserParam(c)
+	if !ok {
+		return
+	}
+	bundle, err := privacy.Export(userID)
+	if err != nil {
+		privacy.RecordRequest("export", privacy.RequestedByAdmin, "error")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	privacy.RecordRequest("export", privacy.RequestedByAdmin, "ok")
+
+	name := fmt.Sprintf("user_%d_%s", userID, bundle.ExportedAt.Format("20060102_150405"))
+	if c.Query("format") != "zip" {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, name))
+		c.IndentedJSON(http.StatusOK, bundle)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := bundle.WriteZip(&buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, name))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// handlePrivacyForget 彻底删除用户数据并写入删除记录，部分失败时仍返回已删除的条数。
+func (s *server) handlePrivacyForget(c *gin.Context) {
+	userID, ok := memoryUserParam(c)
+	if !ok {
+		return
+	}
+	report, err := privacy.Forget(userID, privacy.RequestedByAdmin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+func (s *server) handlePrivacyTombstones(c *gin.Context) {
+	setNoCacheHeaders(c)
+	c.JSON(http.StatusOK, gin.H{"tombstones": privacy.GetTombstoneManager().List()})
+}
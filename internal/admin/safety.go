@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"project-yume/internal/safety"
+	"project-yume/internal/state"
+	"project-yume/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultCrisisEventLimit = 50
+	maxCrisisEventLimit     = 500
+)
+
+type crisisEventsResponse struct {
+	Events []safety.Event `json:"events"`
+	// Guarded 仍在守护期的会话及到期时间。
+	Guarded map[string]time.Time `json:"guarded"`
+}
+
+// handleCrisisEvents 返回最近的危机触发记录，可按用户过滤，最新的在前。
+func (s *server) handleCrisisEvents(c *gin.Context) {
+	setNoCacheHeaders(c)
+
+	limit := defaultCrisisEventLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		if parsed > maxCrisisEventLimit {
+			parsed = maxCrisisEventLimit
+		}
+		limit = parsed
+	}
+
+	var userID int64
+	if raw := strings.TrimSpace(c.Query("user_id")); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be an integer"})
+			return
+		}
+		userID = parsed
+	}
+
+	events := safety.GetEventManager().Events(userID, limit)
+	response := crisisEventsResponse{Events: events, Guarded: make(map[string]time.Time)}
+	sm := state.GetManager()
+	for _, event := range events {
+		if until, ok := sm.Guarded(event.SessionID); ok {
+			response.Guarded[event.SessionID] = until
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// handleReleaseCrisisGuard 管理员确认用户安全后，提前解除该用户全部会话的守护状态。
+func (s *server) handleReleaseCrisisGuard(c *gin.Context) {
+	userID, ok := memoryUserParam(c)
+	if !ok {
+		return
+	}
+
+	sm := state.GetManager()
+	released := make([]string, 0)
+	for _, session := range sm.UserSessions(userID) {
+		if sm.ReleaseGuard(session.ID) {
+			released = append(released, session.ID)
+		}
+	}
+	if len(released) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no guarded session"})
+		return
+	}
+	utils.Infow("crisis guard released by admin",
+		utils.Int64("user_id", userID),
+		utils.Any("sessions", released),
+	)
+	c.JSON(http.StatusOK, gin.H{"released": released})
+}
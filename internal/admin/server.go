@@ -32,6 +32,8 @@ const (
 )
 
 type configResponse struct {
+	AIProvider             string   `json:"aiProvider"`
+	AIProviders            []string `json:"aiProviders"`
 	AIBaseURL              string   `json:"aiBaseUrl"`
 	AIModel                string   `json:"aiModel"`
 	AIKeyMasked            string   `json:"aiKeyMasked"`
@@ -63,6 +65,7 @@ type configResponse struct {
 
 type aiProfileResponse struct {
 	Name          string  `json:"name"`
+	AIProvider    string  `json:"aiProvider"`
 	AIBaseURL     string  `json:"aiBaseUrl"`
 	AIModel       string  `json:"aiModel"`
 	AIKeyMasked   string  `json:"aiKeyMasked"`
@@ -76,6 +79,7 @@ type aiProfileResponse struct {
 }
 
 type updateConfigRequest struct {
+	AIProvider             string  `json:"aiProvider"`
 	AIBaseURL              string  `json:"aiBaseUrl"`
 	AIModel                string  `json:"aiModel"`
 	AIProfile              string  `json:"aiProfile"`
@@ -116,10 +120,11 @@ type logContentResponse struct {
 }
 
 type healthResponse struct {
-	Status    string            `json:"status"`
-	Time      time.Time         `json:"time"`
-	UptimeSec int64             `json:"uptimeSec"`
-	Checks    map[string]string `json:"checks"`
+	Status     string                     `json:"status"`
+	Time       time.Time                  `json:"time"`
+	UptimeSec  int64                      `json:"uptimeSec"`
+	Checks     map[string]string          `json:"checks"`
+	AIProfiles []aifunction.ProfileHealth `json:"aiProfiles,omitempty"`
 }
 
 type characterConfigResponse struct {
@@ -191,6 +196,26 @@ func (s *server) routes() *gin.Engine {
 		adminGroup.GET("/config", s.handleGetConfig)
 		adminGroup.PUT("/config", s.handlePutConfig)
 		adminGroup.GET("/ai-profiles/:name", s.handleGetAIProfile)
+		adminGroup.GET("/ai-routes", s.handleGetAIRoutes)
+		adminGroup.PUT("/ai-routes", s.handlePutAIRoutes)
+		adminGroup.GET("/usage", s.handleUsage)
+		adminGroup.GET("/audit", s.handleAuditSearch)
+		adminGroup.GET("/audit/:id", s.handleGetAudit)
+		adminGroup.GET("/memory/users", s.handleMemoryUsers)
+		adminGroup.GET("/memory/facts", s.handleMemoryFacts)
+		adminGroup.PUT("/memory/facts/:id", s.handleUpdateMemoryFact)
+		adminGroup.DELETE("/memory/facts/:id", s.handleDeleteMemoryFact)
+		adminGroup.GET("/memory/timeline/:user_id", s.handleMemoryFactTimeline)
+		adminGroup.GET("/memory/profiles/:user_id", s.handleGetMemoryProfile)
+		adminGroup.PUT("/memory/profiles/:user_id", s.handleUpdateMemoryProfile)
+		adminGroup.GET("/memory/emotional/:user_id", s.handleGetEmotionalMemory)
+		adminGroup.GET("/memory/affinity/:user_id", s.handleGetAffinity)
+		adminGroup.GET("/memory/mood/:user_id", s.handleGetMood)
+		adminGroup.GET("/privacy/users/:user_id/export", s.handlePrivacyExport)
+		adminGroup.DELETE("/privacy/users/:user_id", s.handlePrivacyForget)
+		adminGroup.GET("/privacy/tombstones", s.handlePrivacyTombstones)
+		adminGroup.GET("/safety/events", s.handleCrisisEvents)
+		adminGroup.DELETE("/safety/guard/:user_id", s.handleReleaseCrisisGuard)
 		adminGroup.GET("/image-assets", s.handleImageAssets)
 		adminGroup.GET("/logs/files", s.handleLogFiles)
 		adminGroup.GET("/logs/content", s.handleLogContent)
@@ -199,6 +224,8 @@ func (s *server) routes() *gin.Engine {
 		adminGroup.GET("/characters/:name", s.handleGetCharacterConfig)
 		adminGroup.PUT("/characters/:name", s.handleUpdateCharacterConfig)
 		adminGroup.POST("/characters", s.handleCreateCharacterConfig)
+		adminGroup.GET("/handlers", s.handleMessageHandlers)
+		adminGroup.GET("/handlers/dispatches", s.handleHandlerDispatches)
 	}
 
 	engine.NoRoute(func(c *gin.Context) {
@@ -259,6 +286,20 @@ func (s *server) handleReady(c *gin.Context) {
 		resp.Checks["log_dir"] = "ok"
 	}
 
+	// 回复链路上的配置全部熔断时视为不可接流量。
+	resp.AIProfiles = aiProfilesHealth()
+	replyAvailable := false
+	for _, target := range config.GetAIRouteChain(config.AITaskReply) {
+		state := aifunction.ProfileState(target.Name)
+		resp.Checks["ai_profile:"+target.Name] = state
+		if state != aifunction.BreakerOpen {
+			replyAvailable = true
+		}
+	}
+	if !replyAvailable {
+		resp.Status = "degraded"
+	}
+
 	status := http.StatusOK
 	if resp.Status != "ok" {
 		status = http.StatusServiceUnavailable
@@ -302,6 +343,7 @@ func (s *server) handlePutConfig(c *gin.Context) {
 	}
 
 	targetProfile := config.AIProfile{
+		Provider:      req.AIProvider,
 		AIBaseURL:     req.AIBaseURL,
 		AIModel:       req.AIModel,
 		AIKey:         aiKey,
@@ -311,6 +353,9 @@ func (s *server) handlePutConfig(c *gin.Context) {
 		AIRetryCount:  req.AIRetryCount,
 		AIRateLimit:   req.AIRateLimit,
 		AITopP:        req.AITopP,
+		// 单价不在表单里，沿用配置文件中的值。
+		InputPrice:  existingProfile.InputPrice,
+		OutputPrice: existingProfile.OutputPrice,
 	}
 	if err := config.ValidateAIProfile(targetProfile); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -384,6 +429,7 @@ func (s *server) handleGetAIProfile(c *gin.Context) {
 		config.GetAIConfigFilePath(),
 		cfg.AiProfile,
 		config.AIProfile{
+			Provider:      cfg.AiProvider,
 			AIBaseURL:     cfg.AiBaseUrl,
 			AIModel:       cfg.AiModel,
 			AIKey:         cfg.AiKEY,
@@ -408,6 +454,7 @@ func (s *server) handleGetAIProfile(c *gin.Context) {
 
 	c.JSON(http.StatusOK, aiProfileResponse{
 		Name:          name,
+		AIProvider:    profile.Provider,
 		AIBaseURL:     profile.AIBaseURL,
 		AIModel:       profile.AIModel,
 		AIKeyMasked:   maskSecret(profile.AIKey),
@@ -863,6 +910,7 @@ func (s *server) buildConfigResponse() (configResponse, error) {
 		config.GetAIConfigFilePath(),
 		cfg.AiProfile,
 		config.AIProfile{
+			Provider:      cfg.AiProvider,
 			AIBaseURL:     cfg.AiBaseUrl,
 			AIModel:       cfg.AiModel,
 			AIKey:         cfg.AiKEY,
@@ -885,6 +933,8 @@ func (s *server) buildConfigResponse() (configResponse, error) {
 	aiPromptRaw := firstNonEmpty(os.Getenv("AI_PROMPT"), readEnvValue(envMap, "AI_PROMPT", "AiPrompt"))
 
 	return configResponse{
+		AIProvider:             firstNonEmpty(cfg.AiProvider, config.AIProviderOpenAI),
+		AIProviders:            config.AIProviders(),
 		AIBaseURL:              cfg.AiBaseUrl,
 		AIModel:                cfg.AiModel,
 		AIKeyMasked:            maskSecret(cfg.AiKEY),
@@ -1027,7 +1077,11 @@ func validateUpdateRequest(req updateConfigRequest) error {
 	if strings.TrimSpace(req.AIProfile) == "" {
 		return fmt.Errorf("aiProfile is required")
 	}
-	if strings.TrimSpace(req.AIBaseURL) == "" {
+	provider := strings.ToLower(strings.TrimSpace(req.AIProvider))
+	if provider != "" && !config.IsAIProvider(provider) {
+		return fmt.Errorf("aiProvider must be one of %s", strings.Join(config.AIProviders(), "/"))
+	}
+	if (provider == "" || provider == config.AIProviderOpenAI) && strings.TrimSpace(req.AIBaseURL) == "" {
 		return fmt.Errorf("aiBaseUrl is required")
 	}
 	if strings.TrimSpace(req.AIModel) == "" {
@@ -1193,6 +1247,9 @@ func validateCharacterConfig(cfg *character.CharacterConfig) error {
 	if cfg.Name == "" {
 		return fmt.Errorf("character config.name is required")
 	}
+	if _, err := cfg.Presets(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -1402,7 +1459,7 @@ func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, PUT, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, PUT, DELETE, OPTIONS")
 
 		if c.Request.Method == http.MethodOptions {
 			c.AbortWithStatus(http.StatusNoContent)
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"project-yume/internal/usage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultUsageDays = 7
+	maxUsageDays     = 93
+)
+
+type usageResponse struct {
+	Budget usage.BudgetStatus `json:"budget"`
+	Days   []usage.Day        `json:"days"`
+}
+
+// handleUsage 返回预算状态与最近几天按任务/配置/用户/会话汇总的用量，最新的在前。
+func (s *server) handleUsage(c *gin.Context) {
+	days := defaultUsageDays
+	if raw := c.Query("days"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a positive integer"})
+			return
+		}
+		if parsed > maxUsageDays {
+			parsed = maxUsageDays
+		}
+		days = parsed
+	}
+
+	now := time.Now()
+	manager := usage.GetManager()
+	c.JSON(http.StatusOK, usageResponse{
+		Budget: manager.Budget(now),
+		Days:   manager.Days(now, days),
+	})
+}
@@ -6,11 +6,12 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"net/http"
 	"strings"
-	"sync"
 	"time"
 
-	"project-yume/internal/config"
+	"project-yume/internal/clock"
+	"project-yume/internal/metrics"
 	"project-yume/internal/utils"
 
 	openai "github.com/sashabaranov/go-openai"
@@ -24,14 +25,9 @@ const (
 	maxRetryDelay           = 8 * time.Second
 )
 
-var (
-	aiLimiterOnce sync.Once
-	aiLimiter     *tokenBucketLimiter
-	aiLimiterMu   sync.Mutex
-)
-
 type tokenBucketLimiter struct {
 	tokens chan struct{}
+	done   chan struct{}
 }
 
 func newTokenBucketLimiter(ratePerMinute int) *tokenBucketLimiter {
@@ -41,6 +37,7 @@ func newTokenBucketLimiter(ratePerMinute int) *tokenBucketLimiter {
 
 	limiter := &tokenBucketLimiter{
 		tokens: make(chan struct{}, ratePerMinute),
+		done:   make(chan struct{}),
 	}
 
 	for i := 0; i < ratePerMinute; i++ {
@@ -51,10 +48,16 @@ func newTokenBucketLimiter(ratePerMinute int) *tokenBucketLimiter {
 	ticker := time.NewTicker(interval)
 
 	go func() {
-		for range ticker.C {
+		defer ticker.Stop()
+		for {
 			select {
-			case limiter.tokens <- struct{}{}:
-			default:
+			case <-limiter.done:
+				return
+			case <-ticker.C:
+				select {
+				case limiter.tokens <- struct{}{}:
+				default:
+				}
 			}
 		}
 	}()
@@ -62,6 +65,9 @@ func newTokenBucketLimiter(ratePerMinute int) *tokenBucketLimiter {
 	return limiter
 }
 
+// errLimiterStopped 限流器已被替换或丢弃，调用方应重新读取当前的限流器。
+var errLimiterStopped = errors.New("rate limiter stopped")
+
 func (l *tokenBucketLimiter) Wait(ctx context.Context) error {
 	if l == nil {
 		return nil
@@ -70,30 +76,19 @@ func (l *tokenBucketLimiter) Wait(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
+	case <-l.done:
+		return errLimiterStopped
 	case <-l.tokens:
 		return nil
 	}
 }
 
-func getAILimiter() *tokenBucketLimiter {
-	aiLimiterMu.Lock()
-	defer aiLimiterMu.Unlock()
-
-	aiLimiterOnce.Do(func() {
-		rateLimit := config.GetConfig().AiRateLimit
-		if rateLimit <= 0 {
-			rateLimit = defaultRateLimitRPM
-		}
-		aiLimiter = newTokenBucketLimiter(rateLimit)
-	})
-	return aiLimiter
-}
-
-func ResetRateLimiter() {
-	aiLimiterMu.Lock()
-	defer aiLimiterMu.Unlock()
-	aiLimiter = nil
-	aiLimiterOnce = sync.Once{}
+// Stop 停止补充令牌的协程并唤醒等待者，限流器被替换时调用。
+func (l *tokenBucketLimiter) Stop() {
+	if l == nil {
+		return
+	}
+	close(l.done)
 }
 
 func backoffDelay(attempt int) time.Duration {
@@ -154,80 +149,223 @@ func isRetryableAIError(err error) bool {
 	return false
 }
 
-func createChatCompletionWithPolicy(request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
-	cfg := config.GetConfig()
+// errLocalRateLimited 本地限流等待超时，换下一个配置但不计入熔断。
+var errLocalRateLimited = errors.New("wait rate limiter failed")
 
-	timeoutSeconds := cfg.AiTimeout
+// retryPolicy 返回配置的单次请求超时与总尝试次数。
+func (t *routeTarget) retryPolicy() (time.Duration, int) {
+	timeoutSeconds := t.cfg.AITimeout
 	if timeoutSeconds <= 0 {
 		timeoutSeconds = defaultAITimeoutSeconds
 	}
 
-	maxRetryCount := cfg.AiRetryCount
+	maxRetryCount := t.cfg.AIRetryCount
 	if maxRetryCount < 0 {
 		maxRetryCount = 0
 	}
 	if maxRetryCount > defaultMaxRetryCount {
 		maxRetryCount = defaultMaxRetryCount
 	}
+	return time.Duration(timeoutSeconds) * time.Second, maxRetryCount + 1
+}
 
-	attempts := maxRetryCount + 1
-	timeout := time.Duration(timeoutSeconds) * time.Second
+func (t *routeTarget) waitLimiter(ctx context.Context, timeout time.Duration) error {
+	waitCtx, cancelWait := context.WithTimeout(ctx, timeout)
+	defer cancelWait()
+	for {
+		err := t.limiter.Load().Wait(waitCtx)
+		if errors.Is(err, errLimiterStopped) {
+			// 配置重载替换了限流器，改到新的上面等；路由被丢弃时为 nil，直接放行
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("%w: %v", errLocalRateLimited, err)
+		}
+		return nil
+	}
+}
+
+// isFailoverError 判断错误是否说明该配置当前不可用，值得换下一个配置并计入熔断。
+// 参数错误等请求本身的问题换配置也没用，直接返回给调用方。
+func isFailoverError(err error) bool {
+	if isRetryableAIError(err) {
+		return true
+	}
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.HTTPStatusCode == http.StatusUnauthorized || apiErr.HTTPStatusCode == http.StatusForbidden
+	case errors.As(err, &reqErr):
+		return reqErr.HTTPStatusCode == http.StatusUnauthorized || reqErr.HTTPStatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// withFailover 依次在路由的各配置上执行 call，跳过已熔断的配置；预算只允许预设回复时直接拒绝。
+// call 返回的错误若属于服务端不可用，计入该配置的熔断并换下一个；其他错误直接返回。
+func withFailover(ctx context.Context, r *route, call func(t *routeTarget) error) error {
+	if err := checkBudget(r); err != nil {
+		return err
+	}
 
 	var lastErr error
+	var previous *routeTarget
+	for _, t := range r.targets {
+		if !t.breaker.Allow(time.Now()) {
+			metrics.IncCounter(
+				"bot_ai_calls_total",
+				"Total chat completion calls by route, profile and result.",
+				r.labels(t, map[string]string{"result": "breaker_open"}),
+			)
+			continue
+		}
+		if previous != nil {
+			metrics.IncCounter(
+				"bot_ai_failover_total",
+				"Total AI requests moved to a backup profile.",
+				map[string]string{"route": r.task, "from": previous.profile, "to": t.profile},
+			)
+			utils.Warn("AI request failing over (route=%s): %s -> %s", r.task, previous.profile, t.profile)
+		}
+
+		err := call(t)
+		var partial *partialStreamError
+		switch {
+		case errors.As(err, &partial):
+			return err
+		case err == nil:
+			t.breaker.Success()
+			return nil
+		case ctx.Err() != nil:
+			t.breaker.Release()
+			return ctx.Err()
+		case errors.Is(err, errLocalRateLimited):
+			t.breaker.Release()
+		case isFailoverError(err):
+			t.breaker.Failure(time.Now(), err)
+		default:
+			t.breaker.Release()
+			return err
+		}
+		lastErr = err
+		previous = t
+	}
+	if lastErr == nil {
+		return fmt.Errorf("all ai profiles are unavailable (route=%s)", r.task)
+	}
+	return lastErr
+}
+
+func createChatCompletionWithPolicy(ctx context.Context, r *route, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	var resp openai.ChatCompletionResponse
+	err := withFailover(ctx, r, func(t *routeTarget) error {
+		startedAt := time.Now()
+		var err error
+		resp, err = completeOnTarget(ctx, r, t, request)
+		var output *openai.ChatCompletionMessage
+		if len(resp.Choices) > 0 {
+			output = &resp.Choices[0].Message
+		}
+		recordAudit(ctx, r, t, request, output, startedAt, err)
+		return err
+	})
+	return resp, err
+}
 
+// completeOnTarget 在单个配置上按其重试策略请求。
+func completeOnTarget(ctx context.Context, r *route, t *routeTarget, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	timeout, attempts := t.retryPolicy()
+	t.apply(&request)
+	startedAt := time.Now()
+
+	var lastErr error
 	for attempt := 1; attempt <= attempts; attempt++ {
-		limiter := getAILimiter()
-		if limiter != nil {
-			waitCtx, cancelWait := context.WithTimeout(context.Background(), timeout)
-			err := limiter.Wait(waitCtx)
-			cancelWait()
-			if err != nil {
-				return openai.ChatCompletionResponse{}, fmt.Errorf("wait rate limiter failed: %w", err)
-			}
+		if err := t.waitLimiter(ctx, timeout); err != nil {
+			recordAICall(r, t, "rate_limited", startedAt)
+			return openai.ChatCompletionResponse{}, err
 		}
 
-		attemptCtx, cancelAttempt := context.WithTimeout(context.Background(), timeout)
-		client := getClient()
-		if client == nil {
-			cancelAttempt()
-			return openai.ChatCompletionResponse{}, fmt.Errorf("ai client is not initialized")
-		}
-		resp, lastErr = client.CreateChatCompletion(attemptCtx, request)
+		attemptCtx, cancelAttempt := context.WithTimeout(ctx, timeout)
+		resp, err := t.client.CreateChatCompletion(attemptCtx, request)
 		cancelAttempt()
 
-		if lastErr == nil {
+		if err == nil {
+			recordAICall(r, t, "ok", startedAt)
+			var reply openai.ChatCompletionMessage
+			if len(resp.Choices) > 0 {
+				reply = resp.Choices[0].Message
+			}
+			recordUsage(ctx, r, t, request, &resp.Usage, reply)
 			return resp, nil
 		}
+		lastErr = err
+		if ctx.Err() != nil {
+			recordAICall(r, t, "canceled", startedAt)
+			return openai.ChatCompletionResponse{}, ctx.Err()
+		}
 
-		if attempt >= attempts || !isRetryableAIError(lastErr) {
+		if attempt >= attempts || !isRetryableAIError(err) {
 			break
 		}
 
 		delay := backoffDelay(attempt)
-		utils.Warn("AI request failed, retrying (%d/%d) after %v: %v", attempt, attempts, delay, lastErr)
-		time.Sleep(delay)
+		recordAIRetry(r, t)
+		utils.Warn("AI request failed, retrying (route=%s profile=%s %d/%d) after %v: %v", r.task, t.profile, attempt, attempts, delay, err)
+		select {
+		case <-ctx.Done():
+			recordAICall(r, t, "canceled", startedAt)
+			return openai.ChatCompletionResponse{}, ctx.Err()
+		case <-clock.After(delay):
+		}
 	}
 
+	recordAICall(r, t, "error", startedAt)
 	return openai.ChatCompletionResponse{}, fmt.Errorf("chat completion failed after %d attempts: %w", attempts, lastErr)
 }
 
-func Queryai(prompt string, msg string) (string, error) {
+func recordAICall(r *route, t *routeTarget, result string, startedAt time.Time) {
+	metrics.IncCounter(
+		"bot_ai_calls_total",
+		"Total chat completion calls by route, profile and result.",
+		r.labels(t, map[string]string{"result": result}),
+	)
+	metrics.ObserveDuration(
+		"bot_ai_call_duration",
+		"Chat completion call duration by route, including retries.",
+		time.Since(startedAt),
+		r.labels(t, nil),
+	)
+}
+
+func recordAIRetry(r *route, t *routeTarget) {
+	metrics.IncCounter(
+		"bot_ai_retries_total",
+		"Total chat completion retries by route.",
+		r.labels(t, nil),
+	)
+}
+
+// Queryai 按任务路由发起单轮请求。ctx 取消时会中断限流等待、请求本身以及重试退避。
+func Queryai(ctx context.Context, task string, prompt string, msg string) (string, error) {
+	r := getRoute(task)
 	resp, err := createChatCompletionWithPolicy(
-		openai.ChatCompletionRequest{
-			Model: config.GetConfig().AiModel,
-			Messages: []openai.ChatCompletionMessage{
-				{Role: "system", Content: prompt},
-				{Role: "user", Content: msg},
-			},
-			Stream:      false,
-			MaxTokens:   config.GetConfig().AiMaxTokens,
-			Temperature: config.GetConfig().AiTemperature,
-			TopP:        config.GetConfig().AiTopP,
-		},
+		ctx,
+		r,
+		r.newRequest([]openai.ChatCompletionMessage{
+			{Role: "system", Content: prompt},
+			{Role: "user", Content: msg},
+		}),
 	)
 	if err != nil {
-		return "", fmt.Errorf("error in Queryai : ChatCompletion error: %v", err)
+		return "", fmt.Errorf("error in Queryai : ChatCompletion error: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
@@ -238,20 +376,13 @@ func Queryai(prompt string, msg string) (string, error) {
 	return content, nil
 }
 
-func QueryaiWithChain(conversation []openai.ChatCompletionMessage) (newConversation []openai.ChatCompletionMessage, result []string, err error) {
-	resp, err := createChatCompletionWithPolicy(
-		openai.ChatCompletionRequest{
-			Model:       config.GetConfig().AiModel,
-			Messages:    conversation,
-			Stream:      false,
-			MaxTokens:   config.GetConfig().AiMaxTokens,
-			Temperature: config.GetConfig().AiTemperature,
-			TopP:        config.GetConfig().AiTopP,
-			N:           1,
-		},
-	)
+func QueryaiWithChain(ctx context.Context, task string, conversation []openai.ChatCompletionMessage) (newConversation []openai.ChatCompletionMessage, result []string, err error) {
+	r := getRoute(task)
+	request := r.newRequest(conversation)
+	request.N = 1
+	resp, err := createChatCompletionWithPolicy(ctx, r, request)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error in QueryaiWithChain : ChatCompletion error: %v", err)
+		return nil, nil, fmt.Errorf("error in QueryaiWithChain : ChatCompletion error: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
@@ -0,0 +1,68 @@
+package aifunction
+
+import (
+	"context"
+	"time"
+
+	"project-yume/internal/audit"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// recordAudit 记录在某个配置上的一次调用（含重试），参数按该配置实际发出的值记录。
+func recordAudit(ctx context.Context, r *route, t *routeTarget, request openai.ChatCompletionRequest, output *openai.ChatCompletionMessage, startedAt time.Time, err error) {
+	t.apply(&request)
+	record := audit.NewRecord(ctx, audit.KindCall, r.task)
+	record.Profile = t.profile
+	record.Model = request.Model
+	record.LatencyMs = time.Since(startedAt).Milliseconds()
+	record.Params = &audit.Params{
+		Temperature: request.Temperature,
+		TopP:        request.TopP,
+		MaxTokens:   request.MaxTokens,
+		Stream:      request.Stream,
+	}
+	if request.ResponseFormat != nil && request.ResponseFormat.JSONSchema != nil {
+		record.Params.JSONSchema = request.ResponseFormat.JSONSchema.Name
+	}
+	for _, tool := range request.Tools {
+		if tool.Function != nil {
+			record.Params.Tools = append(record.Params.Tools, tool.Function.Name)
+		}
+	}
+	record.Messages = make([]audit.Message, 0, len(request.Messages))
+	for _, message := range request.Messages {
+		record.Messages = append(record.Messages, auditMessage(message))
+	}
+	if output != nil && (output.Content != "" || len(output.ToolCalls) > 0) {
+		message := auditMessage(*output)
+		record.Output = &message
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	audit.GetManager().Write(record)
+}
+
+func auditMessage(message openai.ChatCompletionMessage) audit.Message {
+	result := audit.Message{
+		Role:       message.Role,
+		Content:    messageText(message),
+		Name:       message.Name,
+		ToolCallID: message.ToolCallID,
+	}
+	for _, part := range message.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeImageURL {
+			// 图片可能是很大的 data URL，只记占位。
+			result.Content += "\n[image]"
+		}
+	}
+	for _, call := range message.ToolCalls {
+		result.ToolCalls = append(result.ToolCalls, audit.ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	return result
+}
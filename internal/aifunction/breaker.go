@@ -0,0 +1,187 @@
+package aifunction
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"project-yume/internal/config"
+	"project-yume/internal/metrics"
+	"project-yume/internal/utils"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+
+	defaultBreakerFailures = 3
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// ProfileHealth 某个 AI 配置的熔断状态，供后台与 /readyz 展示。
+type ProfileHealth struct {
+	Profile             string     `json:"profile"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+}
+
+// circuitBreaker 按配置统计连续失败：达到阈值后熔断，冷却结束后只放行一个探测请求，
+// 探测成功恢复，失败则重新熔断。熔断状态按配置共享，与任务路由无关。
+type circuitBreaker struct {
+	mu        sync.Mutex
+	profile   string
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastError string
+}
+
+var (
+	breakers   = map[string]*circuitBreaker{}
+	breakersMu sync.Mutex
+)
+
+func getBreaker(profile string) *circuitBreaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[profile]
+	if !ok {
+		b = &circuitBreaker{profile: profile, state: BreakerClosed}
+		breakers[profile] = b
+	}
+	return b
+}
+
+func breakerSettings() (int, time.Duration) {
+	cfg := config.GetConfig()
+	failures := cfg.AiBreakerFailures
+	if failures <= 0 {
+		failures = defaultBreakerFailures
+	}
+	cooldown := time.Duration(cfg.AiBreakerCooldownSec) * time.Second
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	return failures, cooldown
+}
+
+// Allow 判断当前是否可以向该配置发请求。
+func (b *circuitBreaker) Allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		_, cooldown := breakerSettings()
+		if now.Sub(b.openedAt) < cooldown {
+			return false
+		}
+		b.transition(BreakerHalfOpen)
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+	b.lastError = ""
+	if b.state != BreakerClosed {
+		b.transition(BreakerClosed)
+	}
+}
+
+func (b *circuitBreaker) Failure(now time.Time, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if err != nil {
+		b.lastError = err.Error()
+	}
+
+	threshold, _ := breakerSettings()
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= threshold) {
+		b.openedAt = now
+		b.transition(BreakerOpen)
+	}
+}
+
+// Release 请求因调用方取消等与服务端无关的原因结束时，归还探测名额。
+func (b *circuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) transition(state string) {
+	utils.Infow("ai breaker state changed",
+		utils.String("profile", b.profile),
+		utils.String("from", b.state),
+		utils.String("to", state),
+	)
+	b.state = state
+	metrics.IncCounter(
+		"bot_ai_breaker_transitions_total",
+		"Total AI profile circuit breaker transitions by target state.",
+		map[string]string{"profile": b.profile, "state": state},
+	)
+}
+
+func (b *circuitBreaker) snapshot() ProfileHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	health := ProfileHealth{
+		Profile:             b.profile,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		health.OpenedAt = &openedAt
+	}
+	return health
+}
+
+// ProfilesHealth 返回已发过请求的各配置的熔断状态，按名称排序。
+func ProfilesHealth() []ProfileHealth {
+	breakersMu.Lock()
+	list := make([]*circuitBreaker, 0, len(breakers))
+	for _, b := range breakers {
+		list = append(list, b)
+	}
+	breakersMu.Unlock()
+
+	result := make([]ProfileHealth, 0, len(list))
+	for _, b := range list {
+		result = append(result, b.snapshot())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Profile < result[j].Profile })
+	return result
+}
+
+// ProfileState 返回某个配置的熔断状态，没发过请求的配置视为 closed。
+func ProfileState(profile string) string {
+	breakersMu.Lock()
+	b, ok := breakers[profile]
+	breakersMu.Unlock()
+	if !ok {
+		return BreakerClosed
+	}
+	return b.snapshot().State
+}
@@ -0,0 +1,130 @@
+package aifunction
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"project-yume/internal/audit"
+	"project-yume/internal/config"
+	"project-yume/internal/mockllm"
+)
+
+func newTestTarget(name string, url string) *routeTarget {
+	profile := config.AIProfile{AIBaseURL: url, AIKey: "test", AIModel: name, AITimeout: 5, AIRetryCount: 0}
+	return &routeTarget{
+		profile: name,
+		cfg:     profile,
+		client:  newProvider(profile),
+		breaker: &circuitBreaker{profile: name, state: BreakerClosed},
+	}
+}
+
+func TestFailoverOpensBreakerAndSkipsPrimary(t *testing.T) {
+	cfg := config.GetConfig()
+	dataDir := cfg.DataDir
+	cfg.DataDir = t.TempDir()
+	t.Cleanup(func() { cfg.DataDir = dataDir })
+
+	var primaryHits atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits.Add(1)
+		http.Error(w, `{"error":{"message":"upstream unavailable"}}`, http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"backup"}}]}`)
+	}))
+	defer backup.Close()
+
+	r := &route{task: config.AITaskReply, targets: []*routeTarget{
+		newTestTarget("primary", primary.URL),
+		newTestTarget("backup", backup.URL),
+	}}
+	threshold, _ := breakerSettings()
+	for i := 0; i < threshold+2; i++ {
+		resp, err := createChatCompletionWithPolicy(context.Background(), r, r.newRequest(nil))
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		if got := resp.Choices[0].Message.Content; got != "backup" {
+			t.Fatalf("request %d: unexpected content %q", i, got)
+		}
+	}
+
+	if hits := int(primaryHits.Load()); hits != threshold {
+		t.Fatalf("primary should be skipped once open, hits=%d threshold=%d", hits, threshold)
+	}
+	if state := r.targets[0].breaker.snapshot().State; state != BreakerOpen {
+		t.Fatalf("expected primary breaker open, got %s", state)
+	}
+
+	records, err := audit.GetManager().Search(audit.Query{Task: config.AITaskReply, Limit: 100})
+	if err != nil || len(records) != threshold+threshold+2 {
+		t.Fatalf("expected one audit record per target call, got %d (%v)", len(records), err)
+	}
+	if latest := records[0]; latest.Profile != "backup" || latest.Output == nil || latest.Output.Content != "backup" {
+		t.Fatalf("unexpected latest audit record: %+v", latest)
+	}
+}
+
+func TestRetryRecoversFromMockRateLimit(t *testing.T) {
+	cfg := config.GetConfig()
+	dataDir := cfg.DataDir
+	cfg.DataDir = t.TempDir()
+	t.Cleanup(func() { cfg.DataDir = dataDir })
+
+	mock := mockllm.NewServer(mockllm.Options{})
+	server := httptest.NewServer(mock.Handler())
+	defer server.Close()
+	if err := mock.QueueFault(mockllm.Fault429, 1); err != nil {
+		t.Fatalf("queue fault: %v", err)
+	}
+
+	target := newTestTarget("mock", server.URL+"/v1")
+	target.cfg.AIRetryCount = 1
+	r := &route{task: config.AITaskReply, targets: []*routeTarget{target}}
+	resp, err := createChatCompletionWithPolicy(context.Background(), r, r.newRequest(nil))
+	if err != nil {
+		t.Fatalf("retry should recover from 429: %v", err)
+	}
+	if len(resp.Choices) == 0 || resp.Choices[0].Message.Content == "" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if requests := mock.Requests(); len(requests) != 2 || requests[0].Fault != mockllm.Fault429 {
+		t.Fatalf("expected one failed attempt and one retry, got %+v", requests)
+	}
+	if state := target.breaker.snapshot().State; state != BreakerClosed {
+		t.Fatalf("recovered call should keep breaker closed, got %s", state)
+	}
+}
+
+func TestBreakerHalfOpenAllowsSingleProbe(t *testing.T) {
+	_, cooldown := breakerSettings()
+	b := &circuitBreaker{profile: "p", state: BreakerClosed}
+	now := time.Now()
+	threshold, _ := breakerSettings()
+	for i := 0; i < threshold; i++ {
+		b.Failure(now, fmt.Errorf("boom"))
+	}
+	if b.Allow(now) {
+		t.Fatalf("open breaker should reject before cooldown")
+	}
+
+	later := now.Add(cooldown)
+	if !b.Allow(later) {
+		t.Fatalf("breaker should allow a probe after cooldown")
+	}
+	if b.Allow(later) {
+		t.Fatalf("only one probe should be in flight")
+	}
+	b.Success()
+	if !b.Allow(later) || b.snapshot().State != BreakerClosed {
+		t.Fatalf("successful probe should close the breaker")
+	}
+}
@@ -2,33 +2,140 @@ package aifunction
 
 import (
 	"sync"
+	"sync/atomic"
 
+	"project-yume/internal/clock"
 	"project-yume/internal/config"
+	"project-yume/internal/metrics"
+	"project-yume/internal/usage"
 
 	openai "github.com/sashabaranov/go-openai"
 )
 
+// route 是某个任务的模型调用链：主配置在前，备用配置在后。
+// 不同任务即使指向同一个配置，也各自限流、各自记录指标；熔断状态则按配置共享。
+type route struct {
+	task    string
+	targets []*routeTarget
+
+	// streamUnsupported/toolsUnsupported/schemaUnsupported 记录该路由的服务端是否已确认不支持流式/工具调用/response_format。
+	streamUnsupported atomic.Bool
+	toolsUnsupported  atomic.Bool
+	schemaUnsupported atomic.Bool
+}
+
+// routeTarget 调用链上的一个配置及其客户端。
+type routeTarget struct {
+	profile string
+	cfg     config.AIProfile
+	client  Provider
+	// limiter 配置重载时整体替换，请求读取时不持有 routesMu。
+	limiter atomic.Pointer[tokenBucketLimiter]
+	breaker *circuitBreaker
+}
+
 var (
-	client   *openai.Client
-	clientMu sync.RWMutex
+	routes   = map[string]*route{}
+	routesMu sync.Mutex
 )
 
-func init() {
-	ReloadClient()
+// ReloadClient 丢弃所有路由并重置熔断状态，下次请求时按最新配置重建客户端。
+func ReloadClient() {
+	breakersMu.Lock()
+	breakers = map[string]*circuitBreaker{}
+	breakersMu.Unlock()
+
+	routesMu.Lock()
+	defer routesMu.Unlock()
+	for task, r := range routes {
+		for _, target := range r.targets {
+			target.limiter.Swap(nil).Stop()
+		}
+		delete(routes, task)
+	}
 }
 
-func ReloadClient() {
-	cfg := config.GetConfig()
-	openAIConfig := openai.DefaultConfig(cfg.AiKEY)
-	openAIConfig.BaseURL = cfg.AiBaseUrl
+// ResetRateLimiter 按最新配置重建各路由的限流器。正在等待旧限流器的请求会改到新的上面等。
+func ResetRateLimiter() {
+	routesMu.Lock()
+	defer routesMu.Unlock()
+	for _, r := range routes {
+		for _, target := range r.targets {
+			target.limiter.Swap(newTokenBucketLimiter(rateLimitFor(target.cfg))).Stop()
+		}
+	}
+}
+
+// getRoute 返回任务对应的路由，未知任务按 reply 处理。
+// 预算超出且降级方式为 cheap_profile 时，改用只含降级配置的路由。
+func getRoute(task string) *route {
+	if !config.IsAITask(task) {
+		task = config.AITaskReply
+	}
+
+	key := task
+	status := usage.GetManager().Budget(clock.Now())
+	degraded := status.Exceeded && status.Policy == usage.PolicyCheapProfile
+	if degraded {
+		key = task + budgetRouteSuffix
+		metrics.IncCounter(
+			"bot_ai_budget_degraded_total",
+			"Total AI calls degraded because the budget was exceeded.",
+			map[string]string{"route": task, "policy": usage.PolicyCheapProfile},
+		)
+	}
+
+	routesMu.Lock()
+	defer routesMu.Unlock()
+	if r, ok := routes[key]; ok {
+		return r
+	}
+
+	chain := config.GetAIRouteChain(task)
+	if degraded {
+		profile, _ := config.GetAIProfile(status.Profile)
+		chain = []config.AIRouteTarget{{Name: status.Profile, Profile: profile}}
+	}
+	r := &route{task: task}
+	for _, entry := range chain {
+		target := &routeTarget{
+			profile: entry.Name,
+			cfg:     entry.Profile,
+			client:  routeProvider(entry.Name, entry.Profile),
+			breaker: getBreaker(entry.Name),
+		}
+		target.limiter.Store(newTokenBucketLimiter(rateLimitFor(entry.Profile)))
+		r.targets = append(r.targets, target)
+	}
+	routes[key] = r
+	return r
+}
+
+func rateLimitFor(profile config.AIProfile) int {
+	if profile.AIRateLimit <= 0 {
+		return defaultRateLimitRPM
+	}
+	return profile.AIRateLimit
+}
+
+// newRequest 按主配置填好模型与采样参数，切换到备用配置时由 apply 覆盖。
+func (r *route) newRequest(messages []openai.ChatCompletionMessage) openai.ChatCompletionRequest {
+	request := openai.ChatCompletionRequest{Messages: messages}
+	r.targets[0].apply(&request)
+	return request
+}
 
-	clientMu.Lock()
-	client = openai.NewClientWithConfig(openAIConfig)
-	clientMu.Unlock()
+func (t *routeTarget) apply(request *openai.ChatCompletionRequest) {
+	request.Model = t.cfg.AIModel
+	request.MaxTokens = t.cfg.AIMaxTokens
+	request.Temperature = t.cfg.AITemperature
+	request.TopP = t.cfg.AITopP
 }
 
-func getClient() *openai.Client {
-	clientMu.RLock()
-	defer clientMu.RUnlock()
-	return client
+func (r *route) labels(t *routeTarget, extra map[string]string) map[string]string {
+	labels := map[string]string{"route": r.task, "profile": t.profile}
+	for key, value := range extra {
+		labels[key] = value
+	}
+	return labels
 }
@@ -0,0 +1,111 @@
+package aifunction
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"project-yume/internal/config"
+)
+
+// useAIProfiles 把配置写进临时目录并按它重新加载，测试结束后恢复。
+func useAIProfiles(t *testing.T, set config.AIProfileSet) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ai_profiles.json")
+	if err := config.SaveAIProfileSet(path, set); err != nil {
+		t.Fatalf("save ai profiles: %v", err)
+	}
+	cfg := config.GetConfig()
+	// 重新加载会按配置重建日志，关掉文件日志以免在包目录下建 logs/
+	logToFile := cfg.LogToFile
+	cfg.LogToFile = false
+	previous, hadPrevious := os.LookupEnv("AI_CONFIG_FILE")
+	os.Setenv("AI_CONFIG_FILE", path)
+	if err := config.ReloadRuntimeConfig(); err != nil {
+		t.Fatalf("reload config: %v", err)
+	}
+	ReloadClient()
+	t.Cleanup(func() {
+		if hadPrevious {
+			os.Setenv("AI_CONFIG_FILE", previous)
+		} else {
+			os.Unsetenv("AI_CONFIG_FILE")
+		}
+		config.ReloadRuntimeConfig()
+		ReloadClient()
+		cfg.LogToFile = logToFile
+	})
+}
+
+func TestGetRouteFallsBackAndKeepsLimitersPerRoute(t *testing.T) {
+	useAIProfiles(t, config.AIProfileSet{
+		Active: "main",
+		Profiles: map[string]config.AIProfile{
+			"main": {AIBaseURL: "http://127.0.0.1:1/v1", AIModel: "main-model", AITimeout: 5, AIRateLimit: 30},
+			"fast": {AIBaseURL: "http://127.0.0.1:1/v1", AIModel: "fast-model", AITimeout: 5, AIRateLimit: 5},
+		},
+		Routes: map[string]string{config.AITaskClassify: "fast"},
+	})
+
+	classify := getRoute(config.AITaskClassify)
+	if classify.task != config.AITaskClassify || classify.targets[0].profile != "fast" {
+		t.Fatalf("classify should use its routed profile, got %s/%s", classify.task, classify.targets[0].profile)
+	}
+	if got := cap(classify.targets[0].limiter.Load().tokens); got != 5 {
+		t.Fatalf("classify limiter should follow the fast profile, got %d", got)
+	}
+
+	unknown := getRoute("translate")
+	if unknown.task != config.AITaskReply || unknown != getRoute(config.AITaskReply) {
+		t.Fatalf("unknown task should fall back to the reply route, got %s", unknown.task)
+	}
+	if unknown.targets[0].profile != "main" || cap(unknown.targets[0].limiter.Load().tokens) != 30 {
+		t.Fatalf("unrouted task should use the active profile, got %s", unknown.targets[0].profile)
+	}
+
+	summary := getRoute(config.AITaskSummary)
+	if summary == unknown || summary.targets[0].profile != "main" {
+		t.Fatalf("summary should be its own route on the active profile")
+	}
+	if summary.targets[0].limiter.Load() == unknown.targets[0].limiter.Load() {
+		t.Fatalf("routes sharing a profile must not share a limiter")
+	}
+	if summary.targets[0].breaker != unknown.targets[0].breaker {
+		t.Fatalf("routes sharing a profile should share its circuit breaker")
+	}
+}
+
+func TestResetRateLimiterWakesWaiters(t *testing.T) {
+	target := &routeTarget{profile: "main", cfg: config.AIProfile{AIRateLimit: 1}}
+	target.limiter.Store(newTokenBucketLimiter(1))
+	// 用掉唯一的令牌，下一次等待要一分钟后才有新令牌
+	if err := target.waitLimiter(context.Background(), time.Second); err != nil {
+		t.Fatalf("first wait should pass: %v", err)
+	}
+
+	routesMu.Lock()
+	routes["reset_test"] = &route{task: "reset_test", targets: []*routeTarget{target}}
+	routesMu.Unlock()
+	t.Cleanup(func() {
+		routesMu.Lock()
+		delete(routes, "reset_test")
+		routesMu.Unlock()
+		target.limiter.Swap(nil).Stop()
+	})
+
+	waited := make(chan error, 1)
+	go func() { waited <- target.waitLimiter(context.Background(), 5*time.Second) }()
+	time.Sleep(20 * time.Millisecond)
+	ResetRateLimiter()
+
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Fatalf("waiter should move to the new limiter: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("waiter stayed blocked on the replaced limiter")
+	}
+}
@@ -0,0 +1,352 @@
+package aifunction
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"project-yume/internal/config"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	maxProviderImageBytes = 10 << 20
+	maxProviderErrorBytes = 64 << 10
+)
+
+// Provider 屏蔽不同服务商的协议差异。请求与响应统一用 OpenAI 的结构表示，
+// 适配器负责转换；HTTP 错误转成 *openai.APIError，重试、熔断与降级判断因此不必区分服务商。
+type Provider interface {
+	CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+	CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (ChatStream, error)
+}
+
+// ChatStream 流式响应，Recv 在结束时返回 io.EOF。
+type ChatStream interface {
+	Recv() (openai.ChatCompletionStreamResponse, error)
+	Close() error
+}
+
+// newProvider 按配置的 provider 字段选择适配器，未知或为空时按 OpenAI 兼容接口处理。
+func newProvider(profile config.AIProfile) Provider {
+	switch profile.Provider {
+	case config.AIProviderAnthropic:
+		return newAnthropicProvider(profile)
+	case config.AIProviderGemini:
+		return newGeminiProvider(profile)
+	case config.AIProviderOllama:
+		return newOllamaProvider(profile)
+	default:
+		openAIConfig := openai.DefaultConfig(profile.AIKey)
+		openAIConfig.BaseURL = profile.AIBaseURL
+		return openAIProvider{client: openai.NewClientWithConfig(openAIConfig)}
+	}
+}
+
+// ProviderHook 包装新建的客户端，录制回放时用它记录或替换模型响应。
+type ProviderHook func(profile string, cfg config.AIProfile, next Provider) Provider
+
+type providerHookHolder struct {
+	hook ProviderHook
+}
+
+var providerHook atomic.Value
+
+// SetProviderHook 设置客户端包装，传 nil 取消。已建好的路由会被丢弃，下次请求时重建。
+func SetProviderHook(hook ProviderHook) {
+	providerHook.Store(providerHookHolder{hook: hook})
+	ReloadClient()
+}
+
+// routeProvider 按配置新建客户端，设置了 ProviderHook 时再包一层。
+func routeProvider(name string, profile config.AIProfile) Provider {
+	provider := newProvider(profile)
+	if holder, _ := providerHook.Load().(providerHookHolder); holder.hook != nil {
+		provider = holder.hook(name, profile, provider)
+	}
+	return provider
+}
+
+type openAIProvider struct {
+	client *openai.Client
+}
+
+func (p openAIProvider) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return p.client.CreateChatCompletion(ctx, request)
+}
+
+func (p openAIProvider) CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (ChatStream, error) {
+	return p.client.CreateChatCompletionStream(ctx, request)
+}
+
+// postJSON 发送 JSON 请求，非 2xx 响应读出错误信息后关闭。成功时由调用方关闭响应体。
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body any) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request failed: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, apiErrorFromResponse(resp)
+	}
+	return resp, nil
+}
+
+// apiErrorFromResponse 兼容 {"error":{"message":...}} 与 {"error":"..."} 两种错误体。
+func apiErrorFromResponse(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxProviderErrorBytes))
+	apiErr := &openai.APIError{
+		HTTPStatusCode: resp.StatusCode,
+		HTTPStatus:     resp.Status,
+		Message:        strings.TrimSpace(string(body)),
+	}
+
+	var envelope struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &envelope) != nil || len(envelope.Error) == 0 {
+		return apiErr
+	}
+	var detail struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+		Status  string `json:"status"`
+	}
+	var text string
+	switch {
+	case json.Unmarshal(envelope.Error, &detail) == nil && detail.Message != "":
+		apiErr.Message = detail.Message
+		apiErr.Type = firstNonEmpty(detail.Type, detail.Status)
+	case json.Unmarshal(envelope.Error, &text) == nil && text != "":
+		apiErr.Message = text
+	}
+	return apiErr
+}
+
+func decodeJSONResponse(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response failed: %w", err)
+	}
+	return nil
+}
+
+// sseReader 按 text/event-stream 规则读事件，只关心 event 与 data 两个字段。
+type sseReader struct {
+	reader *bufio.Reader
+}
+
+func newSSEReader(body io.Reader) *sseReader {
+	return &sseReader{reader: bufio.NewReader(body)}
+}
+
+func (s *sseReader) Next() (string, []byte, error) {
+	var event string
+	var data bytes.Buffer
+	for {
+		line, err := s.reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if data.Len() > 0 || event != "" {
+				return event, data.Bytes(), nil
+			}
+			if err != nil {
+				return "", nil, err
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		}
+		if err != nil {
+			if data.Len() > 0 || event != "" {
+				return event, data.Bytes(), nil
+			}
+			return "", nil, err
+		}
+	}
+}
+
+// funcStream 把适配器的逐块解析函数包装成 ChatStream。
+type funcStream struct {
+	body io.Closer
+	next func() (openai.ChatCompletionStreamResponse, error)
+}
+
+func (s *funcStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	return s.next()
+}
+
+func (s *funcStream) Close() error {
+	return s.body.Close()
+}
+
+func streamChunk(model string, delta openai.ChatCompletionStreamChoiceDelta, finish openai.FinishReason) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{
+		Object: "chat.completion.chunk",
+		Model:  model,
+		Choices: []openai.ChatCompletionStreamChoice{{
+			Delta:        delta,
+			FinishReason: finish,
+		}},
+	}
+}
+
+func completionResponse(model string, message openai.ChatCompletionMessage, finish openai.FinishReason, usage openai.Usage) openai.ChatCompletionResponse {
+	return openai.ChatCompletionResponse{
+		Object: "chat.completion",
+		Model:  model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      message,
+			FinishReason: finish,
+		}},
+		Usage: usage,
+	}
+}
+
+// splitSystemMessages 取出所有 system 消息拼成一段，其余消息保持顺序。
+func splitSystemMessages(messages []openai.ChatCompletionMessage) (string, []openai.ChatCompletionMessage) {
+	var system []string
+	rest := make([]openai.ChatCompletionMessage, 0, len(messages))
+	for _, message := range messages {
+		if message.Role == openai.ChatMessageRoleSystem || message.Role == openai.ChatMessageRoleDeveloper {
+			if text := messageText(message); text != "" {
+				system = append(system, text)
+			}
+			continue
+		}
+		rest = append(rest, message)
+	}
+	return strings.Join(system, "\n\n"), rest
+}
+
+// messageText 返回消息的纯文本部分，多段内容按顺序拼接。
+func messageText(message openai.ChatCompletionMessage) string {
+	if len(message.MultiContent) == 0 {
+		return message.Content
+	}
+	var parts []string
+	for _, part := range message.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeText && part.Text != "" {
+			parts = append(parts, part.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// toolCallNames 建立 tool_call_id 到函数名的映射，部分协议回传工具结果时需要函数名。
+func toolCallNames(messages []openai.ChatCompletionMessage) map[string]string {
+	names := make(map[string]string)
+	for _, message := range messages {
+		for _, call := range message.ToolCalls {
+			names[call.ID] = call.Function.Name
+		}
+	}
+	return names
+}
+
+// toolArguments 把 OpenAI 的参数字符串转成 JSON 对象，解析失败时按空对象处理。
+func toolArguments(arguments string) json.RawMessage {
+	raw := json.RawMessage(strings.TrimSpace(arguments))
+	var object map[string]any
+	if len(raw) == 0 || json.Unmarshal(raw, &object) != nil || object == nil {
+		return json.RawMessage(`{}`)
+	}
+	return raw
+}
+
+// toolParameters 返回工具参数的 JSON schema，未声明参数时给一个空对象 schema。
+func toolParameters(definition *openai.FunctionDefinition) json.RawMessage {
+	if definition.Parameters != nil {
+		if raw, err := json.Marshal(definition.Parameters); err == nil && string(raw) != "null" {
+			return raw
+		}
+	}
+	return json.RawMessage(`{"type":"object","properties":{}}`)
+}
+
+// toolsDisabled 判断请求是否显式关闭了工具调用。
+func toolsDisabled(request openai.ChatCompletionRequest) bool {
+	choice, ok := request.ToolChoice.(string)
+	return ok && choice == "none"
+}
+
+var providerCallSeq atomic.Int64
+
+// newToolCallID 给不返回调用 ID 的协议生成一个，用于对应后续的工具结果。
+func newToolCallID() string {
+	return fmt.Sprintf("call_%d", providerCallSeq.Add(1))
+}
+
+// loadImage 返回图片的 MIME 类型与 base64 数据：data URL 直接拆出，http(s) 地址下载后编码。
+func loadImage(ctx context.Context, client *http.Client, url string) (string, string, error) {
+	if strings.HasPrefix(url, "data:") {
+		header, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			return "", "", fmt.Errorf("unsupported data url")
+		}
+		return strings.TrimSuffix(header, ";base64"), data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("download image failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("download image failed: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxProviderImageBytes+1))
+	if err != nil {
+		return "", "", fmt.Errorf("read image failed: %w", err)
+	}
+	if len(data) > maxProviderImageBytes {
+		return "", "", fmt.Errorf("image exceeds %d bytes", maxProviderImageBytes)
+	}
+	mediaType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	if !strings.HasPrefix(mediaType, "image/") {
+		mediaType = http.DetectContentType(data)
+	}
+	return mediaType, base64.StdEncoding.EncodeToString(data), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
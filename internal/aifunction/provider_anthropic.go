@@ -0,0 +1,343 @@
+package aifunction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"project-yume/internal/config"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultAnthropicBaseURL = "https://api.anthropic.com"
+	anthropicAPIVersion     = "2023-06-01"
+)
+
+// anthropicProvider 对接 Anthropic Messages API。
+type anthropicProvider struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newAnthropicProvider(profile config.AIProfile) *anthropicProvider {
+	baseURL := strings.TrimRight(firstNonEmpty(profile.AIBaseURL, defaultAnthropicBaseURL), "/")
+	return &anthropicProvider{
+		baseURL:    strings.TrimSuffix(baseURL, "/v1"),
+		apiKey:     profile.AIKey,
+		httpClient: &http.Client{},
+	}
+}
+
+type anthropicRequest struct {
+	Model       string               `json:"model"`
+	System      string               `json:"system,omitempty"`
+	Messages    []anthropicMessage   `json:"messages"`
+	MaxTokens   int                  `json:"max_tokens"`
+	Temperature *float32             `json:"temperature,omitempty"`
+	Tools       []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Stream      bool                 `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type      string                `json:"type"`
+	Text      string                `json:"text,omitempty"`
+	Source    *anthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+func (p *anthropicProvider) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	body, err := p.buildRequest(ctx, request, false)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	resp, err := postJSON(ctx, p.httpClient, p.baseURL+"/v1/messages", p.headers(), body)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	var result anthropicResponse
+	if err := decodeJSONResponse(resp, &result); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	var text strings.Builder
+	for _, block := range result.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+				ID:   block.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      block.Name,
+					Arguments: string(toolArguments(string(block.Input))),
+				},
+			})
+		}
+	}
+	message.Content = text.String()
+
+	response := completionResponse(result.Model, message, anthropicFinishReason(result.StopReason), openai.Usage{
+		PromptTokens:     result.Usage.InputTokens,
+		CompletionTokens: result.Usage.OutputTokens,
+		TotalTokens:      result.Usage.InputTokens + result.Usage.OutputTokens,
+	})
+	response.ID = result.ID
+	return response, nil
+}
+
+func (p *anthropicProvider) CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (ChatStream, error) {
+	body, err := p.buildRequest(ctx, request, true)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := postJSON(ctx, p.httpClient, p.baseURL+"/v1/messages", p.headers(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := newSSEReader(resp.Body)
+	model := request.Model
+	toolIndex := map[int]int{}
+	var usage anthropicUsage
+	next := func() (openai.ChatCompletionStreamResponse, error) {
+		for {
+			_, data, err := reader.Next()
+			if err != nil {
+				if err == io.EOF {
+					return openai.ChatCompletionStreamResponse{}, io.ErrUnexpectedEOF
+				}
+				return openai.ChatCompletionStreamResponse{}, err
+			}
+			var event struct {
+				Type    string `json:"type"`
+				Index   int    `json:"index"`
+				Message struct {
+					Model string         `json:"model"`
+					Usage anthropicUsage `json:"usage"`
+				} `json:"message"`
+				ContentBlock anthropicBlock `json:"content_block"`
+				Delta        struct {
+					Type        string `json:"type"`
+					Text        string `json:"text"`
+					PartialJSON string `json:"partial_json"`
+					StopReason  string `json:"stop_reason"`
+				} `json:"delta"`
+				Usage anthropicUsage `json:"usage"`
+				Error struct {
+					Type    string `json:"type"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(data, &event); err != nil {
+				return openai.ChatCompletionStreamResponse{}, fmt.Errorf("decode stream event failed: %w", err)
+			}
+
+			switch event.Type {
+			case "message_start":
+				model = firstNonEmpty(event.Message.Model, model)
+				usage.InputTokens = event.Message.Usage.InputTokens
+			case "content_block_start":
+				if event.ContentBlock.Type != "tool_use" {
+					continue
+				}
+				index := len(toolIndex)
+				toolIndex[event.Index] = index
+				return streamChunk(model, openai.ChatCompletionStreamChoiceDelta{
+					ToolCalls: []openai.ToolCall{{
+						Index:    &index,
+						ID:       event.ContentBlock.ID,
+						Type:     openai.ToolTypeFunction,
+						Function: openai.FunctionCall{Name: event.ContentBlock.Name},
+					}},
+				}, ""), nil
+			case "content_block_delta":
+				switch event.Delta.Type {
+				case "text_delta":
+					if event.Delta.Text == "" {
+						continue
+					}
+					return streamChunk(model, openai.ChatCompletionStreamChoiceDelta{Content: event.Delta.Text}, ""), nil
+				case "input_json_delta":
+					index, ok := toolIndex[event.Index]
+					if !ok || event.Delta.PartialJSON == "" {
+						continue
+					}
+					return streamChunk(model, openai.ChatCompletionStreamChoiceDelta{
+						ToolCalls: []openai.ToolCall{{
+							Index:    &index,
+							Function: openai.FunctionCall{Arguments: event.Delta.PartialJSON},
+						}},
+					}, ""), nil
+				}
+			case "message_delta":
+				usage.OutputTokens = event.Usage.OutputTokens
+				chunk := streamChunk(model, openai.ChatCompletionStreamChoiceDelta{}, anthropicFinishReason(event.Delta.StopReason))
+				chunk.Usage = &openai.Usage{
+					PromptTokens:     usage.InputTokens,
+					CompletionTokens: usage.OutputTokens,
+					TotalTokens:      usage.InputTokens + usage.OutputTokens,
+				}
+				return chunk, nil
+			case "message_stop":
+				return openai.ChatCompletionStreamResponse{}, io.EOF
+			case "error":
+				return openai.ChatCompletionStreamResponse{}, &openai.APIError{Type: event.Error.Type, Message: event.Error.Message}
+			}
+		}
+	}
+	return &funcStream{body: resp.Body, next: next}, nil
+}
+
+func (p *anthropicProvider) headers() map[string]string {
+	return map[string]string{
+		"x-api-key":         p.apiKey,
+		"anthropic-version": anthropicAPIVersion,
+	}
+}
+
+// buildRequest 把 OpenAI 格式的对话转成 Messages API 请求：system 单独放，
+// tool 消息转成 user 角色的 tool_result，相邻同角色消息合并成一条。
+func (p *anthropicProvider) buildRequest(ctx context.Context, request openai.ChatCompletionRequest, stream bool) (anthropicRequest, error) {
+	system, messages := splitSystemMessages(request.Messages)
+	body := anthropicRequest{
+		Model:     request.Model,
+		System:    system,
+		MaxTokens: request.MaxTokens,
+		Stream:    stream,
+	}
+	if body.MaxTokens <= 0 {
+		body.MaxTokens = 2000
+	}
+	if request.Temperature > 0 {
+		// Anthropic 的 temperature 上限是 1。
+		temperature := min(request.Temperature, 1)
+		body.Temperature = &temperature
+	}
+
+	for _, message := range messages {
+		role := "user"
+		var blocks []anthropicBlock
+		switch message.Role {
+		case openai.ChatMessageRoleAssistant:
+			role = "assistant"
+			if text := messageText(message); text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+			}
+			for _, call := range message.ToolCalls {
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: toolArguments(call.Function.Arguments),
+				})
+			}
+		case openai.ChatMessageRoleTool:
+			blocks = append(blocks, anthropicBlock{Type: "tool_result", ToolUseID: message.ToolCallID, Content: message.Content})
+		default:
+			if len(message.MultiContent) == 0 && message.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: message.Content})
+			}
+			for _, part := range message.MultiContent {
+				switch {
+				case part.Type == openai.ChatMessagePartTypeText && part.Text != "":
+					blocks = append(blocks, anthropicBlock{Type: "text", Text: part.Text})
+				case part.Type == openai.ChatMessagePartTypeImageURL && part.ImageURL != nil:
+					mediaType, data, err := loadImage(ctx, p.httpClient, part.ImageURL.URL)
+					if err != nil {
+						return anthropicRequest{}, err
+					}
+					blocks = append(blocks, anthropicBlock{
+						Type:   "image",
+						Source: &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data},
+					})
+				}
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		if last := len(body.Messages) - 1; last >= 0 && body.Messages[last].Role == role {
+			body.Messages[last].Content = append(body.Messages[last].Content, blocks...)
+			continue
+		}
+		body.Messages = append(body.Messages, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	for _, tool := range request.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		body.Tools = append(body.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: toolParameters(tool.Function),
+		})
+	}
+	if len(body.Tools) > 0 {
+		body.ToolChoice = &anthropicToolChoice{Type: "auto"}
+		if toolsDisabled(request) {
+			body.ToolChoice.Type = "none"
+		}
+	}
+	return body, nil
+}
+
+func anthropicFinishReason(reason string) openai.FinishReason {
+	switch reason {
+	case "max_tokens":
+		return openai.FinishReasonLength
+	case "tool_use":
+		return openai.FinishReasonToolCalls
+	case "":
+		return ""
+	default:
+		return openai.FinishReasonStop
+	}
+}
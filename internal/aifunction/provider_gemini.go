@@ -0,0 +1,341 @@
+package aifunction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"project-yume/internal/config"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const defaultGeminiBaseURL = "https://generativelanguage.googleapis.com"
+
+// geminiProvider 对接 Gemini generateContent 接口。
+type geminiProvider struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newGeminiProvider(profile config.AIProfile) *geminiProvider {
+	baseURL := strings.TrimRight(firstNonEmpty(profile.AIBaseURL, defaultGeminiBaseURL), "/")
+	return &geminiProvider{
+		baseURL:    strings.TrimSuffix(baseURL, "/v1beta"),
+		apiKey:     profile.AIKey,
+		httpClient: &http.Client{},
+	}
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent         `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent        `json:"contents"`
+	Tools             []geminiTool           `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig      `json:"toolConfig,omitempty"`
+	GenerationConfig  geminiGenerationConfig `json:"generationConfig"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	InlineData       *geminiInlineData       `json:"inlineData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name                 string          `json:"name"`
+	Description          string          `json:"description,omitempty"`
+	ParametersJSONSchema json.RawMessage `json:"parametersJsonSchema,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode string `json:"mode"`
+	} `json:"functionCallingConfig"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature      *float32 `json:"temperature,omitempty"`
+	TopP             *float32 `json:"topP,omitempty"`
+	MaxOutputTokens  int      `json:"maxOutputTokens,omitempty"`
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+}
+
+func (p *geminiProvider) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	body, err := p.buildRequest(ctx, request)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	resp, err := postJSON(ctx, p.httpClient, p.endpoint(request.Model, "generateContent"), p.headers(), body)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	var result geminiResponse
+	if err := decodeJSONResponse(resp, &result); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	var finish openai.FinishReason
+	if len(result.Candidates) > 0 {
+		candidate := result.Candidates[0]
+		text, calls := geminiParts(candidate.Content.Parts)
+		message.Content = text
+		message.ToolCalls = calls
+		finish = geminiFinishReason(candidate.FinishReason, len(calls) > 0)
+	}
+	return completionResponse(firstNonEmpty(result.ModelVersion, request.Model), message, finish, geminiUsage(result)), nil
+}
+
+func (p *geminiProvider) CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (ChatStream, error) {
+	body, err := p.buildRequest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := postJSON(ctx, p.httpClient, p.endpoint(request.Model, "streamGenerateContent")+"?alt=sse", p.headers(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := newSSEReader(resp.Body)
+	toolCount := 0
+	next := func() (openai.ChatCompletionStreamResponse, error) {
+		for {
+			_, data, err := reader.Next()
+			if err != nil {
+				return openai.ChatCompletionStreamResponse{}, err
+			}
+			var result geminiResponse
+			if err := json.Unmarshal(data, &result); err != nil {
+				return openai.ChatCompletionStreamResponse{}, fmt.Errorf("decode stream event failed: %w", err)
+			}
+			if len(result.Candidates) == 0 {
+				continue
+			}
+
+			candidate := result.Candidates[0]
+			text, calls := geminiParts(candidate.Content.Parts)
+			for i := range calls {
+				index := toolCount
+				calls[i].Index = &index
+				toolCount++
+			}
+			finish := geminiFinishReason(candidate.FinishReason, toolCount > 0)
+			if text == "" && len(calls) == 0 && finish == "" {
+				continue
+			}
+			chunk := streamChunk(firstNonEmpty(result.ModelVersion, request.Model), openai.ChatCompletionStreamChoiceDelta{
+				Content:   text,
+				ToolCalls: calls,
+			}, finish)
+			if finish != "" {
+				usage := geminiUsage(result)
+				chunk.Usage = &usage
+			}
+			return chunk, nil
+		}
+	}
+	return &funcStream{body: resp.Body, next: next}, nil
+}
+
+func (p *geminiProvider) endpoint(model string, method string) string {
+	model = strings.TrimPrefix(model, "models/")
+	return fmt.Sprintf("%s/v1beta/models/%s:%s", p.baseURL, url.PathEscape(model), method)
+}
+
+func (p *geminiProvider) headers() map[string]string {
+	return map[string]string{"x-goog-api-key": p.apiKey}
+}
+
+// buildRequest 把 OpenAI 格式的对话转成 Gemini 请求：assistant 对应 model 角色，
+// 工具结果以 functionResponse 形式放回 user 角色，相邻同角色消息合并。
+func (p *geminiProvider) buildRequest(ctx context.Context, request openai.ChatCompletionRequest) (geminiRequest, error) {
+	system, messages := splitSystemMessages(request.Messages)
+	body := geminiRequest{}
+	if system != "" {
+		body.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: system}}}
+	}
+	if request.Temperature > 0 {
+		temperature := request.Temperature
+		body.GenerationConfig.Temperature = &temperature
+	}
+	if request.TopP > 0 {
+		topP := request.TopP
+		body.GenerationConfig.TopP = &topP
+	}
+	body.GenerationConfig.MaxOutputTokens = request.MaxTokens
+	if request.ResponseFormat != nil && request.ResponseFormat.Type != openai.ChatCompletionResponseFormatTypeText {
+		body.GenerationConfig.ResponseMimeType = "application/json"
+	}
+
+	names := toolCallNames(request.Messages)
+	for _, message := range messages {
+		role := "user"
+		var parts []geminiPart
+		switch message.Role {
+		case openai.ChatMessageRoleAssistant:
+			role = "model"
+			if text := messageText(message); text != "" {
+				parts = append(parts, geminiPart{Text: text})
+			}
+			for _, call := range message.ToolCalls {
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{
+					Name: call.Function.Name,
+					Args: toolArguments(call.Function.Arguments),
+				}})
+			}
+		case openai.ChatMessageRoleTool:
+			parts = append(parts, geminiPart{FunctionResponse: &geminiFunctionResponse{
+				Name:     firstNonEmpty(message.Name, names[message.ToolCallID]),
+				Response: geminiToolResponse(message.Content),
+			}})
+		default:
+			if len(message.MultiContent) == 0 && message.Content != "" {
+				parts = append(parts, geminiPart{Text: message.Content})
+			}
+			for _, part := range message.MultiContent {
+				switch {
+				case part.Type == openai.ChatMessagePartTypeText && part.Text != "":
+					parts = append(parts, geminiPart{Text: part.Text})
+				case part.Type == openai.ChatMessagePartTypeImageURL && part.ImageURL != nil:
+					mediaType, data, err := loadImage(ctx, p.httpClient, part.ImageURL.URL)
+					if err != nil {
+						return geminiRequest{}, err
+					}
+					parts = append(parts, geminiPart{InlineData: &geminiInlineData{MimeType: mediaType, Data: data}})
+				}
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		if last := len(body.Contents) - 1; last >= 0 && body.Contents[last].Role == role {
+			body.Contents[last].Parts = append(body.Contents[last].Parts, parts...)
+			continue
+		}
+		body.Contents = append(body.Contents, geminiContent{Role: role, Parts: parts})
+	}
+
+	var declarations []geminiFunctionDeclaration
+	for _, tool := range request.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		declarations = append(declarations, geminiFunctionDeclaration{
+			Name:                 tool.Function.Name,
+			Description:          tool.Function.Description,
+			ParametersJSONSchema: toolParameters(tool.Function),
+		})
+	}
+	if len(declarations) > 0 {
+		body.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+		body.ToolConfig = &geminiToolConfig{}
+		body.ToolConfig.FunctionCallingConfig.Mode = "AUTO"
+		if toolsDisabled(request) {
+			body.ToolConfig.FunctionCallingConfig.Mode = "NONE"
+		}
+	}
+	return body, nil
+}
+
+// geminiToolResponse functionResponse 要求是 JSON 对象，其他内容包成 {"result": ...}。
+func geminiToolResponse(content string) json.RawMessage {
+	var object map[string]any
+	if json.Unmarshal([]byte(content), &object) == nil && object != nil {
+		return json.RawMessage(content)
+	}
+	wrapped, _ := json.Marshal(map[string]string{"result": content})
+	return wrapped
+}
+
+// geminiParts 提取文本与函数调用，跳过思考内容。Gemini 不返回调用 ID，这里补一个。
+func geminiParts(parts []geminiPart) (string, []openai.ToolCall) {
+	var text strings.Builder
+	var calls []openai.ToolCall
+	for _, part := range parts {
+		switch {
+		case part.Thought:
+			continue
+		case part.FunctionCall != nil:
+			calls = append(calls, openai.ToolCall{
+				ID:   newToolCallID(),
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      part.FunctionCall.Name,
+					Arguments: string(toolArguments(string(part.FunctionCall.Args))),
+				},
+			})
+		default:
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String(), calls
+}
+
+func geminiFinishReason(reason string, hasToolCalls bool) openai.FinishReason {
+	switch reason {
+	case "":
+		return ""
+	case "STOP":
+		if hasToolCalls {
+			return openai.FinishReasonToolCalls
+		}
+		return openai.FinishReasonStop
+	case "MAX_TOKENS":
+		return openai.FinishReasonLength
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return openai.FinishReasonContentFilter
+	default:
+		return openai.FinishReasonStop
+	}
+}
+
+func geminiUsage(result geminiResponse) openai.Usage {
+	return openai.Usage{
+		PromptTokens:     result.UsageMetadata.PromptTokenCount,
+		CompletionTokens: result.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:      result.UsageMetadata.TotalTokenCount,
+	}
+}
@@ -0,0 +1,272 @@
+package aifunction
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"project-yume/internal/config"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const defaultOllamaBaseURL = "http://localhost:11434"
+
+// ollamaProvider 对接 Ollama 原生 /api/chat 接口。
+type ollamaProvider struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newOllamaProvider(profile config.AIProfile) *ollamaProvider {
+	baseURL := strings.TrimRight(firstNonEmpty(profile.AIBaseURL, defaultOllamaBaseURL), "/")
+	baseURL = strings.TrimSuffix(strings.TrimSuffix(baseURL, "/v1"), "/api")
+	return &ollamaProvider{
+		baseURL:    baseURL,
+		apiKey:     profile.AIKey,
+		httpClient: &http.Client{},
+	}
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Tools    []openai.Tool   `json:"tools,omitempty"`
+	Format   json.RawMessage `json:"format,omitempty"`
+	Options  ollamaOptions   `json:"options"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaOptions struct {
+	Temperature *float32 `json:"temperature,omitempty"`
+	TopP        *float32 `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+}
+
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (p *ollamaProvider) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	body, err := p.buildRequest(ctx, request, false)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	resp, err := postJSON(ctx, p.httpClient, p.baseURL+"/api/chat", p.headers(), body)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	var result ollamaResponse
+	if err := decodeJSONResponse(resp, &result); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	if result.Error != "" {
+		return openai.ChatCompletionResponse{}, &openai.APIError{Message: result.Error}
+	}
+
+	calls := ollamaToolCalls(result.Message.ToolCalls, 0)
+	for i := range calls {
+		// 非流式响应的调用会原样写回对话历史，不带流式用的 index。
+		calls[i].Index = nil
+	}
+	message := openai.ChatCompletionMessage{
+		Role:      openai.ChatMessageRoleAssistant,
+		Content:   result.Message.Content,
+		ToolCalls: calls,
+	}
+	return completionResponse(firstNonEmpty(result.Model, request.Model), message, ollamaFinishReason(result.DoneReason, len(calls) > 0), ollamaUsage(result)), nil
+}
+
+func (p *ollamaProvider) CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (ChatStream, error) {
+	body, err := p.buildRequest(ctx, request, true)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := postJSON(ctx, p.httpClient, p.baseURL+"/api/chat", p.headers(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	// 流式响应是逐行 JSON，最后一行 done=true。
+	reader := bufio.NewReader(resp.Body)
+	toolCount := 0
+	finished := false
+	next := func() (openai.ChatCompletionStreamResponse, error) {
+		for {
+			if finished {
+				return openai.ChatCompletionStreamResponse{}, io.EOF
+			}
+			line, err := reader.ReadBytes('\n')
+			if len(strings.TrimSpace(string(line))) == 0 {
+				if err == io.EOF {
+					return openai.ChatCompletionStreamResponse{}, io.ErrUnexpectedEOF
+				}
+				if err != nil {
+					return openai.ChatCompletionStreamResponse{}, err
+				}
+				continue
+			}
+			var result ollamaResponse
+			if err := json.Unmarshal(line, &result); err != nil {
+				return openai.ChatCompletionStreamResponse{}, fmt.Errorf("decode stream line failed: %w", err)
+			}
+			if result.Error != "" {
+				return openai.ChatCompletionStreamResponse{}, &openai.APIError{Message: result.Error}
+			}
+
+			calls := ollamaToolCalls(result.Message.ToolCalls, toolCount)
+			toolCount += len(calls)
+			var finish openai.FinishReason
+			if result.Done {
+				finished = true
+				finish = ollamaFinishReason(result.DoneReason, toolCount > 0)
+			}
+			if result.Message.Content == "" && len(calls) == 0 && finish == "" {
+				continue
+			}
+			chunk := streamChunk(firstNonEmpty(result.Model, request.Model), openai.ChatCompletionStreamChoiceDelta{
+				Content:   result.Message.Content,
+				ToolCalls: calls,
+			}, finish)
+			if result.Done {
+				usage := ollamaUsage(result)
+				chunk.Usage = &usage
+			}
+			return chunk, nil
+		}
+	}
+	return &funcStream{body: resp.Body, next: next}, nil
+}
+
+func (p *ollamaProvider) headers() map[string]string {
+	if p.apiKey == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + p.apiKey}
+}
+
+// buildRequest 把 OpenAI 格式的对话转成 Ollama 请求：图片以 base64 放在 images 字段，
+// 工具定义沿用 OpenAI 格式，response_format 转成 format。
+func (p *ollamaProvider) buildRequest(ctx context.Context, request openai.ChatCompletionRequest, stream bool) (ollamaRequest, error) {
+	body := ollamaRequest{
+		Model:  request.Model,
+		Stream: stream,
+	}
+	if request.Temperature > 0 {
+		temperature := request.Temperature
+		body.Options.Temperature = &temperature
+	}
+	if request.TopP > 0 {
+		topP := request.TopP
+		body.Options.TopP = &topP
+	}
+	body.Options.NumPredict = request.MaxTokens
+	if format := request.ResponseFormat; format != nil {
+		switch {
+		case format.Type == openai.ChatCompletionResponseFormatTypeJSONSchema && format.JSONSchema != nil && format.JSONSchema.Schema != nil:
+			schema, err := json.Marshal(format.JSONSchema.Schema)
+			if err != nil {
+				return ollamaRequest{}, fmt.Errorf("marshal response schema failed: %w", err)
+			}
+			body.Format = schema
+		case format.Type != openai.ChatCompletionResponseFormatTypeText:
+			body.Format = json.RawMessage(`"json"`)
+		}
+	}
+	if !toolsDisabled(request) {
+		body.Tools = request.Tools
+	}
+
+	names := toolCallNames(request.Messages)
+	for _, message := range request.Messages {
+		converted := ollamaMessage{Role: message.Role, Content: messageText(message)}
+		switch message.Role {
+		case openai.ChatMessageRoleDeveloper:
+			converted.Role = openai.ChatMessageRoleSystem
+		case openai.ChatMessageRoleAssistant:
+			for _, call := range message.ToolCalls {
+				var toolCall ollamaToolCall
+				toolCall.Function.Name = call.Function.Name
+				toolCall.Function.Arguments = toolArguments(call.Function.Arguments)
+				converted.ToolCalls = append(converted.ToolCalls, toolCall)
+			}
+		case openai.ChatMessageRoleTool:
+			converted.ToolName = firstNonEmpty(message.Name, names[message.ToolCallID])
+		}
+		for _, part := range message.MultiContent {
+			if part.Type != openai.ChatMessagePartTypeImageURL || part.ImageURL == nil {
+				continue
+			}
+			_, data, err := loadImage(ctx, p.httpClient, part.ImageURL.URL)
+			if err != nil {
+				return ollamaRequest{}, err
+			}
+			converted.Images = append(converted.Images, data)
+		}
+		body.Messages = append(body.Messages, converted)
+	}
+	return body, nil
+}
+
+// ollamaToolCalls 转成 OpenAI 的工具调用，Ollama 不返回调用 ID，这里补一个。
+func ollamaToolCalls(calls []ollamaToolCall, offset int) []openai.ToolCall {
+	var result []openai.ToolCall
+	for i, call := range calls {
+		index := offset + i
+		result = append(result, openai.ToolCall{
+			Index: &index,
+			ID:    newToolCallID(),
+			Type:  openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      call.Function.Name,
+				Arguments: string(toolArguments(string(call.Function.Arguments))),
+			},
+		})
+	}
+	return result
+}
+
+func ollamaFinishReason(reason string, hasToolCalls bool) openai.FinishReason {
+	switch {
+	case hasToolCalls:
+		return openai.FinishReasonToolCalls
+	case reason == "length":
+		return openai.FinishReasonLength
+	default:
+		return openai.FinishReasonStop
+	}
+}
+
+func ollamaUsage(result ollamaResponse) openai.Usage {
+	return openai.Usage{
+		PromptTokens:     result.PromptEvalCount,
+		CompletionTokens: result.EvalCount,
+		TotalTokens:      result.PromptEvalCount + result.EvalCount,
+	}
+}
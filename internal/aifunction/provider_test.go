@@ -0,0 +1,253 @@
+package aifunction
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"project-yume/internal/config"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const testImageURL = "data:image/png;base64,aW1n"
+
+func testConversation() openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model:       "test-model",
+		MaxTokens:   100,
+		Temperature: 0.5,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "be nice"},
+			{Role: openai.ChatMessageRoleUser, MultiContent: []openai.ChatMessagePart{
+				{Type: openai.ChatMessagePartTypeText, Text: "look"},
+				{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: testImageURL}},
+			}},
+			{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{{
+				ID: "call_1", Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: "current_time", Arguments: `{}`},
+			}}},
+			{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: `{"now":"10:00"}`},
+		},
+		Tools: []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "current_time"}}},
+	}
+}
+
+// collectStream 读完流式响应，返回拼接后的文本与按 index 合并的工具调用。
+func collectStream(t *testing.T, stream ChatStream) (string, []openai.ToolCall) {
+	t.Helper()
+	defer stream.Close()
+	var text strings.Builder
+	var calls []openai.ToolCall
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return text.String(), calls
+		}
+		if err != nil {
+			t.Fatalf("stream recv failed: %v", err)
+		}
+		for _, choice := range chunk.Choices {
+			text.WriteString(choice.Delta.Content)
+			for _, call := range choice.Delta.ToolCalls {
+				for len(calls) <= *call.Index {
+					calls = append(calls, openai.ToolCall{})
+				}
+				calls[*call.Index].ID += call.ID
+				calls[*call.Index].Function.Name += call.Function.Name
+				calls[*call.Index].Function.Arguments += call.Function.Arguments
+			}
+		}
+	}
+}
+
+func TestAnthropicProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "key" {
+			t.Fatalf("unexpected request %s key=%q", r.URL.Path, r.Header.Get("x-api-key"))
+		}
+		var body anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("decode request failed: %v", err)
+		}
+		if body.System != "be nice" || len(body.Messages) != 3 {
+			t.Fatalf("unexpected system/messages: %q %d", body.System, len(body.Messages))
+		}
+		if image := body.Messages[0].Content[1]; image.Source == nil || image.Source.MediaType != "image/png" || image.Source.Data != "aW1n" {
+			t.Fatalf("unexpected image block: %+v", image)
+		}
+		if result := body.Messages[2].Content[0]; result.Type != "tool_result" || result.ToolUseID != "call_1" {
+			t.Fatalf("unexpected tool result block: %+v", result)
+		}
+
+		if body.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, event := range []string{
+				`{"type":"message_start","message":{"model":"claude","usage":{"input_tokens":5}}}`,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"现在"}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"十点"}}`,
+				`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"current_time"}}`,
+				`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"tz\":"}}`,
+				`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"UTC\"}"}}`,
+				`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":7}}`,
+				`{"type":"message_stop"}`,
+			} {
+				fmt.Fprintf(w, "event: x\ndata: %s\n\n", event)
+			}
+			return
+		}
+		fmt.Fprint(w, `{"id":"msg_1","model":"claude","stop_reason":"tool_use","usage":{"input_tokens":5,"output_tokens":7},
+			"content":[{"type":"text","text":"现在十点"},{"type":"tool_use","id":"toolu_1","name":"current_time","input":{"tz":"UTC"}}]}`)
+	}))
+	defer server.Close()
+
+	provider := newProvider(config.AIProfile{Provider: config.AIProviderAnthropic, AIBaseURL: server.URL, AIKey: "key"})
+	resp, err := provider.CreateChatCompletion(context.Background(), testConversation())
+	if err != nil {
+		t.Fatalf("completion failed: %v", err)
+	}
+	choice := resp.Choices[0]
+	if choice.Message.Content != "现在十点" || choice.FinishReason != openai.FinishReasonToolCalls || resp.Usage.TotalTokens != 12 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if calls := choice.Message.ToolCalls; len(calls) != 1 || calls[0].ID != "toolu_1" || calls[0].Function.Arguments != `{"tz":"UTC"}` {
+		t.Fatalf("unexpected tool calls: %+v", calls)
+	}
+
+	request := testConversation()
+	request.Stream = true
+	stream, err := provider.CreateChatCompletionStream(context.Background(), request)
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	text, calls := collectStream(t, stream)
+	if text != "现在十点" || len(calls) != 1 || calls[0].Function.Arguments != `{"tz":"UTC"}` {
+		t.Fatalf("unexpected stream result: %q %+v", text, calls)
+	}
+}
+
+func TestGeminiProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-goog-api-key") != "key" {
+			t.Fatalf("missing api key header")
+		}
+		var body geminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("decode request failed: %v", err)
+		}
+		if body.SystemInstruction == nil || body.SystemInstruction.Parts[0].Text != "be nice" || len(body.Contents) != 3 {
+			t.Fatalf("unexpected request: %+v", body)
+		}
+		if image := body.Contents[0].Parts[1].InlineData; image == nil || image.MimeType != "image/png" {
+			t.Fatalf("unexpected image part: %+v", body.Contents[0].Parts[1])
+		}
+		if body.Contents[1].Role != "model" || body.Contents[2].Parts[0].FunctionResponse.Name != "current_time" {
+			t.Fatalf("unexpected tool round trip: %+v", body.Contents)
+		}
+
+		switch r.URL.Path {
+		case "/v1beta/models/test-model:generateContent":
+			fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"想一想","thought":true},{"text":"现在十点"}]},"finishReason":"STOP"}],
+				"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":7,"totalTokenCount":12}}`)
+		case "/v1beta/models/test-model:streamGenerateContent":
+			if r.URL.Query().Get("alt") != "sse" {
+				t.Fatalf("stream should request sse")
+			}
+			fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"现在\"}]}}]}\n\n")
+			fmt.Fprint(w, "data: {\"candidates\":[{\"content\":{\"parts\":[{\"functionCall\":{\"name\":\"current_time\",\"args\":{\"tz\":\"UTC\"}}}]},\"finishReason\":\"STOP\"}]}\n\n")
+		default:
+			t.Fatalf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	provider := newProvider(config.AIProfile{Provider: config.AIProviderGemini, AIBaseURL: server.URL, AIKey: "key"})
+	resp, err := provider.CreateChatCompletion(context.Background(), testConversation())
+	if err != nil {
+		t.Fatalf("completion failed: %v", err)
+	}
+	if resp.Choices[0].Message.Content != "现在十点" || resp.Usage.TotalTokens != 12 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	stream, err := provider.CreateChatCompletionStream(context.Background(), testConversation())
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	text, calls := collectStream(t, stream)
+	if text != "现在" || len(calls) != 1 || calls[0].ID == "" || calls[0].Function.Arguments != `{"tz":"UTC"}` {
+		t.Fatalf("unexpected stream result: %q %+v", text, calls)
+	}
+}
+
+func TestOllamaProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Fatalf("unexpected path %s", r.URL.Path)
+		}
+		var body ollamaRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("decode request failed: %v", err)
+		}
+		if len(body.Messages) != 4 || len(body.Messages[1].Images) != 1 || body.Messages[1].Images[0] != "aW1n" {
+			t.Fatalf("unexpected messages: %+v", body.Messages)
+		}
+		if body.Messages[3].ToolName != "current_time" || body.Options.NumPredict != 100 {
+			t.Fatalf("unexpected request: %+v", body)
+		}
+
+		if body.Stream {
+			fmt.Fprintln(w, `{"model":"llama","message":{"role":"assistant","content":"现在"},"done":false}`)
+			fmt.Fprintln(w, `{"model":"llama","message":{"role":"assistant","content":"十点"},"done":false}`)
+			fmt.Fprintln(w, `{"model":"llama","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":5,"eval_count":7}`)
+			return
+		}
+		fmt.Fprint(w, `{"model":"llama","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"current_time","arguments":{"tz":"UTC"}}}]},"done":true,"prompt_eval_count":5,"eval_count":7}`)
+	}))
+	defer server.Close()
+
+	provider := newProvider(config.AIProfile{Provider: config.AIProviderOllama, AIBaseURL: server.URL + "/v1"})
+	resp, err := provider.CreateChatCompletion(context.Background(), testConversation())
+	if err != nil {
+		t.Fatalf("completion failed: %v", err)
+	}
+	choice := resp.Choices[0]
+	if choice.FinishReason != openai.FinishReasonToolCalls || len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"tz":"UTC"}` {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	request := testConversation()
+	request.Stream = true
+	stream, err := provider.CreateChatCompletionStream(context.Background(), request)
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if text, _ := collectStream(t, stream); text != "现在十点" {
+		t.Fatalf("unexpected stream text: %q", text)
+	}
+}
+
+func TestProviderErrorsMapToAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`)
+	}))
+	defer server.Close()
+
+	provider := newProvider(config.AIProfile{Provider: config.AIProviderAnthropic, AIBaseURL: server.URL})
+	_, err := provider.CreateChatCompletion(context.Background(), testConversation())
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusTooManyRequests || apiErr.Message != "slow down" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !isRetryableAIError(err) {
+		t.Fatalf("429 from a native provider should be retryable")
+	}
+}
@@ -0,0 +1,256 @@
+package aifunction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/metrics"
+	"project-yume/internal/utils"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// StreamHandler 接收模型流式输出的增量文本。
+type StreamHandler func(delta string)
+
+func (r *route) streamingEnabled() bool {
+	return config.GetConfig().EnableAIStream && !r.streamUnsupported.Load()
+}
+
+// createChatCompletionStreamWithPolicy 以流式方式请求模型，每收到一段增量就回调 onDelta。
+// 首个增量到达前的失败按普通请求的策略重试，重试用尽后换备用配置；
+// 已经输出内容后失败则直接返回，避免重复下发。
+// 服务端明确不支持流式时回退到非流式请求，并把完整内容一次性交给 onDelta。
+func createChatCompletionStreamWithPolicy(ctx context.Context, r *route, request openai.ChatCompletionRequest, onDelta StreamHandler) (openai.ChatCompletionMessage, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !r.streamingEnabled() {
+		return completeWithoutStream(ctx, r, request, onDelta)
+	}
+
+	request.Stream = true
+	var message openai.ChatCompletionMessage
+	fallback := false
+	err := withFailover(ctx, r, func(t *routeTarget) error {
+		startedAt := time.Now()
+		var err error
+		message, fallback, err = streamOnTarget(ctx, r, t, request, onDelta)
+		if !fallback {
+			recordAudit(ctx, r, t, request, &message, startedAt, err)
+		}
+		return err
+	})
+	if fallback {
+		request.Stream = false
+		return completeWithoutStream(ctx, r, request, onDelta)
+	}
+	return message, err
+}
+
+// streamOnTarget 在单个配置上流式请求。第二个返回值表示该服务端不支持流式，应改用非流式。
+// 已输出过内容的失败包装为不可换配置的错误，避免在另一个配置上重复下发。
+func streamOnTarget(ctx context.Context, r *route, t *routeTarget, request openai.ChatCompletionRequest, onDelta StreamHandler) (openai.ChatCompletionMessage, bool, error) {
+	timeout, attempts := t.retryPolicy()
+	t.apply(&request)
+	startedAt := time.Now()
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err := t.waitLimiter(ctx, timeout); err != nil {
+			recordAICall(r, t, "rate_limited", startedAt)
+			return openai.ChatCompletionMessage{}, false, err
+		}
+
+		message, delivered, err := streamOnce(ctx, r, t, timeout, request, onDelta)
+		if err == nil {
+			recordStreamResult(r, t, "ok")
+			recordAICall(r, t, "ok", startedAt)
+			return message, false, nil
+		}
+		if ctx.Err() != nil {
+			recordAICall(r, t, "canceled", startedAt)
+			return message, false, ctx.Err()
+		}
+		if delivered {
+			recordStreamResult(r, t, "partial")
+			recordAICall(r, t, "error", startedAt)
+			t.breaker.Failure(time.Now(), err)
+			return message, false, &partialStreamError{err: err}
+		}
+		if isStreamUnsupportedError(err) {
+			r.streamUnsupported.Store(true)
+			recordStreamResult(r, t, "fallback")
+			utils.Warn("AI provider does not support streaming, fallback to non-streaming (route=%s profile=%s): %v", r.task, t.profile, err)
+			return openai.ChatCompletionMessage{}, true, nil
+		}
+
+		lastErr = err
+		if attempt >= attempts || !isRetryableAIError(err) {
+			break
+		}
+		delay := backoffDelay(attempt)
+		recordAIRetry(r, t)
+		utils.Warn("AI stream failed, retrying (route=%s profile=%s %d/%d) after %v: %v", r.task, t.profile, attempt, attempts, delay, err)
+		select {
+		case <-ctx.Done():
+			recordAICall(r, t, "canceled", startedAt)
+			return openai.ChatCompletionMessage{}, false, ctx.Err()
+		case <-clock.After(delay):
+		}
+	}
+
+	recordStreamResult(r, t, "error")
+	recordAICall(r, t, "error", startedAt)
+	return openai.ChatCompletionMessage{}, false, fmt.Errorf("chat completion stream failed after %d attempts: %w", attempts, lastErr)
+}
+
+// partialStreamError 流式输出中途失败。熔断已在出错处记录，这里不再换配置重试。
+type partialStreamError struct {
+	err error
+}
+
+func (e *partialStreamError) Error() string {
+	return "chat completion stream interrupted: " + e.err.Error()
+}
+
+func (e *partialStreamError) Unwrap() error {
+	return e.err
+}
+
+// streamOnce 执行一次流式请求，返回拼装好的助手消息以及是否已经向调用方输出过增量。
+// 工具调用的参数按 index 分片到达，这里逐片拼接。
+func streamOnce(ctx context.Context, r *route, t *routeTarget, timeout time.Duration, request openai.ChatCompletionRequest, onDelta StreamHandler) (openai.ChatCompletionMessage, bool, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	startedAt := time.Now()
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	stream, err := t.client.CreateChatCompletionStream(attemptCtx, request)
+	if err != nil {
+		return message, false, err
+	}
+	defer stream.Close()
+
+	var builder strings.Builder
+	var reported *openai.Usage
+	delivered := false
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			message.Content = builder.String()
+			return message, delivered, err
+		}
+		if chunk.Usage != nil {
+			reported = chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta
+		for _, call := range delta.ToolCalls {
+			index := len(message.ToolCalls) - 1
+			if call.Index != nil {
+				index = *call.Index
+			} else if call.ID != "" || index < 0 {
+				index++
+			}
+			for len(message.ToolCalls) <= index {
+				message.ToolCalls = append(message.ToolCalls, openai.ToolCall{Type: openai.ToolTypeFunction})
+			}
+			target := &message.ToolCalls[index]
+			if call.ID != "" {
+				target.ID = call.ID
+			}
+			target.Function.Name += call.Function.Name
+			target.Function.Arguments += call.Function.Arguments
+		}
+		if delta.Content == "" {
+			continue
+		}
+		if !delivered {
+			metrics.ObserveDuration(
+				"bot_ai_first_token_duration",
+				"Time to first streamed token.",
+				time.Since(startedAt),
+				r.labels(t, nil),
+			)
+		}
+		delivered = true
+		builder.WriteString(delta.Content)
+		if onDelta != nil {
+			onDelta(delta.Content)
+		}
+	}
+
+	message.Content = builder.String()
+	if message.Content == "" && len(message.ToolCalls) == 0 {
+		return message, false, fmt.Errorf("chat completion stream returned no content")
+	}
+	recordUsage(ctx, r, t, request, reported, message)
+	return message, delivered, nil
+}
+
+func completeWithoutStream(ctx context.Context, r *route, request openai.ChatCompletionRequest, onDelta StreamHandler) (openai.ChatCompletionMessage, error) {
+	request.Stream = false
+	resp, err := createChatCompletionWithPolicy(ctx, r, request)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return openai.ChatCompletionMessage{}, fmt.Errorf("empty choices")
+	}
+	message := resp.Choices[0].Message
+	if message.Role == "" {
+		message.Role = openai.ChatMessageRoleAssistant
+	}
+	if onDelta != nil && message.Content != "" {
+		onDelta(message.Content)
+	}
+	return message, nil
+}
+
+// isStreamUnsupportedError 判断服务端是否明确拒绝了流式请求。
+// 400 只有在错误信息提到 stream 时才算，避免把普通参数错误当成不支持流式。
+func isStreamUnsupportedError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	mentionsStream := strings.Contains(msg, "stream")
+
+	statusCode := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		statusCode = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		statusCode = reqErr.HTTPStatusCode
+		mentionsStream = mentionsStream || strings.Contains(strings.ToLower(string(reqErr.Body)), "stream")
+	}
+
+	switch statusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return mentionsStream
+	}
+	return mentionsStream && (strings.Contains(msg, "not support") || strings.Contains(msg, "unsupported"))
+}
+
+func recordStreamResult(r *route, t *routeTarget, result string) {
+	metrics.IncCounter(
+		"bot_ai_stream_total",
+		"Total streamed AI requests by route and result.",
+		r.labels(t, map[string]string{"result": result}),
+	)
+}
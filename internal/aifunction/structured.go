@@ -0,0 +1,94 @@
+package aifunction
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"project-yume/internal/config"
+	"project-yume/internal/utils"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ResponseSchema 要求模型按 JSON schema 输出。
+// 服务端不支持 response_format 时自动去掉，之后该路由不再携带，直到 ReloadClient。
+type ResponseSchema struct {
+	Name   string
+	Schema json.RawMessage
+}
+
+func (r *route) schemaEnabled(schema *ResponseSchema) bool {
+	return schema != nil && config.GetConfig().EnableAIJSONSchema && !r.schemaUnsupported.Load()
+}
+
+func (r *route) applySchema(request *openai.ChatCompletionRequest, schema *ResponseSchema) {
+	if !r.schemaEnabled(schema) {
+		return
+	}
+	request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   schema.Name,
+			Schema: schema.Schema,
+			Strict: true,
+		},
+	}
+}
+
+// QueryaiStructured 与 QueryaiWithTools 相同，额外用 schema 约束最终输出。
+// schema 为空时等同于 QueryaiWithTools。
+func QueryaiStructured(ctx context.Context, task string, prompt string, msg string, schema *ResponseSchema, executor ToolExecutor, onDelta StreamHandler) (string, []openai.ChatCompletionMessage, error) {
+	r := getRoute(task)
+	request := r.newRequest([]openai.ChatCompletionMessage{
+		{Role: "system", Content: prompt},
+		{Role: "user", Content: msg},
+	})
+	r.applySchema(&request, schema)
+
+	message, transcript, err := runChatWithTools(ctx, r, request, executor, onDelta)
+	if err != nil {
+		return "", transcript, fmt.Errorf("error in QueryaiStructured : ChatCompletion error: %w", err)
+	}
+	return utils.CleanThinkTag(message.Content), transcript, nil
+}
+
+// dropUnsupportedFeature 在服务端因 response_format 或 tools 拒绝请求时去掉对应参数。
+// 返回 true 表示请求已被降级，可以重试一次。
+func (r *route) dropUnsupportedFeature(request *openai.ChatCompletionRequest, err error) bool {
+	if request.ResponseFormat != nil && isResponseFormatUnsupportedError(err) {
+		r.schemaUnsupported.Store(true)
+		utils.Warn("AI provider does not support response_format, retry without schema (route=%s): %v", r.task, err)
+		request.ResponseFormat = nil
+		return true
+	}
+	if len(request.Tools) > 0 && isToolsUnsupportedError(err) {
+		r.toolsUnsupported.Store(true)
+		utils.Warn("AI provider does not support tool calling, retry without tools (route=%s): %v", r.task, err)
+		request.Tools = nil
+		request.ToolChoice = nil
+		return true
+	}
+	return false
+}
+
+// isResponseFormatUnsupportedError 判断服务端是否因为 response_format 参数拒绝了请求。
+func isResponseFormatUnsupportedError(err error) bool {
+	statusCode := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		statusCode = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		statusCode = reqErr.HTTPStatusCode
+	}
+	if statusCode != http.StatusBadRequest && statusCode != http.StatusUnprocessableEntity && statusCode != http.StatusNotImplemented {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "response_format") || strings.Contains(msg, "json_schema") || strings.Contains(msg, "schema")
+}
@@ -0,0 +1,155 @@
+package aifunction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"project-yume/internal/config"
+	"project-yume/internal/utils"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const defaultToolMaxRounds = 3
+
+// ToolExecutor 提供工具定义并执行模型发起的工具调用。
+// Execute 的返回值会作为 tool 消息原样交给模型，失败信息也应编码在返回值里。
+type ToolExecutor interface {
+	Definitions() []openai.Tool
+	Execute(ctx context.Context, call openai.ToolCall) string
+}
+
+func (r *route) toolsEnabled(executor ToolExecutor) bool {
+	return executor != nil && config.GetConfig().EnableAITools && !r.toolsUnsupported.Load()
+}
+
+func toolMaxRounds() int {
+	rounds := config.GetConfig().AiToolMaxRounds
+	if rounds <= 0 {
+		return defaultToolMaxRounds
+	}
+	return rounds
+}
+
+// runChatWithTools 执行有上限的工具调用循环。
+// 每轮模型若返回 tool_calls，就执行工具并把结果追加到消息里再请求一次；
+// 达到轮数上限后以 tool_choice=none 强制模型给出最终回复。
+// 返回最终助手消息，以及过程中产生的工具调用/结果消息（不含最终回复）。
+func runChatWithTools(ctx context.Context, r *route, request openai.ChatCompletionRequest, executor ToolExecutor, onDelta StreamHandler) (openai.ChatCompletionMessage, []openai.ChatCompletionMessage, error) {
+	messages := append([]openai.ChatCompletionMessage(nil), request.Messages...)
+	var transcript []openai.ChatCompletionMessage
+	maxRounds := toolMaxRounds()
+
+	for round := 0; ; round++ {
+		req := request
+		req.Messages = messages
+		useTools := r.toolsEnabled(executor)
+		if useTools {
+			req.Tools = executor.Definitions()
+			if round >= maxRounds {
+				req.ToolChoice = "none"
+			}
+		}
+
+		message, err := createChatCompletionStreamWithPolicy(ctx, r, req, onDelta)
+		// schema 与 tools 可能都不被支持，最多各降级一次。
+		for retries := 0; err != nil && round == 0 && retries < 2 && ctx.Err() == nil && r.dropUnsupportedFeature(&req, err); retries++ {
+			request.ResponseFormat = req.ResponseFormat
+			useTools = len(req.Tools) > 0
+			message, err = createChatCompletionStreamWithPolicy(ctx, r, req, onDelta)
+		}
+		if err != nil {
+			return message, transcript, err
+		}
+		if len(message.ToolCalls) == 0 || !useTools || round >= maxRounds {
+			message.ToolCalls = nil
+			return message, transcript, nil
+		}
+
+		message.Role = openai.ChatMessageRoleAssistant
+		messages = append(messages, message)
+		transcript = append(transcript, message)
+		for _, call := range message.ToolCalls {
+			if err := ctx.Err(); err != nil {
+				return openai.ChatCompletionMessage{}, transcript, err
+			}
+			result := openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Name:       call.Function.Name,
+				ToolCallID: call.ID,
+				Content:    executor.Execute(ctx, call),
+			}
+			messages = append(messages, result)
+			transcript = append(transcript, result)
+		}
+	}
+}
+
+// isToolsUnsupportedError 判断服务端是否因为 tools 参数拒绝了请求。
+func isToolsUnsupportedError(err error) bool {
+	statusCode := 0
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		statusCode = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		statusCode = reqErr.HTTPStatusCode
+	}
+	if statusCode != http.StatusBadRequest && statusCode != http.StatusUnprocessableEntity && statusCode != http.StatusNotImplemented {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "tool") || strings.Contains(msg, "function")
+}
+
+// QueryaiStream 与 Queryai 相同，但会把模型输出增量实时回调给 onDelta。
+// 返回值是完整内容（已清理思考标签）。
+func QueryaiStream(ctx context.Context, task string, prompt string, msg string, onDelta StreamHandler) (string, error) {
+	content, _, err := QueryaiWithTools(ctx, task, prompt, msg, nil, onDelta)
+	return content, err
+}
+
+// QueryaiWithTools 发起单轮请求，允许模型先调用工具再给出最终回复。
+// executor 为空或未启用工具时等同于 QueryaiStream；onDelta 可为空。
+// 第二个返回值是工具调用与结果消息，调用方应把它们记入会话历史。
+func QueryaiWithTools(ctx context.Context, task string, prompt string, msg string, executor ToolExecutor, onDelta StreamHandler) (string, []openai.ChatCompletionMessage, error) {
+	r := getRoute(task)
+	message, transcript, err := runChatWithTools(
+		ctx,
+		r,
+		r.newRequest([]openai.ChatCompletionMessage{
+			{Role: "system", Content: prompt},
+			{Role: "user", Content: msg},
+		}),
+		executor,
+		onDelta,
+	)
+	if err != nil {
+		return "", transcript, fmt.Errorf("error in QueryaiWithTools : ChatCompletion error: %w", err)
+	}
+	return utils.CleanThinkTag(message.Content), transcript, nil
+}
+
+// QueryaiWithChainStream 与 QueryaiWithChain 相同，但以流式方式输出回复，并支持工具调用。
+// 返回的新会话包含工具调用、工具结果与最终回复。
+func QueryaiWithChainStream(ctx context.Context, task string, conversation []openai.ChatCompletionMessage, executor ToolExecutor, onDelta StreamHandler) ([]openai.ChatCompletionMessage, string, error) {
+	r := getRoute(task)
+	request := r.newRequest(conversation)
+	request.N = 1
+	message, transcript, err := runChatWithTools(ctx, r, request, executor, onDelta)
+	if err != nil {
+		return nil, "", fmt.Errorf("error in QueryaiWithChainStream : ChatCompletion error: %w", err)
+	}
+
+	content := utils.CleanThinkTag(message.Content)
+	conversation = append(conversation, transcript...)
+	conversation = append(conversation, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: content,
+	})
+	return conversation, content, nil
+}
@@ -0,0 +1,86 @@
+package aifunction
+
+import (
+	"context"
+	"errors"
+	"unicode/utf8"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/metrics"
+	"project-yume/internal/usage"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ErrBudgetExceeded 预算超出且降级方式为 preset_only 时，模型调用直接返回该错误。
+var ErrBudgetExceeded = errors.New("ai budget exceeded")
+
+// budgetRouteSuffix 预算降级后改用便宜配置的路由，与正常路由分开缓存。
+const budgetRouteSuffix = "@budget"
+
+// checkBudget 预算超出且只能用预设回复时拒绝调用。
+func checkBudget(r *route) error {
+	if !usage.GetManager().Budget(clock.Now()).PresetOnly() {
+		return nil
+	}
+	metrics.IncCounter(
+		"bot_ai_budget_degraded_total",
+		"Total AI calls degraded because the budget was exceeded.",
+		map[string]string{"route": r.task, "policy": usage.PolicyPresetOnly},
+	)
+	return ErrBudgetExceeded
+}
+
+// recordUsage 记录一次成功调用的用量。服务端没有返回 usage 时按字数估算。
+func recordUsage(ctx context.Context, r *route, t *routeTarget, request openai.ChatCompletionRequest, reported *openai.Usage, reply openai.ChatCompletionMessage) {
+	record := usage.Record{
+		At:      clock.Now(),
+		Task:    r.task,
+		Profile: t.profile,
+		Model:   request.Model,
+	}
+	scope := usage.ScopeFrom(ctx)
+	record.SessionID = scope.SessionID
+	record.UserID = scope.UserID
+
+	if reported != nil && reported.PromptTokens+reported.CompletionTokens > 0 {
+		record.PromptTokens = reported.PromptTokens
+		record.CompletionTokens = reported.CompletionTokens
+	} else {
+		record.Estimated = true
+		for _, message := range request.Messages {
+			record.PromptTokens += estimateMessageTokens(message)
+		}
+		record.CompletionTokens = estimateMessageTokens(reply)
+	}
+	record.Cost = usage.Cost(t.cfg.InputPrice, t.cfg.OutputPrice, record.PromptTokens, record.CompletionTokens)
+	usage.GetManager().Add(record)
+}
+
+func estimateMessageTokens(message openai.ChatCompletionMessage) int {
+	tokens := estimateTokens(messageText(message))
+	for _, call := range message.ToolCalls {
+		tokens += estimateTokens(call.Function.Name) + estimateTokens(call.Function.Arguments)
+	}
+	for _, part := range message.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeImageURL {
+			// 图片按常见的低清晰度计费量粗算。
+			tokens += 85
+		}
+	}
+	return tokens + 4
+}
+
+// estimateTokens 粗略估算 token 数：非 ASCII 字符按一个 token，ASCII 按四个字符一个 token。
+func estimateTokens(text string) int {
+	ascii := 0
+	tokens := 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+			continue
+		}
+		tokens++
+	}
+	return tokens + (ascii+3)/4
+}
@@ -0,0 +1,419 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"project-yume/internal/config"
+	"project-yume/internal/metrics"
+	"project-yume/internal/usage"
+	"project-yume/internal/utils"
+)
+
+// 审计记录保存在 DATA_DIR/audit 下，当前文件写满后改名为带时间戳的历史文件。
+const (
+	dirName        = "audit"
+	currentFile    = "ai_calls.jsonl"
+	rotatedPrefix  = "ai_calls-"
+	rotatedSuffix  = ".jsonl"
+	rotatedLayout  = "20060102-150405.000"
+	maxLineBytes   = 16 << 20
+	defaultMaxMB   = 20
+	defaultMaxKeep = 5
+)
+
+// 记录类型：一次模型调用，或调用方对输出的解析结果。
+const (
+	KindCall  = "call"
+	KindParse = "parse"
+)
+
+// Message 发给模型或模型返回的一条消息。
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+}
+
+type ToolCall struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Params 实际发出的模型参数。
+type Params struct {
+	Temperature float32  `json:"temperature"`
+	TopP        float32  `json:"top_p"`
+	MaxTokens   int      `json:"max_tokens"`
+	Stream      bool     `json:"stream"`
+	JSONSchema  string   `json:"json_schema,omitempty"`
+	Tools       []string `json:"tools,omitempty"`
+}
+
+// Parse 调用方解析模型输出的结果。
+type Parse struct {
+	Outcome string          `json:"outcome"`
+	Error   string          `json:"error,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+}
+
+// Record 一条审计记录。同一条用户消息触发的多次调用共享 RequestID。
+type Record struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	UserID    int64     `json:"user_id,omitempty"`
+	Task      string    `json:"task"`
+	Profile   string    `json:"profile,omitempty"`
+	Model     string    `json:"model,omitempty"`
+	Params    *Params   `json:"params,omitempty"`
+	Messages  []Message `json:"messages,omitempty"`
+	Output    *Message  `json:"output,omitempty"`
+	Parse     *Parse    `json:"parse,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latency_ms"`
+}
+
+// Query 搜索条件，空字段不参与过滤。
+type Query struct {
+	RequestID string
+	SessionID string
+	UserID    int64
+	Task      string
+	Limit     int
+}
+
+func (q Query) match(record Record) bool {
+	return (q.RequestID == "" || record.RequestID == q.RequestID) &&
+		(q.SessionID == "" || record.SessionID == q.SessionID) &&
+		(q.UserID == 0 || record.UserID == q.UserID) &&
+		(q.Task == "" || record.Task == q.Task)
+}
+
+// Manager 负责追加写入和查询审计文件。
+type Manager struct {
+	mu   sync.Mutex
+	dir  string
+	file *os.File
+	size int64
+}
+
+var (
+	manager     *Manager
+	managerOnce sync.Once
+)
+
+func GetManager() *Manager {
+	managerOnce.Do(func() {
+		manager = &Manager{}
+	})
+	return manager
+}
+
+type requestIDKey struct{}
+
+// WithRequestID 把请求 ID 挂到 ctx 上，之后的模型调用都记到这个请求下。
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func RequestIDFrom(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// NewRecord 按 ctx 上的请求 ID 与会话归属预填一条记录。
+func NewRecord(ctx context.Context, kind, task string) Record {
+	scope := usage.ScopeFrom(ctx)
+	return Record{
+		ID:        utils.NewRequestID("ai"),
+		Kind:      kind,
+		Time:      time.Now(),
+		RequestID: RequestIDFrom(ctx),
+		SessionID: scope.SessionID,
+		UserID:    scope.UserID,
+		Task:      task,
+	}
+}
+
+// Write 脱敏后追加一条记录。审计失败只记日志，不影响调用方。
+func (m *Manager) Write(record Record) {
+	cfg := config.GetConfig()
+	if !cfg.EnableAIAudit {
+		return
+	}
+	redactRecord(&record, cfg.AiAuditRedact)
+	line, err := json.Marshal(record)
+	if err != nil {
+		utils.Warn("marshal ai audit record failed: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	maxBytes := int64(cfg.AiAuditMaxFileMB) << 20
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxMB << 20
+	}
+	keep := cfg.AiAuditMaxFiles
+	if keep <= 0 {
+		keep = defaultMaxKeep
+	}
+
+	m.mu.Lock()
+	err = m.appendLocked(auditDir(), line, maxBytes, keep)
+	m.mu.Unlock()
+	if err != nil {
+		utils.Warn("write ai audit record failed: %v", err)
+		metrics.IncCounter("bot_ai_audit_errors_total", "Total AI audit records that failed to write.", nil)
+		return
+	}
+	metrics.IncCounter(
+		"bot_ai_audit_records_total",
+		"Total AI audit records written by kind.",
+		map[string]string{"kind": record.Kind},
+	)
+}
+
+func (m *Manager) appendLocked(dir string, line []byte, maxBytes int64, keep int) error {
+	if m.file != nil && m.dir != dir {
+		_ = m.file.Close()
+		m.file = nil
+	}
+	if m.file == nil {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(filepath.Join(dir, currentFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+		m.dir, m.file, m.size = dir, file, info.Size()
+	}
+
+	if m.size > 0 && m.size+int64(len(line)) > maxBytes {
+		if err := m.rotateLocked(keep); err != nil {
+			return err
+		}
+	}
+	n, err := m.file.Write(line)
+	m.size += int64(n)
+	return err
+}
+
+// rotateLocked 把当前文件改名归档，只保留最近 keep 个历史文件。
+func (m *Manager) rotateLocked(keep int) error {
+	_ = m.file.Close()
+	m.file = nil
+	name := rotatedPrefix + time.Now().Format(rotatedLayout) + rotatedSuffix
+	if err := os.Rename(filepath.Join(m.dir, currentFile), filepath.Join(m.dir, name)); err != nil {
+		return err
+	}
+
+	rotated, err := rotatedFiles(m.dir)
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(rotated); i++ {
+		if err := os.Remove(rotated[i]); err != nil && !os.IsNotExist(err) {
+			utils.Warn("remove old ai audit file failed: %v", err)
+		}
+	}
+
+	file, err := os.OpenFile(filepath.Join(m.dir, currentFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	m.file, m.size = file, 0
+	return nil
+}
+
+// Search 从新到旧返回符合条件的记录。
+func (m *Manager) Search(query Query) ([]Record, error) {
+	if query.Limit <= 0 {
+		query.Limit = 50
+	}
+	var result []Record
+	err := m.scan(func(record Record) bool {
+		if query.match(record) {
+			result = append(result, record)
+		}
+		return len(result) < query.Limit
+	})
+	return result, err
+}
+
+// Get 按记录 ID 查找一条记录。
+func (m *Manager) Get(id string) (Record, bool, error) {
+	var found Record
+	ok := false
+	err := m.scan(func(record Record) bool {
+		if record.ID == id {
+			found, ok = record, true
+			return false
+		}
+		return true
+	})
+	return found, ok, err
+}
+
+// DeleteUser 从所有审计文件中删掉该用户的记录，返回删除的条数。
+// 持有写锁重写文件，期间的写入会等待。
+func (m *Manager) DeleteUser(userID int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.file != nil {
+		_ = m.file.Close()
+		m.file = nil
+	}
+	dir := auditDir()
+	rotated, err := rotatedFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, path := range append([]string{filepath.Join(dir, currentFile)}, rotated...) {
+		removed, err := removeUserLines(path, userID)
+		total += removed
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// removeUserLines 原样保留其他行，只有真的删了内容才替换文件。
+func removeUserLines(path string, userID int64) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	kept := make([]byte, 0, len(data))
+	removed := 0
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		var record struct {
+			UserID int64 `json:"user_id"`
+		}
+		if json.Unmarshal(bytes.TrimSpace(line), &record) == nil && record.UserID == userID {
+			removed++
+			continue
+		}
+		kept = append(kept, line...)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, kept, 0o644); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// scan 从最新的记录开始逐条回调，visit 返回 false 时停止。
+func (m *Manager) scan(visit func(Record) bool) error {
+	dir := auditDir()
+	rotated, err := rotatedFiles(dir)
+	if err != nil {
+		return err
+	}
+	files := append([]string{filepath.Join(dir, currentFile)}, rotated...)
+	for _, path := range files {
+		records, err := readRecords(path)
+		if err != nil {
+			return err
+		}
+		for i := len(records) - 1; i >= 0; i-- {
+			if !visit(records[i]) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func readRecords(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	for scanner.Scan() {
+		var record Record
+		// 写到一半的行直接跳过。
+		if json.Unmarshal(scanner.Bytes(), &record) == nil {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("read %s: %w", filepath.Base(path), err)
+	}
+	return records, nil
+}
+
+// rotatedFiles 返回历史文件路径，最新的在前。
+func rotatedFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, rotatedPrefix) && strings.HasSuffix(name, rotatedSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	return paths, nil
+}
+
+func auditDir() string {
+	dataDir := strings.TrimSpace(config.GetConfig().DataDir)
+	if dataDir == "" {
+		dataDir = "./data"
+	}
+	return filepath.Join(dataDir, dirName)
+}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"project-yume/internal/config"
+)
+
+func TestRedact(t *testing.T) {
+	text := "我的手机 13812345678 或 +86 13912345678，邮箱 foo.bar@example.com，身份证 11010519491231002X，卡号 6222021234567890123"
+	got := Redact(text, []string{"phone", "email", "id_card", "bank_card"})
+	want := "我的手机 [phone] 或 [phone]，邮箱 [email]，身份证 [id_card]，卡号 [bank_card]"
+	if got != want {
+		t.Fatalf("unexpected redaction:\n got %q\nwant %q", got, want)
+	}
+	if got := Redact(text, []string{"email"}); !strings.Contains(got, "13812345678") || strings.Contains(got, "example.com") {
+		t.Fatalf("only enabled rules should apply: %q", got)
+	}
+}
+
+func TestWriteRotatesAndSearches(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	t.Cleanup(func() { *cfg = previous })
+	cfg.DataDir = t.TempDir()
+	cfg.EnableAIAudit = true
+	cfg.AiAuditMaxFileMB = 1
+	cfg.AiAuditMaxFiles = 1
+	cfg.AiAuditRedact = []string{"phone"}
+
+	m := &Manager{}
+	t.Cleanup(func() {
+		if m.file != nil {
+			_ = m.file.Close()
+		}
+	})
+	padding := strings.Repeat("字", 200*1024)
+	for i := 0; i < 4; i++ {
+		record := NewRecord(WithRequestID(context.Background(), "msg-1"), KindCall, "reply")
+		record.Messages = []Message{{Role: "user", Content: "打给 13812345678 " + padding}}
+		m.Write(record)
+	}
+	m.Write(Record{ID: "ai-last", Kind: KindParse, RequestID: "msg-2", Task: "classify", Parse: &Parse{Outcome: "ok"}})
+
+	rotated, err := rotatedFiles(filepath.Join(cfg.DataDir, dirName))
+	if err != nil || len(rotated) != 1 {
+		t.Fatalf("expected one rotated file, got %v (%v)", rotated, err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.DataDir, dirName, currentFile)); err != nil {
+		t.Fatalf("current file missing: %v", err)
+	}
+
+	records, err := m.Search(Query{RequestID: "msg-1", Limit: 10})
+	if err != nil || len(records) == 0 {
+		t.Fatalf("search failed: %v %d", err, len(records))
+	}
+	if content := records[0].Messages[0].Content; strings.Contains(content, "13812345678") || !strings.HasPrefix(content, "打给 [phone]") {
+		t.Fatalf("phone should be redacted: %q", content[:40])
+	}
+
+	record, ok, err := m.Get("ai-last")
+	if err != nil || !ok || record.Parse == nil || record.Parse.Outcome != "ok" {
+		t.Fatalf("get failed: %+v %v %v", record, ok, err)
+	}
+}
@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// 脱敏规则按固定顺序执行：身份证号要先于银行卡号匹配，否则会被当成卡号。
+var redactRules = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"secret", regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_\-]{16,}|(?i:bearer)\s+[A-Za-z0-9._\-]{16,}`)},
+	{"email", regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)},
+	{"id_card", regexp.MustCompile(`\b\d{17}[\dXx]\b`)},
+	{"bank_card", regexp.MustCompile(`\b\d{16,19}\b`)},
+	{"phone", regexp.MustCompile(`(?:\+86[\- ]?|\b86[\- ]?|\b)1[3-9]\d{9}\b`)},
+}
+
+// RedactRules 返回支持的脱敏规则名。
+func RedactRules() []string {
+	names := make([]string, 0, len(redactRules))
+	for _, rule := range redactRules {
+		names = append(names, rule.name)
+	}
+	return names
+}
+
+// Redact 按启用的规则把敏感内容替换为 [规则名]。
+func Redact(text string, enabled []string) string {
+	if text == "" || len(enabled) == 0 {
+		return text
+	}
+	for _, rule := range redactRules {
+		if containsRule(enabled, rule.name) {
+			text = rule.pattern.ReplaceAllString(text, "["+rule.name+"]")
+		}
+	}
+	return text
+}
+
+func containsRule(enabled []string, name string) bool {
+	for _, item := range enabled {
+		if strings.EqualFold(strings.TrimSpace(item), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactRecord(record *Record, enabled []string) {
+	if len(enabled) == 0 {
+		return
+	}
+	for i := range record.Messages {
+		redactMessage(&record.Messages[i], enabled)
+	}
+	if record.Output != nil {
+		redactMessage(record.Output, enabled)
+	}
+	if record.Parse != nil {
+		record.Parse.Error = Redact(record.Parse.Error, enabled)
+		if len(record.Parse.Result) > 0 {
+			// 替换文本不含引号和反斜杠，不会破坏 JSON 结构；保险起见仍校验一次。
+			redacted := json.RawMessage(Redact(string(record.Parse.Result), enabled))
+			if json.Valid(redacted) {
+				record.Parse.Result = redacted
+			}
+		}
+	}
+	record.Error = Redact(record.Error, enabled)
+}
+
+func redactMessage(message *Message, enabled []string) {
+	message.Content = Redact(message.Content, enabled)
+	for i := range message.ToolCalls {
+		message.ToolCalls[i].Arguments = Redact(message.ToolCalls[i].Arguments, enabled)
+	}
+}
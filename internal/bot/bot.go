@@ -0,0 +1,418 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/connect"
+	"project-yume/internal/handler"
+	"project-yume/internal/inbound"
+	"project-yume/internal/metrics"
+	"project-yume/internal/model"
+	"project-yume/internal/privacy"
+	"project-yume/internal/scheduler"
+	"project-yume/internal/service"
+	"project-yume/internal/state"
+	"project-yume/internal/utils"
+
+	"github.com/gorilla/websocket"
+	"github.com/sashabaranov/go-openai"
+)
+
+// NewPipeline 返回默认的入站链路：去重、过滤、归一化。
+func NewPipeline() *inbound.Pipeline {
+	return inbound.NewPipeline(
+		inbound.NewDedupeStage(5*time.Minute),
+		inbound.NewFilterStage(),
+		inbound.NewNormalizeStage(),
+	)
+}
+
+// RunReceiver 从连接读取 OneBot 上报，API 响应交给等待方，消息事件转换后写入 msgChan。
+// 返回时关闭 msgChan。
+func RunReceiver(ctx context.Context, c *websocket.Conn, msgChan chan<- model.Msg) {
+	defer close(msgChan)
+
+	for {
+		select {
+		case <-ctx.Done():
+			utils.Info("消息接收器已停止")
+			return
+		default:
+			_, message, err := connect.ReadMessage(c)
+			if err != nil {
+				utils.Error("读取消息失败: %v", err)
+				time.Sleep(time.Second) // 避免快速重试
+				continue
+			}
+
+			utils.Info("接收到消息: %s", message)
+
+			var envelope map[string]json.RawMessage
+			if err := json.Unmarshal(message, &envelope); err == nil {
+				if _, hasPostType := envelope["post_type"]; !hasPostType {
+					if connect.DispatchAPIResponse(message) {
+						continue
+					}
+				}
+			}
+
+			metrics.IncCounter(
+				"bot_ws_messages_total",
+				"Total WebSocket messages by lifecycle result.",
+				map[string]string{"result": "received"},
+			)
+
+			var msg model.Response
+			err = json.Unmarshal(message, &msg)
+			if err != nil {
+				utils.Error("消息反序列化失败: %v", err)
+				metrics.IncCounter(
+					"bot_ws_messages_total",
+					"Total WebSocket messages by lifecycle result.",
+					map[string]string{"result": "decode_error"},
+				)
+				continue
+			}
+
+			// 转换为内部消息格式
+			internalMsg := model.Msg{
+				Message:   msg.Raw_message,
+				Parts:     buildIncomingMessageParts(msg),
+				User_id:   msg.User_id,
+				Group_id:  msg.Group_id,
+				MessageID: msg.Message_id,
+				Time:      msg.Time,
+				Type: func() int {
+					if msg.Message_type == "group" {
+						return 0
+					}
+					return 1
+				}(),
+			}
+
+			// 非阻塞发送到处理通道
+			select {
+			case msgChan <- internalMsg:
+			case <-time.After(100 * time.Millisecond):
+				utils.Warn("消息通道满，丢弃消息")
+				metrics.IncCounter(
+					"bot_ws_messages_total",
+					"Total WebSocket messages by lifecycle result.",
+					map[string]string{"result": "channel_dropped"},
+				)
+			}
+		}
+	}
+}
+
+// RunProcessor 消费聚合后的消息：走入站链路、记入会话历史，再按会话串行交给处理器。
+// naturalScheduler 可以为 nil。
+func RunProcessor(ctx context.Context, c *websocket.Conn, msgChan <-chan model.Msg,
+	pipeline *inbound.Pipeline, processor *handler.MessageProcessor, naturalScheduler *scheduler.NaturalScheduler,
+) {
+	coordinator := inbound.NewInterruptCoordinator()
+
+	for {
+		select {
+		case <-ctx.Done():
+			utils.Info("消息处理器已停止")
+			return
+		case msg, ok := <-msgChan:
+			if !ok {
+				utils.Info("消息通道已关闭")
+				return
+			}
+
+			sessionID := state.BuildSessionID(msg.User_id, msg.Group_id, msg.Type)
+			enrichedParts := service.EnrichMessageParts(c, msg.Parts)
+			if len(enrichedParts) == 0 {
+				enrichedParts = append([]model.MessagePart(nil), msg.Parts...)
+			}
+			startedAt := time.Unix(msg.Time, 0)
+			if msg.StartTime != 0 {
+				startedAt = time.Unix(msg.StartTime, 0)
+			}
+			endedAt := time.Unix(msg.Time, 0)
+			if msg.EndTime != 0 {
+				endedAt = time.Unix(msg.EndTime, 0)
+			}
+			messageIDs := msg.MessageIDs
+			if len(messageIDs) == 0 && msg.MessageID != 0 {
+				messageIDs = []int64{msg.MessageID}
+			}
+			rawSegments := msg.RawSegments
+			if len(rawSegments) == 0 && msg.Message != "" {
+				rawSegments = []string{msg.Message}
+			}
+			messageCtx := handler.MessageContext{
+				RequestID:    buildMessageRequestID(msg.MessageID),
+				SessionID:    sessionID,
+				UserID:       msg.User_id,
+				GroupID:      msg.Group_id,
+				ChatType:     msg.Type,
+				MessageID:    msg.MessageID,
+				MessageIDs:   messageIDs,
+				RawSegments:  rawSegments,
+				Parts:        enrichedParts,
+				Aggregated:   msg.Aggregated,
+				SegmentCount: len(rawSegments),
+				RawMessage:   msg.Message,
+				ReceivedAt:   endedAt,
+				StartedAt:    startedAt,
+				EndedAt:      endedAt,
+			}
+
+			if err := pipeline.Run(&messageCtx); err != nil {
+				var skipErr *inbound.SkipError
+				if errors.As(err, &skipErr) {
+					utils.Infow("message skipped",
+						utils.String("request_id", messageCtx.RequestID),
+						utils.String("session_id", sessionID),
+						utils.Int64("user_id", msg.User_id),
+						utils.Int64("group_id", msg.Group_id),
+						utils.Int64("message_id", msg.MessageID),
+						utils.Bool("aggregated", messageCtx.Aggregated),
+						utils.Int("segment_count", messageCtx.SegmentCount),
+						utils.String("reason", messageCtx.DropReason),
+					)
+					metrics.IncCounter(
+						"bot_ws_messages_total",
+						"Total WebSocket messages by lifecycle result.",
+						map[string]string{"result": "skipped"},
+					)
+					if msg.Message == "exit();" && messageCtx.DropReason == "filter: control command" {
+						utils.Info("收到退出命令")
+						return
+					}
+					continue
+				}
+				utils.Errorw("message pipeline failed",
+					utils.String("request_id", messageCtx.RequestID),
+					utils.String("session_id", sessionID),
+					utils.Int64("user_id", msg.User_id),
+					utils.Int64("group_id", msg.Group_id),
+					utils.Int64("message_id", msg.MessageID),
+					utils.Err(err),
+				)
+				metrics.IncCounter(
+					"bot_ws_messages_total",
+					"Total WebSocket messages by lifecycle result.",
+					map[string]string{"result": "pipeline_error"},
+				)
+				continue
+			}
+
+			state.GetManager().EnsureSession(sessionID, msg.User_id, msg.Group_id, msg.Type)
+			recordIncomingConversationTurn(messageCtx)
+			if naturalScheduler != nil {
+				naturalScheduler.RescheduleFrom(sessionID, endedAt)
+			}
+
+			run := coordinator.Begin(ctx, messageCtx)
+			go processMessage(c, run, processor, naturalScheduler)
+		}
+	}
+}
+
+// processMessage 在会话协调器中串行处理一轮消息；被后续输入打断时只记录已发出的部分回复。
+func processMessage(c *websocket.Conn, run *inbound.InflightRun, processor *handler.MessageProcessor, naturalScheduler *scheduler.NaturalScheduler) {
+	interrupted := false
+	defer func() { run.Finish(interrupted) }()
+
+	cfg := config.GetConfig()
+	messageCtx := run.Wait()
+	if run.Context().Err() != nil {
+		interrupted = true
+		return
+	}
+	sessionID := messageCtx.SessionID
+
+	utils.Infow("message processing started",
+		utils.String("request_id", messageCtx.RequestID),
+		utils.String("session_id", sessionID),
+		utils.Int64("user_id", messageCtx.UserID),
+		utils.Int64("group_id", messageCtx.GroupID),
+		utils.Int64("message_id", messageCtx.MessageID),
+		utils.Bool("aggregated", messageCtx.Aggregated),
+		utils.Int("segment_count", messageCtx.SegmentCount),
+		utils.String("message", messageCtx.Message),
+		utils.Int("state", int(state.GetManager().GetState(sessionID))),
+	)
+
+	// 使用新的消息处理器获取详细结果
+	result, err := processor.Process(run.Context(), c, messageCtx)
+	if err != nil {
+		utils.Errorw("message processing failed",
+			utils.String("request_id", messageCtx.RequestID),
+			utils.String("session_id", sessionID),
+			utils.Int64("user_id", messageCtx.UserID),
+			utils.Int64("group_id", messageCtx.GroupID),
+			utils.Int64("message_id", messageCtx.MessageID),
+			utils.Err(err),
+		)
+		metrics.IncCounter(
+			"bot_ws_messages_total",
+			"Total WebSocket messages by lifecycle result.",
+			map[string]string{"result": "handler_error"},
+		)
+		return
+	}
+
+	// 处理期间用户要求删除了数据时，本轮消息早于删除记录，不再写回会话和记忆
+	forgotten := privacy.GetTombstoneManager().Blocks(messageCtx.UserID, messageCtx.EndedAt)
+
+	if result.Interrupted {
+		interrupted = true
+		if result.Replied && !forgotten {
+			recordAssistantConversationTurn(sessionID, result.Reply, false, clock.Now())
+		}
+		utils.Infow("message processing interrupted",
+			utils.String("request_id", messageCtx.RequestID),
+			utils.String("session_id", sessionID),
+			utils.Int64("user_id", messageCtx.UserID),
+			utils.Int64("message_id", messageCtx.MessageID),
+			utils.Bool("replied", result.Replied),
+			utils.String("partial_reply", result.Reply),
+		)
+		metrics.IncCounter(
+			"bot_ws_messages_total",
+			"Total WebSocket messages by lifecycle result.",
+			map[string]string{"result": "interrupted"},
+		)
+		return
+	}
+
+	// 记录到情感记忆（如果启用）
+	if cfg.EnableEmotionalMemory && result.Handled && !forgotten {
+		if result.Emotion != "" && result.Intention != "" {
+			utils.Info("记录情感记忆 - 情感: %s, 意图: %s", result.Emotion, result.Intention)
+		} else {
+			utils.Warn("情绪交互记录将跳过，但仍尝试提取长期偏好/事实: emotion=%q intention=%q", result.Emotion, result.Intention)
+		}
+		service.UpdateLongTermMemory(
+			sessionID,
+			messageCtx.UserID,
+			messageCtx.Message,
+			result.Reply,
+			result.Emotion,
+			result.Intention,
+		)
+	}
+
+	// 好感度不依赖情感记忆开关
+	if result.Handled && !forgotten {
+		service.UpdateAffinity(messageCtx.UserID, messageCtx.Message, result.Emotion, result.Intention)
+	}
+
+	// 更新状态
+	if result.Replied && !forgotten {
+		recordedAt := clock.Now()
+		recordAssistantConversationTurn(sessionID, result.Reply, false, recordedAt)
+		if naturalScheduler != nil {
+			naturalScheduler.RescheduleFrom(sessionID, recordedAt)
+		}
+	}
+	if result.ReplyMode != "" && !forgotten {
+		state.GetManager().UpdateLastReplyMode(sessionID, string(result.ReplyMode))
+	}
+
+	utils.Infow("message processing completed",
+		utils.String("request_id", messageCtx.RequestID),
+		utils.String("session_id", sessionID),
+		utils.Int64("user_id", messageCtx.UserID),
+		utils.Int64("group_id", messageCtx.GroupID),
+		utils.Int64("message_id", messageCtx.MessageID),
+		utils.Bool("aggregated", messageCtx.Aggregated),
+		utils.Int("segment_count", messageCtx.SegmentCount),
+		utils.Bool("handled", result.Handled),
+		utils.Bool("replied", result.Replied),
+		utils.String("reply_mode", string(result.ReplyMode)),
+		utils.String("emotion", result.Emotion),
+		utils.String("intention", result.Intention),
+		utils.String("reply", result.Reply),
+		utils.Int("state", int(state.GetManager().GetState(sessionID))),
+	)
+	metrics.IncCounter(
+		"bot_ws_messages_total",
+		"Total WebSocket messages by lifecycle result.",
+		map[string]string{"result": "processed"},
+	)
+}
+
+func recordIncomingConversationTurn(messageCtx handler.MessageContext) {
+	if userMessage, ok := handler.BuildConversationUserMessage(messageCtx); ok {
+		state.GetManager().RecordUserTurn(messageCtx.SessionID, userMessage, messageCtx.EndedAt)
+		return
+	}
+
+	state.GetManager().RecordUserTurn(messageCtx.SessionID, openai.ChatCompletionMessage{
+		Role:    "user",
+		Content: messageCtx.Message,
+	}, messageCtx.EndedAt)
+}
+
+func recordAssistantConversationTurn(sessionID, reply string, proactive bool, recordedAt time.Time) {
+	trimmed := strings.TrimSpace(service.BuildAssistantTranscript(reply))
+	if trimmed == "" {
+		return
+	}
+	state.GetManager().RecordAssistantTurn(sessionID, trimmed, recordedAt, proactive)
+}
+
+func buildMessageRequestID(messageID int64) string {
+	if messageID != 0 {
+		return fmt.Sprintf("msg-%d", messageID)
+	}
+	return utils.NewRequestID("msg")
+}
+
+func buildIncomingMessageParts(resp model.Response) []model.MessagePart {
+	parts := make([]model.MessagePart, 0, len(resp.Message))
+
+	for _, segment := range resp.Message {
+		switch segment.Type {
+		case "text":
+			text := strings.TrimSpace(segment.Data["text"])
+			if text == "" {
+				continue
+			}
+			parts = append(parts, model.MessagePart{
+				Type: "text",
+				Text: text,
+			})
+		case "image":
+			parts = append(parts, model.MessagePart{
+				Type: "image",
+				URL:  strings.TrimSpace(segment.Data["url"]),
+				File: strings.TrimSpace(segment.Data["file"]),
+			})
+		}
+	}
+
+	if len(parts) > 0 {
+		return parts
+	}
+
+	raw := strings.TrimSpace(resp.Raw_message)
+	if raw == "" {
+		return nil
+	}
+	if utils.IsCQImage(raw) {
+		return []model.MessagePart{{
+			Type: "image",
+			URL:  strings.TrimSpace(utils.ExtractImageURL(raw)),
+			File: strings.TrimSpace(utils.ExtractImageFile(raw)),
+		}}
+	}
+	return []model.MessagePart{{
+		Type: "text",
+		Text: raw,
+	}}
+}
@@ -143,6 +143,9 @@ func (cm *CharacterManager) generatePrompt(config *CharacterConfig) string {
 	if len(config.Responses) > 0 {
 		prompt += "【回复风格】\n"
 		for key, value := range config.Responses {
+			if key == PresetsResponseKey {
+				continue
+			}
 			if responses, ok := value.([]interface{}); ok {
 				prompt += fmt.Sprintf("- %s时的回复示例:\n", key)
 				for _, response := range responses {
@@ -0,0 +1,166 @@
+package character
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PresetsResponseKey 是 responses 中存放预设回复规则的键。
+const PresetsResponseKey = "presets"
+
+// PresetMatch 预设回复的匹配方式
+type PresetMatch string
+
+const (
+	PresetMatchExact    PresetMatch = "exact"
+	PresetMatchContains PresetMatch = "contains"
+	PresetMatchRegex    PresetMatch = "regex"
+	PresetMatchFuzzy    PresetMatch = "fuzzy"
+)
+
+// DefaultPresetFuzzyThreshold 模糊匹配默认的相似度阈值。
+const DefaultPresetFuzzyThreshold = 0.75
+
+// PresetRule 一条预设回复规则。
+// Replies 会随机选一条发送；State 非空时命中后切换会话状态；
+// CooldownSec 内同一会话不会重复命中该规则；Stages 非空时只在这些关系阶段生效。
+type PresetRule struct {
+	Name        string      `json:"name,omitempty"`
+	Match       PresetMatch `json:"match,omitempty"`
+	Patterns    []string    `json:"patterns"`
+	Replies     []string    `json:"replies"`
+	State       string      `json:"state,omitempty"`
+	CooldownSec int         `json:"cooldown_sec,omitempty"`
+	Threshold   float64     `json:"threshold,omitempty"`
+	Stages      []string    `json:"stages,omitempty"`
+}
+
+// relationshipStages 关系阶段名，与好感度模块一致。
+var relationshipStages = map[string]struct{}{
+	"stranger":     {},
+	"acquaintance": {},
+	"familiar":     {},
+	"close":        {},
+}
+
+// stageResponseFallback 角色没有配置该阶段的回复池时，退回相邻阶段的。
+var stageResponseFallback = map[string]string{
+	"acquaintance": "stranger",
+	"close":        "familiar",
+}
+
+// AllowsStage 规则是否在该关系阶段生效。stage 为空（关闭好感度）时不限制。
+func (r PresetRule) AllowsStage(stage string) bool {
+	if len(r.Stages) == 0 || stage == "" {
+		return true
+	}
+	for _, allowed := range r.Stages {
+		if allowed == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// StageResponsePool 返回该关系阶段使用的 responses 回复池名，没有可用的回复池时为空。
+func (c *CharacterConfig) StageResponsePool(stage string) string {
+	if c == nil || c.Responses == nil {
+		return ""
+	}
+	for key := stage; key != ""; key = stageResponseFallback[key] {
+		if pool, ok := c.Responses[key].([]interface{}); ok && len(pool) > 0 {
+			return key
+		}
+	}
+	return ""
+}
+
+// Presets 解析 responses.presets。未配置时返回空列表。
+func (c *CharacterConfig) Presets() ([]PresetRule, error) {
+	if c == nil || c.Responses == nil {
+		return nil, nil
+	}
+	raw, ok := c.Responses[PresetsResponseKey]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("marshal responses.presets failed: %w", err)
+	}
+	var rules []PresetRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("responses.presets must be an array of rules: %w", err)
+	}
+
+	for i := range rules {
+		if err := normalizePresetRule(&rules[i]); err != nil {
+			return nil, fmt.Errorf("responses.presets[%d]: %w", i, err)
+		}
+	}
+	return rules, nil
+}
+
+func normalizePresetRule(rule *PresetRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	rule.Match = PresetMatch(strings.ToLower(strings.TrimSpace(string(rule.Match))))
+	if rule.Match == "" {
+		rule.Match = PresetMatchExact
+	}
+	rule.Patterns = compactStrings(rule.Patterns)
+	rule.Replies = compactStrings(rule.Replies)
+	rule.State = strings.TrimSpace(rule.State)
+	rule.Stages = compactStrings(rule.Stages)
+	for i, stage := range rule.Stages {
+		rule.Stages[i] = strings.ToLower(stage)
+		if _, ok := relationshipStages[rule.Stages[i]]; !ok {
+			return fmt.Errorf("unknown stage %q", stage)
+		}
+	}
+
+	if len(rule.Patterns) == 0 {
+		return fmt.Errorf("patterns is required")
+	}
+	if len(rule.Replies) == 0 {
+		return fmt.Errorf("replies is required")
+	}
+	if rule.Name == "" {
+		rule.Name = rule.Patterns[0]
+	}
+	if rule.CooldownSec < 0 {
+		return fmt.Errorf("cooldown_sec must be >= 0")
+	}
+
+	switch rule.Match {
+	case PresetMatchExact, PresetMatchContains:
+	case PresetMatchRegex:
+		for _, pattern := range rule.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("invalid regex %q: %w", pattern, err)
+			}
+		}
+	case PresetMatchFuzzy:
+		if rule.Threshold == 0 {
+			rule.Threshold = DefaultPresetFuzzyThreshold
+		}
+		if rule.Threshold < 0 || rule.Threshold > 1 {
+			return fmt.Errorf("threshold must be between 0 and 1")
+		}
+	default:
+		return fmt.Errorf("unsupported match %q", rule.Match)
+	}
+	return nil
+}
+
+func compactStrings(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if trimmed := strings.TrimSpace(value); trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
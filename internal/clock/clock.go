@@ -0,0 +1,79 @@
+package clock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock 是业务代码读取时间和等待的入口。正常运行用系统时钟，回放时换成 Fake，
+// 消息聚合、打断窗口、打字间隔等与时间相关的行为因此可以按录制时的节奏重现。
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) *Ticker
+}
+
+// Ticker 与 time.Ticker 用法相同。
+type Ticker struct {
+	C    <-chan time.Time
+	stop func()
+}
+
+func (t *Ticker) Stop() {
+	if t != nil && t.stop != nil {
+		t.stop()
+	}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (systemClock) NewTicker(d time.Duration) *Ticker {
+	ticker := time.NewTicker(d)
+	return &Ticker{C: ticker.C, stop: ticker.Stop}
+}
+
+type holder struct {
+	clock Clock
+}
+
+var current atomic.Value
+
+func init() {
+	current.Store(holder{clock: systemClock{}})
+}
+
+// Set 替换全局时钟，传 nil 恢复系统时钟。
+func Set(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+	current.Store(holder{clock: c})
+}
+
+func get() Clock {
+	return current.Load().(holder).clock
+}
+
+func Now() time.Time {
+	return get().Now()
+}
+
+func Since(t time.Time) time.Duration {
+	return get().Now().Sub(t)
+}
+
+func After(d time.Duration) <-chan time.Time {
+	return get().After(d)
+}
+
+func NewTicker(d time.Duration) *Ticker {
+	return get().NewTicker(d)
+}
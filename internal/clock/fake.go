@@ -0,0 +1,146 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake 只在调用 Set/Advance 时前进的时钟。到期的 After 与 Ticker 在前进时触发，
+// Ticker 和 time.Ticker 一样只缓冲一次，跨过多个周期也只触发一次。
+type Fake struct {
+	mu       sync.Mutex
+	now      time.Time
+	waiters  []*fakeWaiter
+	tickers  []*fakeTicker
+	schedule func()
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+type fakeTicker struct {
+	period  time.Duration
+	next    time.Time
+	ch      chan time.Time
+	stopped bool
+}
+
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+// OnSchedule 每登记一次等待就回调一次，回放用它判断系统是否还在活动。
+func (f *Fake) OnSchedule(fn func()) {
+	f.mu.Lock()
+	f.schedule = fn
+	f.mu.Unlock()
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+	} else {
+		f.waiters = append(f.waiters, &fakeWaiter{at: f.now.Add(d), ch: ch})
+	}
+	schedule := f.schedule
+	f.mu.Unlock()
+
+	if schedule != nil {
+		schedule()
+	}
+	return ch
+}
+
+func (f *Fake) NewTicker(d time.Duration) *Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	ticker := &fakeTicker{period: d, next: f.now.Add(d), ch: make(chan time.Time, 1)}
+	f.tickers = append(f.tickers, ticker)
+	f.mu.Unlock()
+
+	return &Ticker{C: ticker.ch, stop: func() {
+		f.mu.Lock()
+		ticker.stopped = true
+		f.mu.Unlock()
+	}}
+}
+
+// Advance 让时钟前进 d。
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set 把时钟拨到 t 并触发所有到期的等待；t 早于当前时间时不回拨。
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t.After(f.now) {
+		f.now = t
+	}
+
+	pending := f.waiters[:0]
+	for _, waiter := range f.waiters {
+		if waiter.at.After(f.now) {
+			pending = append(pending, waiter)
+			continue
+		}
+		waiter.ch <- f.now
+	}
+	f.waiters = pending
+
+	active := f.tickers[:0]
+	for _, ticker := range f.tickers {
+		if ticker.stopped {
+			continue
+		}
+		if !ticker.next.After(f.now) {
+			select {
+			case ticker.ch <- f.now:
+			default:
+			}
+			for !ticker.next.After(f.now) {
+				ticker.next = ticker.next.Add(ticker.period)
+			}
+		}
+		active = append(active, ticker)
+	}
+	f.tickers = active
+}
+
+// NextWaiter 返回最早到期的一次性等待（不含 Ticker）。
+func (f *Fake) NextWaiter() (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var next time.Time
+	for _, waiter := range f.waiters {
+		if next.IsZero() || waiter.at.Before(next) {
+			next = waiter.at
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// NextTick 返回最早的 Ticker 触发时间。
+func (f *Fake) NextTick() (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var next time.Time
+	for _, ticker := range f.tickers {
+		if !ticker.stopped && (next.IsZero() || ticker.next.Before(next)) {
+			next = ticker.next
+		}
+	}
+	return next, !next.IsZero()
+}
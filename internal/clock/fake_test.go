@@ -0,0 +1,46 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeFiresWaitersAndTickers(t *testing.T) {
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	waiter := fake.After(2 * time.Second)
+	ticker := fake.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	if next, ok := fake.NextWaiter(); !ok || !next.Equal(start.Add(2*time.Second)) {
+		t.Fatalf("unexpected next waiter: %v %v", next, ok)
+	}
+
+	fake.Advance(time.Second)
+	select {
+	case <-waiter:
+		t.Fatalf("waiter fired too early")
+	default:
+	}
+	select {
+	case <-ticker.C:
+	default:
+		t.Fatalf("ticker should fire after its period")
+	}
+	if next, _ := fake.NextTick(); !next.Equal(start.Add(1250 * time.Millisecond)) {
+		t.Fatalf("ticker should skip missed periods, next=%v", next)
+	}
+
+	fake.Set(start.Add(3 * time.Second))
+	select {
+	case at := <-waiter:
+		if !at.Equal(start.Add(3 * time.Second)) {
+			t.Fatalf("unexpected fire time %v", at)
+		}
+	default:
+		t.Fatalf("waiter should fire once due")
+	}
+	if _, ok := fake.NextWaiter(); ok {
+		t.Fatalf("fired waiter should be removed")
+	}
+}
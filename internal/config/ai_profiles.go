@@ -2,16 +2,20 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 )
 
 const defaultAIConfigFilePath = "./config/ai_profiles.json"
 
 type AIProfile struct {
+	// Provider 服务商协议，为空按 OpenAI 兼容接口处理。
+	Provider      string  `json:"provider,omitempty"`
 	AIBaseURL     string  `json:"aiBaseUrl"`
 	AIModel       string  `json:"aiModel"`
 	AIKey         string  `json:"aiKey"`
@@ -21,13 +25,52 @@ type AIProfile struct {
 	AIRetryCount  int     `json:"aiRetryCount"`
 	AIRateLimit   int     `json:"aiRateLimit"`
 	AITopP        float32 `json:"aiTopP"`
+	// InputPrice/OutputPrice 每百万输入/输出 token 的价格，用于费用统计与预算。
+	InputPrice  float64 `json:"inputPrice,omitempty"`
+	OutputPrice float64 `json:"outputPrice,omitempty"`
 }
 
 type AIProfileSet struct {
 	Active   string               `json:"active"`
 	Profiles map[string]AIProfile `json:"profiles"`
+	// Routes 把任务指向某个配置，未配置的任务使用 Active。
+	Routes map[string]string `json:"routes,omitempty"`
+	// Failover 主配置失败或熔断时依次尝试的备用配置。
+	Failover []string `json:"failover,omitempty"`
 }
 
+// AIRouteTarget 任务路由链上的一个配置。
+type AIRouteTarget struct {
+	Name    string
+	Profile AIProfile
+}
+
+// 可单独路由的模型任务。
+const (
+	AITaskClassify      = "classify"
+	AITaskReply         = "reply"
+	AITaskMemoryExtract = "memory_extract"
+	AITaskProactive     = "proactive"
+	AITaskSummary       = "summary"
+)
+
+var aiTasks = []string{AITaskClassify, AITaskReply, AITaskMemoryExtract, AITaskProactive, AITaskSummary}
+
+// 支持的服务商协议。
+const (
+	AIProviderOpenAI    = "openai"
+	AIProviderAnthropic = "anthropic"
+	AIProviderGemini    = "gemini"
+	AIProviderOllama    = "ollama"
+)
+
+var aiProviders = []string{AIProviderOpenAI, AIProviderAnthropic, AIProviderGemini, AIProviderOllama}
+
+var (
+	loadedAIProfiles   AIProfileSet
+	loadedAIProfilesMu sync.RWMutex
+)
+
 func GetAIConfigFilePath() string {
 	raw := strings.TrimSpace(os.Getenv("AI_CONFIG_FILE"))
 	if raw == "" {
@@ -172,9 +215,160 @@ func ActiveAIProfile(set AIProfileSet) (string, AIProfile, error) {
 	return set.Active, normalizeAIProfile(profile), nil
 }
 
+// AITasks 返回所有可路由的任务名。
+func AITasks() []string {
+	return append([]string(nil), aiTasks...)
+}
+
+func IsAITask(task string) bool {
+	for _, known := range aiTasks {
+		if known == task {
+			return true
+		}
+	}
+	return false
+}
+
+// AIProviders 返回所有支持的服务商协议名。
+func AIProviders() []string {
+	return append([]string(nil), aiProviders...)
+}
+
+func IsAIProvider(provider string) bool {
+	for _, known := range aiProviders {
+		if known == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// SetAIRoute 设置任务使用的配置，profileName 为空表示改回使用 Active。
+func SetAIRoute(set *AIProfileSet, task string, profileName string) error {
+	task = strings.TrimSpace(task)
+	if !IsAITask(task) {
+		return fmt.Errorf("unknown ai task: %s", task)
+	}
+	profileName = normalizeAIProfileName(profileName)
+	if profileName == "" {
+		delete(set.Routes, task)
+		return nil
+	}
+	if _, ok := set.Profiles[profileName]; !ok {
+		return fmt.Errorf("ai profile not found: %s", profileName)
+	}
+	if set.Routes == nil {
+		set.Routes = map[string]string{}
+	}
+	set.Routes[task] = profileName
+	return nil
+}
+
+// ResolveAIRoute 返回任务实际使用的配置名与配置。
+func ResolveAIRoute(set AIProfileSet, task string) (string, AIProfile, error) {
+	if name, ok := set.Routes[task]; ok {
+		if profile, exists := set.Profiles[name]; exists {
+			return name, normalizeAIProfile(profile), nil
+		}
+	}
+	return ActiveAIProfile(set)
+}
+
+// SetAIFailover 设置备用配置顺序，名称必须已存在。
+func SetAIFailover(set *AIProfileSet, names []string) error {
+	failover := make([]string, 0, len(names))
+	for _, raw := range names {
+		name := normalizeAIProfileName(raw)
+		if name == "" {
+			continue
+		}
+		if _, ok := set.Profiles[name]; !ok {
+			return fmt.Errorf("ai profile not found: %s", name)
+		}
+		failover = append(failover, name)
+	}
+	set.Failover = failover
+	return nil
+}
+
+// GetAIRouteChain 返回任务的主配置及其后的备用配置，备用配置中与主配置重名的跳过。
+func GetAIRouteChain(task string) []AIRouteTarget {
+	name, profile := GetAIRoute(task)
+	chain := []AIRouteTarget{{Name: name, Profile: profile}}
+
+	loadedAIProfilesMu.RLock()
+	set := loadedAIProfiles
+	loadedAIProfilesMu.RUnlock()
+	for _, backup := range set.Failover {
+		if backup == name {
+			continue
+		}
+		if profile, ok := set.Profiles[backup]; ok {
+			chain = append(chain, AIRouteTarget{Name: backup, Profile: normalizeAIProfile(profile)})
+		}
+	}
+	return chain
+}
+
+// GetAIProfile 按名称返回最近一次加载的配置，当前生效的配置含环境变量兜底后的值。
+func GetAIProfile(name string) (AIProfile, bool) {
+	name = normalizeAIProfileName(name)
+	if name == "" {
+		return AIProfile{}, false
+	}
+	loadedAIProfilesMu.RLock()
+	set := loadedAIProfiles
+	loadedAIProfilesMu.RUnlock()
+	if name == config.AiProfile {
+		return currentAIProfile(set), true
+	}
+	profile, ok := set.Profiles[name]
+	if !ok {
+		return AIProfile{}, false
+	}
+	return normalizeAIProfile(profile), true
+}
+
+// GetAIRoute 按最近一次加载的配置解析任务路由。
+// 未单独路由的任务返回当前生效的配置（含环境变量兜底后的值）。
+func GetAIRoute(task string) (string, AIProfile) {
+	loadedAIProfilesMu.RLock()
+	set := loadedAIProfiles
+	loadedAIProfilesMu.RUnlock()
+
+	if name, ok := set.Routes[task]; ok && name != config.AiProfile {
+		if profile, exists := set.Profiles[name]; exists {
+			return name, normalizeAIProfile(profile)
+		}
+	}
+	return config.AiProfile, currentAIProfile(set)
+}
+
+// currentAIProfile 当前生效的配置取自 config 字段，单价只在配置文件里。
+func currentAIProfile(set AIProfileSet) AIProfile {
+	return AIProfile{
+		Provider:      config.AiProvider,
+		AIBaseURL:     config.AiBaseUrl,
+		AIModel:       config.AiModel,
+		AIKey:         config.AiKEY,
+		AITemperature: config.AiTemperature,
+		AIMaxTokens:   config.AiMaxTokens,
+		AITimeout:     config.AiTimeout,
+		AIRetryCount:  config.AiRetryCount,
+		AIRateLimit:   config.AiRateLimit,
+		AITopP:        config.AiTopP,
+		InputPrice:    set.Profiles[config.AiProfile].InputPrice,
+		OutputPrice:   set.Profiles[config.AiProfile].OutputPrice,
+	}
+}
+
 func ValidateAIProfile(profile AIProfile) error {
 	profile = normalizeAIProfile(profile)
-	if strings.TrimSpace(profile.AIBaseURL) == "" {
+	if !IsAIProvider(profile.Provider) {
+		return fmt.Errorf("unknown provider: %s", profile.Provider)
+	}
+	// 非 OpenAI 协议的服务商有默认地址，可以不填。
+	if profile.Provider == AIProviderOpenAI && strings.TrimSpace(profile.AIBaseURL) == "" {
 		return fmt.Errorf("aiBaseUrl is required")
 	}
 	if strings.TrimSpace(profile.AIModel) == "" {
@@ -204,6 +398,7 @@ func ValidateAIProfile(profile AIProfile) error {
 func loadActiveAIProfileIntoConfig() error {
 	fallbackName := normalizeAIProfileName(firstNonBlank(os.Getenv("AI_PROFILE"), config.AiProfile, "default"))
 	fallbackProfile := normalizeAIProfile(AIProfile{
+		Provider:      firstNonBlank(os.Getenv("AI_PROVIDER"), config.AiProvider),
 		AIBaseURL:     firstNonBlank(os.Getenv("AI_BASEURL"), config.AiBaseUrl),
 		AIModel:       firstNonBlank(os.Getenv("AI_MODEL"), config.AiModel),
 		AIKey:         firstNonBlank(os.Getenv("AI_KEY"), config.AiKEY),
@@ -216,9 +411,15 @@ func loadActiveAIProfileIntoConfig() error {
 	})
 
 	path := GetAIConfigFilePath()
-	set, err := EnsureAIProfileSet(path, fallbackName, fallbackProfile)
-	if err != nil {
-		return err
+	// 配置文件不存在时只按环境变量在内存里生成，等管理后台第一次保存时再创建
+	_, statErr := os.Stat(path)
+	persist := !errors.Is(statErr, os.ErrNotExist)
+	set := AIProfileSet{Active: fallbackName, Profiles: map[string]AIProfile{fallbackName: fallbackProfile}}
+	if persist {
+		var err error
+		if set, err = EnsureAIProfileSet(path, fallbackName, fallbackProfile); err != nil {
+			return err
+		}
 	}
 
 	desiredActive := normalizeAIProfileName(firstNonBlank(os.Getenv("AI_PROFILE"), set.Active, fallbackName))
@@ -227,8 +428,10 @@ func loadActiveAIProfileIntoConfig() error {
 			set.Profiles[desiredActive] = fallbackProfile
 		}
 		set.Active = desiredActive
-		if err := SaveAIProfileSet(path, set); err != nil {
-			return err
+		if persist {
+			if err := SaveAIProfileSet(path, set); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -239,6 +442,7 @@ func loadActiveAIProfileIntoConfig() error {
 
 	config.AiProfile = activeName
 	config.AiConfigFile = path
+	config.AiProvider = profile.Provider
 	config.AiBaseUrl = profile.AIBaseURL
 	config.AiModel = profile.AIModel
 	config.AiKEY = profile.AIKey
@@ -248,6 +452,10 @@ func loadActiveAIProfileIntoConfig() error {
 	config.AiRetryCount = profile.AIRetryCount
 	config.AiRateLimit = profile.AIRateLimit
 	config.AiTopP = profile.AITopP
+
+	loadedAIProfilesMu.Lock()
+	loadedAIProfiles = set
+	loadedAIProfilesMu.Unlock()
 	return nil
 }
 
@@ -266,6 +474,43 @@ func normalizeAIProfileSet(set *AIProfileSet) {
 	}
 	set.Profiles = normalizedProfiles
 	set.Active = normalizeAIProfileName(set.Active)
+
+	failover := make([]string, 0, len(set.Failover))
+	seen := make(map[string]struct{}, len(set.Failover))
+	for _, raw := range set.Failover {
+		name := normalizeAIProfileName(raw)
+		if _, ok := set.Profiles[name]; !ok {
+			continue
+		}
+		if _, dup := seen[name]; dup {
+			continue
+		}
+		seen[name] = struct{}{}
+		failover = append(failover, name)
+	}
+	set.Failover = nil
+	if len(failover) > 0 {
+		set.Failover = failover
+	}
+
+	if len(set.Routes) == 0 {
+		set.Routes = nil
+		return
+	}
+	normalizedRoutes := make(map[string]string, len(set.Routes))
+	for task, name := range set.Routes {
+		task = strings.TrimSpace(task)
+		name = normalizeAIProfileName(name)
+		if !IsAITask(task) {
+			continue
+		}
+		// 指向已删除配置的路由直接丢弃，回到 Active。
+		if _, ok := set.Profiles[name]; !ok {
+			continue
+		}
+		normalizedRoutes[task] = name
+	}
+	set.Routes = normalizedRoutes
 }
 
 func normalizeAIProfileName(raw string) string {
@@ -273,6 +518,10 @@ func normalizeAIProfileName(raw string) string {
 }
 
 func normalizeAIProfile(profile AIProfile) AIProfile {
+	profile.Provider = strings.ToLower(strings.TrimSpace(profile.Provider))
+	if profile.Provider == "" {
+		profile.Provider = AIProviderOpenAI
+	}
 	profile.AIBaseURL = strings.TrimSpace(profile.AIBaseURL)
 	profile.AIModel = strings.TrimSpace(profile.AIModel)
 	profile.AIKey = strings.TrimSpace(profile.AIKey)
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadActiveAIProfileFollowsConfigFile(t *testing.T) {
+	cfg := GetConfig()
+	previous := *cfg
+	loadedAIProfilesMu.RLock()
+	previousSet := loadedAIProfiles
+	loadedAIProfilesMu.RUnlock()
+	t.Cleanup(func() {
+		*cfg = previous
+		loadedAIProfilesMu.Lock()
+		loadedAIProfiles = previousSet
+		loadedAIProfilesMu.Unlock()
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ai_profiles.json")
+	if err := SaveAIProfileSet(path, AIProfileSet{
+		Active: "main",
+		Profiles: map[string]AIProfile{
+			"main": {AIBaseURL: "http://127.0.0.1:1/v1", AIModel: "main-model"},
+			"fast": {AIBaseURL: "http://127.0.0.1:1/v1", AIModel: "fast-model"},
+		},
+	}); err != nil {
+		t.Fatalf("save ai profiles: %v", err)
+	}
+	t.Setenv("AI_CONFIG_FILE", path)
+	t.Setenv("AI_PROFILE", "fast")
+
+	if err := loadActiveAIProfileIntoConfig(); err != nil {
+		t.Fatalf("load ai profile: %v", err)
+	}
+	if cfg.AiProfile != "fast" || cfg.AiModel != "fast-model" || cfg.AiConfigFile != path {
+		t.Fatalf("AI_PROFILE should select the fast profile, got %s/%s from %s", cfg.AiProfile, cfg.AiModel, cfg.AiConfigFile)
+	}
+	saved, err := LoadAIProfileSet(path)
+	if err != nil || saved.Active != "fast" || len(saved.Profiles) != 2 {
+		t.Fatalf("switching profile should be saved back, got %+v %v", saved, err)
+	}
+
+	// 文件不存在时只在内存里生成，不替用户创建
+	missing := filepath.Join(dir, "missing", "ai_profiles.json")
+	t.Setenv("AI_CONFIG_FILE", missing)
+	t.Setenv("AI_MODEL", "env-model")
+	if err := loadActiveAIProfileIntoConfig(); err != nil {
+		t.Fatalf("load without config file: %v", err)
+	}
+	if cfg.AiProfile != "fast" || cfg.AiModel != "env-model" {
+		t.Fatalf("missing file should fall back to env, got %s/%s", cfg.AiProfile, cfg.AiModel)
+	}
+	if _, err := os.Stat(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("loading should not create the config file, stat err=%v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 
 	"project-yume/internal/character"
 	"project-yume/internal/utils"
@@ -21,6 +22,7 @@ type Config struct {
 	AiBaseUrl    string
 	AiPrompt     string
 	AiModel      string
+	AiProvider   string // 服务商协议：openai（默认）/anthropic/gemini/ollama
 	AiProfile    string
 	AiConfigFile string
 	Character    string
@@ -34,13 +36,78 @@ type Config struct {
 	BaseInterval           int     // 基础发送间隔(分钟)
 	RandomFactor           float64 // 随机因子
 
+	// 长期记忆提取
+	EnableLLMMemoryExtract     bool    // 用模型从对话中提取画像与事实，失败时退回正则
+	MemoryExtractBatchSize     int     // 同一用户攒够多少条消息提取一次
+	MemoryExtractBatchWaitSec  int     // 首条消息入队后最多等待多久(秒)
+	MemoryExtractMinConfidence float64 // 置信度低于该值的事实不写入
+	EnableFactDecay            bool    // 事实置信度按谓词随时间衰减，被提到或再次确认时回升
+	FactMinConfidence          float64 // 置信度衰减到该值以下的事实标为过时，不再注入
+	EnableFactConfirmation     bool    // 与当前值冲突且置信度低的新说法先挂起，由机器人向用户确认
+	FactConfirmBelow           float64 // 置信度低于该值的冲突说法需要确认
+
+	// 事实语义检索
+	EmbeddingProvider      string  // 嵌入方式：空为关闭，hash 为本地哈希，openai 为 OpenAI 兼容接口
+	EmbeddingProfile       string  // openai 方式使用的模型配置名，为空用当前配置
+	EmbeddingModel         string  // 嵌入模型名
+	EmbeddingDimensions    int     // 向量维度，0 表示模型默认(hash 为 256)
+	EmbeddingTimeoutMs     int     // 单次嵌入请求超时(毫秒)
+	EmbeddingMinSimilarity float64 // 没有关键词命中时，相似度低于该值的事实不返回
+
+	// 关系阶段
+	EnableAffinity          bool  // 按互动累计好感度，决定陌生/熟悉等关系阶段
+	AffinityStageThresholds []int // 进入认识、熟悉、亲近的分数(0-100)，须递增
+
+	// 情绪日历
+	EnableMoodCheckIn bool // 连续几天情绪低落时由主动消息调度发一句关心
+	MoodDistressDays  int  // 连续多少天以难过或生气为主才关心
+
+	// 危机干预
+	EnableCrisisDetection  bool    // 每条消息先检测自伤风险，命中时用求助模板回复并进入守护状态
+	EnableCrisisModelCheck bool    // 词表分数达到复核线时再请分类模型判断
+	CrisisTriggerScore     float64 // 风险分数(0-1)达到该值即触发
+	CrisisReviewScore      float64 // 词表分数达到该值才请模型复核，0 表示每条都复核
+	CrisisGuardHours       int     // 守护状态持续多久(小时)
+	CrisisReplyTemplate    string  // 触发时的回复，{hotlines} 替换为求助热线，$ 分段
+	CrisisHotlines         string  // 求助热线
+	CrisisAlertQQ          int64   // 触发时私聊通知的管理员 QQ，0 为不通知
+	CrisisAlertWebhook     string  // 触发时 POST 事件 JSON 的地址，为空不通知
+
+	// 情景记忆
+	EnableEpisodicMemory bool // 把空闲切分的私聊片段总结成带日期的记录
+	EpisodeIdleGapMin    int  // 空闲多久(分钟)视为一段对话结束
+	EpisodeMinUserTurns  int  // 用户发言少于该条数的片段不总结
+	EpisodePromptLimit   int  // 每次回复最多带几条相关片段
+
 	// AI配置增强
-	AiTemperature float32 // AI温度参数
-	AiMaxTokens   int     // 最大token数
-	AiTimeout     int     // AI请求超时(秒)
-	AiRetryCount  int     // AI请求重试次数
-	AiRateLimit   int     // AI请求速率限制(每分钟)
-	AiTopP        float32 // AI top_p参数
+	AiTemperature        float32 // AI温度参数
+	AiMaxTokens          int     // 最大token数
+	AiTimeout            int     // AI请求超时(秒)
+	AiRetryCount         int     // AI请求重试次数
+	AiRateLimit          int     // AI请求速率限制(每分钟)
+	AiTopP               float32 // AI top_p参数
+	EnableAIStream       bool    // 流式输出回复，逐段发送
+	EnableAITools        bool    // 允许模型调用内置工具
+	AiToolMaxRounds      int     // 单次回复最多的工具调用轮数
+	AiToolTimeoutMs      int     // 单个工具默认超时(毫秒)
+	EnableAIJSONSchema   bool    // 分析请求携带 response_format JSON schema
+	AiBreakerFailures    int     // 连续失败多少次后熔断该配置
+	AiBreakerCooldownSec int     // 熔断后多久放行一次探测请求(秒)
+	EnableReminders      bool    // 启用聊天提醒与到点提醒
+
+	// AI 用量预算，0 表示不限制
+	AiDailyTokenBudget   int     // 每日 token 上限
+	AiMonthlyTokenBudget int     // 每月 token 上限
+	AiDailyCostBudget    float64 // 每日费用上限，单位与配置里的单价一致
+	AiMonthlyCostBudget  float64 // 每月费用上限
+	AiBudgetPolicy       string  // 超出预算后的降级方式：cheap_profile/preset_only
+	AiBudgetProfile      string  // cheap_profile 降级时改用的配置名
+
+	// AI 调用审计
+	EnableAIAudit    bool     // 记录每次模型调用的完整请求与输出
+	AiAuditMaxFileMB int      // 单个审计文件的大小上限(MB)
+	AiAuditMaxFiles  int      // 保留的历史审计文件数
+	AiAuditRedact    []string // 启用的脱敏规则：phone/email/id_card/bank_card/secret
 
 	// 日志配置
 	LogLevel       string // 日志级别
@@ -55,15 +122,21 @@ type Config struct {
 	MetricsPath          string // 指标接口路径
 
 	// 存储配置
-	DataDir string // 数据目录
-	LogDir  string // 日志目录
+	DataDir          string // 数据目录
+	LogDir           string // 日志目录
+	ReplayRecordFile string // 录制回放录像的输出文件，为空不录制；仅启动时生效
 
 	// 功能开关
-	EnableOnlyLongChat           bool // 仅长对话模式
-	MessageAggregateIdleWindowMs int  // 消息聚合空闲窗口(毫秒)
-	MessageAggregateMaxWindowMs  int  // 消息聚合最大窗口(毫秒)
-	MessageAggregateMaxMessages  int  // 单次消息聚合最大条数
-	EnableTimeContext            bool // 启用动态时间上下文
+	EnableOnlyLongChat           bool     // 仅长对话模式
+	MessageAggregateIdleWindowMs int      // 消息聚合空闲窗口(毫秒)
+	MessageAggregateMaxWindowMs  int      // 消息聚合最大窗口(毫秒)
+	MessageAggregateMaxMessages  int      // 单次消息聚合最大条数
+	EnableInterruptMerge         bool     // 生成回复期间用户继续输入时打断并合并重跑
+	InterruptGraceWindowMs       int      // 允许打断的宽限窗口(毫秒)
+	DisabledHandlers             []string // 禁用的消息处理器名称
+	HandlerPriorities            string   // 处理器优先级覆盖，如 preset:300,emotion:200
+	HandlerRoutes                string   // 状态到处理器的路由表，如 idle=preset|emotion;long_chat=long_chat
+	EnableTimeContext            bool     // 启用动态时间上下文
 	TimeContextTimezone          string
 	TimeContextFormat            string
 	EnableVisionInput            bool   // 启用 OpenAI-compatible 视觉输入
@@ -76,8 +149,15 @@ type Config struct {
 
 var config = &Config{}
 
+// 危机干预的默认回复与求助热线，不走角色设定。
+const (
+	DefaultCrisisReplyTemplate = "我很在意你刚才说的话。$你现在安全吗？如果有伤害自己的念头，请马上联系身边信任的人，或者拨打求助热线：{hotlines}$我会一直在这里，愿意的话跟我说说发生了什么。"
+	DefaultCrisisHotlines      = "希望24热线 400-161-9995；北京心理危机研究与干预中心 010-82951332；紧急情况请拨打 110 或 120"
+)
+
 var (
 	cm               *character.CharacterManager
+	cmMu             sync.RWMutex
 	systemBasePrompt string
 )
 
@@ -116,6 +196,7 @@ func init() {
 	config.AiPrompt = basePrompt + os.Getenv("AI_PROMPT")
 	systemBasePrompt = basePrompt
 	config.AiModel = os.Getenv("AI_MODEL")
+	config.AiProvider = os.Getenv("AI_PROVIDER")
 	config.AiProfile = getStringEnv("AI_PROFILE", "default")
 	config.AiConfigFile = GetAIConfigFilePath()
 	config.Character = os.Getenv("CHARACTER")
@@ -124,6 +205,37 @@ func init() {
 	// 调度器配置
 	config.EnableNaturalScheduler = getBoolEnv("ENABLE_NATURAL_SCHEDULER", true)
 	config.EnableEmotionalMemory = getBoolEnv("ENABLE_EMOTIONAL_MEMORY", true)
+	config.EnableLLMMemoryExtract = getBoolEnv("ENABLE_LLM_MEMORY_EXTRACT", false)
+	config.MemoryExtractBatchSize = getIntEnv("MEMORY_EXTRACT_BATCH_SIZE", 5)
+	config.MemoryExtractBatchWaitSec = getIntEnv("MEMORY_EXTRACT_BATCH_WAIT_SEC", 120)
+	config.MemoryExtractMinConfidence = getFloatEnv("MEMORY_EXTRACT_MIN_CONFIDENCE", 0.5)
+	config.EnableFactDecay = getBoolEnv("ENABLE_FACT_DECAY", true)
+	config.FactMinConfidence = getFloatEnv("FACT_MIN_CONFIDENCE", 0.3)
+	config.EnableFactConfirmation = getBoolEnv("ENABLE_FACT_CONFIRMATION", false)
+	config.FactConfirmBelow = getFloatEnv("FACT_CONFIRM_BELOW", 0.75)
+	config.EmbeddingProvider = os.Getenv("EMBEDDING_PROVIDER")
+	config.EmbeddingProfile = os.Getenv("EMBEDDING_PROFILE")
+	config.EmbeddingModel = getStringEnv("EMBEDDING_MODEL", "text-embedding-3-small")
+	config.EmbeddingDimensions = getIntEnv("EMBEDDING_DIMENSIONS", 0)
+	config.EmbeddingTimeoutMs = getIntEnv("EMBEDDING_TIMEOUT_MS", 3000)
+	config.EmbeddingMinSimilarity = getFloatEnv("EMBEDDING_MIN_SIMILARITY", 0.3)
+	config.EnableAffinity = getBoolEnv("ENABLE_AFFINITY", true)
+	config.AffinityStageThresholds = getIntArrayEnv("AFFINITY_STAGE_THRESHOLDS", []int{20, 50, 80})
+	config.EnableMoodCheckIn = getBoolEnv("ENABLE_MOOD_CHECKIN", true)
+	config.MoodDistressDays = getIntEnv("MOOD_DISTRESS_DAYS", 3)
+	config.EnableCrisisDetection = getBoolEnv("ENABLE_CRISIS_DETECTION", true)
+	config.EnableCrisisModelCheck = getBoolEnv("ENABLE_CRISIS_MODEL_CHECK", false)
+	config.CrisisTriggerScore = getFloatEnv("CRISIS_TRIGGER_SCORE", 0.7)
+	config.CrisisReviewScore = getFloatEnv("CRISIS_REVIEW_SCORE", 0.3)
+	config.CrisisGuardHours = getIntEnv("CRISIS_GUARD_HOURS", 24)
+	config.CrisisReplyTemplate = getStringEnv("CRISIS_REPLY_TEMPLATE", DefaultCrisisReplyTemplate)
+	config.CrisisHotlines = getStringEnv("CRISIS_HOTLINES", DefaultCrisisHotlines)
+	config.CrisisAlertQQ = getInt64Env("CRISIS_ALERT_QQ", 0)
+	config.CrisisAlertWebhook = os.Getenv("CRISIS_ALERT_WEBHOOK")
+	config.EnableEpisodicMemory = getBoolEnv("ENABLE_EPISODIC_MEMORY", false)
+	config.EpisodeIdleGapMin = getIntEnv("EPISODE_IDLE_GAP_MIN", 30)
+	config.EpisodeMinUserTurns = getIntEnv("EPISODE_MIN_USER_TURNS", 2)
+	config.EpisodePromptLimit = getIntEnv("EPISODE_PROMPT_LIMIT", 2)
 	config.ActiveHours = getIntArrayEnv("ACTIVE_HOURS", []int{9, 10, 11, 14, 15, 16, 19, 20, 21})
 	config.SleepHours = getIntArrayEnv("SLEEP_HOURS", []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 22, 23})
 	config.BaseInterval = getIntEnv("BASE_INTERVAL", 45)
@@ -136,6 +248,24 @@ func init() {
 	config.AiRetryCount = getIntEnv("AI_RETRY_COUNT", 3)
 	config.AiRateLimit = getIntEnv("AI_RATE_LIMIT", 20)
 	config.AiTopP = float32(getFloatEnv("AI_TOP_P", 0.9))
+	config.EnableAIStream = getBoolEnv("ENABLE_AI_STREAM", true)
+	config.EnableAITools = getBoolEnv("ENABLE_AI_TOOLS", true)
+	config.AiToolMaxRounds = getIntEnv("AI_TOOL_MAX_ROUNDS", 3)
+	config.AiToolTimeoutMs = getIntEnv("AI_TOOL_TIMEOUT_MS", 5000)
+	config.EnableAIJSONSchema = getBoolEnv("ENABLE_AI_JSON_SCHEMA", true)
+	config.AiBreakerFailures = getIntEnv("AI_BREAKER_FAILURES", 3)
+	config.AiBreakerCooldownSec = getIntEnv("AI_BREAKER_COOLDOWN_SEC", 30)
+	config.EnableReminders = getBoolEnv("ENABLE_REMINDERS", true)
+	config.AiDailyTokenBudget = getIntEnv("AI_DAILY_TOKEN_BUDGET", 0)
+	config.AiMonthlyTokenBudget = getIntEnv("AI_MONTHLY_TOKEN_BUDGET", 0)
+	config.AiDailyCostBudget = getFloatEnv("AI_DAILY_COST_BUDGET", 0)
+	config.AiMonthlyCostBudget = getFloatEnv("AI_MONTHLY_COST_BUDGET", 0)
+	config.AiBudgetPolicy = getStringEnv("AI_BUDGET_POLICY", "cheap_profile")
+	config.AiBudgetProfile = os.Getenv("AI_BUDGET_PROFILE")
+	config.EnableAIAudit = getBoolEnv("ENABLE_AI_AUDIT", true)
+	config.AiAuditMaxFileMB = getIntEnv("AI_AUDIT_MAX_FILE_MB", 20)
+	config.AiAuditMaxFiles = getIntEnv("AI_AUDIT_MAX_FILES", 5)
+	config.AiAuditRedact = getStringArrayEnv("AI_AUDIT_REDACT", []string{"phone", "email", "id_card", "bank_card", "secret"})
 
 	if err := loadActiveAIProfileIntoConfig(); err != nil {
 		utils.Warn("load ai profile config failed, fallback env values: %v", err)
@@ -154,12 +284,18 @@ func init() {
 	// 存储配置
 	config.DataDir = getStringEnv("DATA_DIR", "./data")
 	config.LogDir = getStringEnv("LOG_DIR", "./logs")
+	config.ReplayRecordFile = os.Getenv("REPLAY_RECORD_FILE")
 
 	// 功能开关
 	config.EnableOnlyLongChat = getBoolEnv("ENABLE_ONLY_LONG_CHAT", false)
 	config.MessageAggregateIdleWindowMs = getIntEnv("MESSAGE_AGGREGATE_IDLE_WINDOW_MS", 2000)
 	config.MessageAggregateMaxWindowMs = getIntEnv("MESSAGE_AGGREGATE_MAX_WINDOW_MS", 10000)
 	config.MessageAggregateMaxMessages = getIntEnv("MESSAGE_AGGREGATE_MAX_MESSAGES", 5)
+	config.EnableInterruptMerge = getBoolEnv("ENABLE_INTERRUPT_MERGE", true)
+	config.InterruptGraceWindowMs = getIntEnv("INTERRUPT_GRACE_WINDOW_MS", 15000)
+	config.DisabledHandlers = getStringArrayEnv("DISABLED_HANDLERS", nil)
+	config.HandlerPriorities = getStringEnv("HANDLER_PRIORITIES", "")
+	config.HandlerRoutes = getStringEnv("HANDLER_ROUTES", "")
 	config.EnableTimeContext = getBoolEnv("ENABLE_TIME_CONTEXT", true)
 	config.TimeContextTimezone = getStringEnv("TIME_CONTEXT_TIMEZONE", "Asia/Shanghai")
 	config.TimeContextFormat = getStringEnv("TIME_CONTEXT_FORMAT", "2006-01-02 15:04:05")
@@ -170,18 +306,41 @@ func init() {
 	config.ImageAssetDir = getStringEnv("IMAGE_ASSET_DIR", "./assets/images")
 	config.ImageAssetIndexFile = getStringEnv("IMAGE_ASSET_INDEX_FILE", "./assets/images/index.json")
 
-	cm, err := character.NewCharacterManager(getCharacterConfigDir(), config.Character)
+	// 未设置角色时先不加载，由启动入口拒绝启动
+	if config.Character == "" {
+		utils.Warn("CHARACTER not set, character config not loaded")
+		return
+	}
+	characterManager, err := character.NewCharacterManager(getCharacterConfigDir(), config.Character)
 	if err != nil {
 		utils.Error("Failed to create character manager: %v", err)
 		os.Exit(1)
 	}
-	config.AiPrompt += cm.GetPrompt()
+	setCharacterManager(characterManager)
+	config.AiPrompt += characterManager.GetPrompt()
 }
 
 func GetConfig() *Config {
 	return config
 }
 
+// GetCharacterConfig 返回当前生效的角色配置。角色被重新加载后会返回新的指针，
+// 调用方可据此判断是否需要重建缓存。
+func GetCharacterConfig() *character.CharacterConfig {
+	cmMu.RLock()
+	defer cmMu.RUnlock()
+	if cm == nil {
+		return nil
+	}
+	return cm.GetConfig()
+}
+
+func setCharacterManager(manager *character.CharacterManager) {
+	cmMu.Lock()
+	cm = manager
+	cmMu.Unlock()
+}
+
 func getStringEnv(key string, defaultValue string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -214,6 +373,18 @@ func getIntEnv(key string, defaultValue int) int {
 	return result
 }
 
+func getInt64Env(key string, defaultValue int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	result, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return result
+}
+
 func getFloatEnv(key string, defaultValue float64) float64 {
 	value := os.Getenv(key)
 	if value == "" {
@@ -247,3 +418,19 @@ func getIntArrayEnv(key string, defaultValue []int) []int {
 
 	return result
 }
+
+func getStringArrayEnv(key string, defaultValue []string) []string {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	parts := strings.Split(value, ",")
+	result := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
@@ -34,8 +34,57 @@ func ReloadRuntimeConfig() error {
 		return fmt.Errorf("load ai profile config failed: %w", err)
 	}
 
+	config.EnableAIStream = getBoolEnv("ENABLE_AI_STREAM", config.EnableAIStream)
+	config.EnableAITools = getBoolEnv("ENABLE_AI_TOOLS", config.EnableAITools)
+	config.AiToolMaxRounds = getIntEnv("AI_TOOL_MAX_ROUNDS", config.AiToolMaxRounds)
+	config.AiToolTimeoutMs = getIntEnv("AI_TOOL_TIMEOUT_MS", config.AiToolTimeoutMs)
+	config.EnableAIJSONSchema = getBoolEnv("ENABLE_AI_JSON_SCHEMA", config.EnableAIJSONSchema)
+	config.AiBreakerFailures = getIntEnv("AI_BREAKER_FAILURES", config.AiBreakerFailures)
+	config.AiBreakerCooldownSec = getIntEnv("AI_BREAKER_COOLDOWN_SEC", config.AiBreakerCooldownSec)
+	config.EnableReminders = getBoolEnv("ENABLE_REMINDERS", config.EnableReminders)
+	config.AiDailyTokenBudget = getIntEnv("AI_DAILY_TOKEN_BUDGET", config.AiDailyTokenBudget)
+	config.AiMonthlyTokenBudget = getIntEnv("AI_MONTHLY_TOKEN_BUDGET", config.AiMonthlyTokenBudget)
+	config.AiDailyCostBudget = getFloatEnv("AI_DAILY_COST_BUDGET", config.AiDailyCostBudget)
+	config.AiMonthlyCostBudget = getFloatEnv("AI_MONTHLY_COST_BUDGET", config.AiMonthlyCostBudget)
+	config.AiBudgetPolicy = getStringEnv("AI_BUDGET_POLICY", config.AiBudgetPolicy)
+	config.AiBudgetProfile = getStringEnv("AI_BUDGET_PROFILE", config.AiBudgetProfile)
+	config.EnableAIAudit = getBoolEnv("ENABLE_AI_AUDIT", config.EnableAIAudit)
+	config.AiAuditMaxFileMB = getIntEnv("AI_AUDIT_MAX_FILE_MB", config.AiAuditMaxFileMB)
+	config.AiAuditMaxFiles = getIntEnv("AI_AUDIT_MAX_FILES", config.AiAuditMaxFiles)
+	config.AiAuditRedact = getStringArrayEnv("AI_AUDIT_REDACT", config.AiAuditRedact)
 	config.EnableNaturalScheduler = getBoolEnv("ENABLE_NATURAL_SCHEDULER", config.EnableNaturalScheduler)
 	config.EnableEmotionalMemory = getBoolEnv("ENABLE_EMOTIONAL_MEMORY", config.EnableEmotionalMemory)
+	config.EnableLLMMemoryExtract = getBoolEnv("ENABLE_LLM_MEMORY_EXTRACT", config.EnableLLMMemoryExtract)
+	config.MemoryExtractBatchSize = getIntEnv("MEMORY_EXTRACT_BATCH_SIZE", config.MemoryExtractBatchSize)
+	config.MemoryExtractBatchWaitSec = getIntEnv("MEMORY_EXTRACT_BATCH_WAIT_SEC", config.MemoryExtractBatchWaitSec)
+	config.MemoryExtractMinConfidence = getFloatEnv("MEMORY_EXTRACT_MIN_CONFIDENCE", config.MemoryExtractMinConfidence)
+	config.EnableFactDecay = getBoolEnv("ENABLE_FACT_DECAY", config.EnableFactDecay)
+	config.FactMinConfidence = getFloatEnv("FACT_MIN_CONFIDENCE", config.FactMinConfidence)
+	config.EnableFactConfirmation = getBoolEnv("ENABLE_FACT_CONFIRMATION", config.EnableFactConfirmation)
+	config.FactConfirmBelow = getFloatEnv("FACT_CONFIRM_BELOW", config.FactConfirmBelow)
+	config.EmbeddingProvider = getStringEnv("EMBEDDING_PROVIDER", config.EmbeddingProvider)
+	config.EmbeddingProfile = getStringEnv("EMBEDDING_PROFILE", config.EmbeddingProfile)
+	config.EmbeddingModel = getStringEnv("EMBEDDING_MODEL", config.EmbeddingModel)
+	config.EmbeddingDimensions = getIntEnv("EMBEDDING_DIMENSIONS", config.EmbeddingDimensions)
+	config.EmbeddingTimeoutMs = getIntEnv("EMBEDDING_TIMEOUT_MS", config.EmbeddingTimeoutMs)
+	config.EmbeddingMinSimilarity = getFloatEnv("EMBEDDING_MIN_SIMILARITY", config.EmbeddingMinSimilarity)
+	config.EnableAffinity = getBoolEnv("ENABLE_AFFINITY", config.EnableAffinity)
+	config.AffinityStageThresholds = getIntArrayEnv("AFFINITY_STAGE_THRESHOLDS", config.AffinityStageThresholds)
+	config.EnableMoodCheckIn = getBoolEnv("ENABLE_MOOD_CHECKIN", config.EnableMoodCheckIn)
+	config.MoodDistressDays = getIntEnv("MOOD_DISTRESS_DAYS", config.MoodDistressDays)
+	config.EnableCrisisDetection = getBoolEnv("ENABLE_CRISIS_DETECTION", config.EnableCrisisDetection)
+	config.EnableCrisisModelCheck = getBoolEnv("ENABLE_CRISIS_MODEL_CHECK", config.EnableCrisisModelCheck)
+	config.CrisisTriggerScore = getFloatEnv("CRISIS_TRIGGER_SCORE", config.CrisisTriggerScore)
+	config.CrisisReviewScore = getFloatEnv("CRISIS_REVIEW_SCORE", config.CrisisReviewScore)
+	config.CrisisGuardHours = getIntEnv("CRISIS_GUARD_HOURS", config.CrisisGuardHours)
+	config.CrisisReplyTemplate = getStringEnv("CRISIS_REPLY_TEMPLATE", config.CrisisReplyTemplate)
+	config.CrisisHotlines = getStringEnv("CRISIS_HOTLINES", config.CrisisHotlines)
+	config.CrisisAlertQQ = getInt64Env("CRISIS_ALERT_QQ", config.CrisisAlertQQ)
+	config.CrisisAlertWebhook = getStringEnv("CRISIS_ALERT_WEBHOOK", config.CrisisAlertWebhook)
+	config.EnableEpisodicMemory = getBoolEnv("ENABLE_EPISODIC_MEMORY", config.EnableEpisodicMemory)
+	config.EpisodeIdleGapMin = getIntEnv("EPISODE_IDLE_GAP_MIN", config.EpisodeIdleGapMin)
+	config.EpisodeMinUserTurns = getIntEnv("EPISODE_MIN_USER_TURNS", config.EpisodeMinUserTurns)
+	config.EpisodePromptLimit = getIntEnv("EPISODE_PROMPT_LIMIT", config.EpisodePromptLimit)
 	config.ActiveHours = getIntArrayEnv("ACTIVE_HOURS", config.ActiveHours)
 	config.SleepHours = getIntArrayEnv("SLEEP_HOURS", config.SleepHours)
 	config.BaseInterval = getIntEnv("BASE_INTERVAL", config.BaseInterval)
@@ -54,6 +103,11 @@ func ReloadRuntimeConfig() error {
 	config.MessageAggregateIdleWindowMs = getIntEnv("MESSAGE_AGGREGATE_IDLE_WINDOW_MS", config.MessageAggregateIdleWindowMs)
 	config.MessageAggregateMaxWindowMs = getIntEnv("MESSAGE_AGGREGATE_MAX_WINDOW_MS", config.MessageAggregateMaxWindowMs)
 	config.MessageAggregateMaxMessages = getIntEnv("MESSAGE_AGGREGATE_MAX_MESSAGES", config.MessageAggregateMaxMessages)
+	config.EnableInterruptMerge = getBoolEnv("ENABLE_INTERRUPT_MERGE", config.EnableInterruptMerge)
+	config.InterruptGraceWindowMs = getIntEnv("INTERRUPT_GRACE_WINDOW_MS", config.InterruptGraceWindowMs)
+	config.DisabledHandlers = getStringArrayEnv("DISABLED_HANDLERS", config.DisabledHandlers)
+	config.HandlerPriorities = getStringEnv("HANDLER_PRIORITIES", config.HandlerPriorities)
+	config.HandlerRoutes = getStringEnv("HANDLER_ROUTES", config.HandlerRoutes)
 	config.EnableTimeContext = getBoolEnv("ENABLE_TIME_CONTEXT", config.EnableTimeContext)
 	config.TimeContextTimezone = getStringEnv("TIME_CONTEXT_TIMEZONE", config.TimeContextTimezone)
 	config.TimeContextFormat = getStringEnv("TIME_CONTEXT_FORMAT", config.TimeContextFormat)
@@ -71,8 +125,8 @@ func ReloadRuntimeConfig() error {
 	if err != nil {
 		return fmt.Errorf("reload character config failed: %w", err)
 	}
-	cm = characterManager
-	config.AiPrompt = systemBasePrompt + os.Getenv("AI_PROMPT") + cm.GetPrompt()
+	setCharacterManager(characterManager)
+	config.AiPrompt = systemBasePrompt + os.Getenv("AI_PROMPT") + characterManager.GetPrompt()
 
 	if err := utils.ConfigureDefaultLogger(
 		utils.ParseLogLevel(config.LogLevel),
@@ -119,6 +119,9 @@ func WriteMessage(conn *websocket.Conn, messageType int, payload []byte) error {
 
 	select {
 	case err := <-req.result:
+		if tap := loadTap(); tap != nil && err == nil && messageType == websocket.TextMessage {
+			tap.Sent(req.payload)
+		}
 		return err
 	case <-writer.stopCh:
 		return errOutboundClosed
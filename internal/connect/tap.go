@@ -0,0 +1,40 @@
+package connect
+
+import (
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// Tap 观察连接上收发的原始帧，录制回放时使用。回调在读写协程里同步执行，实现需要尽快返回。
+type Tap interface {
+	Received(frame []byte)
+	Sent(frame []byte)
+}
+
+type tapHolder struct {
+	tap Tap
+}
+
+var currentTap atomic.Value
+
+// SetTap 设置帧观察者，传 nil 取消。
+func SetTap(tap Tap) {
+	currentTap.Store(tapHolder{tap: tap})
+}
+
+func loadTap() Tap {
+	holder, _ := currentTap.Load().(tapHolder)
+	return holder.tap
+}
+
+// ReadMessage 读取一帧并交给观察者。
+func ReadMessage(conn *websocket.Conn) (int, []byte, error) {
+	messageType, payload, err := conn.ReadMessage()
+	if err == nil {
+		if tap := loadTap(); tap != nil {
+			tap.Received(payload)
+		}
+	}
+	return messageType, payload, err
+}
@@ -0,0 +1,147 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"project-yume/internal/config"
+	"project-yume/internal/metrics"
+	"project-yume/internal/utils"
+)
+
+const (
+	ProviderHash   = "hash"
+	ProviderOpenAI = "openai"
+
+	defaultHashDimensions = 256
+	defaultTimeout        = 3 * time.Second
+)
+
+// Embedder 把文本转成向量。Name 标识模型与维度，变化后已有向量视为过期。
+type Embedder interface {
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+var (
+	currentMu  sync.Mutex
+	currentKey string
+	current    Embedder
+	override   Embedder
+)
+
+// Current 按当前配置返回嵌入器，未启用时返回 nil。配置变化后自动重建。
+func Current() Embedder {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	if override != nil {
+		return override
+	}
+
+	cfg := config.GetConfig()
+	provider := strings.ToLower(strings.TrimSpace(cfg.EmbeddingProvider))
+	key := strings.Join([]string{provider, cfg.EmbeddingProfile, cfg.EmbeddingModel, fmt.Sprint(cfg.EmbeddingDimensions)}, "|")
+	if key == currentKey {
+		return current
+	}
+
+	currentKey = key
+	current = nil
+	switch provider {
+	case "":
+	case ProviderHash:
+		dims := cfg.EmbeddingDimensions
+		if dims <= 0 {
+			dims = defaultHashDimensions
+		}
+		current = NewHashEmbedder(dims)
+	case ProviderOpenAI:
+		profileName := cfg.EmbeddingProfile
+		if profileName == "" {
+			profileName = cfg.AiProfile
+		}
+		profile, ok := config.GetAIProfile(profileName)
+		if !ok {
+			utils.Warn("embedding profile not found, semantic retrieval disabled: %s", profileName)
+			break
+		}
+		current = NewOpenAIEmbedder(profile, cfg.EmbeddingModel, cfg.EmbeddingDimensions)
+	default:
+		utils.Warn("unknown EMBEDDING_PROVIDER %q, semantic retrieval disabled", provider)
+	}
+	return current
+}
+
+// SetEmbedder 固定使用某个嵌入器，传 nil 恢复按配置选择。供测试与离线工具使用。
+func SetEmbedder(e Embedder) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	override = e
+	currentKey = ""
+	current = nil
+}
+
+// Embed 带超时与指标地调用嵌入器，返回的向量已归一化。
+func Embed(ctx context.Context, e Embedder, texts []string) ([][]float32, error) {
+	timeout := time.Duration(config.GetConfig().EmbeddingTimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	startedAt := time.Now()
+	vectors, err := e.Embed(callCtx, texts)
+	if err == nil && len(vectors) != len(texts) {
+		err = fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(texts))
+	}
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	labels := map[string]string{"embedder": e.Name(), "result": result}
+	metrics.IncCounter("bot_embedding_requests_total", "Total embedding requests by embedder and result.", labels)
+	metrics.ObserveDuration("bot_embedding_duration_seconds", "Embedding request latency.", time.Since(startedAt), labels)
+	if err != nil {
+		return nil, err
+	}
+	for _, vector := range vectors {
+		normalize(vector)
+	}
+	return vectors, nil
+}
+
+// Cosine 两个向量的余弦相似度，维度不同或为零向量时返回 0。
+func Cosine(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+func normalize(vector []float32) {
+	var sum float64
+	for _, value := range vector {
+		sum += float64(value) * float64(value)
+	}
+	if sum == 0 {
+		return
+	}
+	scale := float32(1 / math.Sqrt(sum))
+	for i := range vector {
+		vector[i] *= scale
+	}
+}
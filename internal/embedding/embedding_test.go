@@ -0,0 +1,25 @@
+package embedding
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHashEmbedderRanksOverlappingTextHigher(t *testing.T) {
+	embedder := NewHashEmbedder(256)
+	vectors, err := Embed(context.Background(), embedder, []string{"用户养了一只猫", "我家的猫今天生病了", "明天要去上海出差"})
+	if err != nil {
+		t.Fatalf("Embed returned error: %v", err)
+	}
+	related := Cosine(vectors[0], vectors[1])
+	unrelated := Cosine(vectors[0], vectors[2])
+	if related <= unrelated {
+		t.Fatalf("expected overlapping text to score higher: related=%.3f unrelated=%.3f", related, unrelated)
+	}
+
+	again, _ := embedder.Embed(context.Background(), []string{"用户养了一只猫"})
+	normalize(again[0])
+	if Cosine(vectors[0], again[0]) < 0.9999 {
+		t.Fatalf("hash embedder should be deterministic")
+	}
+}
@@ -0,0 +1,83 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// HashEmbedder 离线可用的确定性嵌入：字符一元、二元组与英文单词哈希到固定维度。
+// 只能识别字面相近的说法，换种说法的语义匹配需要真正的嵌入模型。
+type HashEmbedder struct {
+	dims int
+}
+
+func NewHashEmbedder(dims int) *HashEmbedder {
+	if dims <= 0 {
+		dims = defaultHashDimensions
+	}
+	return &HashEmbedder{dims: dims}
+}
+
+func (h *HashEmbedder) Name() string {
+	return fmt.Sprintf("hash-%d", h.dims)
+}
+
+func (h *HashEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = h.vector(text)
+	}
+	return vectors, nil
+}
+
+func (h *HashEmbedder) vector(text string) []float32 {
+	vector := make([]float32, h.dims)
+	for _, feature := range hashFeatures(text) {
+		hasher := fnv.New64a()
+		hasher.Write([]byte(feature))
+		sum := hasher.Sum64()
+		index := int(sum % uint64(h.dims))
+		// 高位决定符号，减少不同特征落在同一维时的互相抬高
+		if sum>>63 == 1 {
+			vector[index]--
+		} else {
+			vector[index]++
+		}
+	}
+	return vector
+}
+
+// hashFeatures 汉字等按字取一元和二元组，字母数字连续段按整词取，标点与空白断开。
+func hashFeatures(text string) []string {
+	var features []string
+	var word []rune
+	var prev rune
+	flushWord := func() {
+		if len(word) > 0 {
+			features = append(features, "w:"+string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			word = append(word, r)
+			prev = 0
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushWord()
+			features = append(features, "u:"+string(r))
+			if prev != 0 {
+				features = append(features, "b:"+string([]rune{prev, r}))
+			}
+			prev = r
+		default:
+			flushWord()
+			prev = 0
+		}
+	}
+	flushWord()
+	return features
+}
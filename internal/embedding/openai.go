@@ -0,0 +1,66 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"project-yume/internal/config"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const defaultOpenAIModel = "text-embedding-3-small"
+
+// OpenAIEmbedder 调用 OpenAI 兼容的 /embeddings 接口，地址与密钥取自模型配置。
+type OpenAIEmbedder struct {
+	client     *openai.Client
+	model      string
+	dimensions int
+}
+
+func NewOpenAIEmbedder(profile config.AIProfile, model string, dimensions int) *OpenAIEmbedder {
+	if strings.TrimSpace(model) == "" {
+		model = defaultOpenAIModel
+	}
+	clientConfig := openai.DefaultConfig(profile.AIKey)
+	if profile.AIBaseURL != "" {
+		clientConfig.BaseURL = profile.AIBaseURL
+	}
+	return &OpenAIEmbedder{
+		client:     openai.NewClientWithConfig(clientConfig),
+		model:      model,
+		dimensions: dimensions,
+	}
+}
+
+func (o *OpenAIEmbedder) Name() string {
+	if o.dimensions > 0 {
+		return fmt.Sprintf("%s-%d", o.model, o.dimensions)
+	}
+	return o.model
+}
+
+func (o *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	resp, err := o.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input:      texts,
+		Model:      openai.EmbeddingModel(o.model),
+		Dimensions: o.dimensions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create embeddings failed: %w", err)
+	}
+	vectors := make([][]float32, len(texts))
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding index out of range: %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	for i, vector := range vectors {
+		if len(vector) == 0 {
+			return nil, fmt.Errorf("missing embedding for input %d", i)
+		}
+	}
+	return vectors, nil
+}
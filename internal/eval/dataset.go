@@ -0,0 +1,159 @@
+package eval
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"project-yume/internal/service"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Fields 参与评分的字段，按报告中的顺序排列。
+var Fields = []string{"emotion", "intention", "wanna_bye", "reply_mode"}
+
+// Labels 标注或预测的字段值，空字符串表示未标注。
+type Labels struct {
+	Emotion   string `json:"emotion,omitempty"`
+	Intention string `json:"intention,omitempty"`
+	WannaBye  string `json:"wanna_bye,omitempty"`
+	ReplyMode string `json:"reply_mode,omitempty"`
+}
+
+func (l Labels) get(field string) string {
+	switch field {
+	case "emotion":
+		return l.Emotion
+	case "intention":
+		return l.Intention
+	case "wanna_bye":
+		return l.WannaBye
+	case "reply_mode":
+		return l.ReplyMode
+	}
+	return ""
+}
+
+func labelsOf(result service.MessageAnalysis) Labels {
+	return Labels{
+		Emotion:   result.Emotion,
+		Intention: result.Intention,
+		WannaBye:  result.WannaBye,
+		ReplyMode: string(result.ReplyMode),
+	}
+}
+
+// Turn 用例里的一条历史对话。
+type Turn struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Case 数据集中的一条用例。
+type Case struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	// Mode default 或 long_chat，为空按 default。
+	Mode    string `json:"mode,omitempty"`
+	History []Turn `json:"history,omitempty"`
+	// Time 消息时间(RFC3339)，影响提示词里的时间上下文，为空用运行时间。
+	Time   string `json:"time,omitempty"`
+	Expect Labels `json:"expect"`
+}
+
+// LoadDataset 读取 JSONL 数据集，空行和 # 开头的行跳过。
+func LoadDataset(path string) ([]Case, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var cases []Case
+	seen := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var c Case
+		if err := json.Unmarshal([]byte(text), &c); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if c.ID == "" {
+			c.ID = fmt.Sprintf("line-%d", line)
+		}
+		if _, ok := seen[c.ID]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate id %q", path, line, c.ID)
+		}
+		seen[c.ID] = struct{}{}
+		cases = append(cases, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("%s: empty dataset", path)
+	}
+	return cases, nil
+}
+
+func (c Case) validate() error {
+	if strings.TrimSpace(c.Message) == "" {
+		return fmt.Errorf("message is required")
+	}
+	switch service.AnalysisMode(c.Mode) {
+	case "", service.AnalysisModeDefault, service.AnalysisModeLongChat, service.AnalysisModeGuarded:
+	default:
+		return fmt.Errorf("unknown mode %q", c.Mode)
+	}
+	if c.Time != "" {
+		if _, err := time.Parse(time.RFC3339, c.Time); err != nil {
+			return fmt.Errorf("invalid time: %w", err)
+		}
+	}
+	labeled := false
+	for _, field := range Fields {
+		if c.Expect.get(field) != "" {
+			labeled = true
+		}
+	}
+	if !labeled {
+		return fmt.Errorf("expect has no labels")
+	}
+	return nil
+}
+
+// input 转成分析输入，每条用例用独立的会话，互不影响。
+func (c Case) input() service.AnalysisInput {
+	mode := service.AnalysisMode(c.Mode)
+	if mode == "" {
+		mode = service.AnalysisModeDefault
+	}
+	referenceTime := time.Now()
+	if c.Time != "" {
+		referenceTime, _ = time.Parse(time.RFC3339, c.Time)
+	}
+	conversation := make([]openai.ChatCompletionMessage, 0, len(c.History))
+	for _, turn := range c.History {
+		conversation = append(conversation, openai.ChatCompletionMessage{Role: turn.Role, Content: turn.Content})
+	}
+	return service.AnalysisInput{
+		Mode:          mode,
+		SessionID:     "eval:" + c.ID,
+		Message:       c.Message,
+		Conversation:  conversation,
+		ReferenceTime: referenceTime,
+	}
+}
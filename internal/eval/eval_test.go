@@ -0,0 +1,82 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"project-yume/internal/service"
+)
+
+func TestLoadDatasetRejectsDuplicateIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cases.jsonl")
+	data := "# comment\n" +
+		`{"id":"a","message":"hi","expect":{"emotion":"开心"}}` + "\n" +
+		`{"id":"a","message":"hey","expect":{"emotion":"开心"}}` + "\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write dataset: %v", err)
+	}
+	if _, err := LoadDataset(path); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Fatalf("expected duplicate id error, got %v", err)
+	}
+}
+
+func stubAnalyzer(answers map[string]service.MessageAnalysis) Analyzer {
+	return func(_ context.Context, input service.AnalysisInput) (service.MessageAnalysis, error) {
+		answer, ok := answers[input.Message]
+		if !ok {
+			return service.MessageAnalysis{}, errors.New("upstream down")
+		}
+		return answer, nil
+	}
+}
+
+func TestRunScoresFieldsAndComparesVersions(t *testing.T) {
+	cases := []Case{
+		{ID: "happy", Message: "好开心", Expect: Labels{Emotion: "开心", WannaBye: "想继续"}},
+		{ID: "sad", Message: "好难过", Expect: Labels{Emotion: "难过"}},
+		{ID: "down", Message: "挂了", Expect: Labels{Emotion: "中性"}},
+	}
+	a := Run(context.Background(), cases, Options{Name: "a", Concurrency: 2, Analyze: stubAnalyzer(map[string]service.MessageAnalysis{
+		"好开心": {Emotion: "开心", WannaBye: "想继续"},
+		"好难过": {Emotion: "中性"},
+	})})
+	emotion := a.Fields["emotion"]
+	if emotion.Labeled != 3 || emotion.Correct != 1 {
+		t.Fatalf("unexpected emotion stats: %+v", emotion)
+	}
+	if emotion.Confusion["难过"]["中性"] != 1 || emotion.Confusion["中性"]["-"] != 1 {
+		t.Fatalf("unexpected confusion: %+v", emotion.Confusion)
+	}
+	if a.Fields["wanna_bye"].Accuracy != 1 {
+		t.Fatalf("unexpected wanna_bye accuracy: %+v", a.Fields["wanna_bye"])
+	}
+	if a.Outcomes["ok"] != 2 || a.Outcomes["error"] != 1 {
+		t.Fatalf("unexpected outcomes: %+v", a.Outcomes)
+	}
+	if a.Cases[2].ID != "down" {
+		t.Fatalf("results should keep dataset order, got %s", a.Cases[2].ID)
+	}
+
+	b := Run(context.Background(), cases, Options{Name: "b", Analyze: stubAnalyzer(map[string]service.MessageAnalysis{
+		"好开心": {Emotion: "中性", WannaBye: "想继续"},
+		"好难过": {Emotion: "难过"},
+	})})
+	flips := Flips(a, b)
+	if len(flips) != 2 {
+		t.Fatalf("expected 2 flips, got %+v", flips)
+	}
+	if flips[0].ID != "happy" || flips[0].FixedInB || flips[1].ID != "sad" || !flips[1].FixedInB {
+		t.Fatalf("unexpected flips: %+v", flips)
+	}
+
+	var out bytes.Buffer
+	WriteComparison(&out, a, b)
+	if !strings.Contains(out.String(), "sad  emotion fixed") {
+		t.Fatalf("comparison should list flips:\n%s", out.String())
+	}
+}
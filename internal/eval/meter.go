@@ -0,0 +1,108 @@
+package eval
+
+import (
+	"context"
+	"sync"
+
+	"project-yume/internal/aifunction"
+	"project-yume/internal/config"
+	"project-yume/internal/usage"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// meter 累计一条用例发出的模型调用的 token 与费用。
+type meter struct {
+	mu               sync.Mutex
+	calls            int
+	promptTokens     int
+	completionTokens int
+	cost             float64
+}
+
+func (m *meter) add(profile config.AIProfile, reported *openai.Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if reported == nil {
+		return
+	}
+	m.promptTokens += reported.PromptTokens
+	m.completionTokens += reported.CompletionTokens
+	m.cost += usage.Cost(profile.InputPrice, profile.OutputPrice, reported.PromptTokens, reported.CompletionTokens)
+}
+
+type meterKey struct{}
+
+func withMeter(ctx context.Context, m *meter) context.Context {
+	return context.WithValue(ctx, meterKey{}, m)
+}
+
+func meterFrom(ctx context.Context) *meter {
+	m, _ := ctx.Value(meterKey{}).(*meter)
+	return m
+}
+
+// InstallMeter 包装模型客户端，按请求 ctx 上的计量器统计用量。服务端没返回用量时不计 token。
+func InstallMeter() {
+	aifunction.SetProviderHook(func(_ string, profile config.AIProfile, next aifunction.Provider) aifunction.Provider {
+		return meteredProvider{profile: profile, next: next}
+	})
+}
+
+type meteredProvider struct {
+	profile config.AIProfile
+	next    aifunction.Provider
+}
+
+func (p meteredProvider) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	resp, err := p.next.CreateChatCompletion(ctx, request)
+	if m := meterFrom(ctx); m != nil {
+		if err != nil {
+			m.add(p.profile, nil)
+		} else {
+			m.add(p.profile, &resp.Usage)
+		}
+	}
+	return resp, err
+}
+
+func (p meteredProvider) CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (aifunction.ChatStream, error) {
+	stream, err := p.next.CreateChatCompletionStream(ctx, request)
+	m := meterFrom(ctx)
+	if err != nil || m == nil {
+		if err != nil && m != nil {
+			m.add(p.profile, nil)
+		}
+		return stream, err
+	}
+	return &meteredStream{ChatStream: stream, meter: m, profile: p.profile}, nil
+}
+
+type meteredStream struct {
+	aifunction.ChatStream
+	meter   *meter
+	profile config.AIProfile
+	usage   *openai.Usage
+	once    sync.Once
+}
+
+func (s *meteredStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	chunk, err := s.ChatStream.Recv()
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+	if err != nil {
+		s.finish()
+	}
+	return chunk, err
+}
+
+func (s *meteredStream) Close() error {
+	s.finish()
+	return s.ChatStream.Close()
+}
+
+func (s *meteredStream) finish() {
+	s.once.Do(func() { s.meter.add(s.profile, s.usage) })
+}
@@ -0,0 +1,204 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteText 输出单个版本的报告：总览、各字段准确率与混淆矩阵、答错的用例。
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "== %s (%d cases)\n", r.Name, len(r.Cases))
+	r.writeSummary(w)
+
+	for _, field := range Fields {
+		stats := r.Fields[field]
+		if stats.Labeled == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n-- %s  %d/%d  %.1f%%\n", field, stats.Correct, stats.Labeled, stats.Accuracy*100)
+		writeConfusion(w, stats.Confusion)
+	}
+
+	var misses []string
+	for _, result := range r.Cases {
+		if line := missLine(result); line != "" {
+			misses = append(misses, line)
+		}
+	}
+	if len(misses) > 0 {
+		fmt.Fprintf(w, "\n-- misses (%d)\n", len(misses))
+		for _, line := range misses {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+func (r *Report) writeSummary(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "outcomes\t%s\n", formatOutcomes(r.Outcomes))
+	fmt.Fprintf(tw, "latency\tavg %dms  p50 %dms  p95 %dms  max %dms\n", r.Latency.AvgMs, r.Latency.P50Ms, r.Latency.P95Ms, r.Latency.MaxMs)
+	fmt.Fprintf(tw, "tokens\t%d calls  prompt %d  completion %d\n", r.Calls, r.PromptTokens, r.CompletionTokens)
+	fmt.Fprintf(tw, "cost\t%.6f\n", r.Cost)
+	tw.Flush()
+}
+
+// writeConfusion 行为标注值，列为预测值，"-" 列表示没拿到预测(报错或字段为空)。
+func writeConfusion(w io.Writer, confusion map[string]map[string]int) {
+	rows := make([]string, 0, len(confusion))
+	columnSet := make(map[string]struct{})
+	for expected, predicted := range confusion {
+		rows = append(rows, expected)
+		columnSet[expected] = struct{}{}
+		for label := range predicted {
+			columnSet[label] = struct{}{}
+		}
+	}
+	sort.Strings(rows)
+	columns := make([]string, 0, len(columnSet))
+	for label := range columnSet {
+		if label != "-" {
+			columns = append(columns, label)
+		}
+	}
+	sort.Strings(columns)
+	if _, ok := columnSet["-"]; ok {
+		columns = append(columns, "-")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "expected\\predicted\t")
+	for _, column := range columns {
+		fmt.Fprintf(tw, "%s\t", column)
+	}
+	fmt.Fprintln(tw)
+	for _, row := range rows {
+		fmt.Fprintf(tw, "%s\t", row)
+		for _, column := range columns {
+			if count := confusion[row][column]; count > 0 {
+				fmt.Fprintf(tw, "%d\t", count)
+			} else {
+				fmt.Fprint(tw, ".\t")
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
+
+func missLine(result CaseResult) string {
+	if result.Error != "" {
+		return fmt.Sprintf("  %s  error: %s", result.ID, result.Error)
+	}
+	var parts []string
+	for _, field := range Fields {
+		expected := result.Expect.get(field)
+		if expected == "" || result.Correct(field) {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s %s->%s", field, expected, orDash(result.Predicted.get(field))))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("  %s  %s  [%s]", result.ID, strings.Join(parts, ", "), result.Outcome)
+}
+
+// WriteComparison 并排对比两个版本，列出两边判定结果翻转的用例。两份报告须来自同一数据集。
+func WriteComparison(w io.Writer, a, b *Report) {
+	fmt.Fprintf(w, "== %s vs %s (%d cases)\n", a.Name, b.Name, len(a.Cases))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "\t%s\t%s\tdelta\n", a.Name, b.Name)
+	for _, field := range Fields {
+		statsA, statsB := a.Fields[field], b.Fields[field]
+		if statsA.Labeled == 0 && statsB.Labeled == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%.1f%%\t%.1f%%\t%+.1f\n", field, statsA.Accuracy*100, statsB.Accuracy*100, (statsB.Accuracy-statsA.Accuracy)*100)
+	}
+	fmt.Fprintf(tw, "latency avg\t%dms\t%dms\t%+d\n", a.Latency.AvgMs, b.Latency.AvgMs, b.Latency.AvgMs-a.Latency.AvgMs)
+	fmt.Fprintf(tw, "latency p95\t%dms\t%dms\t%+d\n", a.Latency.P95Ms, b.Latency.P95Ms, b.Latency.P95Ms-a.Latency.P95Ms)
+	fmt.Fprintf(tw, "prompt tokens\t%d\t%d\t%+d\n", a.PromptTokens, b.PromptTokens, b.PromptTokens-a.PromptTokens)
+	fmt.Fprintf(tw, "completion tokens\t%d\t%d\t%+d\n", a.CompletionTokens, b.CompletionTokens, b.CompletionTokens-a.CompletionTokens)
+	fmt.Fprintf(tw, "cost\t%.6f\t%.6f\t%+.6f\n", a.Cost, b.Cost, b.Cost-a.Cost)
+	fmt.Fprintf(tw, "outcomes\t%s\t%s\t\n", formatOutcomes(a.Outcomes), formatOutcomes(b.Outcomes))
+	tw.Flush()
+
+	flips := Flips(a, b)
+	if len(flips) == 0 {
+		fmt.Fprintln(w, "\nno flips")
+		return
+	}
+	fmt.Fprintf(w, "\n-- flips (%d)\n", len(flips))
+	for _, flip := range flips {
+		direction := "fixed"
+		if !flip.FixedInB {
+			direction = "broke"
+		}
+		fmt.Fprintf(w, "  %s  %s %s  expected %s  %s: %s  %s: %s\n",
+			flip.ID, flip.Field, direction, flip.Expected, a.Name, orDash(flip.PredictedA), b.Name, orDash(flip.PredictedB))
+	}
+}
+
+// Flip 某条用例的某个字段在两个版本间由对变错或由错变对。
+type Flip struct {
+	ID         string `json:"id"`
+	Field      string `json:"field"`
+	Expected   string `json:"expected"`
+	PredictedA string `json:"predicted_a"`
+	PredictedB string `json:"predicted_b"`
+	// FixedInB 为 true 表示 A 错 B 对。
+	FixedInB bool `json:"fixed_in_b"`
+}
+
+// Flips 按用例 ID 对齐两份报告，找出判定翻转的字段。
+func Flips(a, b *Report) []Flip {
+	byID := make(map[string]CaseResult, len(b.Cases))
+	for _, result := range b.Cases {
+		byID[result.ID] = result
+	}
+	var flips []Flip
+	for _, resultA := range a.Cases {
+		resultB, ok := byID[resultA.ID]
+		if !ok {
+			continue
+		}
+		for _, field := range Fields {
+			correctA, correctB := resultA.Correct(field), resultB.Correct(field)
+			if correctA == correctB {
+				continue
+			}
+			flips = append(flips, Flip{
+				ID:         resultA.ID,
+				Field:      field,
+				Expected:   resultA.Expect.get(field),
+				PredictedA: resultA.Predicted.get(field),
+				PredictedB: resultB.Predicted.get(field),
+				FixedInB:   correctB,
+			})
+		}
+	}
+	return flips
+}
+
+func formatOutcomes(outcomes map[string]int) string {
+	keys := make([]string, 0, len(outcomes))
+	for key := range outcomes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%d", key, outcomes[key]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,205 @@
+package eval
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"project-yume/internal/service"
+)
+
+// Analyzer 被评测的分析函数，默认是 service.AnalyzeMessage。
+type Analyzer func(ctx context.Context, input service.AnalysisInput) (service.MessageAnalysis, error)
+
+// Options 一次评测的参数。
+type Options struct {
+	// Name 报告里的版本名。
+	Name string
+	// Concurrency 并发用例数，默认 4。
+	Concurrency int
+	Analyze     Analyzer
+}
+
+// CaseResult 单条用例的结果。
+type CaseResult struct {
+	ID               string  `json:"id"`
+	Message          string  `json:"message"`
+	Expect           Labels  `json:"expect"`
+	Predicted        Labels  `json:"predicted"`
+	VisibleReply     string  `json:"visible_reply,omitempty"`
+	Outcome          string  `json:"outcome"`
+	Error            string  `json:"error,omitempty"`
+	LatencyMs        int64   `json:"latency_ms"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Correct 该字段已标注且预测一致。
+func (r CaseResult) Correct(field string) bool {
+	expected := r.Expect.get(field)
+	return expected != "" && expected == r.Predicted.get(field)
+}
+
+// FieldStats 单个字段的准确率与混淆矩阵，Confusion[标注][预测] 为条数。
+type FieldStats struct {
+	Labeled   int                       `json:"labeled"`
+	Correct   int                       `json:"correct"`
+	Accuracy  float64                   `json:"accuracy"`
+	Confusion map[string]map[string]int `json:"confusion"`
+}
+
+// LatencyStats 单条用例耗时(毫秒)，包含重试与重问。
+type LatencyStats struct {
+	AvgMs int64 `json:"avg_ms"`
+	P50Ms int64 `json:"p50_ms"`
+	P95Ms int64 `json:"p95_ms"`
+	MaxMs int64 `json:"max_ms"`
+}
+
+// Report 一个版本的评测结果。
+type Report struct {
+	Name             string                 `json:"name"`
+	Cases            []CaseResult           `json:"cases"`
+	Fields           map[string]*FieldStats `json:"fields"`
+	Outcomes         map[string]int         `json:"outcomes"`
+	Latency          LatencyStats           `json:"latency"`
+	Calls            int                    `json:"calls"`
+	PromptTokens     int                    `json:"prompt_tokens"`
+	CompletionTokens int                    `json:"completion_tokens"`
+	Cost             float64                `json:"cost"`
+}
+
+// Run 并发跑完所有用例，结果按数据集顺序排列。ctx 取消时未开始的用例记为 canceled。
+func Run(ctx context.Context, cases []Case, opts Options) *Report {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.Analyze == nil {
+		opts.Analyze = service.AnalyzeMessage
+	}
+
+	results := make([]CaseResult, len(cases))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < opts.Concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results[index] = runCase(ctx, cases[index], opts.Analyze)
+			}
+		}()
+	}
+	for index := range cases {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+
+	return summarize(opts.Name, results)
+}
+
+func runCase(ctx context.Context, c Case, analyze Analyzer) CaseResult {
+	result := CaseResult{ID: c.ID, Message: c.Message, Expect: c.Expect}
+	if err := ctx.Err(); err != nil {
+		result.Outcome = "canceled"
+		result.Error = err.Error()
+		return result
+	}
+
+	m := &meter{}
+	startedAt := time.Now()
+	analysis, err := analyze(withMeter(ctx, m), c.input())
+	result.LatencyMs = time.Since(startedAt).Milliseconds()
+	result.Calls = m.calls
+	result.PromptTokens = m.promptTokens
+	result.CompletionTokens = m.completionTokens
+	result.Cost = m.cost
+	if err != nil {
+		result.Outcome = "error"
+		result.Error = err.Error()
+		return result
+	}
+	result.Predicted = labelsOf(analysis)
+	result.VisibleReply = analysis.VisibleReply
+	result.Outcome = analysis.Outcome
+	if result.Outcome == "" {
+		result.Outcome = "ok"
+	}
+	return result
+}
+
+func summarize(name string, results []CaseResult) *Report {
+	report := &Report{
+		Name:     name,
+		Cases:    results,
+		Fields:   make(map[string]*FieldStats, len(Fields)),
+		Outcomes: make(map[string]int),
+	}
+	for _, field := range Fields {
+		report.Fields[field] = &FieldStats{Confusion: make(map[string]map[string]int)}
+	}
+
+	latencies := make([]int64, 0, len(results))
+	var total int64
+	for _, result := range results {
+		report.Outcomes[result.Outcome]++
+		report.Calls += result.Calls
+		report.PromptTokens += result.PromptTokens
+		report.CompletionTokens += result.CompletionTokens
+		report.Cost += result.Cost
+		latencies = append(latencies, result.LatencyMs)
+		total += result.LatencyMs
+
+		for _, field := range Fields {
+			expected := result.Expect.get(field)
+			if expected == "" {
+				continue
+			}
+			stats := report.Fields[field]
+			stats.Labeled++
+			if result.Correct(field) {
+				stats.Correct++
+			}
+			predicted := result.Predicted.get(field)
+			if predicted == "" {
+				predicted = "-"
+			}
+			if stats.Confusion[expected] == nil {
+				stats.Confusion[expected] = make(map[string]int)
+			}
+			stats.Confusion[expected][predicted]++
+		}
+	}
+	for _, stats := range report.Fields {
+		if stats.Labeled > 0 {
+			stats.Accuracy = float64(stats.Correct) / float64(stats.Labeled)
+		}
+	}
+
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		report.Latency = LatencyStats{
+			AvgMs: total / int64(len(latencies)),
+			P50Ms: percentile(latencies, 0.5),
+			P95Ms: percentile(latencies, 0.95),
+			MaxMs: latencies[len(latencies)-1],
+		}
+	}
+	return report
+}
+
+// percentile 最近秩法，values 已升序。
+func percentile(values []int64, p float64) int64 {
+	rank := int(p*float64(len(values)) + 0.999999)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(values) {
+		rank = len(values)
+	}
+	return values[rank-1]
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/metrics"
+	"project-yume/internal/safety"
+	"project-yume/internal/service"
+	"project-yume/internal/state"
+	"project-yume/internal/usage"
+	"project-yume/internal/utils"
+)
+
+// crisisGentleReply 守护期间预算超出、不能调用模型时的回复。
+const crisisGentleReply = "我在，你慢慢说。$如果现在很难受，可以打求助热线，或者告诉身边信任的人。"
+
+// crisisListeningAck 守护期间模型选了不回复时的替代，不让对方觉得被晾着。
+const crisisListeningAck = "我在听。"
+
+// screenCrisis 在路由之前检测每条消息。命中时直接回复求助信息、进入守护状态并通知管理员，
+// 不再交给其他处理器；未命中时 screened 为 false。
+func (mp *MessageProcessor) screenCrisis(runCtx context.Context, c *websocket.Conn, ctx MessageContext, sm *state.StateManager, record DispatchRecord) (result *ProcessResult, screened bool, err error) {
+	assessment := safety.Assess(runCtx, ctx.Message)
+	if !assessment.Triggered {
+		return nil, false, nil
+	}
+
+	now := clock.Now()
+	guardedUntil := now.Add(time.Duration(max(1, config.GetConfig().CrisisGuardHours)) * time.Hour)
+	sm.Guard(ctx.SessionID, guardedUntil)
+
+	// 求助信息必须完整发出，用户继续输入也不打断
+	reply := safety.ReplyText()
+	_, sendErr := service.SendMsgWithContext(context.WithoutCancel(runCtx), c, ctx.UserID, reply)
+
+	event := safety.GetEventManager().Record(safety.Event{
+		Time:         now,
+		RequestID:    ctx.RequestID,
+		SessionID:    ctx.SessionID,
+		UserID:       ctx.UserID,
+		GroupID:      ctx.GroupID,
+		Message:      ctx.Message,
+		Assessment:   assessment,
+		Reply:        reply,
+		GuardedUntil: guardedUntil,
+	})
+	go safety.Notify(func(userID int64, message string) error {
+		return service.SendMsg(c, userID, message)
+	}, event)
+
+	metrics.IncCounter(
+		"bot_crisis_detections_total",
+		"Total messages that triggered crisis detection by score source.",
+		map[string]string{"source": assessment.Source},
+	)
+	utils.Warnw("crisis detected, session guarded",
+		utils.String("request_id", ctx.RequestID),
+		utils.String("session_id", ctx.SessionID),
+		utils.Int64("user_id", ctx.UserID),
+		utils.String("event_id", event.ID),
+		utils.String("source", assessment.Source),
+		utils.Any("score", assessment.Score),
+		utils.String("guarded_until", guardedUntil.Format(time.RFC3339)),
+	)
+
+	record.Handler = HandlerCrisis
+	if sendErr != nil {
+		result, err = finishHandle(nil, fmt.Errorf("发送求助信息失败: %w", sendErr))
+	} else {
+		result = &ProcessResult{
+			Handled:   true,
+			Replied:   true,
+			Emotion:   "难过",
+			Intention: "想和对方倾诉",
+			ReplyMode: service.ReplyModeFullReply,
+			Reply:     service.BuildAssistantTranscript(reply),
+		}
+	}
+	recordDispatch(record, result, err)
+	return result, true, err
+}
+
+// CrisisHandler 守护期间的回复：照常做结构化分析，但换用更严格的提示词，不开放工具。
+type CrisisHandler struct{}
+
+func NewCrisisHandler() *CrisisHandler {
+	return &CrisisHandler{}
+}
+
+func (h *CrisisHandler) CanHandle(ctx MessageContext, sm *state.StateManager) bool {
+	return true
+}
+
+func (h *CrisisHandler) Handle(runCtx context.Context, c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (*ProcessResult, error) {
+	if usage.GetManager().Budget(clock.Now()).PresetOnly() {
+		if sent, err := service.SendMsgWithContext(runCtx, c, ctx.UserID, crisisGentleReply); err != nil {
+			return interruptedResult(sent, err)
+		}
+		return &ProcessResult{
+			Handled:   true,
+			Replied:   true,
+			ReplyMode: service.ReplyModeFullReply,
+			Reply:     service.BuildAssistantTranscript(crisisGentleReply),
+		}, nil
+	}
+
+	streamer := service.NewReplyStreamer(runCtx, c, ctx.UserID)
+	analysis, err := service.AnalyzeMessage(runCtx, service.AnalysisInput{
+		Mode:          service.AnalysisModeGuarded,
+		SessionID:     ctx.SessionID,
+		UserID:        ctx.UserID,
+		Message:       ctx.Message,
+		Conversation:  sm.GetConversation(ctx.SessionID),
+		ReferenceTime: ctx.ReceivedAt,
+		OnReplyDelta:  streamer.Callback(),
+	})
+	if err != nil {
+		if sent, _ := streamer.Close(false); len(sent) > 0 {
+			return interruptedResult(sent, err)
+		}
+		return nil, fmt.Errorf("分析消息失败: %w", err)
+	}
+
+	if analysis.ReplyMode == service.ReplyModeNoReply {
+		analysis.ReplyMode = service.ReplyModeLightAck
+		analysis.VisibleReply = crisisListeningAck
+	}
+	return applyStructuredReply(runCtx, c, ctx, sm, analysis, streamer, false)
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/safety"
+	"project-yume/internal/state"
+)
+
+func routesTo(route []HandlerSpec, name string) bool {
+	for _, spec := range route {
+		if spec.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestScreenCrisisGuardsSessionAndRecordsEvent(t *testing.T) {
+	cfg := config.GetConfig()
+	if cfg.CrisisAlertQQ != 0 || cfg.CrisisAlertWebhook != "" {
+		t.Skip("crisis alerts are configured, screening would notify real admins")
+	}
+	// 只恢复改过的字段，异步通知还会读配置
+	detection, modelCheck, trigger, guardHours := cfg.EnableCrisisDetection, cfg.EnableCrisisModelCheck, cfg.CrisisTriggerScore, cfg.CrisisGuardHours
+	start := time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	// 发送前的打字间隔立即走完
+	fake.OnSchedule(func() { fake.Advance(3 * time.Second) })
+	clock.Set(fake)
+	const userID = 50501
+	sm := state.GetManager()
+	t.Cleanup(func() {
+		cfg.EnableCrisisDetection, cfg.EnableCrisisModelCheck, cfg.CrisisTriggerScore, cfg.CrisisGuardHours = detection, modelCheck, trigger, guardHours
+		clock.Set(nil)
+		sm.DeleteUserSessions(userID)
+		safety.GetEventManager().DeleteUser(userID)
+	})
+	cfg.EnableCrisisDetection = true
+	cfg.EnableCrisisModelCheck = false
+	cfg.CrisisTriggerScore = 0.7
+	cfg.CrisisGuardHours = 24
+
+	mp := NewMessageProcessor()
+	sessionID := state.PrivateSessionID(userID)
+	sm.EnsureSession(sessionID, userID, 0, 1)
+
+	ctx := MessageContext{RequestID: "req-calm", SessionID: sessionID, UserID: userID, Message: "今天天气不错"}
+	if _, screened, _ := mp.screenCrisis(context.Background(), nil, ctx, sm, DispatchRecord{}); screened {
+		t.Fatalf("calm message should not be screened")
+	}
+	if got := sm.GetState(sessionID); got == state.StateGuarded {
+		t.Fatalf("calm message should not guard the session")
+	}
+
+	ctx = MessageContext{RequestID: "req-crisis", SessionID: sessionID, UserID: userID, Message: "我不想活了"}
+	// 没有连接，求助信息发送失败，但守护和记录照常生效
+	_, screened, err := mp.screenCrisis(context.Background(), nil, ctx, sm, DispatchRecord{})
+	if !screened || err == nil {
+		t.Fatalf("crisis message should be screened and report the send failure, screened=%v err=%v", screened, err)
+	}
+	until, guarded := sm.Guarded(sessionID)
+	if !guarded || !until.Equal(start.Add(24*time.Hour)) {
+		t.Fatalf("session should be guarded on the injected clock, got %v %v", until, guarded)
+	}
+	events := safety.GetEventManager().Events(userID, 0)
+	if len(events) != 1 || events[0].RequestID != "req-crisis" || !events[0].Time.Equal(start) || !events[0].GuardedUntil.Equal(until) {
+		t.Fatalf("unexpected crisis events: %+v", events)
+	}
+}
+
+func TestGuardedSessionRoutesToCrisisUntilReleased(t *testing.T) {
+	start := time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	clock.Set(fake)
+	const userID = 50502
+	sm := state.GetManager()
+	t.Cleanup(func() {
+		clock.Set(nil)
+		sm.DeleteUserSessions(userID)
+	})
+	registry := DefaultRegistry()
+	sessionID := state.PrivateSessionID(userID)
+	sm.EnsureSession(sessionID, userID, 0, 1)
+
+	sm.Guard(sessionID, start.Add(time.Hour))
+	if got := sm.GetState(sessionID); got != state.StateGuarded || !routesTo(registry.Route(got), HandlerCrisis) {
+		t.Fatalf("guarded session should route to the crisis handler, state=%v", got)
+	}
+
+	fake.Advance(2 * time.Hour)
+	if got := sm.GetState(sessionID); got != state.StateIdle || routesTo(registry.Route(got), HandlerCrisis) {
+		t.Fatalf("expired guard should fall back to idle routing, state=%v", got)
+	}
+	if _, guarded := sm.Guarded(sessionID); guarded {
+		t.Fatalf("expired guard should not be reported")
+	}
+	if sm.ReleaseGuard(sessionID) {
+		t.Fatalf("releasing an expired guard should report false")
+	}
+
+	sm.Guard(sessionID, fake.Now().Add(time.Hour))
+	if !sm.ReleaseGuard(sessionID) {
+		t.Fatalf("releasing an active guard should report true")
+	}
+	if got := sm.GetState(sessionID); got != state.StateIdle || routesTo(registry.Route(got), HandlerCrisis) {
+		t.Fatalf("released session should leave the crisis route, state=%v", got)
+	}
+	if sm.ReleaseGuard(sessionID) {
+		t.Fatalf("second release should report false")
+	}
+}
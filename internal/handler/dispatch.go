@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"project-yume/internal/metrics"
+)
+
+const dispatchHistoryLimit = 200
+
+// DispatchRecord 记录一条消息由哪个处理器接手以及处理结果。
+type DispatchRecord struct {
+	Time        time.Time `json:"time"`
+	RequestID   string    `json:"request_id"`
+	SessionID   string    `json:"session_id"`
+	UserID      int64     `json:"user_id"`
+	MessageID   int64     `json:"message_id"`
+	Message     string    `json:"message"`
+	State       string    `json:"state"`
+	Handler     string    `json:"handler"`
+	Candidates  []string  `json:"candidates"`
+	Handled     bool      `json:"handled"`
+	Replied     bool      `json:"replied"`
+	Interrupted bool      `json:"interrupted"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+}
+
+// dispatchLog 是固定容量的环形缓冲，只保存最近的分发记录。
+type dispatchLog struct {
+	mu      sync.Mutex
+	records []DispatchRecord
+	next    int
+	full    bool
+}
+
+var dispatches = &dispatchLog{
+	records: make([]DispatchRecord, dispatchHistoryLimit),
+}
+
+func (l *dispatchLog) add(record DispatchRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records[l.next] = record
+	l.next = (l.next + 1) % len(l.records)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+func (l *dispatchLog) recent(limit int) []DispatchRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	size := l.next
+	if l.full {
+		size = len(l.records)
+	}
+	if limit <= 0 || limit > size {
+		limit = size
+	}
+
+	result := make([]DispatchRecord, 0, limit)
+	for i := 1; i <= limit; i++ {
+		idx := (l.next - i + len(l.records)) % len(l.records)
+		result = append(result, l.records[idx])
+	}
+	return result
+}
+
+// RecentDispatches 返回最近 limit 条分发记录，最新的在前。
+func RecentDispatches(limit int) []DispatchRecord {
+	return dispatches.recent(limit)
+}
+
+func recordDispatch(record DispatchRecord, result *ProcessResult, err error) {
+	record.DurationMs = time.Since(record.Time).Milliseconds()
+	outcome := "ok"
+	if err != nil {
+		record.Error = err.Error()
+		outcome = "error"
+	}
+	if result != nil {
+		record.Handled = result.Handled
+		record.Replied = result.Replied
+		record.Interrupted = result.Interrupted
+		if result.Interrupted {
+			outcome = "interrupted"
+		}
+	}
+	dispatches.add(record)
+
+	metrics.IncCounter(
+		"bot_handler_dispatch_total",
+		"Total messages dispatched to each handler by result.",
+		map[string]string{"handler": record.Handler, "result": outcome},
+	)
+}
@@ -1,17 +1,23 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"project-yume/internal/aifunction"
+	"project-yume/internal/audit"
+	"project-yume/internal/clock"
 	"project-yume/internal/config"
 	"project-yume/internal/memory"
 	"project-yume/internal/metrics"
 	"project-yume/internal/model"
 	"project-yume/internal/service"
 	"project-yume/internal/state"
+	"project-yume/internal/tools"
+	"project-yume/internal/usage"
 	"project-yume/internal/utils"
 
 	"github.com/gorilla/websocket"
@@ -40,68 +46,19 @@ type MessageContext struct {
 	DropReason   string
 }
 
-func sendAIFallbackReply(c *websocket.Conn, userID int64) (string, error) {
-	if err := service.SendMsg(c, userID, aiFallbackReply); err != nil {
+func sendAIFallbackReply(runCtx context.Context, c *websocket.Conn, userID int64) (string, error) {
+	if _, err := service.SendMsgWithContext(runCtx, c, userID, aiFallbackReply); err != nil {
 		return "", err
 	}
 	return aiFallbackReply, nil
 }
 
 // MessageHandler 消息处理器接口
+// 状态过滤由注册表的路由负责，CanHandle 只需判断消息内容本身。
+// runCtx 在用户继续输入触发打断时会被取消，实现需要尽快返回。
 type MessageHandler interface {
 	CanHandle(ctx MessageContext, sm *state.StateManager) bool
-	Handle(c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (*ProcessResult, error)
-}
-
-// PresetHandler 预设回复处理器
-type PresetHandler struct {
-	responses map[string]string
-}
-
-func NewPresetHandler() *PresetHandler {
-	return &PresetHandler{
-		responses: map[string]string{
-			"你好":     "你好",
-			"在干嘛":    "在学习",
-			"在忙呢":    "好吧",
-			"难过了":    "别难过，开心点，加油！",
-			"我想你了":   "是嘛？嘿嘿",
-			"能陪我聊聊吗": "好",
-			"晚安":     "晚安",
-			"早安":     "早安",
-		},
-	}
-}
-
-// CanHandle 检查是否可以处理消息
-func (h *PresetHandler) CanHandle(ctx MessageContext, sm *state.StateManager) bool {
-	if sm.GetState(ctx.SessionID) != state.StateIdle {
-		return false
-	}
-	_, exists := h.responses[ctx.Message]
-	return exists
-}
-
-// Handle 处理消息
-func (h *PresetHandler) Handle(c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (*ProcessResult, error) {
-	response := h.responses[ctx.Message]
-
-	if ctx.Message == "在忙呢" {
-		sm.SetState(ctx.SessionID, state.StateBusy)
-	}
-	if ctx.Message == "能陪我聊聊吗" {
-		sm.SetState(ctx.SessionID, state.StateLongChat)
-	}
-
-	if err := service.SendMsg(c, ctx.UserID, response); err != nil {
-		return nil, err
-	}
-	return &ProcessResult{
-		Handled:   true,
-		Replied:   true,
-		ReplyMode: service.ReplyModeFullReply,
-		Reply:     response,
-	}, nil
+	Handle(runCtx context.Context, c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (*ProcessResult, error)
 }
 
 // EmotionHandler 情感分析处理器
@@ -112,27 +69,33 @@ func NewEmotionHandler() *EmotionHandler {
 }
 
 func (h *EmotionHandler) CanHandle(ctx MessageContext, sm *state.StateManager) bool {
-	return sm.GetState(ctx.SessionID) == state.StateIdle
+	return true
 }
 
-func (h *EmotionHandler) Handle(c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (*ProcessResult, error) {
-	analysis, err := service.AnalyzeMessage(service.AnalysisInput{
+func (h *EmotionHandler) Handle(runCtx context.Context, c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (*ProcessResult, error) {
+	streamer := service.NewReplyStreamer(runCtx, c, ctx.UserID)
+	analysis, err := service.AnalyzeMessage(runCtx, service.AnalysisInput{
 		Mode:          service.AnalysisModeDefault,
 		SessionID:     ctx.SessionID,
 		UserID:        ctx.UserID,
 		Message:       ctx.Message,
 		Conversation:  sm.GetConversation(ctx.SessionID),
 		ReferenceTime: ctx.ReceivedAt,
+		OnReplyDelta:  streamer.Callback(),
+		Tools:         toolExecutor(c, ctx),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("分析消息失败: %v", err)
+		if sent, _ := streamer.Close(false); len(sent) > 0 {
+			return interruptedResult(sent, err)
+		}
+		return nil, fmt.Errorf("分析消息失败: %w", err)
 	}
 
-	if shouldEnterLongChat(analysis) {
+	if shouldEnterLongChat(analysis) && !calledTool(analysis.ToolMessages, tools.ToolSetState) {
 		sm.SetState(ctx.SessionID, state.StateLongChat)
 	}
 
-	return applyStructuredReply(c, ctx, sm, analysis, false)
+	return applyStructuredReply(runCtx, c, ctx, sm, analysis, streamer, false)
 }
 
 // optimizeResponseWithMemory 基于情感记忆优化回复
@@ -149,7 +112,7 @@ func (h *EmotionHandler) optimizeResponseWithMemory(userID int64, message, emoti
 	return service.AdjustResponseByPattern(originalResponse, pattern, emotion)
 }
 
-func (h *EmotionHandler) startAIChat(c *websocket.Conn, ctx MessageContext, sm *state.StateManager, emotion, intention string) (*ProcessResult, error) {
+func (h *EmotionHandler) startAIChat(runCtx context.Context, c *websocket.Conn, ctx MessageContext, sm *state.StateManager, emotion, intention string) (*ProcessResult, error) {
 	cfg := config.GetConfig()
 	userID := ctx.UserID
 
@@ -166,7 +129,8 @@ func (h *EmotionHandler) startAIChat(c *websocket.Conn, ctx MessageContext, sm *
 	conversation = ensureSystemPrompt(conversation, systemPrompt)
 
 	startedAt := time.Now()
-	newConversation, responses, err := aifunction.QueryaiWithChain(conversation)
+	streamer := service.NewReplyStreamer(runCtx, c, ctx.UserID)
+	newConversation, response, err := aifunction.QueryaiWithChainStream(runCtx, config.AITaskReply, conversation, toolExecutor(c, ctx), streamer.Callback())
 	metrics.ObserveDuration(
 		"bot_ai_request_duration",
 		"AI request duration.",
@@ -174,6 +138,9 @@ func (h *EmotionHandler) startAIChat(c *websocket.Conn, ctx MessageContext, sm *
 		map[string]string{"kind": "chat", "mode": "start"},
 	)
 	if err != nil {
+		if sent, _ := streamer.Close(false); len(sent) > 0 || errors.Is(err, context.Canceled) {
+			return interruptedResult(sent, err)
+		}
 		metrics.IncCounter(
 			"bot_ai_requests_total",
 			"Total AI requests by kind and result.",
@@ -185,9 +152,9 @@ func (h *EmotionHandler) startAIChat(c *websocket.Conn, ctx MessageContext, sm *
 			utils.Int64("user_id", ctx.UserID),
 			utils.Err(err),
 		)
-		fallback, sendErr := sendAIFallbackReply(c, ctx.UserID)
+		fallback, sendErr := sendAIFallbackReply(runCtx, c, ctx.UserID)
 		if sendErr != nil {
-			return nil, fmt.Errorf("AI chat failed and fallback send failed: %v / %v", err, sendErr)
+			return nil, fmt.Errorf("AI chat failed and fallback send failed: %v / %w", err, sendErr)
 		}
 		return &ProcessResult{
 			Handled:   true,
@@ -202,10 +169,11 @@ func (h *EmotionHandler) startAIChat(c *websocket.Conn, ctx MessageContext, sm *
 		map[string]string{"kind": "chat", "mode": "start", "result": "ok"},
 	)
 
-	for _, response := range responses {
-		if err := service.SendMsg(c, ctx.UserID, response); err != nil {
-			return nil, fmt.Errorf("发送AI回复失败: %v", err)
+	if sent, err := sendChatReply(runCtx, c, ctx.UserID, streamer, response); err != nil {
+		if result, _ := interruptedResult(sent, err); result != nil {
+			return result, nil
 		}
+		return nil, fmt.Errorf("发送AI回复失败: %w", err)
 	}
 
 	sm.SetConversation(ctx.SessionID, newConversation)
@@ -214,7 +182,7 @@ func (h *EmotionHandler) startAIChat(c *websocket.Conn, ctx MessageContext, sm *
 		Handled:   true,
 		Emotion:   emotion,
 		Intention: intention,
-		Reply:     service.StripReplyDirectives(responses[len(responses)-1]),
+		Reply:     service.StripReplyDirectives(response),
 	}, nil
 }
 
@@ -226,27 +194,35 @@ func NewLongChatHandler() *LongChatHandler {
 }
 
 func (h *LongChatHandler) CanHandle(ctx MessageContext, sm *state.StateManager) bool {
-	return sm.GetState(ctx.SessionID) == state.StateLongChat
+	return true
 }
 
-func (h *LongChatHandler) Handle(c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (*ProcessResult, error) {
-	analysis, err := service.AnalyzeMessage(service.AnalysisInput{
+func (h *LongChatHandler) Handle(runCtx context.Context, c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (*ProcessResult, error) {
+	streamer := service.NewReplyStreamer(runCtx, c, ctx.UserID)
+	analysis, err := service.AnalyzeMessage(runCtx, service.AnalysisInput{
 		Mode:          service.AnalysisModeLongChat,
 		SessionID:     ctx.SessionID,
 		UserID:        ctx.UserID,
 		Message:       ctx.Message,
 		Conversation:  sm.GetConversation(ctx.SessionID),
 		ReferenceTime: ctx.ReceivedAt,
+		OnReplyDelta:  streamer.Callback(),
+		Tools:         toolExecutor(c, ctx),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("分析消息失败: %v", err)
+		if sent, _ := streamer.Close(false); len(sent) > 0 {
+			return interruptedResult(sent, err)
+		}
+		return nil, fmt.Errorf("分析消息失败: %w", err)
 	}
 
-	sm.SetState(ctx.SessionID, state.StateLongChat)
-	return applyStructuredReply(c, ctx, sm, analysis, true)
+	if !calledTool(analysis.ToolMessages, tools.ToolSetState) {
+		sm.SetState(ctx.SessionID, state.StateLongChat)
+	}
+	return applyStructuredReply(runCtx, c, ctx, sm, analysis, streamer, true)
 }
 
-func (h *LongChatHandler) continueAIChat(c *websocket.Conn, ctx MessageContext, sm *state.StateManager, emotion, intention string) (*ProcessResult, error) {
+func (h *LongChatHandler) continueAIChat(runCtx context.Context, c *websocket.Conn, ctx MessageContext, sm *state.StateManager, emotion, intention string) (*ProcessResult, error) {
 	cfg := config.GetConfig()
 	userID := ctx.UserID
 
@@ -265,7 +241,8 @@ func (h *LongChatHandler) continueAIChat(c *websocket.Conn, ctx MessageContext,
 	}
 
 	startedAt := time.Now()
-	newConversation, responses, err := aifunction.QueryaiWithChain(conversation)
+	streamer := service.NewReplyStreamer(runCtx, c, ctx.UserID)
+	newConversation, response, err := aifunction.QueryaiWithChainStream(runCtx, config.AITaskReply, conversation, toolExecutor(c, ctx), streamer.Callback())
 	metrics.ObserveDuration(
 		"bot_ai_request_duration",
 		"AI request duration.",
@@ -273,6 +250,9 @@ func (h *LongChatHandler) continueAIChat(c *websocket.Conn, ctx MessageContext,
 		map[string]string{"kind": "chat", "mode": "continue"},
 	)
 	if err != nil {
+		if sent, _ := streamer.Close(false); len(sent) > 0 || errors.Is(err, context.Canceled) {
+			return interruptedResult(sent, err)
+		}
 		metrics.IncCounter(
 			"bot_ai_requests_total",
 			"Total AI requests by kind and result.",
@@ -284,9 +264,9 @@ func (h *LongChatHandler) continueAIChat(c *websocket.Conn, ctx MessageContext,
 			utils.Int64("user_id", ctx.UserID),
 			utils.Err(err),
 		)
-		fallback, sendErr := sendAIFallbackReply(c, ctx.UserID)
+		fallback, sendErr := sendAIFallbackReply(runCtx, c, ctx.UserID)
 		if sendErr != nil {
-			return nil, fmt.Errorf("AI conversation failed and fallback send failed: %v / %v", err, sendErr)
+			return nil, fmt.Errorf("AI conversation failed and fallback send failed: %v / %w", err, sendErr)
 		}
 		return &ProcessResult{
 			Handled:   true,
@@ -301,10 +281,11 @@ func (h *LongChatHandler) continueAIChat(c *websocket.Conn, ctx MessageContext,
 		map[string]string{"kind": "chat", "mode": "continue", "result": "ok"},
 	)
 
-	for _, response := range responses {
-		if err := service.SendMsg(c, ctx.UserID, response); err != nil {
-			return nil, fmt.Errorf("发送AI回复失败: %v", err)
+	if sent, err := sendChatReply(runCtx, c, ctx.UserID, streamer, response); err != nil {
+		if result, _ := interruptedResult(sent, err); result != nil {
+			return result, nil
 		}
+		return nil, fmt.Errorf("发送AI回复失败: %w", err)
 	}
 
 	sm.SetConversation(ctx.SessionID, newConversation)
@@ -313,13 +294,13 @@ func (h *LongChatHandler) continueAIChat(c *websocket.Conn, ctx MessageContext,
 		Handled:   true,
 		Emotion:   emotion,
 		Intention: intention,
-		Reply:     service.StripReplyDirectives(responses[len(responses)-1]),
+		Reply:     service.StripReplyDirectives(response),
 	}, nil
 }
 
-func (h *LongChatHandler) endAIChat(c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (string, error) {
+func (h *LongChatHandler) endAIChat(runCtx context.Context, c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (string, error) {
 	reply := "好吧，那拜拜。"
-	if err := service.SendMsg(c, ctx.UserID, reply); err != nil {
+	if _, err := service.SendMsgWithContext(runCtx, c, ctx.UserID, reply); err != nil {
 		return "", fmt.Errorf("发送结束回复失败: %v", err)
 	}
 
@@ -328,6 +309,38 @@ func (h *LongChatHandler) endAIChat(c *websocket.Conn, ctx MessageContext, sm *s
 	return reply, nil
 }
 
+// toolExecutor 返回绑定到当前消息的工具执行器，未启用工具时为 nil。
+func toolExecutor(c *websocket.Conn, ctx MessageContext) aifunction.ToolExecutor {
+	return tools.DefaultRegistry().Executor(tools.Invocation{
+		RequestID:     ctx.RequestID,
+		SessionID:     ctx.SessionID,
+		UserID:        ctx.UserID,
+		Message:       ctx.Message,
+		Conn:          c,
+		ReferenceTime: ctx.ReceivedAt,
+	})
+}
+
+// calledTool 判断本轮模型是否调用过指定工具；模型主动切换过状态时不再按默认规则覆盖。
+func calledTool(msgs []openai.ChatCompletionMessage, name string) bool {
+	for _, msg := range msgs {
+		for _, call := range msg.ToolCalls {
+			if call.Function.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sendChatReply 流式模式下只需补发最后一段；否则整体分段发送。
+func sendChatReply(runCtx context.Context, c *websocket.Conn, userID int64, streamer *service.ReplyStreamer, response string) ([]string, error) {
+	if streamer != nil {
+		return streamer.Close(true)
+	}
+	return service.SendMsgWithContext(runCtx, c, userID, response)
+}
+
 func shouldEnterLongChat(analysis service.MessageAnalysis) bool {
 	switch analysis.Intention {
 	case "想和对方聊天", "想被对方鼓励", "想和对方倾诉":
@@ -340,7 +353,11 @@ func shouldEnterLongChat(analysis service.MessageAnalysis) bool {
 	return false
 }
 
-func applyStructuredReply(c *websocket.Conn, ctx MessageContext, sm *state.StateManager, analysis service.MessageAnalysis, longChat bool) (*ProcessResult, error) {
+// applyStructuredReply 按分析结果回复。streamer 非空且已经流式发出片段时，
+// 以实际发出的内容作为完整回复，不再重复发送 visible_reply。
+func applyStructuredReply(runCtx context.Context, c *websocket.Conn, ctx MessageContext, sm *state.StateManager, analysis service.MessageAnalysis, streamer *service.ReplyStreamer, longChat bool) (*ProcessResult, error) {
+	// 工具调用发生在回复之前，先记入历史，保证顺序与模型看到的一致。
+	sm.RecordToolTurns(ctx.SessionID, analysis.ToolMessages)
 	sm.SetDialogueState(ctx.SessionID, state.DialogueState{
 		Emotion:          analysis.Emotion,
 		Intention:        analysis.Intention,
@@ -352,6 +369,44 @@ func applyStructuredReply(c *websocket.Conn, ctx MessageContext, sm *state.State
 		Confidence:       analysis.Confidence,
 	})
 
+	if streamer.Started() {
+		// 流式片段在结果校验前就已发出。最终采用的回复与流出的不一致时（重问、兜底或改为不回复），
+		// 不再补发剩余文本，结果和历史只记录用户实际看到的内容。
+		replyMode := analysis.ReplyMode
+		accepted := streamMatchesAnalysis(streamer.Streamed(), analysis)
+		if !accepted {
+			replyMode = service.ReplyModeFullReply
+			utils.Warnw("streamed reply differs from accepted analysis, keep what was sent",
+				utils.String("request_id", ctx.RequestID),
+				utils.String("session_id", ctx.SessionID),
+				utils.String("outcome", analysis.Outcome),
+				utils.String("reply_mode", string(analysis.ReplyMode)),
+			)
+		}
+		sent, err := streamer.Close(accepted)
+		if err != nil {
+			result, resultErr := interruptedResult(sent, err)
+			if result != nil {
+				result.Emotion = analysis.Emotion
+				result.Intention = analysis.Intention
+				result.ReplyMode = replyMode
+			}
+			return result, resultErr
+		}
+		if longChat && analysis.WannaBye == "想结束对话" {
+			sm.SetState(ctx.SessionID, state.StateIdle)
+		}
+		return &ProcessResult{
+			Handled:   true,
+			Replied:   len(sent) > 0,
+			Emotion:   analysis.Emotion,
+			Intention: analysis.Intention,
+			ReplyMode: replyMode,
+			Reply:     service.BuildAssistantTranscript(strings.Join(sent, "$")),
+		}, nil
+	}
+	streamer.Close(false)
+
 	if analysis.ReplyMode == service.ReplyModeNoReply {
 		if longChat && analysis.WannaBye == "想结束对话" {
 			sm.SetState(ctx.SessionID, state.StateIdle)
@@ -368,14 +423,20 @@ func applyStructuredReply(c *websocket.Conn, ctx MessageContext, sm *state.State
 
 	reply := analysis.VisibleReply
 	if reply == "" {
-		fallback, err := sendAIFallbackReply(c, ctx.UserID)
+		fallback, err := sendAIFallbackReply(runCtx, c, ctx.UserID)
 		if err != nil {
-			return nil, err
+			return interruptedResult(nil, err)
 		}
 		reply = fallback
 	} else {
-		if err := service.SendMsg(c, ctx.UserID, reply); err != nil {
-			return nil, err
+		if sent, err := service.SendMsgWithContext(runCtx, c, ctx.UserID, reply); err != nil {
+			result, resultErr := interruptedResult(sent, err)
+			if result != nil {
+				result.Emotion = analysis.Emotion
+				result.Intention = analysis.Intention
+				result.ReplyMode = analysis.ReplyMode
+			}
+			return result, resultErr
 		}
 	}
 
@@ -395,69 +456,164 @@ func applyStructuredReply(c *websocket.Conn, ctx MessageContext, sm *state.State
 	}, nil
 }
 
+// streamMatchesAnalysis 判断流式发出的文本是否就是最终采用的回复。
+func streamMatchesAnalysis(streamed string, analysis service.MessageAnalysis) bool {
+	if analysis.ReplyMode == service.ReplyModeNoReply {
+		return false
+	}
+	return service.BuildAssistantTranscript(streamed) == service.BuildAssistantTranscript(analysis.VisibleReply)
+}
+
 // ProcessResult 消息处理结果
 type ProcessResult struct {
-	Handled   bool              // 是否被处理
-	Replied   bool              // 是否真正发送了回复
-	Emotion   string            // 检测到的情感
-	Intention string            // 检测到的意图
-	ReplyMode service.ReplyMode // 回复模式
-	Reply     string            // 回复内容
+	Handled     bool              // 是否被处理
+	Replied     bool              // 是否真正发送了回复
+	Interrupted bool              // 是否因用户继续输入被打断
+	Emotion     string            // 检测到的情感
+	Intention   string            // 检测到的意图
+	ReplyMode   service.ReplyMode // 回复模式
+	Reply       string            // 回复内容
+}
+
+// interruptedResult 把发送阶段的取消错误转换为打断结果，已发出的分段记为半截回复。
+// 非取消错误原样返回。
+func interruptedResult(sent []string, err error) (*ProcessResult, error) {
+	if !errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+	result := &ProcessResult{
+		Handled:     true,
+		Interrupted: true,
+	}
+	if len(sent) > 0 {
+		result.Replied = true
+		result.Reply = service.BuildAssistantTranscript(strings.Join(sent, "$"))
+	}
+	return result, nil
 }
 
-// MessageProcessor 消息处理器管理器
+// MessageProcessor 消息处理器管理器，按注册表路由消息。
 type MessageProcessor struct {
-	handlers []MessageHandler
+	registry *HandlerRegistry
 }
 
 func NewMessageProcessor() *MessageProcessor {
 	return &MessageProcessor{
-		handlers: []MessageHandler{
-			NewPresetHandler(),
-			NewEmotionHandler(),
-			NewLongChatHandler(),
-		},
+		registry: DefaultRegistry(),
 	}
 }
 
 // Process 处理消息并返回详细结果
-func (mp *MessageProcessor) Process(c *websocket.Conn, ctx MessageContext) (*ProcessResult, error) {
+// runCtx 被取消时返回 Interrupted 结果而不是错误，由调用方负责合并重跑。
+func (mp *MessageProcessor) Process(runCtx context.Context, c *websocket.Conn, ctx MessageContext) (*ProcessResult, error) {
 	sm := state.GetManager()
 	sm.EnsureSession(ctx.SessionID, ctx.UserID, ctx.GroupID, ctx.ChatType)
+	runCtx = usage.WithScope(runCtx, ctx.SessionID, ctx.UserID)
+	runCtx = audit.WithRequestID(runCtx, ctx.RequestID)
 
-	if config.GetConfig().EnableOnlyLongChat {
-		result, err := mp.handlers[2].Handle(c, ctx, sm)
-		if err != nil {
-			return &ProcessResult{}, err
-		}
-		if result == nil {
-			return &ProcessResult{}, nil
-		}
-		return result, nil
+	botState := sm.GetState(ctx.SessionID)
+	record := DispatchRecord{
+		Time:      clock.Now(),
+		RequestID: ctx.RequestID,
+		SessionID: ctx.SessionID,
+		UserID:    ctx.UserID,
+		MessageID: ctx.MessageID,
+		Message:   ctx.Message,
+		State:     botState.String(),
+	}
+
+	if result, screened, err := mp.screenCrisis(runCtx, c, ctx, sm, record); screened {
+		return result, err
 	}
 
-	for _, handler := range mp.handlers {
-		if !handler.CanHandle(ctx, sm) {
+	route := mp.registry.Route(botState)
+	// 守护期间不让「只用长对话」覆盖路由
+	if config.GetConfig().EnableOnlyLongChat && botState != state.StateGuarded {
+		route = mp.onlyLongChatRoute(route)
+	}
+	if usage.GetManager().Budget(clock.Now()).PresetOnly() {
+		route = mp.presetOnlyRoute(route)
+	}
+
+	for _, spec := range route {
+		record.Candidates = append(record.Candidates, spec.Name)
+		if !spec.Handler.CanHandle(ctx, sm) {
 			continue
 		}
 
-		result, err := handler.Handle(c, ctx, sm)
-		if err != nil {
-			return &ProcessResult{}, err
+		record.Handler = spec.Name
+		result, err := finishHandle(spec.Handler.Handle(runCtx, c, ctx, sm))
+		recordDispatch(record, result, err)
+		return result, err
+	}
+
+	record.Handler = HandlerFallback
+	result, err := finishHandle(sendFallbackQuestion(runCtx, c, ctx.UserID))
+	recordDispatch(record, result, err)
+	return result, err
+}
+
+// onlyLongChatRoute 「只用长对话」时其余回复都交给长对话，
+// 隐私和提醒指令仍按原路由保留在前面，否则用户没法通过聊天导出、删除数据。
+func (mp *MessageProcessor) onlyLongChatRoute(route []HandlerSpec) []HandlerSpec {
+	filtered := make([]HandlerSpec, 0, 3)
+	for _, spec := range route {
+		switch spec.Name {
+		case HandlerPrivacy, HandlerReminder:
+			filtered = append(filtered, spec)
+		}
+	}
+	if longChat, ok := mp.registry.Lookup(HandlerLongChat); ok {
+		filtered = append(filtered, HandlerSpec{Name: HandlerLongChat, Handler: longChat})
+	}
+	return filtered
+}
+
+// presetOnlyRoute 预算超出后只保留不调用模型的处理器，并确保预设回复可用；
+// 都没命中时走兜底回复。
+func (mp *MessageProcessor) presetOnlyRoute(route []HandlerSpec) []HandlerSpec {
+	filtered := make([]HandlerSpec, 0, len(route)+1)
+	hasPreset := false
+	for _, spec := range route {
+		switch spec.Name {
+		case HandlerEmotion, HandlerLongChat:
+			continue
+		case HandlerPreset:
+			hasPreset = true
 		}
-		if result == nil {
-			return &ProcessResult{}, nil
+		filtered = append(filtered, spec)
+	}
+	if !hasPreset {
+		if preset, ok := mp.registry.Lookup(HandlerPreset); ok {
+			filtered = append(filtered, HandlerSpec{Name: HandlerPreset, Handler: preset})
 		}
-		return result, nil
 	}
+	return filtered
+}
 
-	err := service.SendMsg(c, ctx.UserID, "?")
+func sendFallbackQuestion(runCtx context.Context, c *websocket.Conn, userID int64) (*ProcessResult, error) {
+	if sent, err := service.SendMsgWithContext(runCtx, c, userID, "?"); err != nil {
+		return interruptedResult(sent, err)
+	}
 	return &ProcessResult{
 		Handled:   true,
 		Replied:   true,
 		ReplyMode: service.ReplyModeFullReply,
 		Reply:     "?",
-	}, err
+	}, nil
+}
+
+func finishHandle(result *ProcessResult, err error) (*ProcessResult, error) {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return &ProcessResult{Handled: true, Interrupted: true}, nil
+		}
+		return &ProcessResult{}, err
+	}
+	if result == nil {
+		return &ProcessResult{}, nil
+	}
+	return result, nil
 }
 
 func BuildConversationUserMessage(ctx MessageContext) (openai.ChatCompletionMessage, bool) {
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"testing"
+
+	"project-yume/internal/service"
+)
+
+func TestStreamMatchesAnalysis(t *testing.T) {
+	cases := []struct {
+		name     string
+		streamed string
+		analysis service.MessageAnalysis
+		want     bool
+	}{
+		{name: "same reply", streamed: "好呀$明天见", analysis: service.MessageAnalysis{ReplyMode: service.ReplyModeFullReply, VisibleReply: "好呀$明天见"}, want: true},
+		{name: "reasked reply differs", streamed: "好呀$明", analysis: service.MessageAnalysis{ReplyMode: service.ReplyModeFullReply, VisibleReply: "嗯嗯$早点睡", Outcome: "reasked"}, want: false},
+		{name: "fallback to no reply", streamed: "好呀", analysis: service.MessageAnalysis{ReplyMode: service.ReplyModeNoReply, Outcome: "fallback_parse"}, want: false},
+	}
+	for _, tc := range cases {
+		if got := streamMatchesAnalysis(tc.streamed, tc.analysis); got != tc.want {
+			t.Fatalf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package handler
+
+import (
+	"context"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gorilla/websocket"
+
+	"project-yume/internal/character"
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/metrics"
+	"project-yume/internal/service"
+	"project-yume/internal/state"
+	"project-yume/internal/utils"
+)
+
+// presetMatchOrder 多条规则同时命中时，按匹配方式的严格程度决定优先级。
+var presetMatchOrder = []character.PresetMatch{
+	character.PresetMatchExact,
+	character.PresetMatchRegex,
+	character.PresetMatchContains,
+	character.PresetMatchFuzzy,
+}
+
+// PresetHandler 预设回复处理器，规则来自角色配置的 responses.presets。
+// 角色配置被重新加载（例如后台保存角色）后会自动重建规则。
+type PresetHandler struct {
+	mu        sync.Mutex
+	source    *character.CharacterConfig
+	rules     []compiledPreset
+	cooldowns map[string]time.Time
+	rng       *rand.Rand
+}
+
+type compiledPreset struct {
+	rule     character.PresetRule
+	patterns []string
+	regexps  []*regexp.Regexp
+	state    state.BotState
+	setState bool
+}
+
+func NewPresetHandler() *PresetHandler {
+	return &PresetHandler{
+		cooldowns: make(map[string]time.Time),
+		rng:       rand.New(rand.NewSource(clock.Now().UnixNano())),
+	}
+}
+
+// CanHandle 检查是否有未处于冷却中的规则命中消息
+func (h *PresetHandler) CanHandle(ctx MessageContext, sm *state.StateManager) bool {
+	stage := service.RelationshipStage(ctx.UserID)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.matchLocked(ctx, stage, clock.Now()) != nil
+}
+
+// Handle 随机选择命中规则的一条回复发送，并按规则切换状态、记录冷却
+func (h *PresetHandler) Handle(runCtx context.Context, c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (*ProcessResult, error) {
+	now := clock.Now()
+	stage := service.RelationshipStage(ctx.UserID)
+
+	h.mu.Lock()
+	preset := h.matchLocked(ctx, stage, now)
+	if preset == nil {
+		h.mu.Unlock()
+		return nil, nil
+	}
+	response := preset.rule.Replies[h.rng.Intn(len(preset.rule.Replies))]
+	if preset.rule.CooldownSec > 0 {
+		h.cooldowns[presetCooldownKey(ctx.SessionID, preset.rule.Name)] = now.Add(time.Duration(preset.rule.CooldownSec) * time.Second)
+	}
+	h.mu.Unlock()
+
+	if preset.setState {
+		sm.SetState(ctx.SessionID, preset.state)
+	}
+
+	utils.Infow("preset reply matched",
+		utils.String("request_id", ctx.RequestID),
+		utils.String("session_id", ctx.SessionID),
+		utils.String("rule", preset.rule.Name),
+		utils.String("match", string(preset.rule.Match)),
+	)
+	metrics.IncCounter(
+		"bot_preset_hits_total",
+		"Total preset replies by match type.",
+		map[string]string{"match": string(preset.rule.Match)},
+	)
+
+	if sent, err := service.SendMsgWithContext(runCtx, c, ctx.UserID, response); err != nil {
+		return interruptedResult(sent, err)
+	}
+	return &ProcessResult{
+		Handled:   true,
+		Replied:   true,
+		ReplyMode: service.ReplyModeFullReply,
+		Reply:     response,
+	}, nil
+}
+
+// matchLocked 跳过冷却中和不适用于当前关系阶段的规则。
+func (h *PresetHandler) matchLocked(ctx MessageContext, stage string, now time.Time) *compiledPreset {
+	h.refreshLocked()
+	return matchPreset(h.rules, ctx.Message, func(rule character.PresetRule) bool {
+		if !rule.AllowsStage(stage) {
+			return true
+		}
+		until, ok := h.cooldowns[presetCooldownKey(ctx.SessionID, rule.Name)]
+		return ok && now.Before(until)
+	})
+}
+
+// refreshLocked 角色配置指针变化时重新编译规则。
+func (h *PresetHandler) refreshLocked() {
+	source := config.GetCharacterConfig()
+	if source == h.source {
+		return
+	}
+	h.source = source
+
+	rules, err := source.Presets()
+	if err != nil {
+		utils.Warn("加载预设回复失败，本角色暂不使用预设: %v", err)
+		h.rules = nil
+		return
+	}
+	h.rules = compilePresets(rules)
+	utils.Info("预设回复已加载: %d 条规则", len(h.rules))
+}
+
+func compilePresets(rules []character.PresetRule) []compiledPreset {
+	compiled := make([]compiledPreset, 0, len(rules))
+	for _, rule := range rules {
+		preset := compiledPreset{rule: rule}
+		if rule.State != "" {
+			botState, ok := state.ParseBotState(rule.State)
+			if !ok {
+				utils.Warn("预设规则 %s 的状态 %q 无法识别，忽略状态切换", rule.Name, rule.State)
+			} else {
+				preset.state = botState
+				preset.setState = true
+			}
+		}
+		for _, pattern := range rule.Patterns {
+			if rule.Match == character.PresetMatchRegex {
+				if re, err := regexp.Compile(pattern); err == nil {
+					preset.regexps = append(preset.regexps, re)
+				}
+				continue
+			}
+			if normalized := normalizePresetText(pattern); normalized != "" {
+				preset.patterns = append(preset.patterns, normalized)
+			}
+		}
+		compiled = append(compiled, preset)
+	}
+	return compiled
+}
+
+// matchPreset 返回最先命中的规则。严格的匹配方式优先；模糊匹配取相似度最高者。
+func matchPreset(rules []compiledPreset, message string, skip func(character.PresetRule) bool) *compiledPreset {
+	raw := strings.TrimSpace(message)
+	normalized := normalizePresetText(message)
+	if raw == "" {
+		return nil
+	}
+
+	for _, match := range presetMatchOrder {
+		var best *compiledPreset
+		bestScore := 0.0
+		for i := range rules {
+			preset := &rules[i]
+			if preset.rule.Match != match || skip(preset.rule) {
+				continue
+			}
+			score := preset.score(raw, normalized)
+			if score <= 0 {
+				continue
+			}
+			if match != character.PresetMatchFuzzy {
+				return preset
+			}
+			if score > bestScore {
+				best = preset
+				bestScore = score
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+	return nil
+}
+
+func (p *compiledPreset) score(raw, normalized string) float64 {
+	switch p.rule.Match {
+	case character.PresetMatchRegex:
+		for _, re := range p.regexps {
+			if re.MatchString(raw) {
+				return 1
+			}
+		}
+	case character.PresetMatchExact:
+		for _, pattern := range p.patterns {
+			if normalized == pattern {
+				return 1
+			}
+		}
+	case character.PresetMatchContains:
+		for _, pattern := range p.patterns {
+			if normalized != "" && strings.Contains(normalized, pattern) {
+				return 1
+			}
+		}
+	case character.PresetMatchFuzzy:
+		best := 0.0
+		for _, pattern := range p.patterns {
+			if similarity := textSimilarity(normalized, pattern); similarity >= p.rule.Threshold && similarity > best {
+				best = similarity
+			}
+		}
+		return best
+	}
+	return 0
+}
+
+// normalizePresetText 去掉空白与标点并转小写，让“晚安~”“晚安！”都能命中“晚安”。
+func normalizePresetText(text string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// textSimilarity 基于编辑距离的相似度，取值 0~1。
+func textSimilarity(a, b string) float64 {
+	left, right := []rune(a), []rune(b)
+	if len(left) == 0 || len(right) == 0 {
+		return 0
+	}
+
+	prev := make([]int, len(right)+1)
+	curr := make([]int, len(right)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(left); i++ {
+		curr[0] = i
+		for j := 1; j <= len(right); j++ {
+			cost := 1
+			if left[i-1] == right[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	longest := max(len(left), len(right))
+	return 1 - float64(prev[len(right)])/float64(longest)
+}
+
+func presetCooldownKey(sessionID, rule string) string {
+	return sessionID + "\x00" + rule
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"testing"
+
+	"project-yume/internal/character"
+)
+
+func buildTestPresets(t *testing.T, responses map[string]interface{}) []compiledPreset {
+	t.Helper()
+	cfg := &character.CharacterConfig{Responses: responses}
+	rules, err := cfg.Presets()
+	if err != nil {
+		t.Fatalf("Presets returned error: %v", err)
+	}
+	return compilePresets(rules)
+}
+
+func notCooling(character.PresetRule) bool { return false }
+
+func TestMatchPresetPrefersStricterMatch(t *testing.T) {
+	presets := buildTestPresets(t, map[string]interface{}{
+		"presets": []interface{}{
+			map[string]interface{}{"name": "loose", "match": "contains", "patterns": []interface{}{"晚安"}, "replies": []interface{}{"a"}},
+			map[string]interface{}{"name": "strict", "patterns": []interface{}{"晚安"}, "replies": []interface{}{"b"}},
+		},
+	})
+
+	matched := matchPreset(presets, "晚安~", notCooling)
+	if matched == nil || matched.rule.Name != "strict" {
+		t.Fatalf("expected exact rule to win, got %+v", matched)
+	}
+
+	matched = matchPreset(presets, "那我先睡了晚安", notCooling)
+	if matched == nil || matched.rule.Name != "loose" {
+		t.Fatalf("expected contains rule to match, got %+v", matched)
+	}
+}
+
+func TestMatchPresetFuzzyAndCooldown(t *testing.T) {
+	presets := buildTestPresets(t, map[string]interface{}{
+		"presets": []interface{}{
+			map[string]interface{}{"name": "doing", "match": "fuzzy", "patterns": []interface{}{"在干什么"}, "replies": []interface{}{"在学习"}, "cooldown_sec": 60},
+			map[string]interface{}{"name": "chat", "match": "regex", "patterns": []interface{}{"^陪我聊"}, "replies": []interface{}{"好"}, "state": "long_chat"},
+		},
+	})
+
+	if matched := matchPreset(presets, "你在干什么", notCooling); matched == nil || matched.rule.Name != "doing" {
+		t.Fatalf("expected fuzzy rule to match, got %+v", matched)
+	}
+	if matched := matchPreset(presets, "今天天气不错", notCooling); matched != nil {
+		t.Fatalf("expected no match, got %+v", matched.rule)
+	}
+	cooling := func(rule character.PresetRule) bool { return rule.Name == "doing" }
+	if matched := matchPreset(presets, "在干什么", cooling); matched != nil {
+		t.Fatalf("expected cooling rule to be skipped")
+	}
+	if matched := matchPreset(presets, "陪我聊会儿", notCooling); matched == nil || !matched.setState {
+		t.Fatalf("expected regex rule with state transition, got %+v", matched)
+	}
+}
+
+func TestPresetsRejectsInvalidRegex(t *testing.T) {
+	cfg := &character.CharacterConfig{Responses: map[string]interface{}{
+		"presets": []interface{}{
+			map[string]interface{}{"match": "regex", "patterns": []interface{}{"("}, "replies": []interface{}{"x"}},
+		},
+	}}
+	if _, err := cfg.Presets(); err == nil {
+		t.Fatalf("expected invalid regex to be rejected")
+	}
+}
+
+func TestPresetStagesLimitRelationship(t *testing.T) {
+	presets := buildTestPresets(t, map[string]interface{}{
+		"presets": []interface{}{
+			map[string]interface{}{"name": "miss", "match": "contains", "patterns": []interface{}{"想你"}, "replies": []interface{}{"我也是"}, "stages": []interface{}{"Familiar", "close"}},
+		},
+	})
+
+	for stage, want := range map[string]bool{"": true, "stranger": false, "familiar": true, "close": true} {
+		skip := func(rule character.PresetRule) bool { return !rule.AllowsStage(stage) }
+		if matched := matchPreset(presets, "有点想你", skip); (matched != nil) != want {
+			t.Fatalf("stage %q: expected match=%v, got %+v", stage, want, matched)
+		}
+	}
+
+	cfg := &character.CharacterConfig{Responses: map[string]interface{}{
+		"presets": []interface{}{
+			map[string]interface{}{"patterns": []interface{}{"x"}, "replies": []interface{}{"y"}, "stages": []interface{}{"friend"}},
+		},
+	}}
+	if _, err := cfg.Presets(); err == nil {
+		t.Fatalf("expected unknown stage to be rejected")
+	}
+}
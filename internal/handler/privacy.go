@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/privacy"
+	"project-yume/internal/service"
+	"project-yume/internal/state"
+	"project-yume/internal/utils"
+)
+
+// privacyConfirmWindow 说了「删除我的数据」之后多久内确认有效。
+const privacyConfirmWindow = 5 * time.Minute
+
+// privacyFactPreview 查看数据时最多列出的事实条数。
+const privacyFactPreview = 10
+
+type privacyCommand int
+
+const (
+	privacyNone privacyCommand = iota
+	privacyExport
+	privacyForget
+	privacyConfirm
+)
+
+var privacyCommands = map[string]privacyCommand{
+	"导出我的数据":   privacyExport,
+	"查看我的数据":   privacyExport,
+	"你记住了我什么":  privacyExport,
+	"删除我的数据":   privacyForget,
+	"忘记我":      privacyForget,
+	"忘掉我":      privacyForget,
+	"确认删除":     privacyConfirm,
+	"确认删除我的数据": privacyConfirm,
+}
+
+// PrivacyHandler 让用户自己查看存了哪些数据、要求全部删除。删除需要二次确认，只在私聊里处理。
+type PrivacyHandler struct {
+	mu      sync.Mutex
+	pending map[int64]time.Time
+}
+
+func NewPrivacyHandler() *PrivacyHandler {
+	return &PrivacyHandler{pending: make(map[int64]time.Time)}
+}
+
+func (h *PrivacyHandler) CanHandle(ctx MessageContext, sm *state.StateManager) bool {
+	command := parsePrivacyCommand(ctx.Message)
+	if command == privacyConfirm {
+		return h.pendingSince(ctx.UserID, privacyNow(ctx))
+	}
+	return command != privacyNone
+}
+
+func (h *PrivacyHandler) Handle(runCtx context.Context, c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (*ProcessResult, error) {
+	var reply string
+	switch command := parsePrivacyCommand(ctx.Message); {
+	case ctx.GroupID != 0:
+		reply = "这个要私聊我哦，群里不方便说"
+	case command == privacyExport:
+		reply = describeUserData(ctx.UserID)
+	case command == privacyForget:
+		h.mu.Lock()
+		h.pending[ctx.UserID] = privacyNow(ctx)
+		h.mu.Unlock()
+		reply = "要把我记得的关于你的一切都删掉吗？聊天记录、记住的事、提醒都会清空，删了就找不回来了。确定的话 5 分钟内回我「确认删除」。"
+	case command == privacyConfirm:
+		reply = h.forget(ctx)
+	default:
+		return nil, nil
+	}
+
+	if sent, err := service.SendMsgWithContext(runCtx, c, ctx.UserID, reply); err != nil {
+		return interruptedResult(sent, err)
+	}
+	return &ProcessResult{
+		Handled:   true,
+		Replied:   true,
+		ReplyMode: service.ReplyModeFullReply,
+		Reply:     reply,
+	}, nil
+}
+
+func (h *PrivacyHandler) pendingSince(userID int64, now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	requestedAt, ok := h.pending[userID]
+	if ok && now.Sub(requestedAt) > privacyConfirmWindow {
+		delete(h.pending, userID)
+		return false
+	}
+	return ok
+}
+
+func (h *PrivacyHandler) forget(ctx MessageContext) string {
+	h.mu.Lock()
+	delete(h.pending, ctx.UserID)
+	h.mu.Unlock()
+
+	if _, err := privacy.Forget(ctx.UserID, privacy.RequestedByUser); err != nil {
+		utils.Warn("forget user data from chat incomplete: %v", err)
+		return "大部分数据已经删掉了，还有一点没清干净，我让管理员再处理一下"
+	}
+	return "好，关于你的记录都删掉了。以后再聊，我们就当重新认识吧"
+}
+
+// describeUserData 用几句话说明存了哪些数据，完整导出走管理后台。
+func describeUserData(userID int64) string {
+	bundle, err := privacy.Export(userID)
+	if err != nil {
+		utils.Warn("export user data from chat incomplete: %v", err)
+	}
+	privacy.RecordRequest("export", privacy.RequestedByUser, privacyResult(err))
+
+	messages := 0
+	for _, session := range bundle.Sessions {
+		messages += len(session.Conversation)
+	}
+	interactions := 0
+	if bundle.EmotionalMemory != nil {
+		interactions = len(bundle.EmotionalMemory.Interactions)
+	}
+	moodDays := 0
+	if bundle.Mood != nil {
+		moodDays = len(bundle.Mood.Days)
+	}
+
+	lines := []string{"我这里存着你的这些数据："}
+	lines = append(lines, fmt.Sprintf("- 最近的聊天记录 %d 条", messages))
+	if len(bundle.Facts) > 0 {
+		summaries := make([]string, 0, privacyFactPreview)
+		for _, fact := range bundle.Facts {
+			if len(summaries) == privacyFactPreview {
+				break
+			}
+			summaries = append(summaries, fact.Summary)
+		}
+		lines = append(lines, fmt.Sprintf("- 记住的事 %d 条：%s", len(bundle.Facts), strings.Join(summaries, "；")))
+	}
+	if bundle.Profile != nil {
+		if len(bundle.Profile.Likes) > 0 {
+			lines = append(lines, "- 你喜欢："+strings.Join(bundle.Profile.Likes, "、"))
+		}
+		if len(bundle.Profile.Dislikes) > 0 {
+			lines = append(lines, "- 你不喜欢："+strings.Join(bundle.Profile.Dislikes, "、"))
+		}
+	}
+	if bundle.Affinity != nil {
+		lines = append(lines, fmt.Sprintf("- 我们的关系：%s（好感 %.0f/100）", service.RelationshipStageLabel(bundle.Affinity.Stage), bundle.Affinity.Score))
+	}
+	if len(bundle.CrisisEvents) > 0 {
+		lines = append(lines, fmt.Sprintf("- 让我担心你安全的消息记录 %d 条", len(bundle.CrisisEvents)))
+	}
+	lines = append(lines,
+		fmt.Sprintf("- 过往聊天的回忆 %d 段", len(bundle.Episodes)),
+		fmt.Sprintf("- 心情记录 %d 条", interactions),
+		fmt.Sprintf("- 每天的心情汇总 %d 天", moodDays),
+		fmt.Sprintf("- 提醒 %d 个", len(bundle.Reminders)),
+		"完整的导出文件可以找管理员要。想让我全部忘掉的话，说「删除我的数据」。",
+	)
+	return strings.Join(lines, "\n")
+}
+
+func privacyResult(err error) string {
+	if err != nil {
+		return "partial"
+	}
+	return "ok"
+}
+
+// parsePrivacyCommand 只认完整的指令句，去掉首尾标点后比较，避免聊天里顺口提到被误触发。
+func parsePrivacyCommand(message string) privacyCommand {
+	text := strings.TrimSpace(strings.Trim(strings.TrimSpace(message), "。！!？?~～ "))
+	text = strings.TrimPrefix(text, "请")
+	return privacyCommands[text]
+}
+
+func privacyNow(ctx MessageContext) time.Time {
+	if ctx.ReceivedAt.IsZero() {
+		return clock.Now()
+	}
+	return ctx.ReceivedAt
+}
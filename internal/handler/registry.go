@@ -0,0 +1,348 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"project-yume/internal/config"
+	"project-yume/internal/state"
+	"project-yume/internal/utils"
+)
+
+// 内置处理器名称
+const (
+	HandlerPreset   = "preset"
+	HandlerEmotion  = "emotion"
+	HandlerLongChat = "long_chat"
+	HandlerReminder = "reminder"
+	HandlerPrivacy  = "privacy"
+	HandlerCrisis   = "crisis"
+	// HandlerFallback 没有处理器接手时的兜底回复，仅出现在分发记录中。
+	HandlerFallback = "fallback"
+)
+
+// HandlerSpec 描述一个注册到路由表的处理器。
+// States 为空表示可以处理任意状态；Priority 越大越先尝试。
+type HandlerSpec struct {
+	Name     string
+	Priority int
+	States   []state.BotState
+	Disabled bool
+	Handler  MessageHandler
+}
+
+// HandlerInfo 是处理器在当前配置下的生效视图。
+type HandlerInfo struct {
+	Name     string   `json:"name"`
+	Priority int      `json:"priority"`
+	States   []string `json:"states"`
+	Enabled  bool     `json:"enabled"`
+}
+
+// HandlerRegistry 按名称管理消息处理器，并根据配置计算每个状态的路由。
+type HandlerRegistry struct {
+	mu    sync.RWMutex
+	specs map[string]HandlerSpec
+}
+
+var defaultRegistry = NewHandlerRegistry()
+
+func init() {
+	defaultRegistry.MustRegister(HandlerSpec{
+		Name:     HandlerPrivacy,
+		Priority: 500,
+		Handler:  NewPrivacyHandler(),
+	})
+	defaultRegistry.MustRegister(HandlerSpec{
+		Name:     HandlerReminder,
+		Priority: 400,
+		Handler:  NewReminderHandler(),
+	})
+	defaultRegistry.MustRegister(HandlerSpec{
+		Name:     HandlerPreset,
+		Priority: 300,
+		States:   []state.BotState{state.StateIdle},
+		Handler:  NewPresetHandler(),
+	})
+	defaultRegistry.MustRegister(HandlerSpec{
+		Name:     HandlerEmotion,
+		Priority: 200,
+		States:   []state.BotState{state.StateIdle},
+		Handler:  NewEmotionHandler(),
+	})
+	defaultRegistry.MustRegister(HandlerSpec{
+		Name:     HandlerLongChat,
+		Priority: 100,
+		States:   []state.BotState{state.StateLongChat},
+		Handler:  NewLongChatHandler(),
+	})
+	// 守护期间隐私和提醒指令照常可用，其余消息都由它回复
+	defaultRegistry.MustRegister(HandlerSpec{
+		Name:     HandlerCrisis,
+		Priority: 50,
+		States:   []state.BotState{state.StateGuarded},
+		Handler:  NewCrisisHandler(),
+	})
+}
+
+func NewHandlerRegistry() *HandlerRegistry {
+	return &HandlerRegistry{
+		specs: make(map[string]HandlerSpec),
+	}
+}
+
+// DefaultRegistry 返回全局处理器注册表。新增处理器（游戏、指令、提醒等）
+// 在启动时调用 RegisterHandler 即可接入，无需修改 NewMessageProcessor。
+func DefaultRegistry() *HandlerRegistry {
+	return defaultRegistry
+}
+
+// RegisterHandler 向全局注册表登记处理器。
+func RegisterHandler(spec HandlerSpec) error {
+	return defaultRegistry.Register(spec)
+}
+
+// Register 登记处理器，同名处理器会被覆盖。
+func (r *HandlerRegistry) Register(spec HandlerSpec) error {
+	spec.Name = normalizeHandlerName(spec.Name)
+	if spec.Name == "" {
+		return fmt.Errorf("handler name is required")
+	}
+	if spec.Handler == nil {
+		return fmt.Errorf("handler %s has no implementation", spec.Name)
+	}
+	spec.States = append([]state.BotState(nil), spec.States...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.specs[spec.Name] = spec
+	return nil
+}
+
+func (r *HandlerRegistry) MustRegister(spec HandlerSpec) {
+	if err := r.Register(spec); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup 按名称获取已启用的处理器。
+func (r *HandlerRegistry) Lookup(name string) (MessageHandler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	spec, ok := r.specs[normalizeHandlerName(name)]
+	if !ok {
+		return nil, false
+	}
+	spec = applyHandlerOverrides(spec, currentHandlerOverrides())
+	if spec.Disabled {
+		return nil, false
+	}
+	return spec.Handler, true
+}
+
+// Route 返回某个状态下按顺序尝试的处理器。
+// 配置了 HANDLER_ROUTES 的状态按配置顺序，否则按注册的状态与优先级排序。
+func (r *HandlerRegistry) Route(botState state.BotState) []HandlerSpec {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.routeLocked(botState, currentHandlerOverrides())
+}
+
+// Routes 返回全部状态的生效路由表（处理器名称）。
+func (r *HandlerRegistry) Routes() map[string][]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	overrides := currentHandlerOverrides()
+	routes := make(map[string][]string)
+	for _, botState := range state.AllBotStates() {
+		specs := r.routeLocked(botState, overrides)
+		names := make([]string, 0, len(specs))
+		for _, spec := range specs {
+			names = append(names, spec.Name)
+		}
+		routes[botState.String()] = names
+	}
+	return routes
+}
+
+// Handlers 返回全部已注册处理器在当前配置下的状态，按优先级排序。
+func (r *HandlerRegistry) Handlers() []HandlerInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	overrides := currentHandlerOverrides()
+	specs := make([]HandlerSpec, 0, len(r.specs))
+	for _, spec := range r.specs {
+		specs = append(specs, applyHandlerOverrides(spec, overrides))
+	}
+	sortHandlerSpecs(specs)
+
+	infos := make([]HandlerInfo, 0, len(specs))
+	for _, spec := range specs {
+		states := make([]string, 0, len(spec.States))
+		for _, botState := range spec.States {
+			states = append(states, botState.String())
+		}
+		infos = append(infos, HandlerInfo{
+			Name:     spec.Name,
+			Priority: spec.Priority,
+			States:   states,
+			Enabled:  !spec.Disabled,
+		})
+	}
+	return infos
+}
+
+func (r *HandlerRegistry) routeLocked(botState state.BotState, overrides handlerOverrides) []HandlerSpec {
+	if names, ok := overrides.routes[botState]; ok {
+		specs := make([]HandlerSpec, 0, len(names))
+		for _, name := range names {
+			spec, exists := r.specs[name]
+			if !exists {
+				continue
+			}
+			spec = applyHandlerOverrides(spec, overrides)
+			if spec.Disabled {
+				continue
+			}
+			specs = append(specs, spec)
+		}
+		return specs
+	}
+
+	specs := make([]HandlerSpec, 0, len(r.specs))
+	for _, spec := range r.specs {
+		spec = applyHandlerOverrides(spec, overrides)
+		if spec.Disabled || !handlesState(spec, botState) {
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	sortHandlerSpecs(specs)
+	return specs
+}
+
+func handlesState(spec HandlerSpec, botState state.BotState) bool {
+	if len(spec.States) == 0 {
+		return true
+	}
+	for _, candidate := range spec.States {
+		if candidate == botState {
+			return true
+		}
+	}
+	return false
+}
+
+func sortHandlerSpecs(specs []HandlerSpec) {
+	sort.SliceStable(specs, func(i, j int) bool {
+		if specs[i].Priority != specs[j].Priority {
+			return specs[i].Priority > specs[j].Priority
+		}
+		return specs[i].Name < specs[j].Name
+	})
+}
+
+// handlerOverrides 是从配置解析出的禁用列表、优先级与路由覆盖。
+type handlerOverrides struct {
+	disabled   map[string]bool
+	priorities map[string]int
+	routes     map[state.BotState][]string
+}
+
+var overridesCache struct {
+	sync.Mutex
+	key    string
+	parsed handlerOverrides
+}
+
+// currentHandlerOverrides 按配置原文缓存解析结果，配置热更新后自动失效。
+func currentHandlerOverrides() handlerOverrides {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return handlerOverrides{}
+	}
+
+	key := strings.Join(cfg.DisabledHandlers, ",") + "\x00" + cfg.HandlerPriorities + "\x00" + cfg.HandlerRoutes
+	overridesCache.Lock()
+	defer overridesCache.Unlock()
+	if overridesCache.parsed.disabled == nil || overridesCache.key != key {
+		overridesCache.key = key
+		overridesCache.parsed = parseHandlerOverrides(cfg.DisabledHandlers, cfg.HandlerPriorities, cfg.HandlerRoutes)
+	}
+	return overridesCache.parsed
+}
+
+func applyHandlerOverrides(spec HandlerSpec, overrides handlerOverrides) HandlerSpec {
+	if overrides.disabled[spec.Name] {
+		spec.Disabled = true
+	}
+	if priority, ok := overrides.priorities[spec.Name]; ok {
+		spec.Priority = priority
+	}
+	return spec
+}
+
+// parseHandlerOverrides 解析处理器配置：
+// priorities 形如 "preset:300,emotion:200"；
+// routes 形如 "idle=preset|emotion;long_chat=long_chat"。
+// 无法识别的条目会被跳过并记录警告。
+func parseHandlerOverrides(disabled []string, priorities, routes string) handlerOverrides {
+	overrides := handlerOverrides{
+		disabled:   make(map[string]bool),
+		priorities: make(map[string]int),
+		routes:     make(map[state.BotState][]string),
+	}
+
+	for _, name := range disabled {
+		if normalized := normalizeHandlerName(name); normalized != "" {
+			overrides.disabled[normalized] = true
+		}
+	}
+
+	for _, item := range strings.Split(priorities, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, rawPriority, ok := strings.Cut(item, ":")
+		priority, err := strconv.Atoi(strings.TrimSpace(rawPriority))
+		if !ok || err != nil || normalizeHandlerName(name) == "" {
+			utils.Warn("忽略无效的处理器优先级配置: %q", item)
+			continue
+		}
+		overrides.priorities[normalizeHandlerName(name)] = priority
+	}
+
+	for _, item := range strings.Split(routes, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		rawState, rawHandlers, ok := strings.Cut(item, "=")
+		botState, known := state.ParseBotState(rawState)
+		if !ok || !known {
+			utils.Warn("忽略无效的处理器路由配置: %q", item)
+			continue
+		}
+		names := make([]string, 0)
+		for _, name := range strings.Split(rawHandlers, "|") {
+			if normalized := normalizeHandlerName(name); normalized != "" {
+				names = append(names, normalized)
+			}
+		}
+		overrides.routes[botState] = names
+	}
+
+	return overrides
+}
+
+func normalizeHandlerName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"project-yume/internal/state"
+)
+
+type stubHandler struct{}
+
+func (stubHandler) CanHandle(ctx MessageContext, sm *state.StateManager) bool { return true }
+
+func (stubHandler) Handle(runCtx context.Context, c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (*ProcessResult, error) {
+	return &ProcessResult{Handled: true}, nil
+}
+
+func routeNames(specs []HandlerSpec) []string {
+	names := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		names = append(names, spec.Name)
+	}
+	return names
+}
+
+func TestRouteOrdersByPriorityAndState(t *testing.T) {
+	registry := NewHandlerRegistry()
+	registry.MustRegister(HandlerSpec{Name: "low", Priority: 1, Handler: stubHandler{}})
+	registry.MustRegister(HandlerSpec{Name: "high", Priority: 10, States: []state.BotState{state.StateIdle}, Handler: stubHandler{}})
+	registry.MustRegister(HandlerSpec{Name: "busy_only", Priority: 20, States: []state.BotState{state.StateBusy}, Handler: stubHandler{}})
+
+	overrides := parseHandlerOverrides(nil, "", "")
+	got := routeNames(registry.routeLocked(state.StateIdle, overrides))
+	if len(got) != 2 || got[0] != "high" || got[1] != "low" {
+		t.Fatalf("unexpected idle route: %v", got)
+	}
+}
+
+func TestRouteAppliesConfigOverrides(t *testing.T) {
+	registry := NewHandlerRegistry()
+	registry.MustRegister(HandlerSpec{Name: "preset", Priority: 300, States: []state.BotState{state.StateIdle}, Handler: stubHandler{}})
+	registry.MustRegister(HandlerSpec{Name: "emotion", Priority: 200, States: []state.BotState{state.StateIdle}, Handler: stubHandler{}})
+	registry.MustRegister(HandlerSpec{Name: "game", Priority: 50, Handler: stubHandler{}})
+
+	overrides := parseHandlerOverrides([]string{"Preset"}, "game:900, bad", "busy=emotion|missing; unknown=emotion")
+
+	idle := routeNames(registry.routeLocked(state.StateIdle, overrides))
+	if len(idle) != 2 || idle[0] != "game" || idle[1] != "emotion" {
+		t.Fatalf("unexpected idle route: %v", idle)
+	}
+
+	busy := routeNames(registry.routeLocked(state.StateBusy, overrides))
+	if len(busy) != 1 || busy[0] != "emotion" {
+		t.Fatalf("unexpected busy route: %v", busy)
+	}
+}
+
+func TestOnlyLongChatRouteKeepsCommandHandlers(t *testing.T) {
+	registry := NewHandlerRegistry()
+	registry.MustRegister(HandlerSpec{Name: HandlerPrivacy, Priority: 500, Handler: stubHandler{}})
+	registry.MustRegister(HandlerSpec{Name: HandlerReminder, Priority: 400, Handler: stubHandler{}})
+	registry.MustRegister(HandlerSpec{Name: HandlerPreset, Priority: 300, States: []state.BotState{state.StateIdle}, Handler: stubHandler{}})
+	registry.MustRegister(HandlerSpec{Name: HandlerEmotion, Priority: 200, States: []state.BotState{state.StateIdle}, Handler: stubHandler{}})
+	registry.MustRegister(HandlerSpec{Name: HandlerLongChat, Priority: 100, States: []state.BotState{state.StateLongChat}, Handler: stubHandler{}})
+	mp := &MessageProcessor{registry: registry}
+
+	overrides := parseHandlerOverrides(nil, "", "")
+	got := routeNames(mp.onlyLongChatRoute(registry.routeLocked(state.StateIdle, overrides)))
+	if len(got) != 3 || got[0] != HandlerPrivacy || got[1] != HandlerReminder || got[2] != HandlerLongChat {
+		t.Fatalf("only-long-chat route should keep privacy and reminder first, got %v", got)
+	}
+
+	// 被禁用的指令处理器不会被加回来
+	overrides = parseHandlerOverrides([]string{HandlerReminder}, "", "")
+	got = routeNames(mp.onlyLongChatRoute(registry.routeLocked(state.StateIdle, overrides)))
+	if len(got) != 2 || got[0] != HandlerPrivacy || got[1] != HandlerLongChat {
+		t.Fatalf("disabled reminder handler should stay out, got %v", got)
+	}
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/metrics"
+	"project-yume/internal/reminder"
+	"project-yume/internal/service"
+	"project-yume/internal/state"
+	"project-yume/internal/utils"
+)
+
+// ReminderHandler 处理聊天里的提醒指令：新建、查看、取消。
+// 到点投递由 scheduler.ReminderScheduler 负责。
+type ReminderHandler struct{}
+
+func NewReminderHandler() *ReminderHandler {
+	return &ReminderHandler{}
+}
+
+func (h *ReminderHandler) CanHandle(ctx MessageContext, sm *state.StateManager) bool {
+	if !config.GetConfig().EnableReminders {
+		return false
+	}
+	_, ok := parseReminderCommand(ctx)
+	return ok
+}
+
+func (h *ReminderHandler) Handle(runCtx context.Context, c *websocket.Conn, ctx MessageContext, sm *state.StateManager) (*ProcessResult, error) {
+	command, ok := parseReminderCommand(ctx)
+	if !ok {
+		return nil, nil
+	}
+
+	var reply string
+	switch command.Kind {
+	case reminder.CommandCreate:
+		reply = createReminder(ctx, command)
+	case reminder.CommandList:
+		reply = listReminders(ctx)
+	case reminder.CommandCancel:
+		reply = cancelReminders(ctx, command)
+	}
+	metrics.IncCounter(
+		"bot_reminder_commands_total",
+		"Total reminder chat commands by kind.",
+		map[string]string{"kind": reminderCommandName(command.Kind)},
+	)
+
+	if sent, err := service.SendMsgWithContext(runCtx, c, ctx.UserID, reply); err != nil {
+		return interruptedResult(sent, err)
+	}
+	return &ProcessResult{
+		Handled:   true,
+		Replied:   true,
+		ReplyMode: service.ReplyModeFullReply,
+		Reply:     reply,
+	}, nil
+}
+
+func parseReminderCommand(ctx MessageContext) (reminder.Command, bool) {
+	location, _ := service.TimeContextLocation()
+	return reminder.ParseCommand(ctx.Message, reminderNow(ctx), location)
+}
+
+func reminderNow(ctx MessageContext) time.Time {
+	if ctx.ReceivedAt.IsZero() {
+		return clock.Now()
+	}
+	return ctx.ReceivedAt
+}
+
+func createReminder(ctx MessageContext, command reminder.Command) string {
+	location, _ := service.TimeContextLocation()
+	now := reminderNow(ctx)
+	if command.Time.InvalidDate {
+		return "这个日期好像不存在诶，是哪一天呀？"
+	}
+	content := command.Content
+	if content == "" {
+		content = "你让我提醒的事"
+	}
+
+	created, err := reminder.GetManager().Add(reminder.Reminder{
+		UserID:        ctx.UserID,
+		SessionID:     ctx.SessionID,
+		Content:       content,
+		DueAt:         command.Time.At,
+		Repeat:        command.Time.Repeat,
+		SourceMessage: ctx.Message,
+	})
+	if err != nil {
+		utils.Warn("创建提醒失败: %v", err)
+		if !command.Time.At.After(clock.Now()) {
+			return "这个时间已经过去了诶，换个时间？"
+		}
+		return fmt.Sprintf("提醒有点多了，先取消几个吧（最多 %d 个）", reminder.MaxActivePerUser)
+	}
+
+	utils.Infow("reminder created",
+		utils.String("request_id", ctx.RequestID),
+		utils.String("session_id", ctx.SessionID),
+		utils.String("reminder_id", created.ID),
+		utils.String("due_at", created.DueAt.Format(time.RFC3339)),
+		utils.String("repeat", string(created.Repeat)),
+	)
+	return fmt.Sprintf("好，%s提醒你%s", reminder.DescribeTime(created.DueAt, created.Repeat, now, location), created.Content)
+}
+
+func listReminders(ctx MessageContext) string {
+	items := reminder.GetManager().List(ctx.UserID)
+	if len(items) == 0 {
+		return "你现在没有提醒哦"
+	}
+	return "你现在有这些提醒：\n" + formatReminderList(items, reminderNow(ctx))
+}
+
+func cancelReminders(ctx MessageContext, command reminder.Command) string {
+	manager := reminder.GetManager()
+	if command.CancelAll {
+		if count := manager.CancelAll(ctx.UserID); count > 0 {
+			return fmt.Sprintf("好，%d 个提醒都取消了", count)
+		}
+		return "你现在没有提醒哦"
+	}
+
+	items := manager.List(ctx.UserID)
+	if len(items) == 0 {
+		return "你现在没有提醒哦"
+	}
+
+	var targets []reminder.Reminder
+	switch {
+	case command.CancelIndex > 0:
+		if command.CancelIndex > len(items) {
+			return fmt.Sprintf("没有第 %d 个提醒，你现在有这些：\n%s", command.CancelIndex, formatReminderList(items, reminderNow(ctx)))
+		}
+		targets = items[command.CancelIndex-1 : command.CancelIndex]
+	case command.CancelKeyword != "":
+		for _, item := range items {
+			if strings.Contains(item.Content, command.CancelKeyword) || strings.Contains(command.CancelKeyword, item.Content) {
+				targets = append(targets, item)
+			}
+		}
+		if len(targets) == 0 {
+			return "没找到这个提醒，你现在有这些：\n" + formatReminderList(items, reminderNow(ctx))
+		}
+	case len(items) == 1:
+		targets = items
+	default:
+		return "要取消哪一个？告诉我序号就行：\n" + formatReminderList(items, reminderNow(ctx))
+	}
+
+	cancelled := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if item, ok := manager.Cancel(ctx.UserID, target.ID); ok {
+			cancelled = append(cancelled, item.Content)
+		}
+	}
+	return "好，取消了：" + strings.Join(cancelled, "、")
+}
+
+func formatReminderList(items []reminder.Reminder, now time.Time) string {
+	location, _ := service.TimeContextLocation()
+	lines := make([]string, 0, len(items))
+	for i, item := range items {
+		lines = append(lines, fmt.Sprintf("%d. %s %s", i+1, reminder.DescribeTime(item.DueAt, item.Repeat, now, location), item.Content))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func reminderCommandName(kind reminder.CommandKind) string {
+	switch kind {
+	case reminder.CommandCreate:
+		return "create"
+	case reminder.CommandList:
+		return "list"
+	case reminder.CommandCancel:
+		return "cancel"
+	default:
+		return "none"
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"project-yume/internal/clock"
 	"project-yume/internal/config"
 	"project-yume/internal/model"
 	"project-yume/internal/state"
@@ -33,7 +34,7 @@ func NewMessageAggregator() *MessageAggregator {
 func (a *MessageAggregator) Run(ctx context.Context, in <-chan model.Msg, out chan<- model.Msg) {
 	defer close(out)
 
-	ticker := time.NewTicker(defaultAggregationSweepInterval)
+	ticker := clock.NewTicker(defaultAggregationSweepInterval)
 	defer ticker.Stop()
 
 	for {
@@ -64,7 +65,7 @@ func (a *MessageAggregator) handleMessage(ctx context.Context, msg model.Msg, ou
 		return
 	}
 
-	now := time.Now()
+	now := clock.Now()
 	idleWindow, maxWindow, maxMessages := currentAggregationLimits()
 	bucket := a.buckets[sessionID]
 
@@ -96,7 +97,7 @@ func (a *MessageAggregator) handleMessage(ctx context.Context, msg model.Msg, ou
 }
 
 func (a *MessageAggregator) flushExpired(ctx context.Context, out chan<- model.Msg) {
-	now := time.Now()
+	now := clock.Now()
 	idleWindow, maxWindow, _ := currentAggregationLimits()
 
 	for sessionID, bucket := range a.buckets {
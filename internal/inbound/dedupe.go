@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"project-yume/internal/clock"
 	"project-yume/internal/handler"
 )
 
@@ -35,7 +36,7 @@ func (s *DedupeStage) Process(ctx *handler.MessageContext) error {
 		return nil
 	}
 
-	now := time.Now()
+	now := clock.Now()
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -0,0 +1,171 @@
+package inbound
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/handler"
+	"project-yume/internal/metrics"
+)
+
+const defaultInterruptGraceWindow = 15 * time.Second
+
+// InterruptCoordinator 负责同一会话内消息处理的串行化与打断。
+// 新消息到达时，如果上一轮仍在生成且未超过宽限窗口，则取消上一轮，
+// 等它退出后把两轮消息合并成一次重新分析。
+type InterruptCoordinator struct {
+	mu   sync.Mutex
+	runs map[string]*InflightRun
+}
+
+// InflightRun 表示某个会话中一次排队或正在执行的处理。
+type InflightRun struct {
+	coordinator *InterruptCoordinator
+	sessionID   string
+	message     handler.MessageContext
+	registered  time.Time
+	ctx         context.Context
+	cancel      context.CancelFunc
+	prev        *InflightRun
+	done        chan struct{}
+
+	mu          sync.Mutex
+	interrupted bool
+	merged      handler.MessageContext
+}
+
+func NewInterruptCoordinator() *InterruptCoordinator {
+	return &InterruptCoordinator{
+		runs: make(map[string]*InflightRun),
+	}
+}
+
+// Begin 为消息登记一次处理。调用方应在独立协程中先 Wait 再处理，最后调用 Finish。
+func (ic *InterruptCoordinator) Begin(parent context.Context, msg handler.MessageContext) *InflightRun {
+	runCtx, cancel := context.WithCancel(parent)
+	run := &InflightRun{
+		coordinator: ic,
+		sessionID:   msg.SessionID,
+		message:     msg,
+		registered:  clock.Now(),
+		ctx:         runCtx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+
+	ic.mu.Lock()
+	prev := ic.runs[msg.SessionID]
+	ic.runs[msg.SessionID] = run
+	ic.mu.Unlock()
+
+	if prev != nil && !prev.finished() {
+		run.prev = prev
+		if interruptEnabled() && run.registered.Sub(prev.registered) <= currentInterruptGraceWindow() {
+			prev.cancel()
+		}
+	}
+	return run
+}
+
+// Context 返回本轮处理使用的可取消上下文。
+func (r *InflightRun) Context() context.Context {
+	return r.ctx
+}
+
+// Wait 等待同会话上一轮处理结束。若上一轮被打断，返回合并后的消息上下文。
+func (r *InflightRun) Wait() handler.MessageContext {
+	if r.prev == nil {
+		return r.message
+	}
+
+	// 即使本轮已被取消也要等上一轮退出，保证被打断的消息能沿链条继续合并。
+	<-r.prev.done
+
+	prevMessage, interrupted := r.prev.result()
+	r.prev = nil
+	if !interrupted {
+		return r.message
+	}
+
+	metrics.IncCounter(
+		"bot_interrupt_total",
+		"Total in-flight replies interrupted by follow-up messages.",
+		map[string]string{"result": "merged"},
+	)
+	r.message = MergeMessageContexts(prevMessage, r.message)
+	return r.message
+}
+
+// Finish 标记本轮结束。interrupted 为 true 时，下一轮会把本轮消息合并进来重跑。
+func (r *InflightRun) Finish(interrupted bool) {
+	r.mu.Lock()
+	r.interrupted = interrupted
+	r.merged = r.message
+	r.mu.Unlock()
+
+	r.cancel()
+	close(r.done)
+
+	r.coordinator.mu.Lock()
+	if r.coordinator.runs[r.sessionID] == r {
+		delete(r.coordinator.runs, r.sessionID)
+	}
+	r.coordinator.mu.Unlock()
+}
+
+func (r *InflightRun) finished() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *InflightRun) result() (handler.MessageContext, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.merged, r.interrupted
+}
+
+// MergeMessageContexts 把被打断的上一轮消息与新消息合并为一次处理。
+func MergeMessageContexts(prev, next handler.MessageContext) handler.MessageContext {
+	merged := next
+	merged.MessageIDs = append(append([]int64(nil), prev.MessageIDs...), next.MessageIDs...)
+	merged.RawSegments = append(append([]string(nil), prev.RawSegments...), next.RawSegments...)
+	merged.Parts = append(append(merged.Parts[:0:0], prev.Parts...), next.Parts...)
+	merged.SegmentCount = len(merged.RawSegments)
+	merged.Aggregated = true
+	merged.RawMessage = joinNonEmpty(prev.RawMessage, next.RawMessage)
+	merged.Message = joinNonEmpty(prev.Message, next.Message)
+	if !prev.StartedAt.IsZero() {
+		merged.StartedAt = prev.StartedAt
+	}
+	return merged
+}
+
+func joinNonEmpty(values ...string) string {
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			parts = append(parts, value)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func interruptEnabled() bool {
+	return config.GetConfig().EnableInterruptMerge
+}
+
+func currentInterruptGraceWindow() time.Duration {
+	window := time.Duration(config.GetConfig().InterruptGraceWindowMs) * time.Millisecond
+	if window <= 0 {
+		return defaultInterruptGraceWindow
+	}
+	return window
+}
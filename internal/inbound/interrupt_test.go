@@ -0,0 +1,130 @@
+package inbound
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/handler"
+)
+
+func TestMergeMessageContexts(t *testing.T) {
+	started := time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name        string
+		prev        handler.MessageContext
+		next        handler.MessageContext
+		message     string
+		rawMessage  string
+		messageIDs  []int64
+		segments    []string
+		startedAt   time.Time
+		wantSession string
+	}{
+		{
+			name:        "keeps order and earliest start",
+			prev:        handler.MessageContext{SessionID: "private:1", MessageIDs: []int64{1}, RawSegments: []string{"在吗"}, RawMessage: "在吗", Message: "在吗", StartedAt: started},
+			next:        handler.MessageContext{SessionID: "private:1", MessageIDs: []int64{2, 3}, RawSegments: []string{"我想问", "明天几点"}, RawMessage: "我想问\n明天几点", Message: "我想问\n明天几点", StartedAt: started.Add(time.Second)},
+			message:     "在吗\n我想问\n明天几点",
+			rawMessage:  "在吗\n我想问\n明天几点",
+			messageIDs:  []int64{1, 2, 3},
+			segments:    []string{"在吗", "我想问", "明天几点"},
+			startedAt:   started,
+			wantSession: "private:1",
+		},
+		{
+			name:        "skips blank text",
+			prev:        handler.MessageContext{SessionID: "private:1", MessageIDs: []int64{4}, RawSegments: []string{"[图片]"}, RawMessage: "[图片]", Message: " "},
+			next:        handler.MessageContext{SessionID: "private:1", MessageIDs: []int64{5}, RawSegments: []string{"好看吗"}, RawMessage: "好看吗", Message: "好看吗", StartedAt: started},
+			message:     "好看吗",
+			rawMessage:  "[图片]\n好看吗",
+			messageIDs:  []int64{4, 5},
+			segments:    []string{"[图片]", "好看吗"},
+			startedAt:   started,
+			wantSession: "private:1",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			merged := MergeMessageContexts(tc.prev, tc.next)
+			if merged.Message != tc.message || merged.RawMessage != tc.rawMessage {
+				t.Fatalf("unexpected text: %q / %q", merged.Message, merged.RawMessage)
+			}
+			if !reflect.DeepEqual(merged.MessageIDs, tc.messageIDs) || !reflect.DeepEqual(merged.RawSegments, tc.segments) {
+				t.Fatalf("unexpected ids or segments: %v %v", merged.MessageIDs, merged.RawSegments)
+			}
+			if merged.SegmentCount != len(tc.segments) || !merged.Aggregated {
+				t.Fatalf("merged context should count all segments: %+v", merged)
+			}
+			if !merged.StartedAt.Equal(tc.startedAt) || merged.SessionID != tc.wantSession {
+				t.Fatalf("unexpected start or session: %v %q", merged.StartedAt, merged.SessionID)
+			}
+		})
+	}
+}
+
+func TestInterruptCoordinator(t *testing.T) {
+	cfg := config.GetConfig()
+	previousEnabled := cfg.EnableInterruptMerge
+	previousWindow := cfg.InterruptGraceWindowMs
+	t.Cleanup(func() {
+		cfg.EnableInterruptMerge = previousEnabled
+		cfg.InterruptGraceWindowMs = previousWindow
+		clock.Set(nil)
+	})
+	cfg.InterruptGraceWindowMs = 15000
+
+	cases := []struct {
+		name        string
+		enabled     bool
+		gap         time.Duration
+		interrupted bool
+		message     string
+	}{
+		{name: "follow-up inside grace window merges", enabled: true, gap: 3 * time.Second, interrupted: true, message: "第一句\n第二句"},
+		{name: "follow-up after grace window waits", enabled: true, gap: 20 * time.Second, message: "第二句"},
+		{name: "disabled only serializes", enabled: false, gap: time.Second, message: "第二句"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg.EnableInterruptMerge = tc.enabled
+			fake := clock.NewFake(time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC))
+			clock.Set(fake)
+
+			ic := NewInterruptCoordinator()
+			first := ic.Begin(context.Background(), handler.MessageContext{SessionID: "private:1", MessageIDs: []int64{1}, Message: "第一句"})
+			if msg := first.Wait(); msg.Message != "第一句" {
+				t.Fatalf("first run should not wait, got %q", msg.Message)
+			}
+
+			fake.Advance(tc.gap)
+			second := ic.Begin(context.Background(), handler.MessageContext{SessionID: "private:1", MessageIDs: []int64{2}, Message: "第二句"})
+			if cancelled := first.Context().Err() != nil; cancelled != tc.interrupted {
+				t.Fatalf("first run cancelled=%v, want %v", cancelled, tc.interrupted)
+			}
+
+			waited := make(chan handler.MessageContext, 1)
+			go func() { waited <- second.Wait() }()
+			select {
+			case <-waited:
+				t.Fatalf("second run must wait for the first to finish")
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			first.Finish(first.Context().Err() != nil)
+			msg := <-waited
+			if msg.Message != tc.message {
+				t.Fatalf("second run got %q, want %q", msg.Message, tc.message)
+			}
+			second.Finish(false)
+			if len(ic.runs) != 0 {
+				t.Fatalf("finished runs should be removed: %v", ic.runs)
+			}
+		})
+	}
+}
@@ -0,0 +1,440 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"project-yume/internal/config"
+	"project-yume/internal/storage"
+)
+
+// 关系阶段，名字与角色配置 responses 下的回复池一致。
+const (
+	AffinityStageStranger     = "stranger"
+	AffinityStageAcquaintance = "acquaintance"
+	AffinityStageFamiliar     = "familiar"
+	AffinityStageClose        = "close"
+)
+
+// AffinityStages 按亲近程度排序。
+var AffinityStages = []string{AffinityStageStranger, AffinityStageAcquaintance, AffinityStageFamiliar, AffinityStageClose}
+
+// 好感度变化的原因。
+const (
+	AffinityDailyChat        = "daily_chat"
+	AffinityMessage          = "message"
+	AffinityPositive         = "positive"
+	AffinityNegative         = "negative"
+	AffinityApology          = "apology"
+	AffinityLongChat         = "long_chat"
+	AffinityIgnoredProactive = "ignored_proactive"
+	AffinityIdle             = "idle"
+)
+
+const (
+	affinityInitialScore = 10
+	affinityMaxScore     = 100
+	// affinityDailyGainCap 每天靠聊天最多涨多少，刷消息涨不上去。道歉不计入。
+	affinityDailyGainCap = 6
+	// affinityLongChatMessages 一天聊到这么多条算一次长聊。
+	affinityLongChatMessages = 30
+	// affinityIdleGrace 多久不聊开始下降，之后每天降 affinityIdlePerDay。
+	affinityIdleGrace   = 7 * 24 * time.Hour
+	affinityIdlePerDay  = 1.0
+	affinityMaxIdleDrop = 20
+	// affinityTrendDays 保留的每日分数天数，affinityEventLimit 保留的事件条数（不含普通消息）。
+	affinityTrendDays  = 90
+	affinityEventLimit = 50
+)
+
+// affinityDeltas 各原因的分数变化。
+var affinityDeltas = map[string]float64{
+	AffinityDailyChat:        1,
+	AffinityMessage:          0.3,
+	AffinityPositive:         0.5,
+	AffinityApology:          2,
+	AffinityLongChat:         3,
+	AffinityIgnoredProactive: -2,
+}
+
+// affinityNegativeEmotions 对话里的负面语气，生气比敷衍扣得多。
+var affinityNegativeEmotions = map[string]float64{
+	"生气": -1.5,
+	"敷衍": -0.3,
+}
+
+var affinityApologyHints = []string{"对不起", "抱歉", "不好意思", "我错了", "别生气"}
+
+// defaultAffinityThresholds 进入认识、熟悉、亲近三个阶段的分数。
+var defaultAffinityThresholds = []int{20, 50, 80}
+
+// Affinity 某个用户的好感度。
+type Affinity struct {
+	UserID        int64           `json:"user_id"`
+	Score         float64         `json:"score"`
+	Stage         string          `json:"stage"`
+	Day           string          `json:"day"`
+	DayMessages   int             `json:"day_messages"`
+	DayGain       float64         `json:"day_gain"`
+	DayApologized bool            `json:"day_apologized,omitempty"`
+	LastMessageAt time.Time       `json:"last_message_at,omitempty"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+	Trend         []AffinityPoint `json:"trend"`
+	Events        []AffinityEvent `json:"events"`
+}
+
+// AffinityPoint 某天结束时的分数。
+type AffinityPoint struct {
+	Day   string  `json:"day"`
+	Score float64 `json:"score"`
+}
+
+// AffinityEvent 一次分数变化，普通消息不单独记录。
+type AffinityEvent struct {
+	At     time.Time `json:"at"`
+	Reason string    `json:"reason"`
+	Delta  float64   `json:"delta"`
+	Score  float64   `json:"score"`
+}
+
+// AffinityChange 一次记录的结果，Previous 与 Stage 不同时表示阶段变了。
+type AffinityChange struct {
+	Reasons  []string
+	Previous string
+	Stage    string
+	Score    float64
+}
+
+type AffinityManager struct {
+	mu       sync.RWMutex
+	affinity map[int64]*Affinity
+	store    storage.SnapshotStore
+	dirty    storage.DirtyMarker
+}
+
+var affinityManager *AffinityManager
+
+const AffinitySnapshotName = "memory/affinity.json"
+const AffinityFlushTaskName = "affinity"
+
+func init() {
+	affinityManager = &AffinityManager{
+		affinity: make(map[int64]*Affinity),
+	}
+}
+
+func GetAffinityManager() *AffinityManager {
+	return affinityManager
+}
+
+// RecordMessage 按用户的一条消息更新好感度：每天第一次聊天、消息数、语气、道歉和长聊会加分，
+// 很久没聊会先扣掉空闲的分。
+func (am *AffinityManager) RecordMessage(userID int64, message, emotion, intention string, at time.Time) AffinityChange {
+	if userID == 0 {
+		return AffinityChange{}
+	}
+
+	am.mu.Lock()
+	record := am.ensureLocked(userID, at)
+	change := AffinityChange{Previous: record.Stage}
+
+	if idle := at.Sub(record.LastMessageAt); !record.LastMessageAt.IsZero() && idle > affinityIdleGrace {
+		days := math.Floor((idle-affinityIdleGrace).Hours()/24) + 1
+		record.apply(AffinityIdle, -math.Min(days*affinityIdlePerDay, affinityMaxIdleDrop), at, &change)
+	}
+	if record.rollDay(at) {
+		record.gain(AffinityDailyChat, at, &change)
+	}
+	record.DayMessages++
+	record.LastMessageAt = at
+	record.gain(AffinityMessage, at, &change)
+
+	if emotion == "开心" {
+		record.gain(AffinityPositive, at, &change)
+	}
+	if delta, ok := affinityNegativeEmotions[emotion]; ok {
+		record.apply(AffinityNegative, delta, at, &change)
+	}
+	if !record.DayApologized && (intention == "和对方道歉" || containsAnyText(message, affinityApologyHints)) {
+		record.DayApologized = true
+		record.apply(AffinityApology, affinityDeltas[AffinityApology], at, &change)
+	}
+	if record.DayMessages == affinityLongChatMessages {
+		record.gain(AffinityLongChat, at, &change)
+	}
+
+	record.finish(at, &change)
+	am.mu.Unlock()
+
+	am.markDirty()
+	return change
+}
+
+// RecordIgnoredProactive 主动发的消息到下一次主动之前都没等到回复。
+func (am *AffinityManager) RecordIgnoredProactive(userID int64, at time.Time) AffinityChange {
+	if userID == 0 {
+		return AffinityChange{}
+	}
+
+	am.mu.Lock()
+	record := am.ensureLocked(userID, at)
+	change := AffinityChange{Previous: record.Stage}
+	record.apply(AffinityIgnoredProactive, affinityDeltas[AffinityIgnoredProactive], at, &change)
+	record.finish(at, &change)
+	am.mu.Unlock()
+
+	am.markDirty()
+	return change
+}
+
+// GetAffinity 返回用户好感度的副本。
+func (am *AffinityManager) GetAffinity(userID int64) (Affinity, bool) {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+
+	record := am.affinity[userID]
+	if record == nil {
+		return Affinity{}, false
+	}
+	return cloneAffinity(record), true
+}
+
+// Stage 返回用户当前的关系阶段，没有记录时为陌生。
+func (am *AffinityManager) Stage(userID int64) string {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+
+	if record := am.affinity[userID]; record != nil {
+		return record.Stage
+	}
+	return AffinityStageStranger
+}
+
+// Score 返回用户当前的好感度，没有记录时为初始值。
+func (am *AffinityManager) Score(userID int64) float64 {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+
+	if record := am.affinity[userID]; record != nil {
+		return record.Score
+	}
+	return affinityInitialScore
+}
+
+// AffinityUserIDs 返回有好感度记录的用户。
+func (am *AffinityManager) AffinityUserIDs() []int64 {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return sortedUserIDs(am.affinity)
+}
+
+// DeleteUser 删除用户的好感度，返回是否存在。
+func (am *AffinityManager) DeleteUser(userID int64) bool {
+	am.mu.Lock()
+	_, ok := am.affinity[userID]
+	delete(am.affinity, userID)
+	am.mu.Unlock()
+
+	if ok {
+		am.markDirty()
+	}
+	return ok
+}
+
+// AffinityStageFor 按配置的阈值把分数换成阶段。
+func AffinityStageFor(score float64) string {
+	thresholds := config.GetConfig().AffinityStageThresholds
+	if !validAffinityThresholds(thresholds) {
+		thresholds = defaultAffinityThresholds
+	}
+	stage := AffinityStageStranger
+	for i, threshold := range thresholds {
+		if score >= float64(threshold) {
+			stage = AffinityStages[i+1]
+		}
+	}
+	return stage
+}
+
+func validAffinityThresholds(thresholds []int) bool {
+	if len(thresholds) != len(AffinityStages)-1 {
+		return false
+	}
+	for i := 1; i < len(thresholds); i++ {
+		if thresholds[i] <= thresholds[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+func (am *AffinityManager) ConfigurePersistence(store storage.SnapshotStore, dirty storage.DirtyMarker) error {
+	am.mu.Lock()
+	am.store = store
+	am.dirty = dirty
+	am.mu.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	data, err := store.Load(AffinitySnapshotName)
+	if err != nil {
+		return fmt.Errorf("load affinity failed: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	loaded := make(map[int64]*Affinity)
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("unmarshal affinity failed: %w", err)
+	}
+
+	am.mu.Lock()
+	am.affinity = make(map[int64]*Affinity, len(loaded))
+	for userID, record := range loaded {
+		if record == nil {
+			continue
+		}
+		record.UserID = userID
+		// 阈值可能改过，按当前配置重算
+		record.Stage = AffinityStageFor(record.Score)
+		am.affinity[userID] = record
+	}
+	am.mu.Unlock()
+	return nil
+}
+
+func (am *AffinityManager) Flush() error {
+	am.mu.RLock()
+	store := am.store
+	snapshot := make(map[int64]Affinity, len(am.affinity))
+	for userID, record := range am.affinity {
+		snapshot[userID] = cloneAffinity(record)
+	}
+	am.mu.RUnlock()
+
+	if store == nil {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal affinity failed: %w", err)
+	}
+	if err := store.Save(AffinitySnapshotName, data); err != nil {
+		return fmt.Errorf("save affinity failed: %w", err)
+	}
+	return nil
+}
+
+func (am *AffinityManager) ensureLocked(userID int64, at time.Time) *Affinity {
+	if am.affinity == nil {
+		am.affinity = make(map[int64]*Affinity)
+	}
+	record := am.affinity[userID]
+	if record == nil {
+		record = &Affinity{
+			UserID:    userID,
+			Score:     affinityInitialScore,
+			Stage:     AffinityStageFor(affinityInitialScore),
+			UpdatedAt: at,
+		}
+		am.affinity[userID] = record
+	}
+	return record
+}
+
+func (am *AffinityManager) markDirty() {
+	am.mu.RLock()
+	dirty := am.dirty
+	am.mu.RUnlock()
+
+	if dirty != nil {
+		dirty.MarkDirty(AffinityFlushTaskName)
+	}
+}
+
+// rollDay 跨天时清空当天计数，返回是否是新的一天。
+func (a *Affinity) rollDay(at time.Time) bool {
+	day := at.Format("2006-01-02")
+	if a.Day == day {
+		return false
+	}
+	a.Day = day
+	a.DayMessages = 0
+	a.DayGain = 0
+	a.DayApologized = false
+	return true
+}
+
+// gain 计入每日上限的加分。
+func (a *Affinity) gain(reason string, at time.Time, change *AffinityChange) {
+	delta := math.Min(affinityDeltas[reason], affinityDailyGainCap-a.DayGain)
+	if delta <= 0 {
+		return
+	}
+	a.DayGain += delta
+	a.apply(reason, delta, at, change)
+}
+
+func (a *Affinity) apply(reason string, delta float64, at time.Time, change *AffinityChange) {
+	before := a.Score
+	a.Score = math.Max(0, math.Min(affinityMaxScore, a.Score+delta))
+	if a.Score == before {
+		return
+	}
+	change.Reasons = append(change.Reasons, reason)
+	if reason == AffinityMessage {
+		return
+	}
+	a.Events = append(a.Events, AffinityEvent{At: at, Reason: reason, Delta: roundAffinity(a.Score - before), Score: roundAffinity(a.Score)})
+	if overflow := len(a.Events) - affinityEventLimit; overflow > 0 {
+		a.Events = append([]AffinityEvent(nil), a.Events[overflow:]...)
+	}
+}
+
+// finish 更新阶段和当天的趋势点。
+func (a *Affinity) finish(at time.Time, change *AffinityChange) {
+	a.Score = roundAffinity(a.Score)
+	a.Stage = AffinityStageFor(a.Score)
+	a.UpdatedAt = at
+
+	day := at.Format("2006-01-02")
+	if last := len(a.Trend) - 1; last >= 0 && a.Trend[last].Day == day {
+		a.Trend[last].Score = a.Score
+	} else {
+		a.Trend = append(a.Trend, AffinityPoint{Day: day, Score: a.Score})
+	}
+	if overflow := len(a.Trend) - affinityTrendDays; overflow > 0 {
+		a.Trend = append([]AffinityPoint(nil), a.Trend[overflow:]...)
+	}
+
+	change.Stage = a.Stage
+	change.Score = a.Score
+}
+
+func roundAffinity(score float64) float64 {
+	return math.Round(score*100) / 100
+}
+
+func cloneAffinity(record *Affinity) Affinity {
+	cloned := *record
+	cloned.Trend = append([]AffinityPoint{}, record.Trend...)
+	cloned.Events = append([]AffinityEvent{}, record.Events...)
+	return cloned
+}
+
+func containsAnyText(text string, hints []string) bool {
+	for _, hint := range hints {
+		if strings.Contains(text, hint) {
+			return true
+		}
+	}
+	return false
+}
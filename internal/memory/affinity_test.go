@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"project-yume/internal/config"
+)
+
+func TestAffinityDailyCapApologyAndIdleDrop(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := cfg.AffinityStageThresholds
+	t.Cleanup(func() { cfg.AffinityStageThresholds = previous })
+	cfg.AffinityStageThresholds = []int{20, 50, 80}
+
+	am := &AffinityManager{affinity: make(map[int64]*Affinity)}
+	const userID = 7
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 40; i++ {
+		am.RecordMessage(userID, "今天好开心", "开心", "", start.Add(time.Duration(i)*time.Minute))
+	}
+	if score := am.Score(userID); score != 16 {
+		t.Fatalf("daily gain should be capped at 6, got %v", score)
+	}
+	am.RecordMessage(userID, "对不起嘛", "", "", start.Add(time.Hour))
+	am.RecordMessage(userID, "抱歉抱歉", "", "", start.Add(time.Hour+time.Minute))
+	if score := am.Score(userID); score != 18 {
+		t.Fatalf("apology should add 2 once per day past the cap, got %v", score)
+	}
+	if change := am.RecordIgnoredProactive(userID, start.Add(2*time.Hour)); change.Score != 16 || change.Stage != AffinityStageStranger {
+		t.Fatalf("ignored proactive should drop 2, got %+v", change)
+	}
+
+	change := am.RecordMessage(userID, "我回来了", "", "", start.Add(10*24*time.Hour))
+	if change.Score != 14.3 {
+		t.Fatalf("expected idle drop of 3 then daily gain, got %+v", change)
+	}
+	record, _ := am.GetAffinity(userID)
+	if len(record.Trend) != 2 || record.Trend[0].Score != 16 {
+		t.Fatalf("unexpected trend: %+v", record.Trend)
+	}
+	reasons := map[string]float64{}
+	for _, event := range record.Events {
+		if event.Reason == AffinityMessage {
+			t.Fatalf("plain messages should not be recorded as events")
+		}
+		reasons[event.Reason] += event.Delta
+	}
+	if reasons[AffinityIdle] != -3 || reasons[AffinityApology] != 2 || reasons[AffinityIgnoredProactive] != -2 || reasons[AffinityLongChat] != 0 {
+		t.Fatalf("unexpected events: %+v", record.Events)
+	}
+}
+
+func TestAffinityStageThresholds(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := cfg.AffinityStageThresholds
+	t.Cleanup(func() { cfg.AffinityStageThresholds = previous })
+
+	cfg.AffinityStageThresholds = []int{10, 30, 60}
+	if stage := AffinityStageFor(30); stage != AffinityStageFamiliar {
+		t.Fatalf("expected familiar at 30, got %s", stage)
+	}
+	cfg.AffinityStageThresholds = []int{50, 20}
+	if stage := AffinityStageFor(30); stage != AffinityStageAcquaintance {
+		t.Fatalf("invalid thresholds should fall back to defaults, got %s", stage)
+	}
+	if stage := AffinityStageFor(95); stage != AffinityStageClose {
+		t.Fatalf("expected close at 95, got %s", stage)
+	}
+}
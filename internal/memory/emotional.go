@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"project-yume/internal/clock"
 	"project-yume/internal/storage"
 	"project-yume/internal/utils"
 )
@@ -74,13 +75,13 @@ func (mm *MemoryManager) RecordInteraction(userID int64, userMsg, botReply, emot
 				EmotionCount:   make(map[string]int),
 				IntentionCount: make(map[string]int),
 			},
-			LastSeen: time.Now(),
+			LastSeen: clock.Now(),
 		}
 	}
 
 	memory := mm.memories[userID]
 	memory.mu.Lock()
-	now := time.Now()
+	now := clock.Now()
 	interaction := Interaction{
 		Timestamp: now,
 		UserMsg:   userMsg,
@@ -134,6 +135,44 @@ func (mm *MemoryManager) GetRecentEmotions(userID int64, count int) []string {
 	return emotions
 }
 
+// GetMemory 返回用户情感记忆的副本，没有记录时返回 nil。
+func (mm *MemoryManager) GetMemory(userID int64) *EmotionalMemory {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	memory := mm.memories[userID]
+	if memory == nil {
+		return nil
+	}
+	return cloneEmotionalMemory(memory)
+}
+
+// UserIDs 返回有情感记忆的用户。
+func (mm *MemoryManager) UserIDs() []int64 {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+	return sortedUserIDs(mm.memories)
+}
+
+// DeleteUser 删除用户的情感记忆，返回删除的交互条数。
+func (mm *MemoryManager) DeleteUser(userID int64) int {
+	mm.mu.Lock()
+	count := 0
+	memory := mm.memories[userID]
+	if memory != nil {
+		memory.mu.RLock()
+		count = len(memory.Interactions)
+		memory.mu.RUnlock()
+		delete(mm.memories, userID)
+	}
+	mm.mu.Unlock()
+
+	if memory != nil {
+		mm.markDirty()
+	}
+	return count
+}
+
 // GetConversationPattern 获取对话模式
 func (mm *MemoryManager) GetConversationPattern(userID int64) string {
 	mm.mu.RLock()
@@ -309,24 +348,27 @@ func (mm *MemoryManager) snapshotLocked() map[int64]*EmotionalMemory {
 			continue
 		}
 
-		memory.mu.RLock()
-		copyMemory := &EmotionalMemory{
-			UserID:       memory.UserID,
-			Interactions: append([]Interaction(nil), memory.Interactions...),
-			Preferences: Preferences{
-				EmotionCount:   cloneStringIntMap(memory.Preferences.EmotionCount),
-				IntentionCount: cloneStringIntMap(memory.Preferences.IntentionCount),
-			},
-			LastSeen: memory.LastSeen,
-		}
-		memory.mu.RUnlock()
-
-		result[userID] = copyMemory
+		result[userID] = cloneEmotionalMemory(memory)
 	}
 
 	return result
 }
 
+func cloneEmotionalMemory(memory *EmotionalMemory) *EmotionalMemory {
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	return &EmotionalMemory{
+		UserID:       memory.UserID,
+		Interactions: append([]Interaction(nil), memory.Interactions...),
+		Preferences: Preferences{
+			EmotionCount:   cloneStringIntMap(memory.Preferences.EmotionCount),
+			IntentionCount: cloneStringIntMap(memory.Preferences.IntentionCount),
+		},
+		LastSeen: memory.LastSeen,
+	}
+}
+
 func (mm *MemoryManager) normalizeMemoriesLocked() {
 	if mm.memories == nil {
 		mm.memories = make(map[int64]*EmotionalMemory)
@@ -0,0 +1,354 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/embedding"
+	"project-yume/internal/storage"
+	"project-yume/internal/utils"
+)
+
+const (
+	EpisodeSourceAI      = "ai"
+	EpisodeSourceExcerpt = "excerpt"
+)
+
+// Episode 一段过往对话的摘要，按空闲间隔切分。
+type Episode struct {
+	ID        string      `json:"id"`
+	UserID    int64       `json:"user_id"`
+	SessionID string      `json:"session_id"`
+	StartedAt time.Time   `json:"started_at"`
+	EndedAt   time.Time   `json:"ended_at"`
+	Summary   string      `json:"summary"`
+	Topics    []string    `json:"topics"`
+	Emotion   string      `json:"emotion,omitempty"`
+	Source    string      `json:"source"`
+	Vector    *FactVector `json:"vector,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type EpisodeManager struct {
+	mu       sync.RWMutex
+	episodes map[int64][]*Episode
+	store    storage.SnapshotStore
+	dirty    storage.DirtyMarker
+}
+
+var episodeManager *EpisodeManager
+
+const EpisodeSnapshotName = "memory/episodes.json"
+const EpisodeFlushTaskName = "episodes"
+
+// maxEpisodesPerUser 每个用户保留的片段数，超出时丢弃最早的。
+const maxEpisodesPerUser = 200
+
+func init() {
+	episodeManager = &EpisodeManager{
+		episodes: make(map[int64][]*Episode),
+	}
+}
+
+func GetEpisodeManager() *EpisodeManager {
+	return episodeManager
+}
+
+// AddEpisode 保存一个片段，缺省字段自动补齐。
+func (em *EpisodeManager) AddEpisode(episode Episode) {
+	episode.Summary = strings.TrimSpace(episode.Summary)
+	if episode.UserID == 0 || episode.Summary == "" {
+		return
+	}
+	if episode.ID == "" {
+		episode.ID = utils.NewRequestID("episode")
+	}
+	if episode.CreatedAt.IsZero() {
+		episode.CreatedAt = clock.Now()
+	}
+	if episode.EndedAt.IsZero() {
+		episode.EndedAt = episode.CreatedAt
+	}
+	if episode.StartedAt.IsZero() {
+		episode.StartedAt = episode.EndedAt
+	}
+	episode.Topics = mergeUniqueStrings(nil, episode.Topics)
+	episode.Vector = nil
+
+	em.mu.Lock()
+	list := append(em.episodes[episode.UserID], &episode)
+	if len(list) > maxEpisodesPerUser {
+		list = append([]*Episode(nil), list[len(list)-maxEpisodesPerUser:]...)
+	}
+	em.episodes[episode.UserID] = list
+	em.mu.Unlock()
+
+	em.markDirty()
+}
+
+// ListEpisodes 按时间倒序返回用户的片段。
+func (em *EpisodeManager) ListEpisodes(userID int64) []Episode {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+
+	source := em.episodes[userID]
+	result := make([]Episode, 0, len(source))
+	for i := len(source) - 1; i >= 0; i-- {
+		result = append(result, cloneEpisode(source[i]))
+	}
+	return result
+}
+
+// EpisodeUserIDs 返回有情景片段的用户。
+func (em *EpisodeManager) EpisodeUserIDs() []int64 {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	return sortedUserIDs(em.episodes)
+}
+
+// DeleteUserEpisodes 删除用户的全部片段，返回删除的数量。
+func (em *EpisodeManager) DeleteUserEpisodes(userID int64) int {
+	em.mu.Lock()
+	count := len(em.episodes[userID])
+	delete(em.episodes, userID)
+	em.mu.Unlock()
+
+	if count > 0 {
+		em.markDirty()
+	}
+	return count
+}
+
+// FindRelevantEpisodes 按话题/关键词命中与语义相似度挑选和 query 相关的片段，没有命中时返回空。
+func (em *EpisodeManager) FindRelevantEpisodes(userID int64, query string, limit int) []Episode {
+	if limit <= 0 || strings.TrimSpace(query) == "" {
+		return []Episode{}
+	}
+
+	var queryVector []float32
+	embedder := embedding.Current()
+	if embedder != nil {
+		queryVector = em.embedForQuery(userID, query, embedder)
+	}
+
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+
+	type scoredEpisode struct {
+		episode Episode
+		score   float64
+	}
+
+	keywords := extractMemoryKeywords(query)
+	minSimilarity := config.GetConfig().EmbeddingMinSimilarity
+	now := clock.Now()
+	scored := make([]scoredEpisode, 0)
+	for _, episode := range em.episodes[userID] {
+		keywordScore := scoreEpisode(episode, query, keywords)
+		score := float64(keywordScore)
+		if queryVector != nil {
+			similarity := 0.0
+			if episode.Vector != nil && episode.Vector.Model == embedder.Name() {
+				similarity = embedding.Cosine(queryVector, episode.Vector.Vector)
+			}
+			if similarity < minSimilarity && keywordScore <= 1 {
+				continue
+			}
+			score = hybridFactScore(similarity, keywordScore, now.Sub(episode.EndedAt))
+		} else if keywordScore <= 1 {
+			continue
+		}
+		scored = append(scored, scoredEpisode{episode: cloneEpisode(episode), score: score})
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		if scored[i].score == scored[j].score {
+			return scored[i].episode.EndedAt.After(scored[j].episode.EndedAt)
+		}
+		return scored[i].score > scored[j].score
+	})
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+
+	result := make([]Episode, 0, len(scored))
+	for _, item := range scored {
+		result = append(result, item.episode)
+	}
+	return result
+}
+
+// embedForQuery 与事实检索相同：补齐缺失或过期的片段向量，返回 query 的向量；失败返回 nil。
+func (em *EpisodeManager) embedForQuery(userID int64, query string, embedder embedding.Embedder) []float32 {
+	name := embedder.Name()
+	em.mu.RLock()
+	var ids, texts []string
+	for _, episode := range em.episodes[userID] {
+		text := episodeEmbeddingText(episode)
+		if episode.Vector != nil && episode.Vector.Model == name && episode.Vector.Text == text {
+			continue
+		}
+		ids = append(ids, episode.ID)
+		texts = append(texts, text)
+	}
+	em.mu.RUnlock()
+
+	vectors, err := embedding.Embed(context.Background(), embedder, append(texts, query))
+	if err != nil {
+		utils.Warn("embed episodes failed, fallback to keyword retrieval: %v", err)
+		return nil
+	}
+	if len(ids) == 0 {
+		return vectors[0]
+	}
+
+	em.mu.Lock()
+	byID := make(map[string]*Episode, len(em.episodes[userID]))
+	for _, episode := range em.episodes[userID] {
+		byID[episode.ID] = episode
+	}
+	for i, id := range ids {
+		if episode := byID[id]; episode != nil {
+			episode.Vector = &FactVector{Model: name, Text: texts[i], Vector: vectors[i]}
+		}
+	}
+	em.mu.Unlock()
+	em.markDirty()
+	return vectors[len(vectors)-1]
+}
+
+func episodeEmbeddingText(episode *Episode) string {
+	return episode.Summary + "；" + strings.Join(episode.Topics, "、")
+}
+
+// scoreEpisode 基础分为 1；话题出现在原句里加分最多，因为中文 query 多半切不出关键词。
+func scoreEpisode(episode *Episode, query string, keywords []string) int {
+	score := 1
+	for _, topic := range episode.Topics {
+		if topic != "" && strings.Contains(query, topic) {
+			score += 5
+		}
+	}
+	for _, keyword := range keywords {
+		if keyword == "" {
+			continue
+		}
+		if strings.Contains(episode.Summary, keyword) {
+			score += 4
+		}
+		for _, topic := range episode.Topics {
+			if topic != "" && strings.Contains(topic, keyword) {
+				score += 2
+			}
+		}
+	}
+	return score
+}
+
+func (em *EpisodeManager) ConfigurePersistence(store storage.SnapshotStore, dirty storage.DirtyMarker) error {
+	em.mu.Lock()
+	em.store = store
+	em.dirty = dirty
+	em.mu.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	data, err := store.Load(EpisodeSnapshotName)
+	if err != nil {
+		return fmt.Errorf("load episodes failed: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	loaded := make(map[int64][]*Episode)
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("unmarshal episodes failed: %w", err)
+	}
+
+	em.mu.Lock()
+	em.episodes = loaded
+	em.normalizeEpisodesLocked()
+	em.mu.Unlock()
+	return nil
+}
+
+func (em *EpisodeManager) Flush() error {
+	em.mu.RLock()
+	store := em.store
+	snapshot := em.snapshotLocked()
+	em.mu.RUnlock()
+
+	if store == nil {
+		return nil
+	}
+
+	// 含向量，不缩进
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("marshal episodes failed: %w", err)
+	}
+	if err := store.Save(EpisodeSnapshotName, data); err != nil {
+		return fmt.Errorf("save episodes failed: %w", err)
+	}
+	return nil
+}
+
+func (em *EpisodeManager) normalizeEpisodesLocked() {
+	for userID, episodes := range em.episodes {
+		normalized := make([]*Episode, 0, len(episodes))
+		for _, episode := range episodes {
+			if episode == nil || strings.TrimSpace(episode.Summary) == "" {
+				continue
+			}
+			episode.UserID = userID
+			if episode.ID == "" {
+				episode.ID = utils.NewRequestID("episode")
+			}
+			normalized = append(normalized, episode)
+		}
+		sort.SliceStable(normalized, func(i, j int) bool {
+			return normalized[i].EndedAt.Before(normalized[j].EndedAt)
+		})
+		em.episodes[userID] = normalized
+	}
+}
+
+func (em *EpisodeManager) snapshotLocked() map[int64][]*Episode {
+	result := make(map[int64][]*Episode, len(em.episodes))
+	for userID, episodes := range em.episodes {
+		copied := make([]*Episode, 0, len(episodes))
+		for _, episode := range episodes {
+			cloned := cloneEpisode(episode)
+			copied = append(copied, &cloned)
+		}
+		result[userID] = copied
+	}
+	return result
+}
+
+func (em *EpisodeManager) markDirty() {
+	em.mu.RLock()
+	dirty := em.dirty
+	em.mu.RUnlock()
+
+	if dirty != nil {
+		dirty.MarkDirty(EpisodeFlushTaskName)
+	}
+}
+
+// cloneEpisode 向量只读，共享即可。
+func cloneEpisode(episode *Episode) Episode {
+	cloned := *episode
+	cloned.Topics = append([]string(nil), episode.Topics...)
+	return cloned
+}
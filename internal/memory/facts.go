@@ -1,13 +1,19 @@
 package memory
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/embedding"
 	"project-yume/internal/storage"
 	"project-yume/internal/utils"
 )
@@ -16,6 +22,8 @@ const (
 	FactStatusActive       = "active"
 	FactStatusStale        = "stale"
 	FactStatusContradicted = "contradicted"
+	// FactStatusPending 与当前值冲突但把握不大的新说法，等用户确认，不参与检索。
+	FactStatusPending = "pending"
 )
 
 type FactMemory struct {
@@ -32,20 +40,116 @@ type FactMemory struct {
 	CreatedAt       time.Time  `json:"created_at"`
 	LastConfirmedAt time.Time  `json:"last_confirmed_at"`
 	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	// DecayedAt 置信度已衰减到的时间点，为空时从 LastConfirmedAt 算起。
+	DecayedAt         time.Time          `json:"decayed_at,omitempty"`
+	ConfidenceHistory []ConfidenceChange `json:"confidence_history,omitempty"`
+	// ValidFrom 成为当前值的时间，重新生效时更新，从未生效过的为空；SupersededBy/SupersededAt 记录被哪条事实在何时取代。
+	ValidFrom    time.Time  `json:"valid_from,omitempty"`
+	SupersededBy string     `json:"superseded_by,omitempty"`
+	SupersededAt *time.Time `json:"superseded_at,omitempty"`
+}
+
+// FactTransition 一次取值变化：From 被 To 取代。
+type FactTransition struct {
+	From FactMemory `json:"from"`
+	To   FactMemory `json:"to"`
+	At   time.Time  `json:"at"`
+}
+
+// 置信度变化的原因。
+const (
+	ConfidenceCreated      = "created"
+	ConfidenceReconfirmed  = "reconfirmed"
+	ConfidenceMentioned    = "mentioned"
+	ConfidenceDecayed      = "decayed"
+	ConfidenceContradicted = "contradicted"
+	ConfidenceStale        = "stale"
+	ConfidenceEdited       = "edited"
+	// ConfidenceRejected 待确认的说法被用户否认。
+	ConfidenceRejected = "rejected"
+)
+
+// ConfidenceChange 一次置信度变化后的值。
+type ConfidenceChange struct {
+	At         time.Time `json:"at"`
+	Confidence float64   `json:"confidence"`
+	Reason     string    `json:"reason"`
+}
+
+// FactVector 事实的嵌入向量。Model 或 Text 与当前不一致时视为过期，检索时重新计算。
+type FactVector struct {
+	Model  string    `json:"model"`
+	Text   string    `json:"text"`
+	Vector []float32 `json:"vector"`
 }
 
 type FactManager struct {
-	mu    sync.RWMutex
-	facts map[int64][]*FactMemory
-	store storage.SnapshotStore
-	dirty storage.DirtyMarker
+	mu      sync.RWMutex
+	facts   map[int64][]*FactMemory
+	vectors map[string]*FactVector
+	store   storage.SnapshotStore
+	dirty   storage.DirtyMarker
 }
 
 var factManager *FactManager
 
 const FactSnapshotName = "memory/fact_memories.json"
+const FactIndexSnapshotName = "memory/fact_index.json"
 const FactFlushTaskName = "fact_memories"
 
+// 语义检索的混合打分权重：相似度、关键词命中、最近确认时间。
+const (
+	factSimilarityWeight = 0.6
+	factKeywordWeight    = 0.3
+	factRecencyWeight    = 0.1
+	factRecencyHalfLife  = 30 * 24 * time.Hour
+)
+
+// 置信度生命周期：随时间按谓词衰减，再次确认或被提到时回升，被否定时下降。
+const (
+	// factReconfirmGain 再次确认时补上与 1 之间差距的比例。
+	factReconfirmGain = 0.5
+	// factMentionGain 用户提到事实对象时补上的比例，同一事实 factMentionInterval 内只补一次。
+	factMentionGain     = 0.1
+	factMentionInterval = 24 * time.Hour
+	// factContradictPenalty 被否定时置信度乘上的系数。
+	factContradictPenalty = 0.5
+	// factHistoryLimit 每条事实保留的置信度变化条数。
+	factHistoryLimit = 20
+	// factHistoryMinDelta 衰减累计超过该值才记一条历史，避免每小时一条。
+	factHistoryMinDelta = 0.05
+	defaultFactHalfLife = 90 * 24 * time.Hour
+	// factPendingTTL 待确认的事实多久没被确认就作废。
+	factPendingTTL = 7 * 24 * time.Hour
+	// factTransitionsPerPredicate 提示词里每个谓词最多带几次变化。
+	factTransitionsPerPredicate = 2
+)
+
+// factConfidenceHalfLife 各谓词置信度减半所需时间：名字身份最稳定，计划很快过时。
+var factConfidenceHalfLife = map[string]time.Duration{
+	"name":          365 * 24 * time.Hour,
+	"identity":      365 * 24 * time.Hour,
+	"location":      180 * 24 * time.Hour,
+	"pet":           180 * 24 * time.Hour,
+	"likes":         120 * 24 * time.Hour,
+	"dislikes":      120 * 24 * time.Hour,
+	"current_plan":  14 * 24 * time.Hour,
+	"today_plan":    2 * 24 * time.Hour,
+	"tomorrow_plan": 3 * 24 * time.Hour,
+}
+
+// opposingFactPredicates 同一对象上互相否定的谓词。
+var opposingFactPredicates = map[string]string{
+	"likes":    "dislikes",
+	"dislikes": "likes",
+}
+
+// factNegationHints 消息里带这些词时不算作对事实的印证，否定交给提取器处理。
+var factNegationHints = []string{"不喜欢", "不再", "讨厌", "不是", "没有", "不养", "搬走", "换了", "放弃"}
+
+// ErrFactNotFound 按 ID 找不到事实。
+var ErrFactNotFound = errors.New("fact not found")
+
 var exclusiveFactPredicates = map[string]struct{}{
 	"name":         {},
 	"identity":     {},
@@ -53,9 +157,51 @@ var exclusiveFactPredicates = map[string]struct{}{
 	"current_plan": {},
 }
 
+// knownFactPredicates 是允许写入的事实谓词，顺序即展示顺序。
+var knownFactPredicates = []string{
+	"likes",
+	"dislikes",
+	"name",
+	"identity",
+	"location",
+	"pet",
+	"current_plan",
+	"today_plan",
+	"tomorrow_plan",
+}
+
+// factPredicateTTL 计划类事实的默认有效期。
+var factPredicateTTL = map[string]time.Duration{
+	"current_plan":  7 * 24 * time.Hour,
+	"today_plan":    36 * time.Hour,
+	"tomorrow_plan": 48 * time.Hour,
+}
+
+// FactPredicateTTL 返回谓词的默认有效期，长期有效的谓词返回 false。
+func FactPredicateTTL(predicate string) (time.Duration, bool) {
+	ttl, ok := factPredicateTTL[predicate]
+	return ttl, ok
+}
+
+// FactPredicates 返回允许写入的事实谓词。
+func FactPredicates() []string {
+	return append([]string(nil), knownFactPredicates...)
+}
+
+// IsKnownFactPredicate 判断谓词是否在白名单内。
+func IsKnownFactPredicate(predicate string) bool {
+	for _, known := range knownFactPredicates {
+		if known == predicate {
+			return true
+		}
+	}
+	return false
+}
+
 func init() {
 	factManager = &FactManager{
-		facts: make(map[int64][]*FactMemory),
+		facts:   make(map[int64][]*FactMemory),
+		vectors: make(map[string]*FactVector),
 	}
 }
 
@@ -68,7 +214,7 @@ func (fm *FactManager) UpsertFacts(userID int64, sessionID string, candidates []
 		return
 	}
 
-	now := time.Now()
+	now := clock.Now()
 
 	fm.mu.Lock()
 	fm.ensureFactsLocked(userID)
@@ -88,18 +234,18 @@ func (fm *FactManager) UpsertFacts(userID int64, sessionID string, candidates []
 			candidate.Confidence = 0.6
 		}
 
-		if _, ok := exclusiveFactPredicates[candidate.Predicate]; ok {
-			for _, existing := range fm.facts[userID] {
-				if existing == nil || existing.Status != FactStatusActive {
-					continue
-				}
-				if existing.Predicate == candidate.Predicate && existing.Object != candidate.Object {
-					existing.Status = FactStatusContradicted
-				}
-			}
+		existing := fm.findExactFactLocked(userID, candidate.Predicate, candidate.Object)
+		if fm.needsConfirmationLocked(candidate, existing) {
+			fm.holdForConfirmationLocked(candidate, existing, now)
+			continue
 		}
 
-		if existing := fm.findExactFactLocked(userID, candidate.Predicate, candidate.Object); existing != nil {
+		if existing != nil {
+			if existing.Status != FactStatusActive {
+				existing.ValidFrom = now
+				existing.SupersededBy = ""
+				existing.SupersededAt = nil
+			}
 			existing.Summary = candidate.Summary
 			existing.Tags = mergeUniqueStrings(existing.Tags, candidate.Tags)
 			existing.SourceMessage = candidate.SourceMessage
@@ -108,33 +254,39 @@ func (fm *FactManager) UpsertFacts(userID int64, sessionID string, candidates []
 			if candidate.ExpiresAt != nil {
 				existing.ExpiresAt = candidate.ExpiresAt
 			}
-			if candidate.Confidence > existing.Confidence {
-				existing.Confidence = candidate.Confidence
-			}
+			existing.decayTo(now)
+			existing.Confidence = math.Max(existing.Confidence+(1-existing.Confidence)*factReconfirmGain, candidate.Confidence)
+			existing.noteConfidence(now, ConfidenceReconfirmed)
+			fm.supersedeLocked(existing, now)
 			continue
 		}
 
-		record := candidate
-		record.ID = utils.NewRequestID("fact")
-		record.CreatedAt = now
-		record.LastConfirmedAt = now
-		record.Tags = mergeUniqueStrings(nil, record.Tags)
-		fm.facts[userID] = append(fm.facts[userID], &record)
+		record := newFactRecord(candidate, now)
+		fm.facts[userID] = append(fm.facts[userID], record)
+		fm.supersedeLocked(record, now)
 	}
 
 	fm.mu.Unlock()
 	fm.markDirty()
 }
 
+// FindRelevantFacts 按与 query 的相关度返回事实。启用嵌入时按相似度、关键词和最近确认时间混合打分，
+// 嵌入不可用时只按关键词。
 func (fm *FactManager) FindRelevantFacts(userID int64, query string, limit int) []FactMemory {
 	if limit <= 0 {
 		limit = 5
 	}
 
 	fm.mu.Lock()
-	fm.expireFactsLocked(userID, time.Now())
+	fm.expireFactsLocked(userID, clock.Now())
 	fm.mu.Unlock()
 
+	var queryVector []float32
+	embedder := embedding.Current()
+	if embedder != nil && strings.TrimSpace(query) != "" {
+		queryVector = fm.embedForQuery(userID, query, embedder)
+	}
+
 	fm.mu.RLock()
 	defer fm.mu.RUnlock()
 
@@ -145,42 +297,45 @@ func (fm *FactManager) FindRelevantFacts(userID int64, query string, limit int)
 
 	type scoredFact struct {
 		fact  FactMemory
-		score int
+		score float64
 	}
 
 	keywords := extractMemoryKeywords(query)
+	cfg := config.GetConfig()
+	minSimilarity := cfg.EmbeddingMinSimilarity
 	scored := make([]scoredFact, 0, len(source))
-	now := time.Now()
+	now := clock.Now()
 
 	for _, fact := range source {
 		if fact == nil || fact.Status != FactStatusActive {
 			continue
 		}
+		// 维护任务每小时才标一次 stale，这里先挡住已经低于阈值的
+		if fact.Confidence < cfg.FactMinConfidence {
+			continue
+		}
 		if fact.ExpiresAt != nil && fact.ExpiresAt.Before(now) {
 			continue
 		}
 
-		score := scoreFact(fact, keywords)
-		if score == 0 && len(keywords) > 0 {
+		keywordScore := scoreFact(fact, keywords)
+		score := float64(keywordScore)
+		if queryVector != nil {
+			similarity := 0.0
+			if vector := fm.vectors[fact.ID]; vector != nil && vector.Model == embedder.Name() {
+				similarity = embedding.Cosine(queryVector, vector.Vector)
+			}
+			// scoreFact 基础分为 1，大于 1 才是真正命中了关键词
+			if similarity < minSimilarity && keywordScore <= 1 {
+				continue
+			}
+			score = hybridFactScore(similarity, keywordScore, now.Sub(fact.LastConfirmedAt))
+		} else if keywordScore == 0 && len(keywords) > 0 {
 			continue
 		}
 
 		scored = append(scored, scoredFact{
-			fact: FactMemory{
-				ID:              fact.ID,
-				UserID:          fact.UserID,
-				SessionID:       fact.SessionID,
-				Predicate:       fact.Predicate,
-				Object:          fact.Object,
-				Summary:         fact.Summary,
-				Tags:            append([]string(nil), fact.Tags...),
-				Confidence:      fact.Confidence,
-				SourceMessage:   fact.SourceMessage,
-				Status:          fact.Status,
-				CreatedAt:       fact.CreatedAt,
-				LastConfirmedAt: fact.LastConfirmedAt,
-				ExpiresAt:       cloneTimePointer(fact.ExpiresAt),
-			},
+			fact:  cloneFact(fact),
 			score: score,
 		})
 	}
@@ -203,6 +358,399 @@ func (fm *FactManager) FindRelevantFacts(userID int64, query string, limit int)
 	return result
 }
 
+// embedForQuery 把该用户缺向量或向量过期的事实与 query 一起嵌入，返回 query 的向量；失败返回 nil。
+func (fm *FactManager) embedForQuery(userID int64, query string, embedder embedding.Embedder) []float32 {
+	name := embedder.Name()
+	fm.mu.RLock()
+	var ids, texts []string
+	for _, fact := range fm.facts[userID] {
+		if fact == nil || fact.Status != FactStatusActive {
+			continue
+		}
+		text := factEmbeddingText(fact)
+		if vector := fm.vectors[fact.ID]; vector != nil && vector.Model == name && vector.Text == text {
+			continue
+		}
+		ids = append(ids, fact.ID)
+		texts = append(texts, text)
+	}
+	fm.mu.RUnlock()
+
+	vectors, err := embedding.Embed(context.Background(), embedder, append(texts, query))
+	if err != nil {
+		utils.Warn("embed facts failed, fallback to keyword retrieval: %v", err)
+		return nil
+	}
+	if len(ids) == 0 {
+		return vectors[0]
+	}
+
+	fm.mu.Lock()
+	if fm.vectors == nil {
+		fm.vectors = make(map[string]*FactVector)
+	}
+	for i, id := range ids {
+		fm.vectors[id] = &FactVector{Model: name, Text: texts[i], Vector: vectors[i]}
+	}
+	fm.mu.Unlock()
+	fm.markDirty()
+	return vectors[len(vectors)-1]
+}
+
+func factEmbeddingText(fact *FactMemory) string {
+	return fact.Summary + "；" + fact.Object
+}
+
+// hybridFactScore 相似度为主，关键词命中与最近确认作为加分，结果在 0 到 1 之间。
+func hybridFactScore(similarity float64, keywordScore int, age time.Duration) float64 {
+	keyword := math.Min(float64(keywordScore-1), 10) / 10
+	recency := math.Exp2(-float64(max(age, 0)) / float64(factRecencyHalfLife))
+	return factSimilarityWeight*math.Max(similarity, 0) + factKeywordWeight*keyword + factRecencyWeight*recency
+}
+
+// ListFacts 返回用户的全部事实（含失效的），按最近确认时间倒序。
+func (fm *FactManager) ListFacts(userID int64) []FactMemory {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	result := make([]FactMemory, 0, len(fm.facts[userID]))
+	for _, fact := range fm.facts[userID] {
+		if fact != nil {
+			result = append(result, cloneFact(fact))
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].LastConfirmedAt.After(result[j].LastConfirmedAt)
+	})
+	return result
+}
+
+// FactUserIDs 返回有事实记录的用户。
+func (fm *FactManager) FactUserIDs() []int64 {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+	return sortedUserIDs(fm.facts)
+}
+
+// FactEdit 人工修改事实，nil 字段保持不变。
+type FactEdit struct {
+	Object     *string
+	Summary    *string
+	Tags       []string
+	Confidence *float64
+	Status     *string
+	// ExpiresAt 为零值时清除有效期。
+	ExpiresAt *time.Time
+}
+
+// EditFact 按 ID 修改事实。改回 active 的排他谓词事实会取代同谓词的其他事实。
+func (fm *FactManager) EditFact(id string, edit FactEdit) (FactMemory, error) {
+	fm.mu.Lock()
+	fact := fm.findFactByIDLocked(id)
+	if fact == nil {
+		fm.mu.Unlock()
+		return FactMemory{}, ErrFactNotFound
+	}
+
+	if edit.Object != nil {
+		object := strings.TrimSpace(*edit.Object)
+		if object == "" {
+			fm.mu.Unlock()
+			return FactMemory{}, fmt.Errorf("object must not be empty")
+		}
+		fact.Object = object
+	}
+	if edit.Summary != nil {
+		summary := strings.TrimSpace(*edit.Summary)
+		if summary == "" {
+			fm.mu.Unlock()
+			return FactMemory{}, fmt.Errorf("summary must not be empty")
+		}
+		fact.Summary = summary
+	}
+	if edit.Tags != nil {
+		fact.Tags = mergeUniqueStrings(nil, edit.Tags)
+	}
+	if edit.Confidence != nil {
+		if *edit.Confidence <= 0 || *edit.Confidence > 1 {
+			fm.mu.Unlock()
+			return FactMemory{}, fmt.Errorf("confidence must be in (0, 1]")
+		}
+		// 后台保存时总会带上置信度，没改就不记历史
+		if *edit.Confidence != fact.Confidence {
+			fact.Confidence = *edit.Confidence
+			fact.DecayedAt = clock.Now()
+			fact.noteConfidence(fact.DecayedAt, ConfidenceEdited)
+		}
+	}
+	if edit.ExpiresAt != nil {
+		if edit.ExpiresAt.IsZero() {
+			fact.ExpiresAt = nil
+		} else {
+			fact.ExpiresAt = cloneTimePointer(edit.ExpiresAt)
+		}
+	}
+	if edit.Status != nil {
+		switch *edit.Status {
+		case FactStatusActive, FactStatusStale, FactStatusContradicted, FactStatusPending:
+		default:
+			fm.mu.Unlock()
+			return FactMemory{}, fmt.Errorf("unknown fact status: %q", *edit.Status)
+		}
+		if *edit.Status == FactStatusActive && fact.Status != FactStatusActive {
+			fact.LastConfirmedAt = clock.Now()
+			fact.DecayedAt = fact.LastConfirmedAt
+			fact.ValidFrom = fact.LastConfirmedAt
+			fact.SupersededBy = ""
+			fact.SupersededAt = nil
+		}
+		fact.Status = *edit.Status
+	}
+	if fact.Status == FactStatusActive {
+		fm.supersedeLocked(fact, clock.Now())
+	}
+	result := cloneFact(fact)
+	fm.mu.Unlock()
+
+	fm.markDirty()
+	return result, nil
+}
+
+// DeleteFact 按 ID 删除事实及其向量。
+func (fm *FactManager) DeleteFact(id string) error {
+	fm.mu.Lock()
+	deleted := false
+	for userID, facts := range fm.facts {
+		for index, fact := range facts {
+			if fact != nil && fact.ID == id {
+				fm.facts[userID] = append(facts[:index:index], facts[index+1:]...)
+				delete(fm.vectors, id)
+				deleted = true
+				break
+			}
+		}
+		if deleted {
+			break
+		}
+	}
+	fm.mu.Unlock()
+
+	if !deleted {
+		return ErrFactNotFound
+	}
+	fm.markDirty()
+	return nil
+}
+
+// DeleteUserFacts 删除用户的全部事实及其向量，返回删除的数量。
+func (fm *FactManager) DeleteUserFacts(userID int64) int {
+	fm.mu.Lock()
+	facts := fm.facts[userID]
+	for _, fact := range facts {
+		if fact != nil {
+			delete(fm.vectors, fact.ID)
+		}
+	}
+	delete(fm.facts, userID)
+	fm.mu.Unlock()
+
+	if len(facts) > 0 {
+		fm.markDirty()
+	}
+	return len(facts)
+}
+
+// ReinforceMentions 用户消息里提到了事实的对象且没有否定语气时，小幅提高置信度。返回受影响的条数。
+func (fm *FactManager) ReinforceMentions(userID int64, message string) int {
+	message = strings.TrimSpace(message)
+	if userID == 0 || message == "" {
+		return 0
+	}
+	for _, hint := range factNegationHints {
+		if strings.Contains(message, hint) {
+			return 0
+		}
+	}
+
+	now := clock.Now()
+	fm.mu.Lock()
+	count := 0
+	for _, fact := range fm.facts[userID] {
+		if fact == nil || fact.Status != FactStatusActive || len([]rune(fact.Object)) < 2 || !strings.Contains(message, fact.Object) {
+			continue
+		}
+		if now.Sub(fact.lastReinforcedAt()) < factMentionInterval {
+			continue
+		}
+		fact.decayTo(now)
+		fact.Confidence += (1 - fact.Confidence) * factMentionGain
+		fact.noteConfidence(now, ConfidenceMentioned)
+		count++
+	}
+	fm.mu.Unlock()
+
+	if count > 0 {
+		fm.markDirty()
+	}
+	return count
+}
+
+// FactMaintenance 一次维护的结果。
+type FactMaintenance struct {
+	Decayed int
+	Stale   int
+	Expired int
+}
+
+// MaintainFacts 把全部用户的活跃事实衰减到 now，过期或置信度低于 minConfidence 的标为 stale，
+// 超过 factPendingTTL 仍未确认的待确认事实也标为 stale。
+func (fm *FactManager) MaintainFacts(now time.Time, minConfidence float64) FactMaintenance {
+	var result FactMaintenance
+	fm.mu.Lock()
+	for _, facts := range fm.facts {
+		for _, fact := range facts {
+			if fact == nil {
+				continue
+			}
+			if fact.Status == FactStatusPending && now.Sub(fact.LastConfirmedAt) > factPendingTTL {
+				fact.Status = FactStatusStale
+				result.Expired++
+				continue
+			}
+			if fact.Status != FactStatusActive {
+				continue
+			}
+			if fact.ExpiresAt != nil && fact.ExpiresAt.Before(now) {
+				fact.Status = FactStatusStale
+				result.Expired++
+				continue
+			}
+			before := fact.Confidence
+			fact.decayTo(now)
+			if fact.Confidence < minConfidence {
+				fact.Status = FactStatusStale
+				fact.noteConfidence(now, ConfidenceStale)
+				result.Stale++
+				continue
+			}
+			if fact.Confidence < before {
+				result.Decayed++
+				if last := len(fact.ConfidenceHistory) - 1; last < 0 || fact.ConfidenceHistory[last].Confidence-fact.Confidence >= factHistoryMinDelta {
+					fact.noteConfidence(now, ConfidenceDecayed)
+				}
+			}
+		}
+	}
+	fm.mu.Unlock()
+
+	if result != (FactMaintenance{}) {
+		fm.markDirty()
+	}
+	return result
+}
+
+// PendingFacts 返回用户等待确认的事实，最新的在前。
+func (fm *FactManager) PendingFacts(userID int64, limit int) []FactMemory {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	result := make([]FactMemory, 0)
+	for _, fact := range fm.facts[userID] {
+		if fact != nil && fact.Status == FactStatusPending {
+			result = append(result, cloneFact(fact))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].LastConfirmedAt.After(result[j].LastConfirmedAt) })
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// CurrentFact 返回排他谓词当前生效的事实。
+func (fm *FactManager) CurrentFact(userID int64, predicate string) (FactMemory, bool) {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	if current := fm.currentFactLocked(userID, predicate); current != nil {
+		return cloneFact(current), true
+	}
+	return FactMemory{}, false
+}
+
+// FactTimeline 返回某个谓词的历次取值（不含从未生效的待确认说法），按生效时间排序。
+func (fm *FactManager) FactTimeline(userID int64, predicate string) []FactMemory {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	result := make([]FactMemory, 0)
+	for _, fact := range fm.facts[userID] {
+		if fact != nil && fact.Predicate == predicate && !fact.ValidFrom.IsZero() {
+			result = append(result, cloneFact(fact))
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].ValidFrom.Before(result[j].ValidFrom) })
+	return result
+}
+
+// RecentTransitions 返回与当前事实或 query 相关的取值变化：current 中事实的前值，以及 query 提到的旧值。
+// 每个谓词最多 factTransitionsPerPredicate 次，最近的在前。
+func (fm *FactManager) RecentTransitions(userID int64, query string, current []FactMemory) []FactTransition {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	successors := make(map[string]struct{}, len(current))
+	for _, fact := range current {
+		successors[fact.ID] = struct{}{}
+	}
+	byID := make(map[string]*FactMemory, len(fm.facts[userID]))
+	for _, fact := range fm.facts[userID] {
+		if fact != nil {
+			byID[fact.ID] = fact
+		}
+	}
+
+	result := make([]FactTransition, 0)
+	for _, fact := range fm.facts[userID] {
+		if fact == nil || fact.SupersededBy == "" || fact.SupersededAt == nil {
+			continue
+		}
+		successor := byID[fact.SupersededBy]
+		if successor == nil {
+			continue
+		}
+		_, follows := successors[successor.ID]
+		mentioned := query != "" && len([]rune(fact.Object)) >= 2 && strings.Contains(query, fact.Object)
+		if !follows && !mentioned {
+			continue
+		}
+		result = append(result, FactTransition{From: cloneFact(fact), To: cloneFact(successor), At: *fact.SupersededAt})
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].At.After(result[j].At) })
+
+	perPredicate := make(map[string]int)
+	limited := result[:0]
+	for _, transition := range result {
+		if perPredicate[transition.From.Predicate] == factTransitionsPerPredicate {
+			continue
+		}
+		perPredicate[transition.From.Predicate]++
+		limited = append(limited, transition)
+	}
+	return limited
+}
+
+func (fm *FactManager) findFactByIDLocked(id string) *FactMemory {
+	for _, facts := range fm.facts {
+		for _, fact := range facts {
+			if fact != nil && fact.ID == id {
+				return fact
+			}
+		}
+	}
+	return nil
+}
+
 func (fm *FactManager) ConfigurePersistence(store storage.SnapshotStore, dirty storage.DirtyMarker) error {
 	fm.mu.Lock()
 	fm.store = store
@@ -226,8 +774,20 @@ func (fm *FactManager) ConfigurePersistence(store storage.SnapshotStore, dirty s
 		return fmt.Errorf("unmarshal facts failed: %w", err)
 	}
 
+	// 向量索引丢失或损坏只影响检索，重新计算即可
+	vectors := make(map[string]*FactVector)
+	if indexData, err := store.Load(FactIndexSnapshotName); err != nil {
+		utils.Warn("load fact index failed, vectors will be rebuilt: %v", err)
+	} else if len(indexData) > 0 {
+		if err := json.Unmarshal(indexData, &vectors); err != nil {
+			utils.Warn("unmarshal fact index failed, vectors will be rebuilt: %v", err)
+			vectors = make(map[string]*FactVector)
+		}
+	}
+
 	fm.mu.Lock()
 	fm.facts = loaded
+	fm.vectors = vectors
 	fm.normalizeFactsLocked()
 	fm.mu.Unlock()
 	return nil
@@ -237,6 +797,7 @@ func (fm *FactManager) Flush() error {
 	fm.mu.RLock()
 	store := fm.store
 	snapshot := fm.snapshotLocked()
+	index := fm.indexSnapshotLocked()
 	fm.mu.RUnlock()
 
 	if store == nil {
@@ -250,9 +811,34 @@ func (fm *FactManager) Flush() error {
 	if err := store.Save(FactSnapshotName, data); err != nil {
 		return fmt.Errorf("save facts failed: %w", err)
 	}
+
+	// 向量较大，不缩进
+	indexData, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("marshal fact index failed: %w", err)
+	}
+	if err := store.Save(FactIndexSnapshotName, indexData); err != nil {
+		return fmt.Errorf("save fact index failed: %w", err)
+	}
 	return nil
 }
 
+// indexSnapshotLocked 只保留仍存在的事实的向量。
+func (fm *FactManager) indexSnapshotLocked() map[string]*FactVector {
+	result := make(map[string]*FactVector, len(fm.vectors))
+	for _, facts := range fm.facts {
+		for _, fact := range facts {
+			if fact == nil {
+				continue
+			}
+			if vector := fm.vectors[fact.ID]; vector != nil {
+				result[fact.ID] = vector
+			}
+		}
+	}
+	return result
+}
+
 func (fm *FactManager) ensureFactsLocked(userID int64) {
 	if fm.facts == nil {
 		fm.facts = make(map[int64][]*FactMemory)
@@ -274,6 +860,72 @@ func (fm *FactManager) findExactFactLocked(userID int64, predicate, object strin
 	return nil
 }
 
+// currentFactLocked 排他谓词当前生效的那条。
+func (fm *FactManager) currentFactLocked(userID int64, predicate string) *FactMemory {
+	if _, ok := exclusiveFactPredicates[predicate]; !ok {
+		return nil
+	}
+	for _, fact := range fm.facts[userID] {
+		if fact != nil && fact.Status == FactStatusActive && fact.Predicate == predicate {
+			return fact
+		}
+	}
+	return nil
+}
+
+// needsConfirmationLocked 开启确认时，把握不大又与当前值冲突的排他谓词说法先挂起；同一说法第二次出现时直接采纳。
+func (fm *FactManager) needsConfirmationLocked(candidate FactMemory, existing *FactMemory) bool {
+	cfg := config.GetConfig()
+	if !cfg.EnableFactConfirmation || candidate.Confidence >= cfg.FactConfirmBelow {
+		return false
+	}
+	if existing != nil && (existing.Status == FactStatusActive || existing.Status == FactStatusPending) {
+		return false
+	}
+	return fm.currentFactLocked(candidate.UserID, candidate.Predicate) != nil
+}
+
+func (fm *FactManager) holdForConfirmationLocked(candidate FactMemory, existing *FactMemory, now time.Time) {
+	if existing == nil {
+		record := newFactRecord(candidate, now)
+		record.Status = FactStatusPending
+		record.ValidFrom = time.Time{}
+		fm.facts[candidate.UserID] = append(fm.facts[candidate.UserID], record)
+		return
+	}
+	existing.Summary = candidate.Summary
+	existing.SourceMessage = candidate.SourceMessage
+	existing.Status = FactStatusPending
+	existing.LastConfirmedAt = now
+	existing.Confidence = candidate.Confidence
+	existing.DecayedAt = now
+	existing.noteConfidence(now, ConfidenceCreated)
+}
+
+// supersedeLocked 让与 record 冲突的事实失效：排他谓词的其他取值，以及同一对象上相反的喜好。
+// 被取代的生效事实记下继任者，待确认的说法记为被否认。
+func (fm *FactManager) supersedeLocked(record *FactMemory, now time.Time) {
+	_, exclusive := exclusiveFactPredicates[record.Predicate]
+	opposing := opposingFactPredicates[record.Predicate]
+	for _, other := range fm.facts[record.UserID] {
+		if other == nil || other == record || (other.Status != FactStatusActive && other.Status != FactStatusPending) {
+			continue
+		}
+		if !(exclusive && other.Predicate == record.Predicate && other.Object != record.Object) &&
+			!(opposing != "" && other.Predicate == opposing && other.Object == record.Object) {
+			continue
+		}
+		if other.Status == FactStatusPending {
+			other.Status = FactStatusContradicted
+			other.noteConfidence(now, ConfidenceRejected)
+			continue
+		}
+		other.SupersededBy = record.ID
+		other.SupersededAt = cloneTimePointer(&now)
+		contradictFact(other, now)
+	}
+}
+
 func (fm *FactManager) expireFactsLocked(userID int64, now time.Time) {
 	for _, fact := range fm.facts[userID] {
 		if fact == nil || fact.Status != FactStatusActive || fact.ExpiresAt == nil {
@@ -318,11 +970,15 @@ func (fm *FactManager) normalizeFactsLocked() {
 				fact.ID = utils.NewRequestID("fact")
 			}
 			if fact.CreatedAt.IsZero() {
-				fact.CreatedAt = time.Now()
+				fact.CreatedAt = clock.Now()
 			}
 			if fact.LastConfirmedAt.IsZero() {
 				fact.LastConfirmedAt = fact.CreatedAt
 			}
+			// 早期数据没有生效时间，除了挂起或被否认的说法都按创建时间补上
+			if fact.ValidFrom.IsZero() && fact.Status != FactStatusPending && fact.lastConfidenceReason() != ConfidenceRejected {
+				fact.ValidFrom = fact.CreatedAt
+			}
 			normalized = append(normalized, fact)
 		}
 		fm.facts[userID] = normalized
@@ -337,21 +993,8 @@ func (fm *FactManager) snapshotLocked() map[int64][]*FactMemory {
 			if fact == nil {
 				continue
 			}
-			copied = append(copied, &FactMemory{
-				ID:              fact.ID,
-				UserID:          fact.UserID,
-				SessionID:       fact.SessionID,
-				Predicate:       fact.Predicate,
-				Object:          fact.Object,
-				Summary:         fact.Summary,
-				Tags:            append([]string(nil), fact.Tags...),
-				Confidence:      fact.Confidence,
-				SourceMessage:   fact.SourceMessage,
-				Status:          fact.Status,
-				CreatedAt:       fact.CreatedAt,
-				LastConfirmedAt: fact.LastConfirmedAt,
-				ExpiresAt:       cloneTimePointer(fact.ExpiresAt),
-			})
+			cloned := cloneFact(fact)
+			copied = append(copied, &cloned)
 		}
 		result[userID] = copied
 	}
@@ -441,6 +1084,45 @@ func extractMemoryKeywords(query string) []string {
 	return keywords
 }
 
+// newFactRecord 由候选生成新记录。
+func newFactRecord(candidate FactMemory, now time.Time) *FactMemory {
+	record := candidate
+	record.ID = utils.NewRequestID("fact")
+	record.CreatedAt = now
+	record.LastConfirmedAt = now
+	record.DecayedAt = now
+	record.ValidFrom = now
+	record.SupersededBy = ""
+	record.SupersededAt = nil
+	record.Tags = mergeUniqueStrings(nil, record.Tags)
+	record.ConfidenceHistory = nil
+	record.noteConfidence(now, ConfidenceCreated)
+	return &record
+}
+
+func cloneFact(fact *FactMemory) FactMemory {
+	return FactMemory{
+		ID:                fact.ID,
+		UserID:            fact.UserID,
+		SessionID:         fact.SessionID,
+		Predicate:         fact.Predicate,
+		Object:            fact.Object,
+		Summary:           fact.Summary,
+		Tags:              append([]string(nil), fact.Tags...),
+		Confidence:        fact.Confidence,
+		SourceMessage:     fact.SourceMessage,
+		Status:            fact.Status,
+		CreatedAt:         fact.CreatedAt,
+		LastConfirmedAt:   fact.LastConfirmedAt,
+		ExpiresAt:         cloneTimePointer(fact.ExpiresAt),
+		DecayedAt:         fact.DecayedAt,
+		ConfidenceHistory: append([]ConfidenceChange(nil), fact.ConfidenceHistory...),
+		ValidFrom:         fact.ValidFrom,
+		SupersededBy:      fact.SupersededBy,
+		SupersededAt:      cloneTimePointer(fact.SupersededAt),
+	}
+}
+
 func cloneTimePointer(source *time.Time) *time.Time {
 	if source == nil {
 		return nil
@@ -448,3 +1130,70 @@ func cloneTimePointer(source *time.Time) *time.Time {
 	value := *source
 	return &value
 }
+
+// decayTo 按谓词的半衰期把置信度衰减到 now。关闭衰减时不变。
+func (fact *FactMemory) decayTo(now time.Time) {
+	if !config.GetConfig().EnableFactDecay {
+		return
+	}
+	since := fact.DecayedAt
+	if since.IsZero() {
+		since = fact.LastConfirmedAt
+	}
+	if !now.After(since) {
+		return
+	}
+	halfLife, ok := factConfidenceHalfLife[fact.Predicate]
+	if !ok {
+		halfLife = defaultFactHalfLife
+	}
+	fact.Confidence *= math.Exp2(-float64(now.Sub(since)) / float64(halfLife))
+	fact.DecayedAt = now
+}
+
+// noteConfidence 记下当前置信度，只保留最近 factHistoryLimit 条。
+func (fact *FactMemory) noteConfidence(at time.Time, reason string) {
+	fact.ConfidenceHistory = append(fact.ConfidenceHistory, ConfidenceChange{
+		At:         at,
+		Confidence: math.Round(fact.Confidence*1000) / 1000,
+		Reason:     reason,
+	})
+	if overflow := len(fact.ConfidenceHistory) - factHistoryLimit; overflow > 0 {
+		fact.ConfidenceHistory = append([]ConfidenceChange(nil), fact.ConfidenceHistory[overflow:]...)
+	}
+}
+
+func (fact *FactMemory) lastConfidenceReason() string {
+	if len(fact.ConfidenceHistory) == 0 {
+		return ""
+	}
+	return fact.ConfidenceHistory[len(fact.ConfidenceHistory)-1].Reason
+}
+
+// lastReinforcedAt 最近一次确认或被提到的时间。
+func (fact *FactMemory) lastReinforcedAt() time.Time {
+	latest := fact.LastConfirmedAt
+	for _, change := range fact.ConfidenceHistory {
+		if change.Reason == ConfidenceMentioned && change.At.After(latest) {
+			latest = change.At
+		}
+	}
+	return latest
+}
+
+// contradictFact 被新的说法否定：置信度打折并标为 contradicted。
+func contradictFact(fact *FactMemory, now time.Time) {
+	fact.decayTo(now)
+	fact.Confidence *= factContradictPenalty
+	fact.Status = FactStatusContradicted
+	fact.noteConfidence(now, ConfidenceContradicted)
+}
+
+func sortedUserIDs[V any](source map[int64]V) []int64 {
+	result := make([]int64, 0, len(source))
+	for userID := range source {
+		result = append(result, userID)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
@@ -0,0 +1,230 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/embedding"
+)
+
+// topicEmbedder 按是否提到猫给出两种方向的向量，模拟能识别换种说法的嵌入模型。
+type topicEmbedder struct {
+	calls int
+	texts int
+}
+
+func (e *topicEmbedder) Name() string { return "topic" }
+
+func (e *topicEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	e.texts += len(texts)
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		if strings.Contains(text, "猫") || strings.Contains(text, "主子") {
+			vectors[i] = []float32{1, 0}
+		} else {
+			vectors[i] = []float32{0, 1}
+		}
+	}
+	return vectors, nil
+}
+
+func TestFindRelevantFactsMatchesParaphrasesAndReembedsChangedFacts(t *testing.T) {
+	embedder := &topicEmbedder{}
+	embedding.SetEmbedder(embedder)
+	defer embedding.SetEmbedder(nil)
+
+	fm := &FactManager{facts: make(map[int64][]*FactMemory), vectors: make(map[string]*FactVector)}
+	fm.UpsertFacts(1, "s", []FactMemory{
+		{Predicate: "pet", Object: "猫", Summary: "用户养了一只猫"},
+		{Predicate: "location", Object: "上海", Summary: "用户住在上海"},
+	})
+
+	facts := fm.FindRelevantFacts(1, "我家主子今天不吃饭", 5)
+	if len(facts) != 1 || facts[0].Predicate != "pet" {
+		t.Fatalf("expected only the pet fact, got %+v", facts)
+	}
+	if embedder.texts != 3 {
+		t.Fatalf("expected two facts and the query to be embedded, got %d texts", embedder.texts)
+	}
+
+	fm.FindRelevantFacts(1, "主子", 5)
+	if embedder.texts != 4 {
+		t.Fatalf("unchanged facts should reuse vectors, embedded %d texts", embedder.texts)
+	}
+
+	fm.UpsertFacts(1, "s", []FactMemory{{Predicate: "location", Object: "杭州", Summary: "用户住在杭州"}})
+	fm.FindRelevantFacts(1, "主子", 5)
+	if embedder.texts != 6 {
+		t.Fatalf("only the new fact and the query should be embedded, got %d texts", embedder.texts)
+	}
+}
+
+func TestEditFactReactivatesExclusivePredicateAndDeleteDropsVector(t *testing.T) {
+	fm := &FactManager{facts: make(map[int64][]*FactMemory), vectors: make(map[string]*FactVector)}
+	fm.UpsertFacts(1, "s", []FactMemory{{Predicate: "location", Object: "上海", Summary: "用户住在上海"}})
+	fm.UpsertFacts(1, "s", []FactMemory{{Predicate: "location", Object: "杭州", Summary: "用户住在杭州"}})
+
+	var shanghai, hangzhou string
+	for _, fact := range fm.ListFacts(1) {
+		if fact.Object == "上海" {
+			shanghai = fact.ID
+		} else {
+			hangzhou = fact.ID
+		}
+	}
+
+	status := FactStatusActive
+	if _, err := fm.EditFact(shanghai, FactEdit{Status: &status}); err != nil {
+		t.Fatalf("EditFact returned error: %v", err)
+	}
+	for _, fact := range fm.ListFacts(1) {
+		expected := FactStatusContradicted
+		if fact.ID == shanghai {
+			expected = FactStatusActive
+		}
+		if fact.Status != expected {
+			t.Fatalf("fact %s expected %s, got %s", fact.Object, expected, fact.Status)
+		}
+	}
+
+	invalid := "deleted"
+	if _, err := fm.EditFact(shanghai, FactEdit{Status: &invalid}); err == nil {
+		t.Fatalf("expected error for unknown status")
+	}
+
+	fm.vectors[hangzhou] = &FactVector{Model: "topic"}
+	if err := fm.DeleteFact(hangzhou); err != nil {
+		t.Fatalf("DeleteFact returned error: %v", err)
+	}
+	if len(fm.ListFacts(1)) != 1 || fm.vectors[hangzhou] != nil {
+		t.Fatalf("fact and vector should be removed")
+	}
+	if err := fm.DeleteFact(hangzhou); err != ErrFactNotFound {
+		t.Fatalf("expected ErrFactNotFound, got %v", err)
+	}
+}
+
+func TestFactConfidenceDecaysReinforcesAndGoesStale(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	t.Cleanup(func() { *cfg = previous })
+	cfg.EnableFactDecay = true
+
+	fm := &FactManager{facts: make(map[int64][]*FactMemory), vectors: make(map[string]*FactVector)}
+	fm.UpsertFacts(1, "s", []FactMemory{
+		{Predicate: "current_plan", Object: "准备考研", Summary: "用户在准备考研", Confidence: 0.8},
+		{Predicate: "likes", Object: "咖啡", Summary: "用户喜欢咖啡", Confidence: 0.8},
+	})
+	plan, coffee := fm.facts[1][0], fm.facts[1][1]
+
+	// 计划半衰期 14 天，四周后只剩四分之一
+	for _, fact := range fm.facts[1] {
+		fact.LastConfirmedAt = fact.LastConfirmedAt.Add(-28 * 24 * time.Hour)
+		fact.DecayedAt = fact.LastConfirmedAt
+	}
+	result := fm.MaintainFacts(time.Now(), 0.3)
+	if plan.Status != FactStatusStale || result.Stale != 1 || result.Decayed != 1 {
+		t.Fatalf("plan should go stale, got %+v status=%s confidence=%.3f", result, plan.Status, plan.Confidence)
+	}
+	if coffee.Status != FactStatusActive || coffee.Confidence < 0.6 {
+		t.Fatalf("likes should decay slowly, got %.3f", coffee.Confidence)
+	}
+
+	decayed := coffee.Confidence
+	if fm.ReinforceMentions(1, "我已经不喜欢咖啡了") != 0 {
+		t.Fatalf("negated mention should not reinforce")
+	}
+	if fm.ReinforceMentions(1, "今天又喝了咖啡") != 1 || coffee.Confidence <= decayed {
+		t.Fatalf("mention should reinforce, got %.3f", coffee.Confidence)
+	}
+	if fm.ReinforceMentions(1, "咖啡真好喝") != 0 {
+		t.Fatalf("mention should reinforce at most once a day")
+	}
+
+	fm.UpsertFacts(1, "s", []FactMemory{{Predicate: "dislikes", Object: "咖啡", Summary: "用户不喜欢咖啡", Confidence: 0.8}})
+	if coffee.Status != FactStatusContradicted {
+		t.Fatalf("opposite preference should contradict, got %s", coffee.Status)
+	}
+	last := coffee.ConfidenceHistory[len(coffee.ConfidenceHistory)-1]
+	if last.Reason != ConfidenceContradicted || len(coffee.ConfidenceHistory) != 4 {
+		t.Fatalf("unexpected history: %+v", coffee.ConfidenceHistory)
+	}
+}
+
+func TestExclusiveFactKeepsTimelineAndHoldsUnsureChanges(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	t.Cleanup(func() { *cfg = previous })
+	cfg.EnableFactConfirmation = true
+	cfg.FactConfirmBelow = 0.75
+
+	fm := &FactManager{facts: make(map[int64][]*FactMemory), vectors: make(map[string]*FactVector)}
+	fm.UpsertFacts(1, "s", []FactMemory{{Predicate: "location", Object: "上海", Summary: "用户住在上海", Confidence: 0.9}})
+	fm.UpsertFacts(1, "s", []FactMemory{{Predicate: "location", Object: "北京", Summary: "用户搬到了北京", Confidence: 0.9}})
+
+	current, ok := fm.CurrentFact(1, "location")
+	if !ok || current.Object != "北京" {
+		t.Fatalf("confident change should take effect, got %+v", current)
+	}
+	timeline := fm.FactTimeline(1, "location")
+	if len(timeline) != 2 || timeline[0].Object != "上海" || timeline[0].SupersededBy != current.ID || timeline[0].SupersededAt == nil {
+		t.Fatalf("unexpected timeline: %+v", timeline)
+	}
+	if changes := fm.RecentTransitions(1, "", []FactMemory{current}); len(changes) != 1 || changes[0].From.Object != "上海" {
+		t.Fatalf("current fact should bring its previous value, got %+v", changes)
+	}
+	if changes := fm.RecentTransitions(1, "上海最近下雨了吗", nil); len(changes) != 1 {
+		t.Fatalf("mentioning the old value should bring the change, got %+v", changes)
+	}
+
+	// 把握不大的新说法先挂起，当前值不变
+	fm.UpsertFacts(1, "s", []FactMemory{{Predicate: "location", Object: "杭州", Summary: "用户住在杭州", Confidence: 0.5}})
+	if current, _ := fm.CurrentFact(1, "location"); current.Object != "北京" {
+		t.Fatalf("unsure change should not overwrite, got %+v", current)
+	}
+	if pending := fm.PendingFacts(1, 0); len(pending) != 1 || pending[0].Object != "杭州" {
+		t.Fatalf("unsure change should be pending, got %+v", pending)
+	}
+
+	// 用户否认后，待确认的说法作废
+	fm.UpsertFacts(1, "s", []FactMemory{{Predicate: "location", Object: "北京", Summary: "用户住在北京", Confidence: 0.9}})
+	if pending := fm.PendingFacts(1, 0); len(pending) != 0 {
+		t.Fatalf("denied change should be dropped, got %+v", pending)
+	}
+	if timeline := fm.FactTimeline(1, "location"); len(timeline) != 2 {
+		t.Fatalf("denied change should stay out of the timeline, got %+v", timeline)
+	}
+
+	// 同一说法出现第二次时采纳
+	fm.UpsertFacts(1, "s", []FactMemory{{Predicate: "location", Object: "深圳", Summary: "用户住在深圳", Confidence: 0.5}})
+	fm.UpsertFacts(1, "s", []FactMemory{{Predicate: "location", Object: "深圳", Summary: "用户住在深圳", Confidence: 0.5}})
+	if current, _ := fm.CurrentFact(1, "location"); current.Object != "深圳" {
+		t.Fatalf("repeated change should be accepted, got %+v", current)
+	}
+}
+
+func TestPlanFactsExpireOnTheInjectedClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC))
+	clock.Set(fake)
+	defer clock.Set(nil)
+
+	fm := &FactManager{facts: make(map[int64][]*FactMemory), vectors: make(map[string]*FactVector)}
+	expiresAt := clock.Now().Add(36 * time.Hour)
+	fm.UpsertFacts(1, "private:1", []FactMemory{{
+		Predicate: "today_plan", Object: "去看牙", Summary: "用户今天要去看牙",
+		Confidence: 0.8, Status: FactStatusActive, ExpiresAt: &expiresAt,
+	}})
+
+	if facts := fm.FindRelevantFacts(1, "看牙", 5); len(facts) != 1 {
+		t.Fatalf("plan should still be active on the replayed clock, got %+v", facts)
+	}
+	fake.Advance(48 * time.Hour)
+	if facts := fm.FindRelevantFacts(1, "看牙", 5); len(facts) != 0 {
+		t.Fatalf("plan should expire once the replayed clock passes it, got %+v", facts)
+	}
+}
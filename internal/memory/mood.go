@@ -0,0 +1,379 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"project-yume/internal/storage"
+)
+
+const (
+	// moodRetentionDays 每个用户保留的天数，比情感记忆的 100 条交互长得多。
+	moodRetentionDays = 365
+	// moodCheckInLimit 保留的关心记录条数。
+	moodCheckInLimit = 20
+	// moodDistressMinMessages、moodDistressShare 某种负面情绪一天至少出现几次、占带情绪消息的多少才算当天的主要情绪。
+	moodDistressMinMessages = 2
+	moodDistressShare       = 0.4
+)
+
+// moodEmotionIntensity 各情绪的强度，中性、敷衍接近 0。
+var moodEmotionIntensity = map[string]float64{
+	"开心": 0.6,
+	"生气": 0.9,
+	"难过": 0.8,
+	"哲学": 0.3,
+	"敷衍": 0.2,
+	"中性": 0.1,
+}
+
+// moodIntenseIntentions 想倾诉或想被鼓励时强度再加一点。
+var moodIntenseIntentions = map[string]struct{}{
+	"想和对方倾诉": {},
+	"想被对方鼓励": {},
+}
+
+// MoodDistressEmotions 连续多天出现需要关心的情绪。
+var MoodDistressEmotions = []string{"难过", "生气"}
+
+// MoodDay 某个用户一天的情绪汇总。
+type MoodDay struct {
+	Day       string         `json:"day"`
+	Messages  int            `json:"messages"`
+	Rated     int            `json:"rated"`
+	Emotions  map[string]int `json:"emotions"`
+	Intensity float64        `json:"intensity"`
+	Dominant  string         `json:"dominant"`
+}
+
+// MoodCheckIn 一次因情绪低落发出的关心。
+type MoodCheckIn struct {
+	At      time.Time `json:"at"`
+	Emotion string    `json:"emotion"`
+	Days    int       `json:"days"`
+	Message string    `json:"message"`
+}
+
+// MoodPattern 截止到今天或昨天，连续几天以同一种负面情绪为主。
+type MoodPattern struct {
+	Emotion string `json:"emotion"`
+	Days    int    `json:"days"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// MoodTimeline 某个用户的每日情绪，按日期升序。
+type MoodTimeline struct {
+	UserID   int64         `json:"user_id"`
+	Days     []MoodDay     `json:"days"`
+	CheckIns []MoodCheckIn `json:"check_ins"`
+}
+
+type MoodManager struct {
+	mu    sync.RWMutex
+	moods map[int64]*MoodTimeline
+	store storage.SnapshotStore
+	dirty storage.DirtyMarker
+}
+
+var moodManager *MoodManager
+
+const MoodSnapshotName = "memory/mood.json"
+const MoodFlushTaskName = "mood"
+
+func init() {
+	moodManager = &MoodManager{
+		moods: make(map[int64]*MoodTimeline),
+	}
+}
+
+func GetMoodManager() *MoodManager {
+	return moodManager
+}
+
+// Record 把一条消息计入当天的汇总，at 应已换算到本地时区。情绪为空时只计消息数。
+func (mm *MoodManager) Record(userID int64, emotion, intention string, at time.Time) {
+	if userID == 0 {
+		return
+	}
+
+	mm.mu.Lock()
+	if mm.moods == nil {
+		mm.moods = make(map[int64]*MoodTimeline)
+	}
+	timeline := mm.moods[userID]
+	if timeline == nil {
+		timeline = &MoodTimeline{UserID: userID}
+		mm.moods[userID] = timeline
+	}
+	day := timeline.dayLocked(at.Format("2006-01-02"))
+	day.Messages++
+	if intensity, ok := moodEmotionIntensity[emotion]; ok {
+		if _, intense := moodIntenseIntentions[intention]; intense {
+			intensity = min(1, intensity+0.1)
+		}
+		day.Intensity = math.Round((day.Intensity*float64(day.Rated)+intensity)/float64(day.Rated+1)*100) / 100
+		day.Rated++
+		day.Emotions[emotion]++
+		day.Dominant = dominantEmotion(day.Emotions)
+	}
+	mm.mu.Unlock()
+
+	mm.markDirty()
+}
+
+// Timeline 返回最近 days 天（按最后一条记录往前算，<=0 表示全部）的汇总副本。
+func (mm *MoodManager) Timeline(userID int64, days int) (MoodTimeline, bool) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	timeline := mm.moods[userID]
+	if timeline == nil {
+		return MoodTimeline{}, false
+	}
+	cloned := cloneMoodTimeline(timeline)
+	if days > 0 && len(cloned.Days) > 0 {
+		last, _ := time.Parse("2006-01-02", cloned.Days[len(cloned.Days)-1].Day)
+		from := last.AddDate(0, 0, -(days - 1)).Format("2006-01-02")
+		start := 0
+		for start < len(cloned.Days) && cloned.Days[start].Day < from {
+			start++
+		}
+		cloned.Days = cloned.Days[start:]
+	}
+	return cloned, true
+}
+
+// DistressPattern 找出截止到 today 或前一天、连续天数最多的负面情绪，没有时返回 false。
+func (mm *MoodManager) DistressPattern(userID int64, today string) (MoodPattern, bool) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	timeline := mm.moods[userID]
+	if timeline == nil || len(timeline.Days) == 0 {
+		return MoodPattern{}, false
+	}
+	todayAt, err := time.Parse("2006-01-02", today)
+	if err != nil {
+		return MoodPattern{}, false
+	}
+	yesterday := todayAt.AddDate(0, 0, -1).Format("2006-01-02")
+	if last := timeline.Days[len(timeline.Days)-1].Day; last != today && last != yesterday {
+		return MoodPattern{}, false
+	}
+
+	var best MoodPattern
+	for _, emotion := range MoodDistressEmotions {
+		pattern := MoodPattern{Emotion: emotion}
+		var previous time.Time
+		for i := len(timeline.Days) - 1; i >= 0; i-- {
+			day := timeline.Days[i]
+			at, err := time.Parse("2006-01-02", day.Day)
+			if err != nil || !day.distressedBy(emotion) {
+				break
+			}
+			if !previous.IsZero() && !at.AddDate(0, 0, 1).Equal(previous) {
+				break
+			}
+			if pattern.To == "" {
+				pattern.To = day.Day
+			}
+			pattern.From = day.Day
+			pattern.Days++
+			previous = at
+		}
+		if pattern.Days > best.Days {
+			best = pattern
+		}
+	}
+	return best, best.Days > 0
+}
+
+// LastCheckIn 返回最近一次关心，没有时返回 false。
+func (mm *MoodManager) LastCheckIn(userID int64) (MoodCheckIn, bool) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	timeline := mm.moods[userID]
+	if timeline == nil || len(timeline.CheckIns) == 0 {
+		return MoodCheckIn{}, false
+	}
+	return timeline.CheckIns[len(timeline.CheckIns)-1], true
+}
+
+// RecordCheckIn 记下一次已发出的关心。
+func (mm *MoodManager) RecordCheckIn(userID int64, checkIn MoodCheckIn) {
+	mm.mu.Lock()
+	timeline := mm.moods[userID]
+	if timeline == nil {
+		mm.mu.Unlock()
+		return
+	}
+	timeline.CheckIns = append(timeline.CheckIns, checkIn)
+	if overflow := len(timeline.CheckIns) - moodCheckInLimit; overflow > 0 {
+		timeline.CheckIns = append([]MoodCheckIn(nil), timeline.CheckIns[overflow:]...)
+	}
+	mm.mu.Unlock()
+
+	mm.markDirty()
+}
+
+// MoodUserIDs 返回有情绪汇总的用户。
+func (mm *MoodManager) MoodUserIDs() []int64 {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+	return sortedUserIDs(mm.moods)
+}
+
+// DeleteUser 删除用户的情绪汇总，返回删除的天数。
+func (mm *MoodManager) DeleteUser(userID int64) int {
+	mm.mu.Lock()
+	count := 0
+	timeline := mm.moods[userID]
+	if timeline != nil {
+		count = len(timeline.Days)
+		delete(mm.moods, userID)
+	}
+	mm.mu.Unlock()
+
+	if timeline != nil {
+		mm.markDirty()
+	}
+	return count
+}
+
+func (mm *MoodManager) ConfigurePersistence(store storage.SnapshotStore, dirty storage.DirtyMarker) error {
+	mm.mu.Lock()
+	mm.store = store
+	mm.dirty = dirty
+	mm.mu.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	data, err := store.Load(MoodSnapshotName)
+	if err != nil {
+		return fmt.Errorf("load mood timelines failed: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	loaded := make(map[int64]*MoodTimeline)
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("unmarshal mood timelines failed: %w", err)
+	}
+
+	mm.mu.Lock()
+	mm.moods = make(map[int64]*MoodTimeline, len(loaded))
+	for userID, timeline := range loaded {
+		if timeline == nil {
+			continue
+		}
+		timeline.UserID = userID
+		for i := range timeline.Days {
+			if timeline.Days[i].Emotions == nil {
+				timeline.Days[i].Emotions = make(map[string]int)
+			}
+		}
+		mm.moods[userID] = timeline
+	}
+	mm.mu.Unlock()
+	return nil
+}
+
+func (mm *MoodManager) Flush() error {
+	mm.mu.RLock()
+	store := mm.store
+	snapshot := make(map[int64]MoodTimeline, len(mm.moods))
+	for userID, timeline := range mm.moods {
+		snapshot[userID] = cloneMoodTimeline(timeline)
+	}
+	mm.mu.RUnlock()
+
+	if store == nil {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal mood timelines failed: %w", err)
+	}
+	if err := store.Save(MoodSnapshotName, data); err != nil {
+		return fmt.Errorf("save mood timelines failed: %w", err)
+	}
+	return nil
+}
+
+func (mm *MoodManager) markDirty() {
+	mm.mu.RLock()
+	dirty := mm.dirty
+	mm.mu.RUnlock()
+
+	if dirty != nil {
+		dirty.MarkDirty(MoodFlushTaskName)
+	}
+}
+
+// dayLocked 返回某天的汇总，没有时追加一天并裁掉超出保留期的旧数据。
+func (t *MoodTimeline) dayLocked(day string) *MoodDay {
+	for i := len(t.Days) - 1; i >= 0; i-- {
+		if t.Days[i].Day == day {
+			return &t.Days[i]
+		}
+		if t.Days[i].Day < day {
+			break
+		}
+	}
+	t.Days = append(t.Days, MoodDay{Day: day, Emotions: make(map[string]int)})
+	// 时钟回拨时保持按日期升序
+	for i := len(t.Days) - 1; i > 0 && t.Days[i].Day < t.Days[i-1].Day; i-- {
+		t.Days[i], t.Days[i-1] = t.Days[i-1], t.Days[i]
+	}
+	if overflow := len(t.Days) - moodRetentionDays; overflow > 0 {
+		t.Days = append([]MoodDay(nil), t.Days[overflow:]...)
+	}
+	for i := range t.Days {
+		if t.Days[i].Day == day {
+			return &t.Days[i]
+		}
+	}
+	// 比保留期还早的日期，计入一个不保存的临时记录
+	return &MoodDay{Day: day, Emotions: make(map[string]int)}
+}
+
+func (d MoodDay) distressedBy(emotion string) bool {
+	count := d.Emotions[emotion]
+	return count >= moodDistressMinMessages && float64(count) >= moodDistressShare*float64(d.Rated)
+}
+
+// dominantEmotion 次数最多的情绪，并列时取强度高的，保证结果确定。
+func dominantEmotion(emotions map[string]int) string {
+	dominant := ""
+	for emotion, count := range emotions {
+		best := emotions[dominant]
+		if dominant == "" || count > best ||
+			(count == best && (moodEmotionIntensity[emotion] > moodEmotionIntensity[dominant] ||
+				(moodEmotionIntensity[emotion] == moodEmotionIntensity[dominant] && emotion < dominant))) {
+			dominant = emotion
+		}
+	}
+	return dominant
+}
+
+func cloneMoodTimeline(timeline *MoodTimeline) MoodTimeline {
+	cloned := MoodTimeline{
+		UserID:   timeline.UserID,
+		Days:     make([]MoodDay, len(timeline.Days)),
+		CheckIns: append([]MoodCheckIn{}, timeline.CheckIns...),
+	}
+	for i, day := range timeline.Days {
+		day.Emotions = cloneStringIntMap(day.Emotions)
+		cloned.Days[i] = day
+	}
+	return cloned
+}
@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMoodTimelineAggregatesDaysAndFindsDistressStreak(t *testing.T) {
+	mm := &MoodManager{moods: make(map[int64]*MoodTimeline)}
+	const userID = 11
+	start := time.Date(2026, 3, 1, 21, 0, 0, 0, time.UTC)
+
+	mm.Record(userID, "开心", "想和对方聊天", start)
+	mm.Record(userID, "", "", start.Add(time.Minute))
+	for day := 1; day <= 3; day++ {
+		at := start.AddDate(0, 0, day)
+		mm.Record(userID, "难过", "想和对方倾诉", at)
+		mm.Record(userID, "难过", "", at.Add(time.Minute))
+		mm.Record(userID, "中性", "", at.Add(2*time.Minute))
+	}
+
+	timeline, ok := mm.Timeline(userID, 0)
+	if !ok || len(timeline.Days) != 4 {
+		t.Fatalf("expected 4 days, got %+v", timeline.Days)
+	}
+	first := timeline.Days[0]
+	if first.Messages != 2 || first.Rated != 1 || first.Dominant != "开心" || first.Intensity != 0.6 {
+		t.Fatalf("unexpected first day: %+v", first)
+	}
+	if last := timeline.Days[3]; last.Dominant != "难过" || last.Intensity != 0.6 || last.Emotions["难过"] != 2 {
+		t.Fatalf("unexpected last day: %+v", last)
+	}
+	if recent, _ := mm.Timeline(userID, 2); len(recent.Days) != 2 || recent.Days[0].Day != "2026-03-03" {
+		t.Fatalf("expected last two days, got %+v", recent.Days)
+	}
+
+	pattern, ok := mm.DistressPattern(userID, "2026-03-05")
+	if !ok || pattern.Emotion != "难过" || pattern.Days != 3 || pattern.From != "2026-03-02" || pattern.To != "2026-03-04" {
+		t.Fatalf("unexpected pattern: %+v %v", pattern, ok)
+	}
+	if _, ok := mm.DistressPattern(userID, "2026-03-07"); ok {
+		t.Fatalf("a streak that ended days ago should not count")
+	}
+
+	// 中间断一天，连续天数从头算
+	mm.Record(userID, "难过", "", start.AddDate(0, 0, 5))
+	mm.Record(userID, "难过", "", start.AddDate(0, 0, 5).Add(time.Minute))
+	if pattern, _ := mm.DistressPattern(userID, "2026-03-06"); pattern.Days != 1 {
+		t.Fatalf("gap day should break the streak, got %+v", pattern)
+	}
+
+	mm.RecordCheckIn(userID, MoodCheckIn{At: start, Emotion: "难过", Days: 3})
+	if checkIn, ok := mm.LastCheckIn(userID); !ok || checkIn.Days != 3 {
+		t.Fatalf("unexpected check-in: %+v", checkIn)
+	}
+	if deleted := mm.DeleteUser(userID); deleted != 5 {
+		t.Fatalf("expected 5 days deleted, got %d", deleted)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"project-yume/internal/clock"
 	"project-yume/internal/storage"
 )
 
@@ -72,7 +73,7 @@ func (pm *ProfileManager) ApplyPatch(userID int64, patch ProfilePatch) {
 	profile.Likes = mergeUniqueStrings(profile.Likes, patch.Likes)
 	profile.Dislikes = mergeUniqueStrings(profile.Dislikes, patch.Dislikes)
 	profile.Taboos = mergeUniqueStrings(profile.Taboos, patch.Taboos)
-	profile.UpdatedAt = time.Now()
+	profile.UpdatedAt = clock.Now()
 	pm.mu.Unlock()
 
 	pm.markDirty()
@@ -99,6 +100,46 @@ func (pm *ProfileManager) GetProfile(userID int64) UserProfile {
 	}
 }
 
+// SetPreferenceLists 人工覆盖喜好、厌恶与禁忌列表，nil 表示该项不变。
+func (pm *ProfileManager) SetPreferenceLists(userID int64, likes, dislikes, taboos []string) UserProfile {
+	pm.mu.Lock()
+	profile := pm.ensureProfileLocked(userID)
+	if likes != nil {
+		profile.Likes = mergeUniqueStrings(nil, likes)
+	}
+	if dislikes != nil {
+		profile.Dislikes = mergeUniqueStrings(nil, dislikes)
+	}
+	if taboos != nil {
+		profile.Taboos = mergeUniqueStrings(nil, taboos)
+	}
+	profile.UpdatedAt = clock.Now()
+	pm.mu.Unlock()
+
+	pm.markDirty()
+	return pm.GetProfile(userID)
+}
+
+// ProfileUserIDs 返回有画像的用户。
+func (pm *ProfileManager) ProfileUserIDs() []int64 {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return sortedUserIDs(pm.profiles)
+}
+
+// DeleteProfile 删除用户画像，返回是否存在。
+func (pm *ProfileManager) DeleteProfile(userID int64) bool {
+	pm.mu.Lock()
+	_, ok := pm.profiles[userID]
+	delete(pm.profiles, userID)
+	pm.mu.Unlock()
+
+	if ok {
+		pm.markDirty()
+	}
+	return ok
+}
+
 func (pm *ProfileManager) ConfigurePersistence(store storage.SnapshotStore, dirty storage.DirtyMarker) error {
 	pm.mu.Lock()
 	pm.store = store
@@ -157,7 +198,7 @@ func (pm *ProfileManager) ensureProfileLocked(userID int64) *UserProfile {
 			Likes:     []string{},
 			Dislikes:  []string{},
 			Taboos:    []string{},
-			UpdatedAt: time.Now(),
+			UpdatedAt: clock.Now(),
 		}
 		pm.profiles[userID] = profile
 		return profile
@@ -173,7 +214,7 @@ func (pm *ProfileManager) ensureProfileLocked(userID int64) *UserProfile {
 		profile.Taboos = []string{}
 	}
 	if profile.UpdatedAt.IsZero() {
-		profile.UpdatedAt = time.Now()
+		profile.UpdatedAt = clock.Now()
 	}
 	return profile
 }
@@ -200,7 +241,7 @@ func (pm *ProfileManager) normalizeProfilesLocked() {
 			profile.Taboos = []string{}
 		}
 		if profile.UpdatedAt.IsZero() {
-			profile.UpdatedAt = time.Now()
+			profile.UpdatedAt = clock.Now()
 		}
 	}
 }
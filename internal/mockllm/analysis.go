@@ -0,0 +1,173 @@
+package mockllm
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// AnalysisSchemaName 与 service 包分析请求的 schema 名一致。
+const AnalysisSchemaName = "message_analysis"
+
+// analysis 字段与顺序和 service.MessageAnalysis 一致，visible_reply 放最后方便流式提取。
+type analysis struct {
+	Emotion          string  `json:"emotion"`
+	Intention        string  `json:"intention"`
+	WannaBye         string  `json:"wanna_bye"`
+	ReplyMode        string  `json:"reply_mode"`
+	ReplyExpectation string  `json:"reply_expectation"`
+	TurnStatus       string  `json:"turn_status"`
+	SupportStrategy  string  `json:"support_strategy"`
+	Topic            string  `json:"topic"`
+	UserNeed         string  `json:"user_need"`
+	Confidence       float64 `json:"confidence"`
+	VisibleReply     string  `json:"visible_reply"`
+}
+
+type keywordRule struct {
+	keywords []string
+	apply    func(*analysis)
+}
+
+// keywordRules 按关键词给出一个说得过去的分析结果，先命中的优先。
+var keywordRules = []keywordRule{
+	{[]string{"拜拜", "晚安", "睡了", "下次聊"}, func(a *analysis) {
+		a.WannaBye = "想结束对话"
+		a.SupportStrategy = "close_conversation"
+		a.ReplyExpectation = "low"
+		a.VisibleReply = "好，晚安$早点休息"
+	}},
+	{[]string{"累", "难过", "哭", "烦死", "压力"}, func(a *analysis) {
+		a.Emotion = "难过"
+		a.Intention = "想和对方倾诉"
+		a.SupportStrategy = "comfort"
+		a.UserNeed = "被安慰"
+		a.ReplyExpectation = "high"
+		a.VisibleReply = "辛苦了$先歇一会儿吧$我在呢"
+	}},
+	{[]string{"生气", "滚", "讨厌"}, func(a *analysis) {
+		a.Emotion = "生气"
+		a.SupportStrategy = "acknowledge_and_wait"
+		a.VisibleReply = "怎么了$谁惹你了"
+	}},
+	{[]string{"哈哈", "开心", "太好了"}, func(a *analysis) {
+		a.Emotion = "开心"
+		a.VisibleReply = "哈哈$什么事这么开心"
+	}},
+	{[]string{"加油", "考试", "面试"}, func(a *analysis) {
+		a.Intention = "想被对方鼓励"
+		a.SupportStrategy = "encourage"
+		a.VisibleReply = "你可以的$加油"
+	}},
+	{[]string{"?", "？", "吗", "什么", "怎么"}, func(a *analysis) {
+		a.SupportStrategy = "answer_directly"
+		a.VisibleReply = "我想想$应该是这样的"
+	}},
+	{[]string{"嗯", "哦", "好吧"}, func(a *analysis) {
+		a.Emotion = "敷衍"
+		a.ReplyMode = "light_ack"
+		a.ReplyExpectation = "low"
+		a.TurnStatus = "user_holds_floor"
+		a.SupportStrategy = "acknowledge_and_wait"
+		a.VisibleReply = "嗯嗯"
+	}},
+}
+
+// defaultAnalysis 按用户消息生成合法的分析 JSON，override 中的字段覆盖默认值。
+// 普通消息场景只接受 wanna_bye=想继续，只有长对话场景才会判断为想结束。
+func defaultAnalysis(userText string, longChat bool, override json.RawMessage) string {
+	result := analysis{
+		Emotion:          "中性",
+		Intention:        "想和对方聊天",
+		WannaBye:         "想继续",
+		ReplyMode:        "full_reply",
+		ReplyExpectation: "medium",
+		TurnStatus:       "handoff_to_ai",
+		SupportStrategy:  "continue_chat",
+		Topic:            topicOf(userText),
+		Confidence:       0.8,
+		VisibleReply:     "嗯嗯$然后呢",
+	}
+	for _, rule := range keywordRules {
+		if containsAny(userText, rule.keywords) {
+			rule.apply(&result)
+			break
+		}
+	}
+	if !longChat {
+		result.WannaBye = "想继续"
+	}
+
+	data, _ := json.Marshal(result)
+	if len(override) == 0 {
+		return string(data)
+	}
+	// 先转成有序的字段再合并，保证 visible_reply 仍在最后。
+	var fields map[string]json.RawMessage
+	_ = json.Unmarshal(data, &fields)
+	var overrides map[string]json.RawMessage
+	if err := json.Unmarshal(override, &overrides); err != nil {
+		return string(data)
+	}
+	for key, value := range overrides {
+		fields[key] = value
+	}
+	return orderedJSON(fields)
+}
+
+var analysisFieldOrder = []string{
+	"emotion", "intention", "wanna_bye", "reply_mode", "reply_expectation", "turn_status",
+	"support_strategy", "topic", "user_need", "confidence", "visible_reply",
+}
+
+func orderedJSON(fields map[string]json.RawMessage) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	written := 0
+	write := func(key string, value json.RawMessage) {
+		if written > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+		written++
+	}
+	known := make(map[string]struct{}, len(analysisFieldOrder))
+	for _, key := range analysisFieldOrder {
+		known[key] = struct{}{}
+		if key == "visible_reply" {
+			continue
+		}
+		if value, ok := fields[key]; ok {
+			write(key, value)
+		}
+	}
+	for key, value := range fields {
+		if _, ok := known[key]; !ok {
+			write(key, value)
+		}
+	}
+	if value, ok := fields["visible_reply"]; ok {
+		write("visible_reply", value)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func topicOf(text string) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) > 10 {
+		runes = runes[:10]
+	}
+	return string(runes)
+}
+
+func containsAny(text string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
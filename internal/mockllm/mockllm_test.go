@@ -0,0 +1,134 @@
+package mockllm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func newTestClient(t *testing.T, opts Options) (*Server, *openai.Client) {
+	t.Helper()
+	mock := NewServer(opts)
+	server := httptest.NewServer(mock.Handler())
+	t.Cleanup(server.Close)
+	config := openai.DefaultConfig("test")
+	config.BaseURL = server.URL + "/v1"
+	return mock, openai.NewClientWithConfig(config)
+}
+
+func analysisRequest(text string) openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model: "mock",
+		Messages: []openai.ChatCompletionMessage{
+			{Role: "system", Content: "字段要求：visible_reply"},
+			{Role: "user", Content: "【最近对话】\n无\n\n【当前用户消息】\n" + text},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type:       openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{Name: AnalysisSchemaName},
+		},
+	}
+}
+
+func TestAnalysisResponsesAreValidJSON(t *testing.T) {
+	_, client := newTestClient(t, Options{})
+	resp, err := client.CreateChatCompletion(context.Background(), analysisRequest("今天好累啊"))
+	if err != nil {
+		t.Fatalf("completion: %v", err)
+	}
+	var result analysis
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &result); err != nil {
+		t.Fatalf("analysis should be valid json: %v", err)
+	}
+	if result.Emotion != "难过" || result.SupportStrategy != "comfort" || result.VisibleReply == "" {
+		t.Fatalf("unexpected analysis: %+v", result)
+	}
+
+	request := analysisRequest("今天好累啊")
+	request.Stream = true
+	stream, err := client.CreateChatCompletionStream(context.Background(), request)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer stream.Close()
+	var content strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		if len(chunk.Choices) > 0 {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if content.String() != resp.Choices[0].Message.Content {
+		t.Fatalf("stream content differs:\n%s\n%s", content.String(), resp.Choices[0].Message.Content)
+	}
+}
+
+func TestFaultsFromQueueMarkerAndRules(t *testing.T) {
+	rulesPath := filepath.Join(t.TempDir(), "rules.json")
+	rules := `{"rules":[
+		{"name":"bye","contains":"拜拜","analysis":{"visible_reply":"明天见"}},
+		{"name":"slow","contains":"卡住","fault":"timeout","times":1}
+	]}`
+	if err := os.WriteFile(rulesPath, []byte(rules), 0o644); err != nil {
+		t.Fatalf("write rules: %v", err)
+	}
+	loaded, err := LoadRules(rulesPath)
+	if err != nil {
+		t.Fatalf("load rules: %v", err)
+	}
+	mock, client := newTestClient(t, Options{Rules: loaded})
+
+	if err := mock.QueueFault(Fault429, 1); err != nil {
+		t.Fatalf("queue: %v", err)
+	}
+	_, err = client.CreateChatCompletion(context.Background(), analysisRequest("你好"))
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected queued 429, got %v", err)
+	}
+
+	resp, err := client.CreateChatCompletion(context.Background(), analysisRequest("[mock:malformed] 你好"))
+	if err != nil {
+		t.Fatalf("malformed: %v", err)
+	}
+	if json.Valid([]byte(resp.Choices[0].Message.Content)) {
+		t.Fatalf("malformed marker should break json: %s", resp.Choices[0].Message.Content)
+	}
+
+	resp, err = client.CreateChatCompletion(context.Background(), analysisRequest("拜拜"))
+	if err != nil {
+		t.Fatalf("rule: %v", err)
+	}
+	var result analysis
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &result); err != nil || result.VisibleReply != "明天见" || result.WannaBye != "想继续" {
+		t.Fatalf("rule override not applied: %+v %v", result, err)
+	}
+	if !strings.HasSuffix(resp.Choices[0].Message.Content, `"visible_reply":"明天见"}`) {
+		t.Fatalf("visible_reply should stay last: %s", resp.Choices[0].Message.Content)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := client.CreateChatCompletion(ctx, analysisRequest("卡住了")); err == nil {
+		t.Fatalf("timeout rule should hang until the client gives up")
+	}
+	if _, err := client.CreateChatCompletion(context.Background(), analysisRequest("卡住了")); err != nil {
+		t.Fatalf("timeout rule should expire after one hit: %v", err)
+	}
+}
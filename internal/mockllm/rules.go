@@ -0,0 +1,165 @@
+package mockllm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// 可注入的故障。
+const (
+	FaultTimeout   = "timeout"   // 挂起直到客户端放弃
+	Fault429       = "429"       // 返回 429 Too Many Requests
+	Fault500       = "500"       // 返回 500
+	Fault503       = "503"       // 返回 503
+	FaultMalformed = "malformed" // 返回截断的 JSON 内容
+	FaultCut       = "cut"       // 流式输出一半后断开，不发 [DONE]
+)
+
+var validFaults = map[string]struct{}{
+	FaultTimeout:   {},
+	Fault429:       {},
+	Fault500:       {},
+	Fault503:       {},
+	FaultMalformed: {},
+	FaultCut:       {},
+}
+
+// markerPattern 匹配消息里的 [mock:429] 这类标记，聊天时直接输入即可触发故障。
+var markerPattern = regexp.MustCompile(`\[mock:([a-z0-9]+)\]`)
+
+// ToolCall 规则要求模型发起的工具调用。
+type ToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// Rule 一条脚本规则。条件都为空的规则匹配所有请求；按文件中的顺序取第一条命中的。
+type Rule struct {
+	Name string `json:"name"`
+
+	// 条件
+	Contains string `json:"contains,omitempty"` // 最后一条用户消息包含该文本
+	Regex    string `json:"regex,omitempty"`    // 最后一条用户消息匹配该正则
+	Schema   string `json:"schema,omitempty"`   // response_format 的 schema 名
+	Model    string `json:"model,omitempty"`
+	Stream   *bool  `json:"stream,omitempty"`
+	Times    int    `json:"times,omitempty"` // 命中这么多次后失效，0 表示不限
+
+	// 响应
+	Fault    string          `json:"fault,omitempty"`
+	DelayMs  int             `json:"delay_ms,omitempty"`
+	Content  string          `json:"content,omitempty"`
+	Analysis json.RawMessage `json:"analysis,omitempty"` // 覆盖默认分析结果中的字段
+	ToolCall *ToolCall       `json:"tool_call,omitempty"`
+
+	pattern *regexp.Regexp
+	hits    int
+}
+
+// RuleSet 规则文件的结构。
+type RuleSet struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadRules 读取规则文件并校验。
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set RuleSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse rules %s: %w", path, err)
+	}
+	for i := range set.Rules {
+		if err := set.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i, set.Rules[i].Name, err)
+		}
+	}
+	return set.Rules, nil
+}
+
+func (r *Rule) compile() error {
+	if r.Fault != "" {
+		if _, ok := validFaults[r.Fault]; !ok {
+			return fmt.Errorf("unknown fault %q", r.Fault)
+		}
+	}
+	if r.Regex != "" {
+		pattern, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return err
+		}
+		r.pattern = pattern
+	}
+	if len(r.Analysis) > 0 {
+		var fields map[string]any
+		if err := json.Unmarshal(r.Analysis, &fields); err != nil {
+			return fmt.Errorf("analysis must be a JSON object: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) matches(req *request) bool {
+	if r.Times > 0 && r.hits >= r.Times {
+		return false
+	}
+	if r.Contains != "" && !strings.Contains(req.lastUser, r.Contains) {
+		return false
+	}
+	if r.pattern != nil && !r.pattern.MatchString(req.lastUser) {
+		return false
+	}
+	if r.Schema != "" && r.Schema != req.schema {
+		return false
+	}
+	if r.Model != "" && r.Model != req.body.Model {
+		return false
+	}
+	if r.Stream != nil && *r.Stream != req.body.Stream {
+		return false
+	}
+	return true
+}
+
+// faultQueue 通过管理接口排队的故障，依次作用在之后的请求上。
+type faultQueue struct {
+	mu     sync.Mutex
+	faults []string
+}
+
+func (q *faultQueue) push(fault string, count int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := 0; i < count; i++ {
+		q.faults = append(q.faults, fault)
+	}
+}
+
+func (q *faultQueue) pop() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.faults) == 0 {
+		return ""
+	}
+	fault := q.faults[0]
+	q.faults = q.faults[1:]
+	return fault
+}
+
+func (q *faultQueue) pending() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string{}, q.faults...)
+}
+
+func (q *faultQueue) clear() {
+	q.mu.Lock()
+	q.faults = nil
+	q.mu.Unlock()
+}
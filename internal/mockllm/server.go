@@ -0,0 +1,417 @@
+package mockllm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"project-yume/internal/utils"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	maxRecentRequests = 100
+	// currentMessageMarker 分析请求里当前用户消息所在段落的标题。
+	currentMessageMarker = "【当前用户消息】"
+	longChatMarker       = "用户正在和 AI 进行长对话"
+	defaultReply         = "嗯嗯$我在听"
+)
+
+// Options 服务参数。
+type Options struct {
+	Rules      []Rule
+	Latency    time.Duration // 每次响应前的固定延迟
+	ChunkDelay time.Duration // 流式分片之间的延迟
+	ChunkRunes int           // 每个流式分片的字数
+	HoldLimit  time.Duration // timeout 故障最长挂起时间，防止客户端不设超时时永远不返回
+}
+
+// Server OpenAI 兼容的模拟模型服务。
+type Server struct {
+	opts   Options
+	mu     sync.Mutex
+	rules  []Rule
+	faults faultQueue
+	seq    atomic.Int64
+
+	recentMu sync.Mutex
+	recent   []RequestLog
+}
+
+// RequestLog 收到的请求摘要，供联调时核对实际发出的内容。
+type RequestLog struct {
+	ID       int64                          `json:"id"`
+	Time     time.Time                      `json:"time"`
+	Model    string                         `json:"model"`
+	Stream   bool                           `json:"stream"`
+	Schema   string                         `json:"schema,omitempty"`
+	Tools    []string                       `json:"tools,omitempty"`
+	Rule     string                         `json:"rule,omitempty"`
+	Fault    string                         `json:"fault,omitempty"`
+	Messages []openai.ChatCompletionMessage `json:"messages"`
+}
+
+// request 一次请求解析后的内容。
+type request struct {
+	body     openai.ChatCompletionRequest
+	lastUser string
+	schema   string
+}
+
+func NewServer(opts Options) *Server {
+	if opts.ChunkRunes <= 0 {
+		opts.ChunkRunes = 6
+	}
+	if opts.HoldLimit <= 0 {
+		opts.HoldLimit = 2 * time.Minute
+	}
+	return &Server{opts: opts, rules: opts.Rules}
+}
+
+// Handler 返回 HTTP 路由：
+//
+//	POST   /v1/chat/completions  聊天补全，支持流式
+//	GET    /v1/models            模型列表
+//	POST   /mock/faults          排队故障 {"fault":"429","count":2}
+//	GET    /mock/faults          查看排队中的故障
+//	DELETE /mock/faults          清空故障
+//	GET    /mock/requests        最近收到的请求
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", s.handleChat)
+	mux.HandleFunc("/chat/completions", s.handleChat)
+	mux.HandleFunc("/v1/models", s.handleModels)
+	mux.HandleFunc("/mock/faults", s.handleFaults)
+	mux.HandleFunc("/mock/requests", s.handleRequests)
+	return mux
+}
+
+// QueueFault 让之后的 count 个请求依次触发故障。
+func (s *Server) QueueFault(fault string, count int) error {
+	if _, ok := validFaults[fault]; !ok {
+		return fmt.Errorf("unknown fault %q", fault)
+	}
+	if count <= 0 {
+		count = 1
+	}
+	s.faults.push(fault, count)
+	return nil
+}
+
+// Requests 返回最近的请求，最新的在后。
+func (s *Server) Requests() []RequestLog {
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+	return append([]RequestLog{}, s.recent...)
+}
+
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+	var body openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid json: "+err.Error())
+		return
+	}
+	req := &request{body: body, lastUser: lastUserText(body.Messages)}
+	if body.ResponseFormat != nil && body.ResponseFormat.JSONSchema != nil {
+		req.schema = body.ResponseFormat.JSONSchema.Name
+	}
+
+	rule := s.match(req)
+	fault := s.faults.pop()
+	if fault == "" {
+		if marker := markerPattern.FindStringSubmatch(req.lastUser); marker != nil {
+			fault = marker[1]
+		}
+	}
+	if fault == "" && rule != nil {
+		fault = rule.Fault
+	}
+	s.log(req, rule, fault)
+
+	delay := s.opts.Latency
+	if rule != nil && rule.DelayMs > 0 {
+		delay += time.Duration(rule.DelayMs) * time.Millisecond
+	}
+	if delay > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+
+	switch fault {
+	case FaultTimeout:
+		select {
+		case <-r.Context().Done():
+		case <-time.After(s.opts.HoldLimit):
+			writeError(w, http.StatusGatewayTimeout, "timeout", "mock timeout")
+		}
+		return
+	case Fault429:
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, "rate_limit_exceeded", "mock rate limit exceeded")
+		return
+	case Fault500:
+		writeError(w, http.StatusInternalServerError, "server_error", "mock internal error")
+		return
+	case Fault503:
+		writeError(w, http.StatusServiceUnavailable, "server_error", "mock service unavailable")
+		return
+	}
+
+	message := s.reply(req, rule)
+	if fault == FaultMalformed {
+		message.Content = malformed(message.Content)
+	}
+	if body.Stream {
+		s.writeStream(w, r, req, message, fault == FaultCut)
+		return
+	}
+	writeCompletion(w, req, message)
+}
+
+func (s *Server) match(req *request) *Rule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if rule.matches(req) {
+			rule.hits++
+			matched := *rule
+			return &matched
+		}
+	}
+	return nil
+}
+
+// reply 生成回复：规则指定的内容优先，其次是工具调用，再按请求类型给默认内容。
+func (s *Server) reply(req *request, rule *Rule) openai.ChatCompletionMessage {
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	userText := currentUserText(req.lastUser)
+
+	if rule != nil && rule.ToolCall != nil && len(req.body.Tools) > 0 && !answeredTool(req.body.Messages) {
+		arguments := string(rule.ToolCall.Arguments)
+		if arguments == "" {
+			arguments = "{}"
+		}
+		message.ToolCalls = []openai.ToolCall{{
+			ID:       fmt.Sprintf("call_mock_%d", s.seq.Add(1)),
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: rule.ToolCall.Name, Arguments: arguments},
+		}}
+		return message
+	}
+
+	switch {
+	case rule != nil && rule.Content != "":
+		message.Content = rule.Content
+	case req.schema == AnalysisSchemaName || isAnalysisPrompt(req.body.Messages):
+		var override json.RawMessage
+		if rule != nil {
+			override = rule.Analysis
+		}
+		message.Content = defaultAnalysis(userText, isLongChatPrompt(req.body.Messages), override)
+	case req.schema != "":
+		message.Content = "{}"
+	default:
+		message.Content = defaultReply
+	}
+	return message
+}
+
+func (s *Server) log(req *request, rule *Rule, fault string) {
+	entry := RequestLog{
+		ID:       s.seq.Add(1),
+		Time:     time.Now(),
+		Model:    req.body.Model,
+		Stream:   req.body.Stream,
+		Schema:   req.schema,
+		Fault:    fault,
+		Messages: req.body.Messages,
+	}
+	for _, tool := range req.body.Tools {
+		if tool.Function != nil {
+			entry.Tools = append(entry.Tools, tool.Function.Name)
+		}
+	}
+	if rule != nil {
+		entry.Rule = rule.Name
+	}
+	utils.Info("mockllm request #%d model=%s stream=%t schema=%s rule=%s fault=%s",
+		entry.ID, entry.Model, entry.Stream, entry.Schema, entry.Rule, entry.Fault)
+
+	s.recentMu.Lock()
+	s.recent = append(s.recent, entry)
+	if len(s.recent) > maxRecentRequests {
+		s.recent = s.recent[len(s.recent)-maxRecentRequests:]
+	}
+	s.recentMu.Unlock()
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"data":   []map[string]any{{"id": "mock", "object": "model", "owned_by": "mockllm"}},
+	})
+}
+
+func (s *Server) handleFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]any{"pending": s.faults.pending()})
+	case http.MethodDelete:
+		s.faults.clear()
+		writeJSON(w, http.StatusOK, map[string]any{"pending": []string{}})
+	case http.MethodPost:
+		var body struct {
+			Fault string `json:"fault"`
+			Count int    `json:"count"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid json: "+err.Error())
+			return
+		}
+		if err := s.QueueFault(body.Fault, body.Count); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"pending": s.faults.pending()})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+	}
+}
+
+func (s *Server) handleRequests(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"requests": s.Requests()})
+}
+
+func lastUserText(messages []openai.ChatCompletionMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		message := messages[i]
+		if message.Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		if message.Content != "" {
+			return message.Content
+		}
+		parts := make([]string, 0, len(message.MultiContent))
+		for _, part := range message.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeText {
+				parts = append(parts, part.Text)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// currentUserText 分析请求的用户消息里带着时间、记忆和最近对话，只取当前用户消息那段。
+func currentUserText(text string) string {
+	if index := strings.LastIndex(text, currentMessageMarker); index >= 0 {
+		return strings.TrimSpace(text[index+len(currentMessageMarker):])
+	}
+	return text
+}
+
+// isAnalysisPrompt 关闭 JSON schema 时分析请求不带 response_format，按提示词识别。
+func isAnalysisPrompt(messages []openai.ChatCompletionMessage) bool {
+	for _, message := range messages {
+		if message.Role == openai.ChatMessageRoleSystem && strings.Contains(message.Content, "visible_reply") {
+			return true
+		}
+	}
+	return false
+}
+
+// isLongChatPrompt 长对话场景的分析提示词带有场景说明。
+func isLongChatPrompt(messages []openai.ChatCompletionMessage) bool {
+	for _, message := range messages {
+		if message.Role == openai.ChatMessageRoleSystem && strings.Contains(message.Content, longChatMarker) {
+			return true
+		}
+	}
+	return false
+}
+
+// answeredTool 最后一条消息是工具结果时说明工具已经调过，这轮应给出正文。
+func answeredTool(messages []openai.ChatCompletionMessage) bool {
+	return len(messages) > 0 && messages[len(messages)-1].Role == openai.ChatMessageRoleTool
+}
+
+// malformed 截掉结尾并留下多余逗号，得到一段解析不了的 JSON。
+func malformed(content string) string {
+	runes := []rune(content)
+	if len(runes) > 4 {
+		runes = runes[:len(runes)*2/3]
+	}
+	return string(runes) + `,,`
+}
+
+func usageOf(req *request, message openai.ChatCompletionMessage) openai.Usage {
+	prompt := 0
+	for _, m := range req.body.Messages {
+		prompt += estimateTokens(m.Content)
+	}
+	completion := estimateTokens(message.Content)
+	for _, call := range message.ToolCalls {
+		completion += estimateTokens(call.Function.Arguments)
+	}
+	return openai.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+}
+
+// estimateTokens 粗略估计，中文按每字一个 token。
+func estimateTokens(text string) int {
+	count := 0
+	for _, r := range text {
+		if r > 127 {
+			count += 2
+		} else {
+			count++
+		}
+	}
+	return (count + 1) / 2
+}
+
+func writeCompletion(w http.ResponseWriter, req *request, message openai.ChatCompletionMessage) {
+	finish := openai.FinishReasonStop
+	if len(message.ToolCalls) > 0 {
+		finish = openai.FinishReasonToolCalls
+	}
+	writeJSON(w, http.StatusOK, openai.ChatCompletionResponse{
+		ID:      fmt.Sprintf("chatcmpl-mock-%d", time.Now().UnixNano()),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   modelOf(req),
+		Choices: []openai.ChatCompletionChoice{{Index: 0, Message: message, FinishReason: finish}},
+		Usage:   usageOf(req, message),
+	})
+}
+
+func modelOf(req *request) string {
+	if req.body.Model == "" {
+		return "mock"
+	}
+	return req.body.Model
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, kind, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{"message": message, "type": kind, "code": status},
+	})
+}
@@ -0,0 +1,97 @@
+package mockllm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// writeStream 按 SSE 输出分片。cut 为 true 时输出一半后直接断开，模拟上游中途掉线。
+func (s *Server) writeStream(w http.ResponseWriter, r *http.Request, req *request, message openai.ChatCompletionMessage, cut bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "server_error", "streaming unsupported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	id := fmt.Sprintf("chatcmpl-mock-%d", time.Now().UnixNano())
+	created := time.Now().Unix()
+	send := func(delta openai.ChatCompletionStreamChoiceDelta, finish openai.FinishReason, usage *openai.Usage) bool {
+		chunk := openai.ChatCompletionStreamResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   modelOf(req),
+			Choices: []openai.ChatCompletionStreamChoice{{Index: 0, Delta: delta, FinishReason: finish}},
+			Usage:   usage,
+		}
+		if usage != nil {
+			chunk.Choices = []openai.ChatCompletionStreamChoice{}
+		}
+		data, _ := json.Marshal(chunk)
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	if !send(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, "", nil) {
+		return
+	}
+
+	if len(message.ToolCalls) > 0 {
+		for i, call := range message.ToolCalls {
+			index := i
+			call.Index = &index
+			if !send(openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{call}}, "", nil) {
+				return
+			}
+		}
+		send(openai.ChatCompletionStreamChoiceDelta{}, openai.FinishReasonToolCalls, nil)
+	} else {
+		chunks := splitRunes(message.Content, s.opts.ChunkRunes)
+		for i, chunk := range chunks {
+			if cut && i >= len(chunks)/2 {
+				return
+			}
+			if i > 0 && s.opts.ChunkDelay > 0 {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(s.opts.ChunkDelay):
+				}
+			}
+			if !send(openai.ChatCompletionStreamChoiceDelta{Content: chunk}, "", nil) {
+				return
+			}
+		}
+		if cut {
+			return
+		}
+		send(openai.ChatCompletionStreamChoiceDelta{}, openai.FinishReasonStop, nil)
+	}
+
+	if req.body.StreamOptions != nil && req.body.StreamOptions.IncludeUsage {
+		usage := usageOf(req, message)
+		send(openai.ChatCompletionStreamChoiceDelta{}, "", &usage)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+func splitRunes(text string, size int) []string {
+	runes := []rune(text)
+	chunks := make([]string, 0, len(runes)/size+1)
+	for start := 0; start < len(runes); start += size {
+		end := min(start+size, len(runes))
+		chunks = append(chunks, string(runes[start:end]))
+	}
+	return chunks
+}
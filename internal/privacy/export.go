@@ -0,0 +1,128 @@
+package privacy
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"project-yume/internal/audit"
+	"project-yume/internal/memory"
+	"project-yume/internal/reminder"
+	"project-yume/internal/safety"
+	"project-yume/internal/state"
+	"project-yume/internal/usage"
+)
+
+// maxExportAuditRecords 导出的审计记录上限，最新的优先。
+const maxExportAuditRecords = 5000
+
+// imageCacheNote 图片只在处理消息时向 OneBot 解析地址，本地不落盘。
+const imageCacheNote = "图片只在处理消息时向 OneBot 查询地址或做 OCR，本地没有按用户缓存的图片；会话里可能留有图片地址，已包含在 sessions 中。"
+
+// Bundle 某个用户在各模块中的全部数据。
+type Bundle struct {
+	UserID          int64                   `json:"user_id"`
+	ExportedAt      time.Time               `json:"exported_at"`
+	Sessions        []state.Session         `json:"sessions"`
+	EmotionalMemory *memory.EmotionalMemory `json:"emotional_memory,omitempty"`
+	Profile         *memory.UserProfile     `json:"profile,omitempty"`
+	Affinity        *memory.Affinity        `json:"affinity,omitempty"`
+	Mood            *memory.MoodTimeline    `json:"mood,omitempty"`
+	Facts           []memory.FactMemory     `json:"facts"`
+	Episodes        []memory.Episode        `json:"episodes"`
+	Reminders       []reminder.Reminder     `json:"reminders"`
+	CrisisEvents    []safety.Event          `json:"crisis_events"`
+	Usage           map[string]usage.Totals `json:"usage"`
+	Audit           []audit.Record          `json:"audit"`
+	Logs            []LogReference          `json:"logs"`
+	Tombstone       *Tombstone              `json:"tombstone,omitempty"`
+	Notes           []string                `json:"notes"`
+
+	logLines map[string][][]byte
+}
+
+// Export 汇总用户的全部数据。读取审计或日志失败时返回已收集的部分和错误。
+func Export(userID int64) (*Bundle, error) {
+	bundle := &Bundle{
+		UserID:     userID,
+		ExportedAt: time.Now(),
+		Sessions:   state.GetManager().UserSessions(userID),
+		Facts:      memory.GetFactManager().ListFacts(userID),
+		Episodes:   memory.GetEpisodeManager().ListEpisodes(userID),
+		Reminders:  reminder.GetManager().ListAll(userID),
+		Usage:      usage.GetManager().UserTotals(userID),
+		Audit:      []audit.Record{},
+		Logs:       []LogReference{},
+		Notes:      []string{imageCacheNote},
+	}
+	bundle.EmotionalMemory = memory.GetManager().GetMemory(userID)
+	profiles := memory.GetProfileManager()
+	if slices.Contains(profiles.ProfileUserIDs(), userID) {
+		profile := profiles.GetProfile(userID)
+		bundle.Profile = &profile
+	}
+	if affinity, ok := memory.GetAffinityManager().GetAffinity(userID); ok {
+		bundle.Affinity = &affinity
+	}
+	if mood, ok := memory.GetMoodManager().Timeline(userID, 0); ok {
+		bundle.Mood = &mood
+	}
+	bundle.CrisisEvents = safety.GetEventManager().Events(userID, 0)
+	for i := range bundle.Episodes {
+		bundle.Episodes[i].Vector = nil
+	}
+	if tombstone, ok := GetTombstoneManager().Get(userID); ok {
+		bundle.Tombstone = &tombstone
+	}
+
+	records, err := audit.GetManager().Search(audit.Query{UserID: userID, Limit: maxExportAuditRecords})
+	if err != nil {
+		return bundle, fmt.Errorf("read audit records failed: %w", err)
+	}
+	if records != nil {
+		bundle.Audit = records
+	}
+	if len(records) == maxExportAuditRecords {
+		bundle.Notes = append(bundle.Notes, fmt.Sprintf("审计记录只导出了最新的 %d 条。", maxExportAuditRecords))
+	}
+
+	refs, lines, err := collectLogs(userID)
+	bundle.Logs, bundle.logLines = refs, lines
+	if err != nil {
+		return bundle, fmt.Errorf("scan logs failed: %w", err)
+	}
+	return bundle, nil
+}
+
+// WriteZip 写出 zip 包：export.json 为完整数据，logs/ 下是各文件中提到该用户的原始行。
+func (b *Bundle) WriteZip(w io.Writer) error {
+	archive := zip.NewWriter(w)
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := archive.Create("export.json")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	for _, ref := range b.Logs {
+		file, err := archive.Create("logs/" + filepath.Base(ref.File))
+		if err != nil {
+			return err
+		}
+		for _, line := range b.logLines[ref.File] {
+			if _, err := file.Write(line); err != nil {
+				return err
+			}
+		}
+	}
+	return archive.Close()
+}
@@ -0,0 +1,106 @@
+package privacy
+
+import (
+	"errors"
+	"fmt"
+
+	"project-yume/internal/audit"
+	"project-yume/internal/clock"
+	"project-yume/internal/memory"
+	"project-yume/internal/metrics"
+	"project-yume/internal/reminder"
+	"project-yume/internal/safety"
+	"project-yume/internal/state"
+	"project-yume/internal/usage"
+	"project-yume/internal/utils"
+)
+
+// Report 一次删除的结果，各项为删除的条数。
+type Report struct {
+	UserID       int64          `json:"user_id"`
+	Sessions     []string       `json:"sessions"`
+	Interactions int            `json:"interactions"`
+	Profile      bool           `json:"profile"`
+	Affinity     bool           `json:"affinity"`
+	MoodDays     int            `json:"mood_days"`
+	Facts        int            `json:"facts"`
+	Episodes     int            `json:"episodes"`
+	Reminders    int            `json:"reminders"`
+	CrisisEvents int            `json:"crisis_events"`
+	UsageDays    int            `json:"usage_days"`
+	AuditRecords int            `json:"audit_records"`
+	LogLines     int            `json:"log_lines"`
+	KeptFiles    []LogReference `json:"kept_files"`
+	Tombstone    Tombstone      `json:"tombstone"`
+}
+
+// Forget 先写删除记录再清除各模块中的用户数据，期间还在处理的旧消息会被删除记录拦下。
+// 审计或日志改写失败时其余数据照常删除，错误一并返回。
+func Forget(userID int64, requestedBy string) (Report, error) {
+	if userID == 0 {
+		return Report{}, fmt.Errorf("user_id is required")
+	}
+	report := Report{
+		UserID:    userID,
+		KeptFiles: []LogReference{},
+		Tombstone: GetTombstoneManager().Record(userID, requestedBy, clock.Now()),
+	}
+
+	report.Sessions = state.GetManager().DeleteUserSessions(userID)
+	report.Interactions = memory.GetManager().DeleteUser(userID)
+	report.Profile = memory.GetProfileManager().DeleteProfile(userID)
+	report.Affinity = memory.GetAffinityManager().DeleteUser(userID)
+	report.MoodDays = memory.GetMoodManager().DeleteUser(userID)
+	report.Facts = memory.GetFactManager().DeleteUserFacts(userID)
+	report.Episodes = memory.GetEpisodeManager().DeleteUserEpisodes(userID)
+	report.Reminders = reminder.GetManager().DeleteUser(userID)
+	report.CrisisEvents = safety.GetEventManager().DeleteUser(userID)
+	// 会话可能已被清空，私聊会话 ID 总是补上
+	sessionIDs := append([]string{state.PrivateSessionID(userID)}, report.Sessions...)
+	report.UsageDays = usage.GetManager().ForgetUser(userID, sessionIDs)
+
+	var errs []error
+	auditRecords, err := audit.GetManager().DeleteUser(userID)
+	report.AuditRecords = auditRecords
+	if err != nil {
+		errs = append(errs, fmt.Errorf("purge audit records failed: %w", err))
+	}
+	logLines, err := purgeLogs(userID)
+	report.LogLines = logLines
+	if err != nil {
+		errs = append(errs, fmt.Errorf("purge logs failed: %w", err))
+	}
+	if refs, _, err := collectLogs(userID); err == nil {
+		for _, ref := range refs {
+			if ref.Kept {
+				report.KeptFiles = append(report.KeptFiles, ref)
+			}
+		}
+	}
+
+	err = errors.Join(errs...)
+	result := "ok"
+	if err != nil {
+		result = "partial"
+		utils.Warn("forget user data incomplete: %v", err)
+	}
+	// 不记用户 ID，否则刚清理过的日志里又会出现
+	utils.Infow("user data forgotten",
+		utils.String("requested_by", requestedBy),
+		utils.Int("sessions", len(report.Sessions)),
+		utils.Int("facts", report.Facts),
+		utils.Int("audit_records", report.AuditRecords),
+		utils.Int("log_lines", report.LogLines),
+	)
+	RecordRequest("forget", requestedBy, result)
+	return report, err
+}
+
+// RecordRequest 记录导出与删除请求的次数。
+func RecordRequest(action, requestedBy, result string) {
+	metrics.IncCounter(
+		"bot_privacy_requests_total",
+		"Total user data export and forget requests.",
+		map[string]string{"action": action, "source": requestedBy, "result": result},
+	)
+}
@@ -0,0 +1,149 @@
+package privacy
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"project-yume/internal/config"
+)
+
+// maxLogLineNumbers 每个文件最多记下多少个行号，匹配行数照常统计。
+const maxLogLineNumbers = 1000
+
+// LogReference 日志或录像文件中提到该用户的行。
+type LogReference struct {
+	File        string `json:"file"`
+	Matches     int    `json:"matches"`
+	LineNumbers []int  `json:"line_numbers"`
+	// Kept 为 true 表示删除时不会改写该文件，需要人工处理。
+	Kept bool `json:"kept,omitempty"`
+}
+
+// userPattern 按完整数字匹配用户 ID，避免 123 命中 41234。
+func userPattern(userID int64) *regexp.Regexp {
+	return regexp.MustCompile(`(^|[^0-9])` + strconv.FormatInt(userID, 10) + `([^0-9]|$)`)
+}
+
+// logFiles 返回日志目录下的 .log 文件，按文件名排序。
+func logFiles() ([]string, error) {
+	dir := strings.TrimSpace(config.GetConfig().LogDir)
+	if dir == "" {
+		dir = "./logs"
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".log") {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// scanFile 返回提到该用户的行号与行内容，文件不存在时返回 nil。
+func scanFile(path string, pattern *regexp.Regexp) (LogReference, [][]byte, error) {
+	ref := LogReference{File: path, LineNumbers: []int{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ref, nil, nil
+	}
+	if err != nil {
+		return ref, nil, err
+	}
+	var lines [][]byte
+	for index, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if !pattern.Match(line) {
+			continue
+		}
+		ref.Matches++
+		if len(ref.LineNumbers) < maxLogLineNumbers {
+			ref.LineNumbers = append(ref.LineNumbers, index+1)
+		}
+		lines = append(lines, line)
+	}
+	return ref, lines, nil
+}
+
+// collectLogs 扫描日志目录和回放录像，返回引用及匹配到的原始行，键为文件路径。
+func collectLogs(userID int64) ([]LogReference, map[string][][]byte, error) {
+	pattern := userPattern(userID)
+	paths, err := logFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	refs := make([]LogReference, 0)
+	lines := make(map[string][][]byte)
+	add := func(path string, kept bool) error {
+		ref, matched, err := scanFile(path, pattern)
+		if err != nil {
+			return err
+		}
+		if ref.Matches == 0 {
+			return nil
+		}
+		ref.Kept = kept
+		refs = append(refs, ref)
+		lines[path] = matched
+		return nil
+	}
+	for _, path := range paths {
+		if err := add(path, false); err != nil {
+			return refs, lines, err
+		}
+	}
+	// 录像是整段会话的原始帧，改写后无法回放，只列出不删除
+	if cassette := strings.TrimSpace(config.GetConfig().ReplayRecordFile); cassette != "" {
+		if err := add(cassette, true); err != nil {
+			return refs, lines, err
+		}
+	}
+	return refs, lines, nil
+}
+
+// purgeLogs 从日志目录的文件里删掉提到该用户的行，返回删除的行数。
+// 当天的日志仍在追加写入，改写期间写入的少量行可能丢失。
+func purgeLogs(userID int64) (int, error) {
+	pattern := userPattern(userID)
+	paths, err := logFiles()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return total, err
+		}
+		kept := make([]byte, 0, len(data))
+		removed := 0
+		for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+			if pattern.Match(line) {
+				removed++
+				continue
+			}
+			kept = append(kept, line...)
+		}
+		if removed == 0 {
+			continue
+		}
+		// 原地覆盖而不是改名替换，日志器持有的文件句柄继续有效
+		if err := os.WriteFile(path, kept, 0o666); err != nil {
+			return total, err
+		}
+		total += removed
+	}
+	return total, nil
+}
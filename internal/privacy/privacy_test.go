@@ -0,0 +1,102 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"project-yume/internal/audit"
+	"project-yume/internal/config"
+	"project-yume/internal/memory"
+	"project-yume/internal/reminder"
+	"project-yume/internal/state"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestExportAndForgetUser(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	t.Cleanup(func() { *cfg = previous })
+	cfg.DataDir = t.TempDir()
+	cfg.LogDir = t.TempDir()
+	cfg.EnableAIAudit = true
+	cfg.ReplayRecordFile = ""
+
+	const userID, otherID = 9001, 9002
+	sessionID := state.PrivateSessionID(userID)
+	sm := state.GetManager()
+	sm.EnsureSession(sessionID, userID, 0, 1)
+	sm.RecordUserTurn(sessionID, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "我养了一只猫"}, time.Now())
+	memory.GetFactManager().UpsertFacts(userID, sessionID, []memory.FactMemory{{Predicate: "pet", Object: "猫", Summary: "用户养了猫", Confidence: 0.9}})
+	memory.GetFactManager().UpsertFacts(otherID, state.PrivateSessionID(otherID), []memory.FactMemory{{Predicate: "pet", Object: "狗", Summary: "用户养了狗", Confidence: 0.9}})
+	memory.GetProfileManager().SetPreferenceLists(userID, []string{"猫"}, nil, nil)
+	if _, err := reminder.GetManager().Add(reminder.Reminder{UserID: userID, Content: "喂猫", DueAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatalf("add reminder failed: %v", err)
+	}
+	audit.GetManager().Write(audit.Record{ID: "ai-user", Kind: audit.KindCall, UserID: userID, Task: "reply"})
+	audit.GetManager().Write(audit.Record{ID: "ai-other", Kind: audit.KindCall, UserID: otherID, Task: "reply"})
+	logFile := filepath.Join(cfg.LogDir, "bot_2026-03-01.log")
+	logText := "INFO message user_id=9001 text\nINFO message user_id=90011\nINFO other user_id=9002\n"
+	if err := os.WriteFile(logFile, []byte(logText), 0o644); err != nil {
+		t.Fatalf("write log failed: %v", err)
+	}
+
+	bundle, err := Export(userID)
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if len(bundle.Sessions) != 1 || len(bundle.Facts) != 1 || bundle.Profile == nil || len(bundle.Reminders) != 1 {
+		t.Fatalf("unexpected bundle: %+v", bundle)
+	}
+	if len(bundle.Audit) != 1 || bundle.Audit[0].ID != "ai-user" {
+		t.Fatalf("unexpected audit records: %+v", bundle.Audit)
+	}
+	if len(bundle.Logs) != 1 || bundle.Logs[0].Matches != 1 || bundle.Logs[0].LineNumbers[0] != 1 {
+		t.Fatalf("unexpected log references: %+v", bundle.Logs)
+	}
+	var buf bytes.Buffer
+	if err := bundle.WriteZip(&buf); err != nil {
+		t.Fatalf("write zip failed: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil || len(archive.File) != 2 || archive.File[0].Name != "export.json" {
+		t.Fatalf("unexpected zip: %v %v", archive, err)
+	}
+
+	report, err := Forget(userID, RequestedByAdmin)
+	if err != nil {
+		t.Fatalf("forget failed: %v", err)
+	}
+	if report.Facts != 1 || !report.Profile || report.Reminders != 1 || report.AuditRecords != 1 || report.LogLines != 1 || len(report.Sessions) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	after, err := Export(userID)
+	if err != nil {
+		t.Fatalf("export after forget failed: %v", err)
+	}
+	if len(after.Sessions)+len(after.Facts)+len(after.Reminders)+len(after.Audit)+len(after.Logs) != 0 || after.Profile != nil || after.Tombstone == nil {
+		t.Fatalf("data left after forget: %+v", after)
+	}
+	if len(memory.GetFactManager().ListFacts(otherID)) != 1 {
+		t.Fatalf("other user's facts should be kept")
+	}
+	if records, _ := audit.GetManager().Search(audit.Query{UserID: otherID}); len(records) != 1 {
+		t.Fatalf("other user's audit records should be kept, got %d", len(records))
+	}
+	if data, _ := os.ReadFile(logFile); strings.Contains(string(data), "user_id=9001 ") || !strings.Contains(string(data), "90011") {
+		t.Fatalf("unexpected log after purge: %q", data)
+	}
+
+	tombstones := GetTombstoneManager()
+	if !tombstones.Blocks(userID, report.Tombstone.DeletedAt.Add(-time.Minute)) {
+		t.Fatalf("messages before deletion should be blocked")
+	}
+	if tombstones.Blocks(userID, report.Tombstone.DeletedAt.Add(time.Minute)) || tombstones.Blocks(otherID, time.Now()) {
+		t.Fatalf("later messages and other users should not be blocked")
+	}
+}
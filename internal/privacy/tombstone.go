@@ -0,0 +1,162 @@
+package privacy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"project-yume/internal/storage"
+)
+
+const (
+	RequestedByAdmin = "admin"
+	RequestedByUser  = "user"
+)
+
+const TombstoneSnapshotName = "privacy/tombstones.json"
+const TombstoneFlushTaskName = "tombstones"
+
+// Tombstone 记录某个用户的数据已被删除，只保存用户 ID 和时间，不含任何内容。
+type Tombstone struct {
+	UserID      int64     `json:"user_id"`
+	DeletedAt   time.Time `json:"deleted_at"`
+	RequestedBy string    `json:"requested_by"`
+}
+
+// TombstoneManager 保存删除记录，记忆写入前据此拦截删除之前的消息。
+type TombstoneManager struct {
+	mu         sync.RWMutex
+	tombstones map[int64]*Tombstone
+	store      storage.SnapshotStore
+	dirty      storage.DirtyMarker
+}
+
+var tombstoneManager *TombstoneManager
+
+func init() {
+	tombstoneManager = &TombstoneManager{
+		tombstones: make(map[int64]*Tombstone),
+	}
+}
+
+func GetTombstoneManager() *TombstoneManager {
+	return tombstoneManager
+}
+
+// Record 写入或刷新用户的删除记录。
+func (tm *TombstoneManager) Record(userID int64, requestedBy string, at time.Time) Tombstone {
+	tombstone := Tombstone{UserID: userID, DeletedAt: at, RequestedBy: requestedBy}
+
+	tm.mu.Lock()
+	tm.tombstones[userID] = &tombstone
+	tm.mu.Unlock()
+
+	tm.markDirty()
+	return tombstone
+}
+
+// Get 返回用户的删除记录。
+func (tm *TombstoneManager) Get(userID int64) (Tombstone, bool) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	tombstone := tm.tombstones[userID]
+	if tombstone == nil {
+		return Tombstone{}, false
+	}
+	return *tombstone, true
+}
+
+// List 按删除时间倒序返回全部删除记录。
+func (tm *TombstoneManager) List() []Tombstone {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	result := make([]Tombstone, 0, len(tm.tombstones))
+	for _, tombstone := range tm.tombstones {
+		result = append(result, *tombstone)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].DeletedAt.After(result[j].DeletedAt) })
+	return result
+}
+
+// Blocks 判断 at 时刻的消息是否早于删除，早于删除的内容不应再写入记忆。
+// 时间未知时放行，避免用户删除后重新开始的对话被一直拦截。
+func (tm *TombstoneManager) Blocks(userID int64, at time.Time) bool {
+	if userID == 0 || at.IsZero() {
+		return false
+	}
+	tombstone, ok := tm.Get(userID)
+	return ok && !at.After(tombstone.DeletedAt)
+}
+
+func (tm *TombstoneManager) ConfigurePersistence(store storage.SnapshotStore, dirty storage.DirtyMarker) error {
+	tm.mu.Lock()
+	tm.store = store
+	tm.dirty = dirty
+	tm.mu.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	data, err := store.Load(TombstoneSnapshotName)
+	if err != nil {
+		return fmt.Errorf("load tombstones failed: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	loaded := make(map[int64]*Tombstone)
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("unmarshal tombstones failed: %w", err)
+	}
+
+	tm.mu.Lock()
+	tm.tombstones = make(map[int64]*Tombstone, len(loaded))
+	for userID, tombstone := range loaded {
+		if tombstone == nil || userID == 0 {
+			continue
+		}
+		tombstone.UserID = userID
+		tm.tombstones[userID] = tombstone
+	}
+	tm.mu.Unlock()
+	return nil
+}
+
+func (tm *TombstoneManager) Flush() error {
+	tm.mu.RLock()
+	store := tm.store
+	snapshot := make(map[int64]Tombstone, len(tm.tombstones))
+	for userID, tombstone := range tm.tombstones {
+		snapshot[userID] = *tombstone
+	}
+	tm.mu.RUnlock()
+
+	if store == nil {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal tombstones failed: %w", err)
+	}
+	if err := store.Save(TombstoneSnapshotName, data); err != nil {
+		return fmt.Errorf("save tombstones failed: %w", err)
+	}
+	return nil
+}
+
+func (tm *TombstoneManager) markDirty() {
+	tm.mu.RLock()
+	dirty := tm.dirty
+	tm.mu.RUnlock()
+
+	if dirty != nil {
+		dirty.MarkDirty(TombstoneFlushTaskName)
+	}
+}
@@ -0,0 +1,153 @@
+package reminder
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// CommandKind 聊天里与提醒相关的指令类型。
+type CommandKind int
+
+const (
+	CommandNone CommandKind = iota
+	CommandCreate
+	CommandList
+	CommandCancel
+)
+
+// Command 从一句话里识别出的提醒指令。
+// 取消时三选一：CancelAll、CancelIndex（列表序号，从 1 开始）、CancelKeyword。
+type Command struct {
+	Kind          CommandKind
+	Time          ParsedTime
+	Content       string
+	CancelAll     bool
+	CancelIndex   int
+	CancelKeyword string
+}
+
+var (
+	createTriggerPattern = regexp.MustCompile(`(?:记得)?(?:提醒(?:一下)?我|叫(?:一下)?我|喊我)`)
+	listCommandPattern   = regexp.MustCompile(`^(?:查看|看看|看下|看一下|列出|显示)?(?:我的|我有哪些|我有什么|有哪些|有什么|现在的|所有的?)?提醒(?:列表|事项)?(?:有哪些|有什么|呢|吗)?$`)
+	cancelAllPattern     = regexp.MustCompile(`^(?:(?:取消|删除|删掉|清空|关掉)(?:全部|所有)的?提醒了?|清空提醒)$`)
+	cancelIndexPattern   = regexp.MustCompile(`^(?:取消|删除|删掉|关掉)(?:第(` + numeral + `)个?提醒|提醒(` + numeral + `))了?$`)
+	cancelKeywordPattern = regexp.MustCompile(`^(?:(?:取消|删除|删掉|关掉)(.+?)(?:的|这个)?提醒了?|不用再?提醒我?(.+?)了)$`)
+)
+
+// contentPrefixes/contentSuffixes 提醒内容两端常见的口语成分。
+var (
+	contentPrefixes = []string{"到时候", "记得", "麻烦", "帮我", "一下", "请", "你", "要", "该"}
+	contentSuffixes = []string{"的时候", "一下", "哦", "喔", "噢", "哈", "啊", "呀", "吧", "呢", "了"}
+)
+
+// ParseCommand 识别创建、查看、取消提醒的聊天指令。
+func ParseCommand(message string, now time.Time, loc *time.Location) (Command, bool) {
+	compact := compactCommandText(message)
+	if compact == "" {
+		return Command{}, false
+	}
+
+	switch {
+	case listCommandPattern.MatchString(compact):
+		return Command{Kind: CommandList}, true
+	case cancelAllPattern.MatchString(compact):
+		return Command{Kind: CommandCancel, CancelAll: true}, true
+	case compact == "取消提醒" || compact == "删除提醒":
+		return Command{Kind: CommandCancel}, true
+	}
+	if m := cancelIndexPattern.FindStringSubmatch(compact); m != nil {
+		token := m[1]
+		if token == "" {
+			token = m[2]
+		}
+		if index, ok := parseNumber(token); ok && index > 0 {
+			return Command{Kind: CommandCancel, CancelIndex: index}, true
+		}
+	}
+	if m := cancelKeywordPattern.FindStringSubmatch(compact); m != nil {
+		keyword := m[1]
+		if keyword == "" {
+			keyword = m[2]
+		}
+		if keyword = trimContent(keyword); keyword != "" {
+			return Command{Kind: CommandCancel, CancelKeyword: keyword}, true
+		}
+	}
+
+	trigger := createTriggerPattern.FindStringIndex(message)
+	if trigger == nil {
+		return Command{}, false
+	}
+	parsed, ok := ParseTime(message, now, loc)
+	if !ok {
+		return Command{}, false
+	}
+	return Command{
+		Kind:    CommandCreate,
+		Time:    parsed,
+		Content: extractContent(message, trigger, parsed.Spans),
+	}, true
+}
+
+// extractContent 去掉时间表达和“提醒我”之后剩下的就是提醒内容。
+// 优先取“提醒我”后面的部分，后面为空时再看前面。
+func extractContent(message string, trigger []int, spans [][2]int) string {
+	removed := make([]bool, len(message))
+	for _, span := range spans {
+		for i := span[0]; i < span[1]; i++ {
+			removed[i] = true
+		}
+	}
+	keep := func(from, to int) string {
+		var builder strings.Builder
+		for i := from; i < to; i++ {
+			if !removed[i] {
+				builder.WriteByte(message[i])
+			}
+		}
+		return builder.String()
+	}
+
+	if after := trimContent(keep(trigger[1], len(message))); after != "" {
+		return after
+	}
+	return trimContent(keep(0, trigger[0]))
+}
+
+func trimContent(text string) string {
+	text = strings.TrimFunc(text, isContentBoundary)
+	for changed := true; changed; {
+		changed = false
+		for _, prefix := range contentPrefixes {
+			if strings.HasPrefix(text, prefix) {
+				text = strings.TrimFunc(strings.TrimPrefix(text, prefix), isContentBoundary)
+				changed = true
+			}
+		}
+		for _, suffix := range contentSuffixes {
+			if strings.HasSuffix(text, suffix) {
+				text = strings.TrimFunc(strings.TrimSuffix(text, suffix), isContentBoundary)
+				changed = true
+			}
+		}
+	}
+	return text
+}
+
+func isContentBoundary(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// compactCommandText 去掉空白与标点，方便整句匹配查看/取消指令。
+func compactCommandText(text string) string {
+	var builder strings.Builder
+	for _, r := range text {
+		if isContentBoundary(r) {
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
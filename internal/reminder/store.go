@@ -0,0 +1,342 @@
+package reminder
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/storage"
+	"project-yume/internal/utils"
+)
+
+const (
+	StatusActive    = "active"
+	StatusDone      = "done"
+	StatusCancelled = "cancelled"
+	StatusMissed    = "missed"
+)
+
+const SnapshotName = "reminders/reminders.json"
+const FlushTaskName = "reminders"
+
+const (
+	// MaxActivePerUser 单个用户同时存在的提醒上限。
+	MaxActivePerUser = 20
+	// finishedRetention 已完成/取消的提醒保留多久后清理。
+	finishedRetention = 7 * 24 * time.Hour
+)
+
+type Reminder struct {
+	ID            string    `json:"id"`
+	UserID        int64     `json:"user_id"`
+	SessionID     string    `json:"session_id"`
+	Content       string    `json:"content"`
+	DueAt         time.Time `json:"due_at"`
+	Repeat        Repeat    `json:"repeat,omitempty"`
+	Status        string    `json:"status"`
+	SourceMessage string    `json:"source_message,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastFiredAt   time.Time `json:"last_fired_at,omitempty"`
+	FireCount     int       `json:"fire_count,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Manager 保存所有用户的提醒。
+type Manager struct {
+	mu        sync.RWMutex
+	reminders map[int64][]*Reminder
+	store     storage.SnapshotStore
+	dirty     storage.DirtyMarker
+}
+
+var manager *Manager
+
+func init() {
+	manager = &Manager{
+		reminders: make(map[int64][]*Reminder),
+	}
+}
+
+func GetManager() *Manager {
+	return manager
+}
+
+// Add 新建提醒。DueAt 必须在未来，单个用户的活跃提醒数量有上限。
+func (m *Manager) Add(candidate Reminder) (Reminder, error) {
+	candidate.Content = strings.TrimSpace(candidate.Content)
+	if candidate.UserID == 0 {
+		return Reminder{}, fmt.Errorf("user id is required")
+	}
+	if candidate.Content == "" {
+		return Reminder{}, fmt.Errorf("content is required")
+	}
+	if _, ok := ParseRepeat(string(candidate.Repeat)); !ok {
+		return Reminder{}, fmt.Errorf("unsupported repeat %q", candidate.Repeat)
+	}
+	now := clock.Now()
+	if !candidate.DueAt.After(now) {
+		return Reminder{}, fmt.Errorf("due time %s is in the past", candidate.DueAt.Format(time.RFC3339))
+	}
+
+	m.mu.Lock()
+	m.pruneLocked(candidate.UserID, now)
+	active := 0
+	for _, existing := range m.reminders[candidate.UserID] {
+		if existing.Status == StatusActive {
+			active++
+		}
+	}
+	if active >= MaxActivePerUser {
+		m.mu.Unlock()
+		return Reminder{}, fmt.Errorf("too many active reminders (max %d)", MaxActivePerUser)
+	}
+
+	record := candidate
+	record.ID = utils.NewRequestID("rem")
+	record.Status = StatusActive
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	m.reminders[record.UserID] = append(m.reminders[record.UserID], &record)
+	m.mu.Unlock()
+
+	m.markDirty()
+	return record, nil
+}
+
+// List 返回用户的活跃提醒，按到期时间排序。
+func (m *Manager) List(userID int64) []Reminder {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]Reminder, 0, len(m.reminders[userID]))
+	for _, item := range m.reminders[userID] {
+		if item.Status == StatusActive {
+			result = append(result, *item)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].DueAt.Before(result[j].DueAt) })
+	return result
+}
+
+// Cancel 取消指定提醒。
+func (m *Manager) Cancel(userID int64, id string) (Reminder, bool) {
+	m.mu.Lock()
+	var cancelled Reminder
+	found := false
+	for _, item := range m.reminders[userID] {
+		if item.ID == id && item.Status == StatusActive {
+			item.Status = StatusCancelled
+			item.UpdatedAt = clock.Now()
+			cancelled = *item
+			found = true
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if found {
+		m.markDirty()
+	}
+	return cancelled, found
+}
+
+// CancelAll 取消用户的全部活跃提醒，返回取消的数量。
+func (m *Manager) CancelAll(userID int64) int {
+	m.mu.Lock()
+	count := 0
+	now := clock.Now()
+	for _, item := range m.reminders[userID] {
+		if item.Status == StatusActive {
+			item.Status = StatusCancelled
+			item.UpdatedAt = now
+			count++
+		}
+	}
+	m.mu.Unlock()
+
+	if count > 0 {
+		m.markDirty()
+	}
+	return count
+}
+
+// ListAll 返回用户的全部提醒（含已完成和已取消），按创建时间排序。
+func (m *Manager) ListAll(userID int64) []Reminder {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]Reminder, 0, len(m.reminders[userID]))
+	for _, item := range m.reminders[userID] {
+		result = append(result, *item)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// DeleteUser 彻底删除用户的全部提醒，返回删除的数量。
+func (m *Manager) DeleteUser(userID int64) int {
+	m.mu.Lock()
+	count := len(m.reminders[userID])
+	delete(m.reminders, userID)
+	m.mu.Unlock()
+
+	if count > 0 {
+		m.markDirty()
+	}
+	return count
+}
+
+// Due 返回已经到期的活跃提醒。
+func (m *Manager) Due(now time.Time) []Reminder {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []Reminder
+	for _, items := range m.reminders {
+		for _, item := range items {
+			if item.Status == StatusActive && !item.DueAt.After(now) {
+				result = append(result, *item)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].DueAt.Before(result[j].DueAt) })
+	return result
+}
+
+// MarkFired 记录一次提醒结果。delivered 为 false 表示错过了（例如停机太久）。
+// 重复提醒顺延到 now 之后的下一次，一次性提醒结束。
+func (m *Manager) MarkFired(userID int64, id string, now time.Time, delivered bool, loc *time.Location) {
+	m.mu.Lock()
+	changed := false
+	for _, item := range m.reminders[userID] {
+		if item.ID != id || item.Status != StatusActive {
+			continue
+		}
+		changed = true
+		item.UpdatedAt = now
+		if delivered {
+			item.LastFiredAt = now
+			item.FireCount++
+		}
+
+		if next, ok := Next(item.DueAt, item.Repeat, loc); ok {
+			for !next.After(now) {
+				next, _ = Next(next, item.Repeat, loc)
+			}
+			item.DueAt = next
+			break
+		}
+		if delivered {
+			item.Status = StatusDone
+		} else {
+			item.Status = StatusMissed
+		}
+		break
+	}
+	m.mu.Unlock()
+
+	if changed {
+		m.markDirty()
+	}
+}
+
+func (m *Manager) ConfigurePersistence(store storage.SnapshotStore, dirty storage.DirtyMarker) error {
+	m.mu.Lock()
+	m.store = store
+	m.dirty = dirty
+	m.mu.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	data, err := store.Load(SnapshotName)
+	if err != nil {
+		return fmt.Errorf("load reminders failed: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	loaded := make(map[int64][]*Reminder)
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("unmarshal reminders failed: %w", err)
+	}
+
+	m.mu.Lock()
+	m.reminders = loaded
+	for userID, items := range m.reminders {
+		filtered := items[:0]
+		for _, item := range items {
+			if item != nil {
+				filtered = append(filtered, item)
+			}
+		}
+		m.reminders[userID] = filtered
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Manager) Flush() error {
+	m.mu.RLock()
+	store := m.store
+	snapshot := m.snapshotLocked()
+	m.mu.RUnlock()
+
+	if store == nil {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal reminders failed: %w", err)
+	}
+	if err := store.Save(SnapshotName, data); err != nil {
+		return fmt.Errorf("save reminders failed: %w", err)
+	}
+	return nil
+}
+
+// pruneLocked 清理早已结束的提醒，避免列表无限增长。
+func (m *Manager) pruneLocked(userID int64, now time.Time) {
+	if m.reminders == nil {
+		m.reminders = make(map[int64][]*Reminder)
+	}
+	items := m.reminders[userID]
+	kept := items[:0]
+	for _, item := range items {
+		if item.Status != StatusActive && now.Sub(item.UpdatedAt) > finishedRetention {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	m.reminders[userID] = kept
+}
+
+func (m *Manager) snapshotLocked() map[int64][]*Reminder {
+	result := make(map[int64][]*Reminder, len(m.reminders))
+	for userID, items := range m.reminders {
+		copied := make([]*Reminder, 0, len(items))
+		for _, item := range items {
+			record := *item
+			copied = append(copied, &record)
+		}
+		result[userID] = copied
+	}
+	return result
+}
+
+func (m *Manager) markDirty() {
+	m.mu.RLock()
+	dirty := m.dirty
+	m.mu.RUnlock()
+
+	if dirty != nil {
+		dirty.MarkDirty(FlushTaskName)
+	}
+}
@@ -0,0 +1,545 @@
+package reminder
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Repeat 提醒的重复方式，空字符串表示只提醒一次。
+type Repeat string
+
+const (
+	RepeatNone     Repeat = ""
+	RepeatDaily    Repeat = "daily"
+	RepeatWeekdays Repeat = "weekdays"
+	RepeatWeekly   Repeat = "weekly"
+)
+
+var repeatNames = []string{string(RepeatDaily), string(RepeatWeekdays), string(RepeatWeekly)}
+
+// RepeatNames 返回支持的重复方式，不含表示不重复的空字符串。
+func RepeatNames() []string {
+	return append([]string(nil), repeatNames...)
+}
+
+// ParseRepeat 解析外部传入的重复方式，空字符串表示不重复；不支持的值返回 false。
+func ParseRepeat(raw string) (Repeat, bool) {
+	normalized := strings.ToLower(strings.TrimSpace(raw))
+	if normalized == "" {
+		return RepeatNone, true
+	}
+	for _, name := range repeatNames {
+		if name == normalized {
+			return Repeat(name), true
+		}
+	}
+	return RepeatNone, false
+}
+
+// ParsedTime 是从一句话里解析出的提醒时间。Spans 记录被识别为时间表达的片段，
+// 用于从原句中剥离出提醒内容。
+type ParsedTime struct {
+	At     time.Time
+	Repeat Repeat
+	Spans  [][2]int
+	// InvalidDate 说了一个不存在的日期（如“2月30号”），At 为空，调用方应请用户确认。
+	InvalidDate bool
+}
+
+const numeral = `[0-9零〇一二两三四五六七八九十]+`
+
+var (
+	repeatPattern   = regexp.MustCompile(`每(?:个)?(?:天|日)|每(?:个)?工作日|工作日|每(?:个)?(?:周|星期|礼拜)([一二三四五六日天1-7])|每晚|每早`)
+	durationPattern = regexp.MustCompile(`过?(` + numeral + `)?个?(半)?个?(秒钟?|分钟|分|小时|钟头|刻钟|天|周|星期)(?:之|以)?后`)
+	dayPattern      = regexp.MustCompile(`大后天|后天|明天|明日|明儿|明早|明晚|今天|今日|今儿|今早|今晚|今夜`)
+	weekdayPattern  = regexp.MustCompile(`(下下个?|下个?|这个?|本)?(?:周|星期|礼拜)([一二三四五六日天1-7])`)
+	datePattern     = regexp.MustCompile(`(?:(\d{4})年)?(` + numeral + `)月(` + numeral + `)[日号]|(` + numeral + `)[日号]`)
+	periodPattern   = regexp.MustCompile(`凌晨|早上|早晨|清晨|上午|中午|下午|傍晚|晚上|夜里|半夜`)
+	clockPattern    = regexp.MustCompile(`(\d{1,2})[:：](\d{2})|(` + numeral + `)[点點](?:钟)?(?:(半)|(一刻)|(三刻)|(` + numeral + `)分?)?`)
+)
+
+// periodDefaults 只说了时段没说几点时使用的默认钟点。
+var periodDefaults = map[string]int{
+	"凌晨": 6,
+	"早上": 8,
+	"早晨": 8,
+	"清晨": 7,
+	"上午": 9,
+	"中午": 12,
+	"下午": 15,
+	"傍晚": 18,
+	"晚上": 20,
+	"夜里": 22,
+	"半夜": 0,
+}
+
+const defaultReminderHour = 9
+
+// ParseTime 解析中文的相对/绝对时间表达，例如“明天早上八点”“下周三”“半小时后”
+// “今晚十点”“每天七点半”“3月5号”。now 决定“今天”是哪一天，结果落在 loc 时区。
+// 没有识别到任何时间表达时 ok 为 false；日期不存在时 ok 为 true 且 InvalidDate 为 true。
+func ParseTime(text string, now time.Time, loc *time.Location) (ParsedTime, bool) {
+	if loc == nil {
+		loc = time.Local
+	}
+	now = now.In(loc)
+	result := ParsedTime{}
+	matched := false
+
+	if m := durationPattern.FindStringSubmatchIndex(text); m != nil {
+		if d, ok := parseDuration(text, m); ok {
+			result.At = now.Add(d)
+			result.Spans = append(result.Spans, [2]int{m[0], m[1]})
+			return result, true
+		}
+	}
+
+	year, month, day := now.Date()
+	explicitDay := false
+	weekdayTarget := -1
+	weekdayPrefix := ""
+	period := ""
+
+	if m := repeatPattern.FindStringSubmatchIndex(text); m != nil {
+		matched = true
+		result.Spans = append(result.Spans, [2]int{m[0], m[1]})
+		token := text[m[0]:m[1]]
+		switch {
+		case strings.Contains(token, "工作日"):
+			result.Repeat = RepeatWeekdays
+		case m[2] >= 0:
+			result.Repeat = RepeatWeekly
+			weekdayTarget = parseWeekday(text[m[2]:m[3]])
+		default:
+			result.Repeat = RepeatDaily
+			switch token {
+			case "每晚":
+				period = "晚上"
+			case "每早":
+				period = "早上"
+			}
+		}
+	}
+
+	if m := dayPattern.FindStringIndex(text); m != nil && result.Repeat == RepeatNone {
+		matched = true
+		explicitDay = true
+		result.Spans = append(result.Spans, [2]int{m[0], m[1]})
+		token := text[m[0]:m[1]]
+		offset := 0
+		switch {
+		case strings.HasPrefix(token, "大后天"):
+			offset = 3
+		case strings.HasPrefix(token, "后天"):
+			offset = 2
+		case strings.HasPrefix(token, "明"):
+			offset = 1
+		}
+		switch token {
+		case "明早", "今早":
+			period = "早上"
+		case "明晚", "今晚", "今夜":
+			period = "晚上"
+		}
+		day += offset
+	}
+
+	if m := weekdayPattern.FindStringSubmatchIndex(text); m != nil && result.Repeat == RepeatNone && !explicitDay {
+		matched = true
+		result.Spans = append(result.Spans, [2]int{m[0], m[1]})
+		if m[2] >= 0 {
+			weekdayPrefix = text[m[2]:m[3]]
+		}
+		weekdayTarget = parseWeekday(text[m[4]:m[5]])
+	}
+
+	if m := datePattern.FindStringSubmatchIndex(text); m != nil && result.Repeat == RepeatNone && !explicitDay && weekdayTarget < 0 {
+		if m[4] >= 0 {
+			monthValue, okMonth := parseNumber(text[m[4]:m[5]])
+			dayValue, okDay := parseNumber(text[m[6]:m[7]])
+			if okMonth && okDay && monthValue >= 1 && monthValue <= 12 && dayValue >= 1 && dayValue <= 31 {
+				matched = true
+				explicitDay = true
+				result.Spans = append(result.Spans, [2]int{m[0], m[1]})
+				if m[2] >= 0 {
+					year, _ = strconv.Atoi(text[m[2]:m[3]])
+				} else if time.Date(year, time.Month(monthValue), dayValue, 23, 59, 0, 0, loc).Before(now) {
+					year++
+				}
+				month, day = time.Month(monthValue), dayValue
+			}
+		} else if dayValue, ok := parseNumber(text[m[8]:m[9]]); ok && dayValue >= 1 && dayValue <= 31 {
+			matched = true
+			explicitDay = true
+			result.Spans = append(result.Spans, [2]int{m[0], m[1]})
+			if dayValue < day {
+				month++
+			}
+			day = dayValue
+		}
+		// time.Date 会把“11月31号”顺延成 12 月 1 日，这类日期不猜，交给调用方追问
+		if explicitDay && time.Date(year, month, day, 0, 0, 0, 0, loc).Day() != day {
+			result.InvalidDate = true
+			result.At = time.Time{}
+			sort.Slice(result.Spans, func(i, j int) bool { return result.Spans[i][0] < result.Spans[j][0] })
+			return result, true
+		}
+	}
+
+	if m := periodPattern.FindStringIndex(text); m != nil {
+		matched = true
+		result.Spans = append(result.Spans, [2]int{m[0], m[1]})
+		period = text[m[0]:m[1]]
+	}
+
+	hour, minute := -1, 0
+	spokenClock := false
+	hasTimeMarker := matched
+	// 已识别的日期片段换成空格再找钟点，否则“周五两点”会被当成“五两点”
+	clockText := maskSpans(text, result.Spans)
+	for _, m := range clockPattern.FindAllStringSubmatchIndex(clockText, -1) {
+		if isQuantityPhrase(clockText, m, hasTimeMarker) {
+			continue
+		}
+		if h, mm, ok := parseClock(clockText, m); ok {
+			matched = true
+			result.Spans = append(result.Spans, [2]int{m[0], m[1]})
+			hour, minute = h, mm
+			spokenClock = m[2] < 0
+			break
+		}
+	}
+
+	if !matched {
+		return ParsedTime{}, false
+	}
+
+	if hour < 0 {
+		if value, ok := periodDefaults[period]; ok {
+			hour = value
+		} else {
+			hour = defaultReminderHour
+		}
+	} else {
+		hour = adjustHourForPeriod(hour, period)
+		if period == "" && spokenClock && hour >= 1 && hour <= 6 && result.Repeat == RepeatNone {
+			// 没说上午凌晨的“一点”到“六点”多半指下午，不管有没有说哪天（“明天三点开会”是 15:00）
+			hour += 12
+		}
+	}
+
+	at := time.Date(year, month, day, 0, 0, 0, 0, loc).Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	if period == "" && hour >= 1 && hour < 12 && !at.After(now) && at.Add(12*time.Hour).After(now) && !explicitDay && weekdayTarget < 0 && result.Repeat == RepeatNone {
+		// 没说上午下午、钟点已过但 12 小时后还没到，按下午理解（14:00 说“八点半”指 20:30）。
+		// 重复提醒不这样推测，“每天七点半”下午说也是早上七点半，首次顺延到明天
+		at = at.Add(12 * time.Hour)
+	}
+
+	switch {
+	case weekdayTarget >= 0:
+		at = alignWeekday(at, now, weekdayTarget, weekdayPrefix)
+	case result.Repeat == RepeatWeekdays:
+		for !at.After(now) || isWeekend(at) {
+			at = at.AddDate(0, 0, 1)
+		}
+	case !explicitDay && !at.After(now):
+		// 只说了钟点且已经过去，理解为明天的这个时间
+		at = at.AddDate(0, 0, 1)
+	}
+
+	result.At = at
+	sort.Slice(result.Spans, func(i, j int) bool { return result.Spans[i][0] < result.Spans[j][0] })
+	return result, true
+}
+
+// Next 返回重复提醒的下一次时间，按 loc 的墙上时间推进，跨夏令时也保持钟点不变。
+func Next(at time.Time, repeat Repeat, loc *time.Location) (time.Time, bool) {
+	if loc == nil {
+		loc = time.Local
+	}
+	at = at.In(loc)
+	switch repeat {
+	case RepeatDaily:
+		return at.AddDate(0, 0, 1), true
+	case RepeatWeekly:
+		return at.AddDate(0, 0, 7), true
+	case RepeatWeekdays:
+		next := at.AddDate(0, 0, 1)
+		for isWeekend(next) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next, true
+	}
+	return time.Time{}, false
+}
+
+func parseDuration(text string, m []int) (time.Duration, bool) {
+	count := 0.0
+	if m[2] >= 0 {
+		value, ok := parseNumber(text[m[2]:m[3]])
+		if !ok {
+			return 0, false
+		}
+		count = float64(value)
+	}
+	if m[4] >= 0 {
+		count += 0.5
+	}
+	unit := text[m[6]:m[7]]
+	if count == 0 {
+		if unit != "刻钟" {
+			return 0, false
+		}
+		count = 1
+	}
+
+	var base time.Duration
+	switch unit {
+	case "秒", "秒钟":
+		base = time.Second
+	case "分钟", "分":
+		base = time.Minute
+	case "小时", "钟头":
+		base = time.Hour
+	case "刻钟":
+		base = 15 * time.Minute
+	case "天":
+		base = 24 * time.Hour
+	case "周", "星期":
+		base = 7 * 24 * time.Hour
+	default:
+		return 0, false
+	}
+	return time.Duration(count * float64(base)), true
+}
+
+func parseClock(text string, m []int) (int, int, bool) {
+	if m[2] >= 0 {
+		hour, _ := strconv.Atoi(text[m[2]:m[3]])
+		minute, _ := strconv.Atoi(text[m[4]:m[5]])
+		return hour, minute, hour <= 24 && minute < 60
+	}
+	hour, ok := parseNumber(text[m[6]:m[7]])
+	if !ok || hour > 24 {
+		return 0, 0, false
+	}
+	minute := 0
+	switch {
+	case m[8] >= 0:
+		minute = 30
+	case m[10] >= 0:
+		minute = 15
+	case m[12] >= 0:
+		minute = 45
+	case m[14] >= 0:
+		value, ok := parseNumber(text[m[14]:m[15]])
+		if !ok || value >= 60 {
+			return 0, 0, false
+		}
+		minute = value
+	}
+	return hour, minute, true
+}
+
+func adjustHourForPeriod(hour int, period string) int {
+	switch period {
+	case "下午", "傍晚":
+		if hour < 12 {
+			return hour + 12
+		}
+	case "晚上", "夜里", "半夜":
+		if hour == 12 {
+			return 24
+		}
+		if hour < 12 && (period != "半夜" || hour >= 6) {
+			return hour + 12
+		}
+	case "中午":
+		if hour < 6 {
+			return hour + 12
+		}
+	case "凌晨":
+		if hour == 12 {
+			return 0
+		}
+	}
+	return hour
+}
+
+// alignWeekday 把日期对齐到目标星期。“下周X”指下一个自然周（周一为一周开始）里的那天；
+// 不带前缀且这周的那天已经过去时顺延一周。
+func alignWeekday(at, now time.Time, target int, prefix string) time.Time {
+	current := mondayIndex(at.Weekday())
+	at = at.AddDate(0, 0, target-current)
+	switch {
+	case strings.HasPrefix(prefix, "下下"):
+		return at.AddDate(0, 0, 14)
+	case strings.HasPrefix(prefix, "下"):
+		return at.AddDate(0, 0, 7)
+	}
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 7)
+	}
+	return at
+}
+
+// clockQuantityNouns 跟在“N点”后面时说明是在数条目，例如“三点想法”“两点建议”。
+var clockQuantityNouns = []string{
+	"想法", "意见", "要求", "建议", "看法", "理由", "原因", "问题", "内容", "东西", "事",
+	"心得", "感想", "体会", "好处", "坏处", "优点", "缺点", "区别", "注意", "原则", "补充", "疑问",
+}
+
+var reminderVerbPattern = regexp.MustCompile(`提醒|叫我|喊我|叫醒|闹钟`)
+
+// isQuantityPhrase 排除不是钟点的“N点”：“买一点水果”“多喝一点水”里的“一点”，
+// 后面跟着名词的“三点想法”，以及既没有其他时间词、也没有“提醒我”之类说法的孤立“N点”（“说两点”）。
+// 带分钟或“钟”的写法（三点半、三点钟、15:30）总是钟点。
+func isQuantityPhrase(text string, m []int, hasTimeMarker bool) bool {
+	token := text[m[0]:m[1]]
+	if token == "一点" && m[0] > 0 {
+		prev, _ := utf8.DecodeLastRuneInString(text[:m[0]])
+		if !strings.ContainsRune("天午上晚里晨号日早 ，,。", prev) {
+			return true
+		}
+	}
+	if m[6] < 0 || m[8] >= 0 || m[10] >= 0 || m[12] >= 0 || m[14] >= 0 || strings.HasSuffix(token, "钟") {
+		return false
+	}
+	rest := text[m[1]:]
+	for _, noun := range clockQuantityNouns {
+		if strings.HasPrefix(rest, noun) {
+			return true
+		}
+	}
+	return !hasTimeMarker && !reminderVerbPattern.MatchString(text) && strings.TrimSpace(text) != token
+}
+
+// maskSpans 把 spans 覆盖的字节换成空格，长度不变，下标仍对应原句。
+func maskSpans(text string, spans [][2]int) string {
+	masked := []byte(text)
+	for _, span := range spans {
+		for i := span[0]; i < span[1]; i++ {
+			masked[i] = ' '
+		}
+	}
+	return string(masked)
+}
+
+// mondayIndex 周一为 0，周日为 6。
+func mondayIndex(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+func isWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
+func parseWeekday(token string) int {
+	switch token {
+	case "一", "1":
+		return 0
+	case "二", "2":
+		return 1
+	case "三", "3":
+		return 2
+	case "四", "4":
+		return 3
+	case "五", "5":
+		return 4
+	case "六", "6":
+		return 5
+	default:
+		return 6
+	}
+}
+
+var chineseDigits = map[rune]int{
+	'零': 0, '〇': 0, '一': 1, '二': 2, '两': 2, '三': 3, '四': 4,
+	'五': 5, '六': 6, '七': 7, '八': 8, '九': 9,
+}
+
+// parseNumber 解析阿拉伯数字或 0~99 的中文数字（十五、二十三、两、零五）。
+func parseNumber(token string) (int, bool) {
+	if token == "" {
+		return 0, false
+	}
+	if value, err := strconv.Atoi(token); err == nil {
+		return value, true
+	}
+
+	if idx := strings.Index(token, "十"); idx >= 0 {
+		tens, ones := 1, 0
+		if left := token[:idx]; left != "" {
+			value, ok := parseDigits(left)
+			if !ok || value > 9 {
+				return 0, false
+			}
+			tens = value
+		}
+		if right := token[idx+len("十"):]; right != "" {
+			value, ok := parseDigits(right)
+			if !ok || value > 9 {
+				return 0, false
+			}
+			ones = value
+		}
+		return tens*10 + ones, true
+	}
+	return parseDigits(token)
+}
+
+func parseDigits(token string) (int, bool) {
+	value := 0
+	for _, r := range token {
+		digit, ok := chineseDigits[r]
+		if !ok {
+			if r < '0' || r > '9' {
+				return 0, false
+			}
+			digit = int(r - '0')
+		}
+		value = value*10 + digit
+	}
+	return value, true
+}
+
+var weekdayNames = []string{"周一", "周二", "周三", "周四", "周五", "周六", "周日"}
+
+// DescribeTime 把提醒时间说成口语，例如“今天 22:00”“明天 08:00”“每周三 21:00”。
+func DescribeTime(at time.Time, repeat Repeat, now time.Time, loc *time.Location) string {
+	if loc == nil {
+		loc = time.Local
+	}
+	at = at.In(loc)
+	now = now.In(loc)
+	clock := at.Format("15:04")
+
+	switch repeat {
+	case RepeatDaily:
+		return "每天 " + clock
+	case RepeatWeekdays:
+		return "工作日 " + clock
+	case RepeatWeekly:
+		return "每" + weekdayNames[mondayIndex(at.Weekday())] + " " + clock
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	days := int(math.Round(time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, loc).Sub(today).Hours() / 24))
+	switch days {
+	case 0:
+		return "今天 " + clock
+	case 1:
+		return "明天 " + clock
+	case 2:
+		return "后天 " + clock
+	}
+	if at.Year() != now.Year() {
+		return at.Format("2006年1月2日") + " " + clock
+	}
+	return at.Format("1月2日") + "（" + weekdayNames[mondayIndex(at.Weekday())] + "）" + clock
+}
@@ -0,0 +1,143 @@
+package reminder
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	return loc
+}
+
+func TestParseTime(t *testing.T) {
+	loc := mustLocation(t)
+	// 2026-10-14 是周三
+	now := time.Date(2026, 10, 14, 14, 0, 0, 0, loc)
+
+	cases := []struct {
+		text   string
+		want   string
+		repeat Repeat
+	}{
+		{"明天早上八点提醒我交作业", "2026-10-15 08:00", RepeatNone},
+		{"下周三提醒我交房租", "2026-10-21 09:00", RepeatNone},
+		{"周五提醒我", "2026-10-16 09:00", RepeatNone},
+		{"周一提醒我", "2026-10-19 09:00", RepeatNone},
+		{"半小时后提醒我去拿快递", "2026-10-14 14:30", RepeatNone},
+		{"一个半小时后叫我", "2026-10-14 15:30", RepeatNone},
+		{"十分钟后提醒我关火", "2026-10-14 14:10", RepeatNone},
+		{"今晚十点提醒我吃药", "2026-10-14 22:00", RepeatNone},
+		{"八点半叫我", "2026-10-14 20:30", RepeatNone},
+		{"晚上12点提醒我", "2026-10-15 00:00", RepeatNone},
+		{"后天下午3:15提醒我", "2026-10-16 15:15", RepeatNone},
+		{"3月5号提醒我", "2027-03-05 09:00", RepeatNone},
+		{"20号下午三点提醒我开会", "2026-10-20 15:00", RepeatNone},
+		{"每天早上七点提醒我喝水", "2026-10-15 07:00", RepeatDaily},
+		{"每周三晚上九点提醒我倒垃圾", "2026-10-14 21:00", RepeatWeekly},
+		{"工作日早上八点提醒我打卡", "2026-10-15 08:00", RepeatWeekdays},
+		{"每天七点半提醒我吃药", "2026-10-15 07:30", RepeatDaily},
+		{"三点", "2026-10-14 15:00", RepeatNone},
+		{"我有3点想法，明天十点提醒我整理", "2026-10-15 10:00", RepeatNone},
+		{"明天三点提醒我开会", "2026-10-15 15:00", RepeatNone},
+		{"周五两点提醒我", "2026-10-16 14:00", RepeatNone},
+		{"一点半提醒我吃饭", "2026-10-15 13:30", RepeatNone},
+		{"明天凌晨三点叫我", "2026-10-15 03:00", RepeatNone},
+		{"明天早上六点叫我起床", "2026-10-15 06:00", RepeatNone},
+		{"明天6:30提醒我", "2026-10-15 06:30", RepeatNone},
+		{"31号提醒我交房租", "2026-10-31 09:00", RepeatNone},
+	}
+	for _, tc := range cases {
+		parsed, ok := ParseTime(tc.text, now, loc)
+		if !ok {
+			t.Fatalf("%s: expected a time", tc.text)
+		}
+		if got := parsed.At.Format("2006-01-02 15:04"); got != tc.want || parsed.Repeat != tc.repeat {
+			t.Fatalf("%s: got %s repeat=%q, want %s repeat=%q", tc.text, got, parsed.Repeat, tc.want, tc.repeat)
+		}
+	}
+
+	for _, text := range []string{"提醒我买一点水果", "你好呀", "我有3点想法", "说两点", "提醒我说三点建议"} {
+		if parsed, ok := ParseTime(text, now, loc); ok {
+			t.Fatalf("%s: expected no time, got %s", text, parsed.At)
+		}
+	}
+}
+
+func TestParseTimeRejectsInvalidDates(t *testing.T) {
+	loc := mustLocation(t)
+	cases := []struct {
+		text    string
+		now     time.Time
+		want    string
+		invalid bool
+	}{
+		{text: "11月31号提醒我", now: time.Date(2026, 10, 14, 14, 0, 0, 0, loc), invalid: true},
+		{text: "2月30号提醒我", now: time.Date(2026, 10, 14, 14, 0, 0, 0, loc), invalid: true},
+		{text: "2月29号提醒我", now: time.Date(2026, 10, 14, 14, 0, 0, 0, loc), invalid: true},
+		{text: "2028年2月29号提醒我", now: time.Date(2026, 10, 14, 14, 0, 0, 0, loc), want: "2028-02-29 09:00"},
+		// 1 月 31 日说“30号”指下个月，2 月没有 30 号
+		{text: "30号提醒我交房租", now: time.Date(2027, 1, 31, 10, 0, 0, 0, loc), invalid: true},
+		{text: "28号提醒我交房租", now: time.Date(2027, 1, 31, 10, 0, 0, 0, loc), want: "2027-02-28 09:00"},
+		{text: "5号提醒我交房租", now: time.Date(2026, 12, 20, 10, 0, 0, 0, loc), want: "2027-01-05 09:00"},
+	}
+	for _, tc := range cases {
+		parsed, ok := ParseTime(tc.text, tc.now, loc)
+		if !ok {
+			t.Fatalf("%s: expected a time expression", tc.text)
+		}
+		if parsed.InvalidDate != tc.invalid {
+			t.Fatalf("%s: invalid=%v, want %v (at %s)", tc.text, parsed.InvalidDate, tc.invalid, parsed.At)
+		}
+		if !tc.invalid {
+			if got := parsed.At.Format("2006-01-02 15:04"); got != tc.want {
+				t.Fatalf("%s: got %s, want %s", tc.text, got, tc.want)
+			}
+		} else if !parsed.At.IsZero() {
+			t.Fatalf("%s: invalid date should not carry a time, got %s", tc.text, parsed.At)
+		}
+	}
+}
+
+func TestNextSkipsWeekendForWeekdays(t *testing.T) {
+	loc := mustLocation(t)
+	friday := time.Date(2026, 10, 16, 8, 0, 0, 0, loc)
+	next, ok := Next(friday, RepeatWeekdays, loc)
+	if !ok || next.Format("2006-01-02 15:04") != "2026-10-19 08:00" {
+		t.Fatalf("unexpected next weekday: %s", next)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	loc := mustLocation(t)
+	now := time.Date(2026, 10, 14, 14, 0, 0, 0, loc)
+
+	create, ok := ParseCommand("明天早上八点提醒我交作业！", now, loc)
+	if !ok || create.Kind != CommandCreate || create.Content != "交作业" {
+		t.Fatalf("unexpected create command: %+v", create)
+	}
+	before, ok := ParseCommand("半小时后去拿快递，记得提醒我哦", now, loc)
+	if !ok || before.Content != "去拿快递" {
+		t.Fatalf("unexpected content before trigger: %+v", before)
+	}
+
+	if cmd, _ := ParseCommand("我的提醒", now, loc); cmd.Kind != CommandList {
+		t.Fatalf("expected list command, got %+v", cmd)
+	}
+	if cmd, _ := ParseCommand("取消第二个提醒", now, loc); cmd.Kind != CommandCancel || cmd.CancelIndex != 2 {
+		t.Fatalf("expected cancel by index, got %+v", cmd)
+	}
+	if cmd, _ := ParseCommand("取消交作业的提醒", now, loc); cmd.Kind != CommandCancel || cmd.CancelKeyword != "交作业" {
+		t.Fatalf("expected cancel by keyword, got %+v", cmd)
+	}
+	if cmd, _ := ParseCommand("取消所有提醒", now, loc); !cmd.CancelAll {
+		t.Fatalf("expected cancel all, got %+v", cmd)
+	}
+	if _, ok := ParseCommand("你提醒了我一件事", now, loc); ok {
+		t.Fatalf("plain chat should not be a command")
+	}
+}
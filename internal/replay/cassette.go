@@ -0,0 +1,311 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"project-yume/internal/config"
+	"project-yume/internal/memory"
+	"project-yume/internal/reminder"
+	"project-yume/internal/state"
+	"project-yume/internal/storage"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 录像文件每行一条 JSON，按写入顺序排列。
+const (
+	KindHeader   = "header"
+	KindInbound  = "inbound"
+	KindOutbound = "outbound"
+	KindAPI      = "api_response"
+	KindAI       = "ai"
+	KindFinal    = "final"
+)
+
+const maxCassetteLine = 16 << 20
+
+// SnapshotNames 回放前后比对的持久化快照。用量统计与真实时间强相关，不参与比对。
+var SnapshotNames = []string{
+	state.SnapshotName,
+	memory.SnapshotName,
+	memory.ProfileSnapshotName,
+	memory.FactSnapshotName,
+	reminder.SnapshotName,
+}
+
+// Entry 录像中的一行。AtMs 为距录制开始的毫秒数。
+type Entry struct {
+	Kind string `json:"kind"`
+	AtMs int64  `json:"at_ms"`
+
+	// header
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Settings  *Settings  `json:"settings,omitempty"`
+
+	// header / final
+	Snapshots map[string]json.RawMessage `json:"snapshots,omitempty"`
+
+	// inbound / outbound / api_response
+	Frame json.RawMessage `json:"frame,omitempty"`
+	Echo  string          `json:"echo,omitempty"`
+
+	// ai
+	AI *AIExchange `json:"ai,omitempty"`
+}
+
+// AIExchange 一次模型调用。流式调用记录收到的全部分片，Error 为空表示正常结束。
+type AIExchange struct {
+	Profile  string                                `json:"profile"`
+	Key      string                                `json:"key"`
+	Stream   bool                                  `json:"stream"`
+	Request  openai.ChatCompletionRequest          `json:"request"`
+	Response *openai.ChatCompletionResponse        `json:"response,omitempty"`
+	Chunks   []openai.ChatCompletionStreamResponse `json:"chunks,omitempty"`
+	Error    *AIError                              `json:"error,omitempty"`
+}
+
+// AIError 模型调用的错误。Status 非 0 时回放还原为 *openai.APIError，重试与换配置的判断保持一致。
+type AIError struct {
+	Status   int    `json:"status,omitempty"`
+	Message  string `json:"message"`
+	Canceled bool   `json:"canceled,omitempty"`
+}
+
+// Settings 影响消息处理行为的配置。录制时写入录像，回放时覆盖本地配置；连接地址与密钥不记录。
+type Settings struct {
+	TargetID               int64    `json:"target_id"`
+	Character              string   `json:"character"`
+	EnableOnlyLongChat     bool     `json:"enable_only_long_chat"`
+	EnableEmotionalMemory  bool     `json:"enable_emotional_memory"`
+	EnableLLMMemoryExtract bool     `json:"enable_llm_memory_extract,omitempty"`
+	MemoryExtractBatchSize int      `json:"memory_extract_batch_size,omitempty"`
+	MemoryExtractWaitSec   int      `json:"memory_extract_wait_sec,omitempty"`
+	EnableReminders        bool     `json:"enable_reminders"`
+	EnableInterruptMerge   bool     `json:"enable_interrupt_merge"`
+	InterruptGraceWindowMs int      `json:"interrupt_grace_window_ms"`
+	AggregateIdleWindowMs  int      `json:"aggregate_idle_window_ms"`
+	AggregateMaxWindowMs   int      `json:"aggregate_max_window_ms"`
+	AggregateMaxMessages   int      `json:"aggregate_max_messages"`
+	EnableAIStream         bool     `json:"enable_ai_stream"`
+	EnableAITools          bool     `json:"enable_ai_tools"`
+	EnableAIJSONSchema     bool     `json:"enable_ai_json_schema"`
+	DisabledHandlers       []string `json:"disabled_handlers,omitempty"`
+	HandlerPriorities      string   `json:"handler_priorities,omitempty"`
+	HandlerRoutes          string   `json:"handler_routes,omitempty"`
+	EnableTimeContext      bool     `json:"enable_time_context"`
+	TimeContextTimezone    string   `json:"time_context_timezone"`
+	TimeContextFormat      string   `json:"time_context_format"`
+	EnableVisionInput      bool     `json:"enable_vision_input"`
+	EnableImageOCRFallback bool     `json:"enable_image_ocr_fallback"`
+	EnableImageAssetReply  bool     `json:"enable_image_asset_reply"`
+}
+
+func captureSettings(cfg *config.Config) Settings {
+	return Settings{
+		TargetID:               cfg.TargetId,
+		Character:              cfg.Character,
+		EnableOnlyLongChat:     cfg.EnableOnlyLongChat,
+		EnableEmotionalMemory:  cfg.EnableEmotionalMemory,
+		EnableLLMMemoryExtract: cfg.EnableLLMMemoryExtract,
+		MemoryExtractBatchSize: cfg.MemoryExtractBatchSize,
+		MemoryExtractWaitSec:   cfg.MemoryExtractBatchWaitSec,
+		EnableReminders:        cfg.EnableReminders,
+		EnableInterruptMerge:   cfg.EnableInterruptMerge,
+		InterruptGraceWindowMs: cfg.InterruptGraceWindowMs,
+		AggregateIdleWindowMs:  cfg.MessageAggregateIdleWindowMs,
+		AggregateMaxWindowMs:   cfg.MessageAggregateMaxWindowMs,
+		AggregateMaxMessages:   cfg.MessageAggregateMaxMessages,
+		EnableAIStream:         cfg.EnableAIStream,
+		EnableAITools:          cfg.EnableAITools,
+		EnableAIJSONSchema:     cfg.EnableAIJSONSchema,
+		DisabledHandlers:       append([]string(nil), cfg.DisabledHandlers...),
+		HandlerPriorities:      cfg.HandlerPriorities,
+		HandlerRoutes:          cfg.HandlerRoutes,
+		EnableTimeContext:      cfg.EnableTimeContext,
+		TimeContextTimezone:    cfg.TimeContextTimezone,
+		TimeContextFormat:      cfg.TimeContextFormat,
+		EnableVisionInput:      cfg.EnableVisionInput,
+		EnableImageOCRFallback: cfg.EnableImageOCRFallback,
+		EnableImageAssetReply:  cfg.EnableImageAssetReply,
+	}
+}
+
+// apply 把录制时的配置写回当前配置，角色不同时重新加载角色。
+func (s Settings) apply(cfg *config.Config) error {
+	if s.Character != "" && s.Character != cfg.Character {
+		if err := os.Setenv("CHARACTER", s.Character); err != nil {
+			return err
+		}
+		if err := config.ReloadRuntimeConfig(); err != nil {
+			return fmt.Errorf("reload character %q failed: %w", s.Character, err)
+		}
+	}
+	cfg.TargetId = s.TargetID
+	cfg.EnableOnlyLongChat = s.EnableOnlyLongChat
+	cfg.EnableEmotionalMemory = s.EnableEmotionalMemory
+	cfg.EnableLLMMemoryExtract = s.EnableLLMMemoryExtract
+	if s.EnableLLMMemoryExtract {
+		cfg.MemoryExtractBatchSize = s.MemoryExtractBatchSize
+		cfg.MemoryExtractBatchWaitSec = s.MemoryExtractWaitSec
+	}
+	// 情景片段由分钟级的后台任务生成，回放不运行它，提示词里也不带
+	cfg.EnableEpisodicMemory = false
+	// 衰减按墙上时间计算，回放时关闭，否则事实置信度每次都不同
+	cfg.EnableFactDecay = false
+	// 好感度按天累计，会改变提示词和预设，回放时关闭
+	cfg.EnableAffinity = false
+	// 回放不通知管理员；模型复核会多出录制里没有的调用，只按词表判断
+	cfg.CrisisAlertQQ = 0
+	cfg.CrisisAlertWebhook = ""
+	cfg.EnableCrisisModelCheck = false
+	cfg.EnableReminders = s.EnableReminders
+	cfg.EnableInterruptMerge = s.EnableInterruptMerge
+	cfg.InterruptGraceWindowMs = s.InterruptGraceWindowMs
+	cfg.MessageAggregateIdleWindowMs = s.AggregateIdleWindowMs
+	cfg.MessageAggregateMaxWindowMs = s.AggregateMaxWindowMs
+	cfg.MessageAggregateMaxMessages = s.AggregateMaxMessages
+	cfg.EnableAIStream = s.EnableAIStream
+	cfg.EnableAITools = s.EnableAITools
+	cfg.EnableAIJSONSchema = s.EnableAIJSONSchema
+	cfg.DisabledHandlers = append([]string(nil), s.DisabledHandlers...)
+	cfg.HandlerPriorities = s.HandlerPriorities
+	cfg.HandlerRoutes = s.HandlerRoutes
+	cfg.EnableTimeContext = s.EnableTimeContext
+	cfg.TimeContextTimezone = s.TimeContextTimezone
+	cfg.TimeContextFormat = s.TimeContextFormat
+	cfg.EnableVisionInput = s.EnableVisionInput
+	cfg.EnableImageOCRFallback = s.EnableImageOCRFallback
+	cfg.EnableImageAssetReply = s.EnableImageAssetReply
+	return nil
+}
+
+// readSnapshots 读取全部比对快照，不存在的跳过。
+func readSnapshots(store storage.SnapshotStore) (map[string]json.RawMessage, error) {
+	snapshots := make(map[string]json.RawMessage, len(SnapshotNames))
+	for _, name := range SnapshotNames {
+		data, err := store.Load(name)
+		if err != nil {
+			return nil, fmt.Errorf("load snapshot %s failed: %w", name, err)
+		}
+		if len(data) == 0 || !json.Valid(data) {
+			continue
+		}
+		snapshots[name] = json.RawMessage(data)
+	}
+	return snapshots, nil
+}
+
+// Cassette 解析后的录像。
+type Cassette struct {
+	Header   Entry
+	Inbound  []Entry
+	Outbound []Entry
+	API      []Entry
+	AI       []AIExchange
+	Final    *Entry
+}
+
+// Load 读取录像文件。录制进程异常退出时没有 final 行，此时只比对发出的消息。
+func Load(path string) (*Cassette, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	cassette := &Cassette{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), maxCassetteLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		switch entry.Kind {
+		case KindHeader:
+			cassette.Header = entry
+		case KindInbound:
+			cassette.Inbound = append(cassette.Inbound, entry)
+		case KindOutbound:
+			cassette.Outbound = append(cassette.Outbound, entry)
+		case KindAPI:
+			cassette.API = append(cassette.API, entry)
+		case KindAI:
+			if entry.AI != nil {
+				cassette.AI = append(cassette.AI, *entry.AI)
+			}
+		case KindFinal:
+			final := entry
+			cassette.Final = &final
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if cassette.Header.StartedAt == nil || cassette.Header.Settings == nil {
+		return nil, fmt.Errorf("%s: missing header", path)
+	}
+	return cassette, nil
+}
+
+// writer 串行追加录像行。
+type writer struct {
+	mu      sync.Mutex
+	file    *os.File
+	started time.Time
+	closed  bool
+}
+
+func newWriter(path string, started time.Time) (*writer, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{file: file, started: started}, nil
+}
+
+func (w *writer) write(entry Entry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	if entry.Kind != KindHeader {
+		entry.AtMs = time.Since(w.started).Milliseconds()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.file.Write(data)
+	return err
+}
+
+func (w *writer) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.file.Close()
+}
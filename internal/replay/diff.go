@@ -0,0 +1,184 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// generatedIDPattern 匹配 utils.NewRequestID 一类带时间戳的编号，回放时必然不同。
+var generatedIDPattern = regexp.MustCompile(`^[a-z_]+-\d{13,}-\d+$`)
+
+// normalizeJSON 解析 JSON 并把时间和生成的编号换成占位符。
+func normalizeJSON(data []byte) (any, error) {
+	var value any
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return normalizeValue(value), nil
+}
+
+func normalizeValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = normalizeValue(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = normalizeValue(item)
+		}
+		return v
+	case string:
+		if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return "<time>"
+		}
+		if generatedIDPattern.MatchString(v) {
+			return "<id>"
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// diffValues 逐字段比对，返回形如 "path: recorded -> replayed" 的差异。
+func diffValues(path string, recorded, replayed any, out *[]string) {
+	switch r := recorded.(type) {
+	case map[string]any:
+		p, ok := replayed.(map[string]any)
+		if !ok {
+			*out = append(*out, fmt.Sprintf("%s: %s -> %s", path, compact(recorded), compact(replayed)))
+			return
+		}
+		keys := make(map[string]struct{}, len(r)+len(p))
+		for key := range r {
+			keys[key] = struct{}{}
+		}
+		for key := range p {
+			keys[key] = struct{}{}
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			diffValues(path+"."+key, r[key], p[key], out)
+		}
+	case []any:
+		p, ok := replayed.([]any)
+		if !ok || len(p) != len(r) {
+			*out = append(*out, fmt.Sprintf("%s: %s -> %s", path, compact(recorded), compact(replayed)))
+			return
+		}
+		for i := range r {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), r[i], p[i], out)
+		}
+	default:
+		if compact(recorded) != compact(replayed) {
+			*out = append(*out, fmt.Sprintf("%s: %s -> %s", path, compact(recorded), compact(replayed)))
+		}
+	}
+}
+
+func compact(value any) string {
+	if value == nil {
+		return "<none>"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	const limit = 200
+	if len(data) > limit {
+		return string(data[:limit]) + "..."
+	}
+	return string(data)
+}
+
+// diffSnapshot 比对一个快照，两边都不存在时视为相同。
+func diffSnapshot(name string, recorded, replayed []byte) ([]string, error) {
+	left, err := normalizeJSON(recorded)
+	if err != nil {
+		return nil, fmt.Errorf("parse recorded %s: %w", name, err)
+	}
+	right, err := normalizeJSON(replayed)
+	if err != nil {
+		return nil, fmt.Errorf("parse replayed %s: %w", name, err)
+	}
+	var diffs []string
+	diffValues(name, left, right, &diffs)
+	return diffs, nil
+}
+
+// outboundLine 把发出的帧归一为去掉 echo 的 action 与参数。
+func outboundLine(frame []byte) string {
+	var message struct {
+		Action string          `json:"action"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(frame, &message); err != nil {
+		return string(frame)
+	}
+	params, err := normalizeJSON(message.Params)
+	if err != nil {
+		return message.Action + " " + string(message.Params)
+	}
+	data, _ := json.Marshal(params)
+	return message.Action + " " + string(data)
+}
+
+// diffLines 最长公共子序列比对，返回 "- " 开头的缺失行与 "+ " 开头的多出行。
+func diffLines(recorded, replayed []string) []string {
+	n, m := len(recorded), len(replayed)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if recorded[i] == replayed[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diffs []string
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case recorded[i] == replayed[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diffs = append(diffs, "- "+recorded[i])
+			i++
+		default:
+			diffs = append(diffs, "+ "+replayed[j])
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		diffs = append(diffs, "- "+recorded[i])
+	}
+	for ; j < m; j++ {
+		diffs = append(diffs, "+ "+replayed[j])
+	}
+	return diffs
+}
+
+func indent(lines []string) string {
+	return "  " + strings.Join(lines, "\n  ")
+}
@@ -0,0 +1,491 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"project-yume/internal/aifunction"
+	"project-yume/internal/bot"
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/connect"
+	"project-yume/internal/handler"
+	"project-yume/internal/inbound"
+	"project-yume/internal/memory"
+	"project-yume/internal/model"
+	"project-yume/internal/reminder"
+	"project-yume/internal/service"
+	"project-yume/internal/state"
+	"project-yume/internal/storage"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultSettle    = 50 * time.Millisecond
+	defaultMaxSettle = 30 * time.Second
+	maxDriveSteps    = 100000
+	// aggregatorSweep 与 inbound 聚合器的扫描周期一致，最后一条消息之后多走两轮保证聚合窗口关闭。
+	aggregatorSweep = 250 * time.Millisecond
+)
+
+// Options 回放参数。
+type Options struct {
+	// Settle 真实时间里连续这么久没有新活动（等待登记、收发帧、模型调用）才拨动假时钟。
+	Settle time.Duration
+	// MaxSettle 单次等待静止的上限，防止忙循环卡住回放。
+	MaxSettle time.Duration
+}
+
+// Result 回放结果。
+type Result struct {
+	Recorded  int
+	Replayed  int
+	Outbound  []string
+	State     []string
+	AIDrift   []string
+	AIMissing []string
+	AIUnused  int
+	NoFinal   bool
+}
+
+// OK 发出的消息与结束状态都一致，且没有缺少模型响应。请求摘要偏差只提示不算失败。
+func (r *Result) OK() bool {
+	return len(r.Outbound) == 0 && len(r.State) == 0 && len(r.AIMissing) == 0
+}
+
+// Report 输出人可读的比对结果。
+func (r *Result) Report(w io.Writer) {
+	fmt.Fprintf(w, "outbound frames: recorded=%d replayed=%d\n", r.Recorded, r.Replayed)
+	if len(r.Outbound) > 0 {
+		fmt.Fprintf(w, "outbound diff (- recorded, + replayed):\n%s\n", indent(r.Outbound))
+	}
+	if r.NoFinal {
+		fmt.Fprintln(w, "state: cassette has no final snapshots, skipped")
+	} else if len(r.State) > 0 {
+		fmt.Fprintf(w, "state diff (recorded -> replayed):\n%s\n", indent(r.State))
+	}
+	if len(r.AIDrift) > 0 {
+		fmt.Fprintf(w, "ai requests changed, answered in recorded order:\n%s\n", indent(r.AIDrift))
+	}
+	if len(r.AIMissing) > 0 {
+		fmt.Fprintf(w, "ai requests without recorded response:\n%s\n", indent(r.AIMissing))
+	}
+	if r.AIUnused > 0 {
+		fmt.Fprintf(w, "recorded ai responses not used: %d\n", r.AIUnused)
+	}
+	if r.OK() {
+		fmt.Fprintln(w, "PASS")
+	} else {
+		fmt.Fprintln(w, "FAIL")
+	}
+}
+
+// memoryStore 回放用的内存快照存储。
+type memoryStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newMemoryStore(snapshots map[string]json.RawMessage) *memoryStore {
+	store := &memoryStore{data: make(map[string][]byte, len(snapshots))}
+	for name, data := range snapshots {
+		store.data[name] = append([]byte(nil), data...)
+	}
+	return store
+}
+
+func (s *memoryStore) Save(name string, data []byte) error {
+	s.mu.Lock()
+	s.data[name] = append([]byte(nil), data...)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Load(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]byte(nil), s.data[name]...), nil
+}
+
+// dirtySet 记下被标脏的任务，结束时只刷这些，与正式运行时 FlushWorker 的行为一致。
+type dirtySet struct {
+	mu    sync.Mutex
+	names map[string]struct{}
+}
+
+func (d *dirtySet) MarkDirty(name string) {
+	d.mu.Lock()
+	d.names[name] = struct{}{}
+	d.mu.Unlock()
+}
+
+func (d *dirtySet) has(name string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.names[name]
+	return ok
+}
+
+type persistTask struct {
+	name      string
+	configure func(storage.SnapshotStore, storage.DirtyMarker) error
+	flush     func() error
+}
+
+func persistTasks() []persistTask {
+	return []persistTask{
+		{memory.FlushTaskName, memory.GetManager().ConfigurePersistence, memory.GetManager().Flush},
+		{memory.ProfileFlushTaskName, memory.GetProfileManager().ConfigurePersistence, memory.GetProfileManager().Flush},
+		{memory.FactFlushTaskName, memory.GetFactManager().ConfigurePersistence, memory.GetFactManager().Flush},
+		{state.FlushTaskName, state.GetManager().ConfigurePersistence, state.GetManager().Flush},
+		{reminder.FlushTaskName, reminder.GetManager().ConfigurePersistence, reminder.GetManager().Flush},
+	}
+}
+
+// Run 用录像驱动真实的聚合、入站链路、处理器和记忆模块，再与录制结果比对。
+// 会修改全局配置、时钟和各单例管理器，一个进程只应回放一次。
+func Run(ctx context.Context, cassette *Cassette, opts Options) (*Result, error) {
+	if opts.Settle <= 0 {
+		opts.Settle = defaultSettle
+	}
+	if opts.MaxSettle <= 0 {
+		opts.MaxSettle = defaultMaxSettle
+	}
+
+	cfg := config.GetConfig()
+	if err := cassette.Header.Settings.apply(cfg); err != nil {
+		return nil, err
+	}
+	dataDir, err := os.MkdirTemp("", "replay-data-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dataDir)
+	cfg.DataDir = dataDir
+	cfg.EnableAIAudit = false
+	cfg.AiDailyTokenBudget = 0
+	cfg.AiMonthlyTokenBudget = 0
+	cfg.AiDailyCostBudget = 0
+	cfg.AiMonthlyCostBudget = 0
+
+	var activity atomic.Int64
+	bump := func() { activity.Add(1) }
+
+	store := newMemoryStore(cassette.Header.Snapshots)
+	dirty := &dirtySet{names: make(map[string]struct{})}
+	tasks := persistTasks()
+	for _, task := range tasks {
+		if err := task.configure(store, dirty); err != nil {
+			return nil, err
+		}
+	}
+
+	startedAt := *cassette.Header.StartedAt
+	fake := clock.NewFake(startedAt)
+	fake.OnSchedule(bump)
+	clock.Set(fake)
+	defer clock.Set(nil)
+
+	stub := newAIStub(cassette.AI, bump)
+	aifunction.SetProviderHook(stub.wrap)
+	defer aifunction.SetProviderHook(nil)
+
+	server := newFakeOneBot(pairAPIResponses(cassette), bump)
+	defer server.close()
+
+	c, err := connect.Init(server.host())
+	if err != nil {
+		return nil, err
+	}
+	defer connect.Close(c)
+	if err := server.waitConn(5 * time.Second); err != nil {
+		return nil, err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rawMsgChan := make(chan model.Msg, 100)
+	aggregatedMsgChan := make(chan model.Msg, 100)
+	go bot.RunReceiver(runCtx, c, rawMsgChan)
+	go inbound.NewMessageAggregator().Run(runCtx, rawMsgChan, aggregatedMsgChan)
+	go bot.RunProcessor(runCtx, c, aggregatedMsgChan, bot.NewPipeline(), handler.NewMessageProcessor(), nil)
+	memoryExtractor := service.GetMemoryExtractor()
+	go memoryExtractor.Run(runCtx)
+
+	window := time.Duration(max(cfg.MessageAggregateIdleWindowMs, cfg.MessageAggregateMaxWindowMs)) * time.Millisecond
+	d := &driver{fake: fake, activity: &activity, settle: opts.Settle, maxSettle: opts.MaxSettle}
+	for _, entry := range cassette.Inbound {
+		at := startedAt.Add(time.Duration(entry.AtMs) * time.Millisecond)
+		if err := d.advanceTo(ctx, at); err != nil {
+			return nil, err
+		}
+		if err := server.push(entry.Frame); err != nil {
+			return nil, err
+		}
+		d.quietUntil = at.Add(window + 2*aggregatorSweep)
+	}
+	if err := d.advanceTo(ctx, time.Time{}); err != nil {
+		return nil, err
+	}
+	d.wait()
+	cancel()
+	memoryExtractor.Drain()
+
+	result := &Result{Recorded: len(cassette.Outbound), AIDrift: stub.drift, AIMissing: stub.missing, AIUnused: stub.unused()}
+	recorded := make([]string, 0, len(cassette.Outbound))
+	for _, entry := range cassette.Outbound {
+		recorded = append(recorded, outboundLine(entry.Frame))
+	}
+	sent := server.sentFrames()
+	replayed := make([]string, 0, len(sent))
+	for _, frame := range sent {
+		replayed = append(replayed, outboundLine(frame))
+	}
+	result.Replayed = len(replayed)
+	result.Outbound = diffLines(recorded, replayed)
+
+	if cassette.Final == nil {
+		result.NoFinal = true
+		return result, nil
+	}
+	for _, task := range tasks {
+		if !dirty.has(task.name) {
+			continue
+		}
+		if err := task.flush(); err != nil {
+			return nil, fmt.Errorf("flush %s failed: %w", task.name, err)
+		}
+	}
+	for _, name := range SnapshotNames {
+		replayedSnapshot, _ := store.Load(name)
+		diffs, err := diffSnapshot(name, cassette.Final.Snapshots[name], replayedSnapshot)
+		if err != nil {
+			return nil, err
+		}
+		result.State = append(result.State, diffs...)
+	}
+	return result, nil
+}
+
+// driver 在系统静止时拨动假时钟：先触发下一个到期的等待，没有等待时跳到下一条入站消息。
+// 聚合器的 Ticker 只在最后一条消息之后的聚合窗口内逐次触发，其余时间直接跳过。
+type driver struct {
+	fake       *clock.Fake
+	activity   *atomic.Int64
+	settle     time.Duration
+	maxSettle  time.Duration
+	quietUntil time.Time
+}
+
+// advanceTo 推进到 target，零值表示一直推进到没有待触发的等待。
+func (d *driver) advanceTo(ctx context.Context, target time.Time) error {
+	for step := 0; step < maxDriveSteps; step++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		d.wait()
+		next, ok := d.next()
+		if !ok || (!target.IsZero() && next.After(target)) {
+			if !target.IsZero() {
+				d.fake.Set(target)
+			}
+			return nil
+		}
+		d.fake.Set(next)
+	}
+	return fmt.Errorf("replay: clock did not settle after %d steps", maxDriveSteps)
+}
+
+func (d *driver) next() (time.Time, bool) {
+	next, ok := d.fake.NextWaiter()
+	if tick, tickOK := d.fake.NextTick(); tickOK && !tick.After(d.quietUntil) && (!ok || tick.Before(next)) {
+		next, ok = tick, true
+	}
+	return next, ok
+}
+
+// wait 等到 settle 时间内没有新活动。
+func (d *driver) wait() {
+	deadline := time.Now().Add(d.maxSettle)
+	last := d.activity.Load()
+	for {
+		time.Sleep(d.settle)
+		current := d.activity.Load()
+		if current == last || time.Now().After(deadline) {
+			return
+		}
+		last = current
+	}
+}
+
+// apiPair 录制时的一次 API 调用与它的响应。
+type apiPair struct {
+	action   string
+	line     string
+	response json.RawMessage
+}
+
+// pairAPIResponses 按 echo 把发出的请求和收到的响应配对。
+func pairAPIResponses(cassette *Cassette) []apiPair {
+	responses := make(map[string][]json.RawMessage)
+	for _, entry := range cassette.API {
+		responses[entry.Echo] = append(responses[entry.Echo], entry.Frame)
+	}
+	var pairs []apiPair
+	for _, entry := range cassette.Outbound {
+		queue := responses[entry.Echo]
+		if entry.Echo == "" || len(queue) == 0 {
+			continue
+		}
+		responses[entry.Echo] = queue[1:]
+		line := outboundLine(entry.Frame)
+		pairs = append(pairs, apiPair{action: strings.SplitN(line, " ", 2)[0], line: line, response: queue[0]})
+	}
+	return pairs
+}
+
+// fakeOneBot 扮演 OneBot 实现：推送录制的上报，按录制内容应答 API 调用，并记下机器人发出的帧。
+type fakeOneBot struct {
+	server   *httptest.Server
+	connCh   chan *websocket.Conn
+	activity func()
+
+	writeMu sync.Mutex
+	conn    *websocket.Conn
+
+	mu    sync.Mutex
+	pairs []apiPair
+	used  []bool
+	sent  [][]byte
+}
+
+func newFakeOneBot(pairs []apiPair, activity func()) *fakeOneBot {
+	f := &fakeOneBot{
+		connCh:   make(chan *websocket.Conn, 1),
+		activity: activity,
+		pairs:    pairs,
+		used:     make([]bool, len(pairs)),
+	}
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		f.connCh <- conn
+		f.serve(conn)
+	}))
+	return f
+}
+
+func (f *fakeOneBot) host() string {
+	return strings.TrimPrefix(f.server.URL, "http://")
+}
+
+func (f *fakeOneBot) waitConn(timeout time.Duration) error {
+	select {
+	case conn := <-f.connCh:
+		f.writeMu.Lock()
+		f.conn = conn
+		f.writeMu.Unlock()
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("replay: bot did not connect")
+	}
+}
+
+func (f *fakeOneBot) push(frame []byte) error {
+	f.activity()
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	return f.conn.WriteMessage(websocket.TextMessage, frame)
+}
+
+func (f *fakeOneBot) serve(conn *websocket.Conn) {
+	for {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		f.activity()
+		f.mu.Lock()
+		f.sent = append(f.sent, frame)
+		f.mu.Unlock()
+
+		var header struct {
+			Echo string `json:"echo"`
+		}
+		if err := json.Unmarshal(frame, &header); err != nil || header.Echo == "" {
+			continue
+		}
+		response := f.answer(frame, header.Echo)
+		f.writeMu.Lock()
+		err = conn.WriteMessage(websocket.TextMessage, response)
+		f.writeMu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// answer 先找参数完全相同的录制响应，再退而找同名 action 的，都没有时返回失败。
+func (f *fakeOneBot) answer(frame []byte, echo string) []byte {
+	line := outboundLine(frame)
+	action := strings.SplitN(line, " ", 2)[0]
+
+	f.mu.Lock()
+	found := -1
+	for i, pair := range f.pairs {
+		if !f.used[i] && pair.line == line {
+			found = i
+			break
+		}
+	}
+	if found < 0 {
+		for i, pair := range f.pairs {
+			if !f.used[i] && pair.action == action {
+				found = i
+				break
+			}
+		}
+	}
+	var recorded json.RawMessage
+	if found >= 0 {
+		f.used[found] = true
+		recorded = f.pairs[found].response
+	}
+	f.mu.Unlock()
+
+	fields := map[string]json.RawMessage{}
+	if recorded == nil || json.Unmarshal(recorded, &fields) != nil {
+		fields = map[string]json.RawMessage{
+			"status":  json.RawMessage(`"failed"`),
+			"retcode": json.RawMessage(`1404`),
+			"data":    json.RawMessage(`null`),
+		}
+	}
+	fields["echo"], _ = json.Marshal(echo)
+	response, _ := json.Marshal(fields)
+	return response
+}
+
+func (f *fakeOneBot) sentFrames() [][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]byte(nil), f.sent...)
+}
+
+func (f *fakeOneBot) close() {
+	f.server.CloseClientConnections()
+	f.server.Close()
+}
@@ -0,0 +1,205 @@
+package replay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"project-yume/internal/aifunction"
+	"project-yume/internal/config"
+	"project-yume/internal/connect"
+	"project-yume/internal/storage"
+	"project-yume/internal/utils"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Recorder 把连接上的收发、API 响应和模型调用写入录像。
+// Close 应在各管理器刷盘之后调用，结束时的快照才是完整的。
+type Recorder struct {
+	out   *writer
+	store storage.SnapshotStore
+}
+
+// StartRecording 开始录制：写入配置与当前快照，挂上连接观察者和模型客户端包装。
+func StartRecording(path string, store storage.SnapshotStore) (*Recorder, error) {
+	startedAt := time.Now()
+	snapshots, err := readSnapshots(store)
+	if err != nil {
+		return nil, err
+	}
+	out, err := newWriter(path, startedAt)
+	if err != nil {
+		return nil, err
+	}
+	settings := captureSettings(config.GetConfig())
+	if err := out.write(Entry{Kind: KindHeader, StartedAt: &startedAt, Settings: &settings, Snapshots: snapshots}); err != nil {
+		out.close()
+		return nil, err
+	}
+
+	r := &Recorder{out: out, store: store}
+	connect.SetTap(r)
+	aifunction.SetProviderHook(r.wrap)
+	return r, nil
+}
+
+// Close 摘掉观察者并写入结束快照。
+func (r *Recorder) Close() error {
+	connect.SetTap(nil)
+	aifunction.SetProviderHook(nil)
+
+	snapshots, err := readSnapshots(r.store)
+	if err != nil {
+		utils.Warn("replay: read final snapshots failed: %v", err)
+	} else if err := r.out.write(Entry{Kind: KindFinal, Snapshots: snapshots}); err != nil {
+		utils.Warn("replay: write final entry failed: %v", err)
+	}
+	return r.out.close()
+}
+
+type frameHeader struct {
+	PostType string `json:"post_type"`
+	Echo     string `json:"echo"`
+}
+
+// Received 实现 connect.Tap。心跳等元事件不影响处理结果，不记录。
+func (r *Recorder) Received(frame []byte) {
+	var header frameHeader
+	if err := json.Unmarshal(frame, &header); err != nil {
+		return
+	}
+	switch {
+	case header.PostType == "meta_event":
+		return
+	case header.PostType != "":
+		r.writeFrame(KindInbound, frame, "")
+	case header.Echo != "":
+		r.writeFrame(KindAPI, frame, header.Echo)
+	}
+}
+
+// Sent 实现 connect.Tap。
+func (r *Recorder) Sent(frame []byte) {
+	var header frameHeader
+	_ = json.Unmarshal(frame, &header)
+	r.writeFrame(KindOutbound, frame, header.Echo)
+}
+
+func (r *Recorder) writeFrame(kind string, frame []byte, echo string) {
+	if !json.Valid(frame) {
+		return
+	}
+	entry := Entry{Kind: kind, Frame: append(json.RawMessage(nil), frame...), Echo: echo}
+	if err := r.out.write(entry); err != nil {
+		utils.Warn("replay: write %s entry failed: %v", kind, err)
+	}
+}
+
+func (r *Recorder) writeAI(exchange AIExchange) {
+	if err := r.out.write(Entry{Kind: KindAI, AI: &exchange}); err != nil {
+		utils.Warn("replay: write ai entry failed: %v", err)
+	}
+}
+
+func (r *Recorder) wrap(profile string, _ config.AIProfile, next aifunction.Provider) aifunction.Provider {
+	return &recordingProvider{recorder: r, profile: profile, next: next}
+}
+
+// requestKey 请求内容的摘要，回放时优先按它匹配响应。
+func requestKey(request openai.ChatCompletionRequest) string {
+	request.StreamOptions = nil
+	data, err := json.Marshal(request)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+func newAIError(err error) *AIError {
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+	result := &AIError{Message: err.Error()}
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		result.Canceled = true
+	case errors.As(err, &apiErr):
+		result.Status = apiErr.HTTPStatusCode
+		result.Message = apiErr.Message
+	case errors.As(err, &reqErr):
+		result.Status = reqErr.HTTPStatusCode
+	}
+	return result
+}
+
+type recordingProvider struct {
+	recorder *Recorder
+	profile  string
+	next     aifunction.Provider
+}
+
+func (p *recordingProvider) exchange(request openai.ChatCompletionRequest, stream bool) AIExchange {
+	return AIExchange{Profile: p.profile, Key: requestKey(request), Stream: stream, Request: request}
+}
+
+func (p *recordingProvider) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	resp, err := p.next.CreateChatCompletion(ctx, request)
+	exchange := p.exchange(request, false)
+	if err != nil {
+		exchange.Error = newAIError(err)
+	} else {
+		exchange.Response = &resp
+	}
+	p.recorder.writeAI(exchange)
+	return resp, err
+}
+
+func (p *recordingProvider) CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (aifunction.ChatStream, error) {
+	stream, err := p.next.CreateChatCompletionStream(ctx, request)
+	exchange := p.exchange(request, true)
+	if err != nil {
+		exchange.Error = newAIError(err)
+		p.recorder.writeAI(exchange)
+		return nil, err
+	}
+	return &recordingStream{provider: p, exchange: exchange, next: stream}, nil
+}
+
+// recordingStream 在流结束、出错或被提前关闭时写入一次。
+type recordingStream struct {
+	provider *recordingProvider
+	exchange AIExchange
+	next     aifunction.ChatStream
+	once     sync.Once
+}
+
+func (s *recordingStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	chunk, err := s.next.Recv()
+	if err != nil {
+		s.finish(err)
+		return chunk, err
+	}
+	s.exchange.Chunks = append(s.exchange.Chunks, chunk)
+	return chunk, nil
+}
+
+func (s *recordingStream) Close() error {
+	s.finish(nil)
+	return s.next.Close()
+}
+
+func (s *recordingStream) finish(err error) {
+	s.once.Do(func() {
+		s.exchange.Error = newAIError(err)
+		s.provider.recorder.writeAI(s.exchange)
+	})
+}
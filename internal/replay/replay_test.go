@@ -0,0 +1,226 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"project-yume/internal/aifunction"
+	"project-yume/internal/config"
+	"project-yume/internal/model"
+	"project-yume/internal/reminder"
+	"project-yume/internal/state"
+	"project-yume/internal/storage"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type fixedProvider struct{}
+
+func (fixedProvider) CreateChatCompletion(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "好呀"}}}}, nil
+}
+
+func (fixedProvider) CreateChatCompletionStream(context.Context, openai.ChatCompletionRequest) (aifunction.ChatStream, error) {
+	return &fixedStream{chunks: []string{"在", "呢"}}, nil
+}
+
+type fixedStream struct {
+	chunks []string
+}
+
+func (s *fixedStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	if len(s.chunks) == 0 {
+		return openai.ChatCompletionStreamResponse{}, io.EOF
+	}
+	chunk := openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: s.chunks[0]}}}}
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *fixedStream) Close() error {
+	return nil
+}
+
+func userRequest(text string) openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{Model: "test", Messages: []openai.ChatCompletionMessage{{Role: "user", Content: text}}}
+}
+
+func TestRecordThenStubReplaysResponses(t *testing.T) {
+	store := storage.NewFileSnapshotStore(t.TempDir())
+	if err := store.Save(state.SnapshotName, []byte(`{"private:1":{"state":"idle"}}`)); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	recorder, err := StartRecording(path, store)
+	if err != nil {
+		t.Fatalf("start recording: %v", err)
+	}
+
+	provider := recorder.wrap("main", config.AIProfile{}, fixedProvider{})
+	if _, err := provider.CreateChatCompletion(context.Background(), userRequest("你好")); err != nil {
+		t.Fatalf("completion: %v", err)
+	}
+	stream, err := provider.CreateChatCompletionStream(context.Background(), userRequest("在吗"))
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+	stream.Close()
+	recorder.Received([]byte(`{"post_type":"meta_event","meta_event_type":"heartbeat"}`))
+	recorder.Received([]byte(`{"post_type":"message","user_id":1,"raw_message":"你好"}`))
+	recorder.Sent([]byte(`{"action":"get_image","params":{"file":"a.jpg"},"echo":"api-1"}`))
+	recorder.Received([]byte(`{"status":"ok","retcode":0,"data":{"url":"http://x"},"echo":"api-1"}`))
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	cassette, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cassette.Inbound) != 1 || len(cassette.Outbound) != 1 || len(cassette.API) != 1 || len(cassette.AI) != 2 {
+		t.Fatalf("unexpected cassette: inbound=%d outbound=%d api=%d ai=%d",
+			len(cassette.Inbound), len(cassette.Outbound), len(cassette.API), len(cassette.AI))
+	}
+	if _, ok := cassette.Header.Snapshots[state.SnapshotName]; !ok || cassette.Final == nil {
+		t.Fatalf("snapshots should be recorded at start and end")
+	}
+	if pairs := pairAPIResponses(cassette); len(pairs) != 1 || pairs[0].action != "get_image" {
+		t.Fatalf("unexpected api pairs: %+v", pairs)
+	}
+
+	stub := newAIStub(cassette.AI, nil)
+	replayed := stubProvider{stub: stub}
+	resp, err := replayed.CreateChatCompletion(context.Background(), userRequest("你好"))
+	if err != nil || resp.Choices[0].Message.Content != "好呀" {
+		t.Fatalf("unexpected replayed completion: %+v %v", resp, err)
+	}
+	replayedStream, err := replayed.CreateChatCompletionStream(context.Background(), userRequest("换了个问法"))
+	if err != nil {
+		t.Fatalf("replayed stream: %v", err)
+	}
+	text := ""
+	for {
+		chunk, err := replayedStream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		text += chunk.Choices[0].Delta.Content
+	}
+	if text != "在呢" || len(stub.drift) != 1 {
+		t.Fatalf("changed request should fall back to recorded order: text=%q drift=%v", text, stub.drift)
+	}
+	if _, err := replayed.CreateChatCompletion(context.Background(), userRequest("再来")); !errors.Is(err, errNoRecording) || len(stub.missing) != 1 {
+		t.Fatalf("extra request should report missing, err=%v", err)
+	}
+}
+
+func TestDiffIgnoresTimesAndGeneratedIDs(t *testing.T) {
+	recorded := []byte(`{"a":{"updated_at":"2026-10-18T09:00:00+08:00","id":"reminder-1792285200000-3","text":"喝水"}}`)
+	replayed := []byte(`{"a":{"updated_at":"2026-10-18T09:00:05+08:00","id":"reminder-1792285205000-1","text":"喝水"}}`)
+	if diffs, err := diffSnapshot("x", recorded, replayed); err != nil || len(diffs) != 0 {
+		t.Fatalf("expected no diff, got %v %v", diffs, err)
+	}
+	changed := []byte(`{"a":{"updated_at":"2026-10-18T09:00:05+08:00","id":"reminder-1792285205000-1","text":"吃药"}}`)
+	if diffs, _ := diffSnapshot("x", recorded, changed); len(diffs) != 1 {
+		t.Fatalf("expected one diff, got %v", diffs)
+	}
+
+	lines := diffLines([]string{"a", "b", "c"}, []string{"a", "c", "d"})
+	if len(lines) != 2 || lines[0] != "- b" || lines[1] != "+ d" {
+		t.Fatalf("unexpected line diff: %v", lines)
+	}
+}
+
+// writeCassette 按录制格式写出录像，返回路径。
+func writeCassette(t *testing.T, entries ...Entry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	var data []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatalf("marshal entry: %v", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("write cassette: %v", err)
+	}
+	return path
+}
+
+func TestReplayKeepsRemindersFromOlderCassettes(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	const userID = 38001
+	t.Cleanup(func() {
+		*cfg = previous
+		reminder.GetManager().DeleteUser(userID)
+	})
+
+	// 录制于真实时间之前；回放的假时钟从录制时间开始，提醒不能因为墙上时间已过而被拒绝
+	location := time.FixedZone("CST", 8*3600)
+	startedAt := time.Date(2025, 3, 1, 8, 0, 0, 0, location)
+	due := time.Date(2025, 3, 2, 9, 0, 0, 0, location)
+	inbound, _ := json.Marshal(map[string]any{
+		"post_type":    "message",
+		"message_type": "private",
+		"sub_type":     "friend",
+		"user_id":      userID,
+		"message_id":   1,
+		"time":         startedAt.Unix(),
+		"raw_message":  "明天早上九点提醒我开会",
+		"message":      []map[string]any{{"type": "text", "data": map[string]string{"text": "明天早上九点提醒我开会"}}},
+	})
+	outbound, _ := json.Marshal(model.Message{
+		Action: "send_private_msg",
+		Params: model.UserMessageParams{User_id: userID, Message: "好，" + reminder.DescribeTime(due, reminder.RepeatNone, startedAt, location) + "提醒你开会"},
+		Echo:   "send_msg",
+	})
+	path := writeCassette(t,
+		Entry{Kind: KindHeader, StartedAt: &startedAt, Settings: &Settings{
+			TargetID:              userID,
+			EnableReminders:       true,
+			AggregateIdleWindowMs: 500,
+			AggregateMaxWindowMs:  1000,
+			AggregateMaxMessages:  5,
+			EnableTimeContext:     true,
+			TimeContextTimezone:   "Asia/Shanghai",
+		}},
+		Entry{Kind: KindInbound, Frame: inbound},
+		Entry{Kind: KindOutbound, AtMs: 3000, Frame: outbound},
+	)
+
+	cassette, err := Load(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	result, err := Run(context.Background(), cassette, Options{Settle: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if !result.OK() {
+		var report strings.Builder
+		result.Report(&report)
+		t.Fatalf("replay diverged from the recording:\n%s", report.String())
+	}
+	items := reminder.GetManager().List(userID)
+	if len(items) != 1 || !items[0].DueAt.Equal(due) || items[0].CreatedAt.Sub(startedAt) > time.Minute {
+		t.Fatalf("reminder should be created on the recorded clock, got %+v", items)
+	}
+}
@@ -0,0 +1,161 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"project-yume/internal/aifunction"
+	"project-yume/internal/config"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// errNoRecording 录像里已没有可用的响应，通常说明改动让模型调用变多了。
+var errNoRecording = errors.New("replay: no recorded ai response left")
+
+// aiStub 按录像返回模型响应。先找请求摘要相同的，找不到时按顺序取下一条同类调用并记为偏差，
+// 提示词改动不会让整段回放失效。
+type aiStub struct {
+	mu        sync.Mutex
+	exchanges []AIExchange
+	used      []bool
+	drift     []string
+	missing   []string
+	activity  func()
+}
+
+func newAIStub(exchanges []AIExchange, activity func()) *aiStub {
+	return &aiStub{exchanges: exchanges, used: make([]bool, len(exchanges)), activity: activity}
+}
+
+func (s *aiStub) wrap(string, config.AIProfile, aifunction.Provider) aifunction.Provider {
+	return stubProvider{stub: s}
+}
+
+func (s *aiStub) take(request openai.ChatCompletionRequest, stream bool) (AIExchange, error) {
+	if s.activity != nil {
+		s.activity()
+	}
+	key := requestKey(request)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fallback := -1
+	for i, exchange := range s.exchanges {
+		if s.used[i] || exchange.Stream != stream {
+			continue
+		}
+		if exchange.Key == key {
+			s.used[i] = true
+			return exchange, nil
+		}
+		if fallback < 0 {
+			fallback = i
+		}
+	}
+	summary := describeRequest(request)
+	if fallback < 0 {
+		s.missing = append(s.missing, summary)
+		return AIExchange{}, errNoRecording
+	}
+	s.used[fallback] = true
+	s.drift = append(s.drift, summary)
+	return s.exchanges[fallback], nil
+}
+
+// unused 返回没被取用的录制调用数，说明改动让模型调用变少了。
+func (s *aiStub) unused() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, used := range s.used {
+		if !used {
+			count++
+		}
+	}
+	return count
+}
+
+func describeRequest(request openai.ChatCompletionRequest) string {
+	last := ""
+	for i := len(request.Messages) - 1; i >= 0; i-- {
+		if request.Messages[i].Role == openai.ChatMessageRoleUser {
+			last = request.Messages[i].Content
+			break
+		}
+	}
+	runes := []rune(last)
+	if len(runes) > 40 {
+		last = string(runes[:40]) + "..."
+	}
+	return fmt.Sprintf("model=%s messages=%d last_user=%q", request.Model, len(request.Messages), last)
+}
+
+// replayError 还原录制时的错误。录制时被取消的调用在回放里一直挂起，直到同样被取消。
+func replayError(ctx context.Context, recorded *AIError) error {
+	if recorded.Canceled {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if recorded.Status != 0 {
+		return &openai.APIError{HTTPStatusCode: recorded.Status, Message: recorded.Message}
+	}
+	return errors.New(recorded.Message)
+}
+
+type stubProvider struct {
+	stub *aiStub
+}
+
+func (p stubProvider) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	exchange, err := p.stub.take(request, false)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	if exchange.Error != nil {
+		return openai.ChatCompletionResponse{}, replayError(ctx, exchange.Error)
+	}
+	if exchange.Response == nil {
+		return openai.ChatCompletionResponse{}, errNoRecording
+	}
+	return *exchange.Response, nil
+}
+
+func (p stubProvider) CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (aifunction.ChatStream, error) {
+	exchange, err := p.stub.take(request, true)
+	if err != nil {
+		return nil, err
+	}
+	if exchange.Error != nil && len(exchange.Chunks) == 0 {
+		return nil, replayError(ctx, exchange.Error)
+	}
+	return &stubStream{ctx: ctx, chunks: exchange.Chunks, err: exchange.Error}, nil
+}
+
+type stubStream struct {
+	ctx    context.Context
+	chunks []openai.ChatCompletionStreamResponse
+	err    *AIError
+}
+
+func (s *stubStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	if err := s.ctx.Err(); err != nil {
+		return openai.ChatCompletionStreamResponse{}, err
+	}
+	if len(s.chunks) > 0 {
+		chunk := s.chunks[0]
+		s.chunks = s.chunks[1:]
+		return chunk, nil
+	}
+	if s.err != nil {
+		return openai.ChatCompletionStreamResponse{}, replayError(s.ctx, s.err)
+	}
+	return openai.ChatCompletionStreamResponse{}, io.EOF
+}
+
+func (s *stubStream) Close() error {
+	return nil
+}
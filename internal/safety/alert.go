@@ -0,0 +1,136 @@
+package safety
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/metrics"
+	"project-yume/internal/utils"
+)
+
+const (
+	// alertCooldown 同一用户连续触发时，冷却期内不重复通知管理员。
+	alertCooldown  = 10 * time.Minute
+	webhookTimeout = 5 * time.Second
+)
+
+const (
+	AlertChannelQQ      = "qq"
+	AlertChannelWebhook = "webhook"
+)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// SendFunc 给管理员发一条私聊消息，由持有 OneBot 连接的调用方提供。
+type SendFunc func(userID int64, message string) error
+
+// Notify 通知配置的管理员 QQ 和 webhook，并把结果写回事件。耗时较长，调用方应异步执行。
+func Notify(send SendFunc, event Event) []AlertResult {
+	cfg := config.GetConfig()
+	channels := make([]string, 0, 2)
+	if cfg.CrisisAlertQQ != 0 {
+		channels = append(channels, AlertChannelQQ)
+	}
+	if strings.TrimSpace(cfg.CrisisAlertWebhook) != "" {
+		channels = append(channels, AlertChannelWebhook)
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+
+	cooling := !GetEventManager().ReserveAlert(event.UserID, event.Time)
+
+	results := make([]AlertResult, 0, len(channels))
+	for _, channel := range channels {
+		result := AlertResult{Channel: channel, At: clock.Now()}
+		var err error
+		switch {
+		case cooling:
+			result.Skipped = true
+		case channel == AlertChannelQQ:
+			err = sendAlertQQ(send, cfg.CrisisAlertQQ, event)
+		default:
+			err = postAlertWebhook(cfg.CrisisAlertWebhook, event)
+		}
+		outcome := "sent"
+		switch {
+		case result.Skipped:
+			outcome = "skipped"
+		case err != nil:
+			outcome = "error"
+			result.Error = err.Error()
+			utils.Errorw("crisis alert failed",
+				utils.String("event_id", event.ID),
+				utils.String("channel", channel),
+				utils.Err(err),
+			)
+		default:
+			result.OK = true
+		}
+		metrics.IncCounter(
+			"bot_crisis_alerts_total",
+			"Total crisis alerts to admins by channel and result.",
+			map[string]string{"channel": channel, "result": outcome},
+		)
+		results = append(results, result)
+	}
+
+	GetEventManager().SetAlerts(event.ID, results)
+	return results
+}
+
+func sendAlertQQ(send SendFunc, adminID int64, event Event) error {
+	if send == nil {
+		return fmt.Errorf("no onebot connection")
+	}
+	// 原消息里的 $ 会被当成分段符，换成全角
+	message := strings.ReplaceAll(event.Message, "$", "＄")
+	source := event.Assessment.Source
+	if len(event.Assessment.Matches) > 0 {
+		source += "：" + strings.Join(event.Assessment.Matches, "、")
+	}
+	text := fmt.Sprintf("【危机提醒】用户 %d 于 %s 的消息触发了危机检测（分数 %.2f，%s）：\n%s\n已回复求助信息，会话守护至 %s。",
+		event.UserID,
+		event.Time.Format("2006-01-02 15:04"),
+		event.Assessment.Score,
+		source,
+		message,
+		event.GuardedUntil.Format("01-02 15:04"),
+	)
+	return send(adminID, text)
+}
+
+func postAlertWebhook(url string, event Event) error {
+	payload, err := json.Marshal(map[string]any{
+		"type":  "crisis",
+		"event": event,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal crisis alert failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSpace(url), bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("build webhook request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("post webhook failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
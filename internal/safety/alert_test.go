@@ -0,0 +1,64 @@
+package safety
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"project-yume/internal/config"
+)
+
+func TestNotifyReservesCooldownAcrossConcurrentEvents(t *testing.T) {
+	var posts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cfg := config.GetConfig()
+	previous := *cfg
+	const userID = 50503
+	t.Cleanup(func() {
+		*cfg = previous
+		GetEventManager().DeleteUser(userID)
+	})
+	cfg.CrisisAlertQQ = 0
+	cfg.CrisisAlertWebhook = server.URL
+
+	start := time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		event := GetEventManager().Record(Event{Time: start.Add(time.Duration(i) * time.Second), SessionID: "private:50503", UserID: userID, Message: "我不想活了"})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Notify(nil, event)
+		}()
+	}
+	wg.Wait()
+
+	if got := posts.Load(); got != 1 {
+		t.Fatalf("concurrent events inside the cooldown should alert once, got %d", got)
+	}
+	skipped := 0
+	for _, event := range GetEventManager().Events(userID, 0) {
+		if len(event.Alerts) != 1 {
+			t.Fatalf("every event should record its alert result: %+v", event)
+		}
+		if event.Alerts[0].Skipped {
+			skipped++
+		}
+	}
+	if skipped != 4 {
+		t.Fatalf("expected 4 skipped alerts, got %d", skipped)
+	}
+
+	later := GetEventManager().Record(Event{Time: start.Add(alertCooldown + time.Minute), SessionID: "private:50503", UserID: userID, Message: "我不想活了"})
+	if results := Notify(nil, later); len(results) != 1 || !results[0].OK || posts.Load() != 2 {
+		t.Fatalf("alert after the cooldown should be sent, got %+v posts=%d", results, posts.Load())
+	}
+}
@@ -0,0 +1,227 @@
+package safety
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"project-yume/internal/aifunction"
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/metrics"
+	"project-yume/internal/usage"
+	"project-yume/internal/utils"
+)
+
+// 风险分数的来源。
+const (
+	SourceLexicon = "lexicon"
+	SourceModel   = "model"
+)
+
+const (
+	defaultTriggerScore = 0.7
+	// extraMatchBonus 每多命中一个不同的词加的分。
+	extraMatchBonus    = 0.1
+	modelReviewTimeout = 10 * time.Second
+)
+
+type crisisTerm struct {
+	text   string
+	weight float64
+}
+
+// crisisLexicon 明确表达轻生意图的词接近 1，流露绝望或提到方式的词略低，需要结合上下文的词低于默认触发线。
+var crisisLexicon = []crisisTerm{
+	{"不想活了", 1}, {"不想活下去", 1}, {"结束自己的生命", 1}, {"结束我的生命", 1}, {"了结自己", 1},
+	{"我要自杀", 1}, {"想自杀", 1}, {"去自杀", 1},
+	{"自杀", 0.9}, {"轻生", 0.9}, {"割腕", 0.9}, {"想死", 0.9}, {"寻死", 0.9},
+	{"死了算了", 0.9}, {"不如死了", 0.9}, {"活不下去", 0.9},
+	{"自残", 0.8}, {"伤害自己", 0.8}, {"上吊", 0.8}, {"烧炭", 0.8}, {"跳楼", 0.8},
+	{"活着没意思", 0.8}, {"活着没有意义", 0.8}, {"活着有什么意义", 0.8}, {"没有活下去的理由", 0.8},
+	{"想消失", 0.6}, {"消失就好了", 0.6}, {"撑不下去了", 0.6}, {"遗书", 0.6}, {"永别了", 0.6},
+	{"安眠药", 0.4}, {"解脱", 0.4}, {"没人需要我", 0.4}, {"我是累赘", 0.4},
+}
+
+// crisisExclusions 含危机词但通常不是字面意思的说法，匹配前先去掉。
+var crisisExclusions = []string{
+	"想死你", "想死我了", "笑死", "自杀式", "自杀小队", "跳楼价", "跳楼大甩卖",
+	"不会自杀", "不会想不开", "没有想死", "不是想死",
+}
+
+func init() {
+	// 长词优先，命中后不再重复计入其中的短词
+	sort.SliceStable(crisisLexicon, func(i, j int) bool {
+		return len([]rune(crisisLexicon[i].text)) > len([]rune(crisisLexicon[j].text))
+	})
+}
+
+// Assessment 一条消息的风险判断。Score 取词表与模型两者中较高的分数。
+type Assessment struct {
+	Score        float64  `json:"score"`
+	LexiconScore float64  `json:"lexicon_score"`
+	Matches      []string `json:"matches,omitempty"`
+	ModelChecked bool     `json:"model_checked"`
+	ModelScore   float64  `json:"model_score,omitempty"`
+	Reason       string   `json:"reason,omitempty"`
+	ModelError   string   `json:"model_error,omitempty"`
+	Source       string   `json:"source,omitempty"`
+	Triggered    bool     `json:"triggered"`
+}
+
+// reviewFunc 请模型给出 0-1 的风险分数和一句理由。
+type reviewFunc func(ctx context.Context, message string) (float64, string, error)
+
+// Assess 按当前配置检测一条消息，未开启检测时返回空结果。
+// 预算超出后只用词表，不请模型复核。
+func Assess(ctx context.Context, message string) Assessment {
+	cfg := config.GetConfig()
+	if !cfg.EnableCrisisDetection {
+		return Assessment{}
+	}
+	var reviewer reviewFunc
+	if cfg.EnableCrisisModelCheck && !usage.GetManager().Budget(clock.Now()).PresetOnly() {
+		reviewer = reviewWithModel
+	}
+	return assess(ctx, message, cfg.CrisisTriggerScore, cfg.CrisisReviewScore, reviewer)
+}
+
+func assess(ctx context.Context, message string, triggerScore, reviewScore float64, reviewer reviewFunc) Assessment {
+	if strings.TrimSpace(message) == "" {
+		return Assessment{}
+	}
+	if triggerScore <= 0 || triggerScore > 1 {
+		triggerScore = defaultTriggerScore
+	}
+
+	lexiconScore, matches := ScoreLexicon(message)
+	result := Assessment{Score: lexiconScore, LexiconScore: lexiconScore, Matches: matches}
+	if lexiconScore > 0 {
+		result.Source = SourceLexicon
+	}
+	if reviewer != nil && lexiconScore < triggerScore && lexiconScore >= max(0, reviewScore) {
+		modelScore, reason, err := reviewer(ctx, message)
+		if err != nil {
+			result.ModelError = err.Error()
+		} else {
+			result.ModelChecked = true
+			result.ModelScore = modelScore
+			result.Reason = reason
+			if modelScore > result.Score {
+				result.Score = modelScore
+				result.Source = SourceModel
+			}
+		}
+	}
+	result.Triggered = result.Score > 0 && result.Score >= triggerScore
+	return result
+}
+
+// ScoreLexicon 按词表给消息打分：取命中词的最高权重，每多一个不同的词加 0.1，最高 1。
+func ScoreLexicon(message string) (float64, []string) {
+	text := normalizeCrisisText(message)
+	for _, exclusion := range crisisExclusions {
+		text = strings.ReplaceAll(text, exclusion, "□")
+	}
+
+	var matches []string
+	score := 0.0
+	for _, term := range crisisLexicon {
+		if !strings.Contains(text, term.text) {
+			continue
+		}
+		text = strings.ReplaceAll(text, term.text, "□")
+		matches = append(matches, term.text)
+		score = max(score, term.weight)
+	}
+	if len(matches) == 0 {
+		return 0, nil
+	}
+	score = min(1, score+extraMatchBonus*float64(len(matches)-1))
+	return math.Round(score*100) / 100, matches
+}
+
+// normalizeCrisisText 去掉空白并转小写，避免用空格隔开的写法漏检。
+func normalizeCrisisText(message string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, message)
+}
+
+const crisisReviewPrompt = `你是心理危机筛查助手，只判断用户这条消息是否流露出自杀、自伤或不想活下去的念头。
+玩笑和夸张说法（如"笑死""想死你了""累死了"）、讨论新闻或作品里的情节、替别人询问求助方式，都不算。
+只返回一个 JSON 对象，不要解释：{"risk":"none|low|high","confidence":0到1的小数,"reason":"一句话理由"}`
+
+// crisisRiskWeights 模型给出的风险等级对应的分数，再乘以置信度。
+var crisisRiskWeights = map[string]float64{
+	"none": 0,
+	"low":  0.5,
+	"high": 1,
+}
+
+// reviewWithModel 用分类任务的路由复核，调用照常记入 AI 审计。
+func reviewWithModel(ctx context.Context, message string) (float64, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, modelReviewTimeout)
+	defer cancel()
+
+	raw, err := aifunction.Queryai(ctx, config.AITaskClassify, crisisReviewPrompt, message)
+	if err == nil {
+		var score float64
+		var reason string
+		score, reason, err = parseCrisisReview(raw)
+		if err == nil {
+			metrics.IncCounter(
+				"bot_crisis_model_checks_total",
+				"Total crisis model reviews by result.",
+				map[string]string{"result": "ok"},
+			)
+			return score, reason, nil
+		}
+	}
+	metrics.IncCounter(
+		"bot_crisis_model_checks_total",
+		"Total crisis model reviews by result.",
+		map[string]string{"result": "error"},
+	)
+	utils.Warn("危机复核失败，只按词表判断: %v", err)
+	return 0, "", err
+}
+
+func parseCrisisReview(raw string) (float64, string, error) {
+	start := strings.Index(raw, "{")
+	end := strings.LastIndex(raw, "}")
+	if start < 0 || end < start {
+		return 0, "", fmt.Errorf("no json object in crisis review: %q", raw)
+	}
+
+	var review struct {
+		Risk       string  `json:"risk"`
+		Confidence float64 `json:"confidence"`
+		Reason     string  `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(raw[start:end+1]), &review); err != nil {
+		return 0, "", fmt.Errorf("unmarshal crisis review failed: %w", err)
+	}
+	weight, ok := crisisRiskWeights[strings.ToLower(strings.TrimSpace(review.Risk))]
+	if !ok {
+		return 0, "", fmt.Errorf("invalid risk: %q", review.Risk)
+	}
+	if review.Confidence < 0 || review.Confidence > 1 {
+		return 0, "", fmt.Errorf("invalid confidence: %v", review.Confidence)
+	}
+	return math.Round(weight*review.Confidence*100) / 100, strings.TrimSpace(review.Reason), nil
+}
+
+// ReplyText 触发时发给用户的回复。
+func ReplyText() string {
+	cfg := config.GetConfig()
+	return strings.ReplaceAll(cfg.CrisisReplyTemplate, "{hotlines}", cfg.CrisisHotlines)
+}
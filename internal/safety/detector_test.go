@@ -0,0 +1,61 @@
+package safety
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestScoreLexiconMatchesAndExclusions(t *testing.T) {
+	if score, matches := ScoreLexicon("我 不想活了"); score != 1 || len(matches) != 1 || matches[0] != "不想活了" {
+		t.Fatalf("expected a single full-weight match, got %v %v", score, matches)
+	}
+	if score, matches := ScoreLexicon("好想解脱，没人需要我"); score != 0.5 || len(matches) != 2 {
+		t.Fatalf("expected 0.4 plus one extra match, got %v %v", score, matches)
+	}
+	for _, message := range []string{"想死你了！", "笑死我了", "双十一跳楼价", "放心，我不会自杀的"} {
+		if score, matches := ScoreLexicon(message); score != 0 {
+			t.Fatalf("%q should not match, got %v %v", message, score, matches)
+		}
+	}
+}
+
+func TestAssessUsesModelOnlyInReviewBand(t *testing.T) {
+	calls := 0
+	reviewer := func(ctx context.Context, message string) (float64, string, error) {
+		calls++
+		return 0.9, "流露出轻生念头", nil
+	}
+
+	if result := assess(context.Background(), "我想自杀", 0.7, 0.3, reviewer); !result.Triggered || result.Source != SourceLexicon || calls != 0 {
+		t.Fatalf("lexicon hit above trigger should skip the model, got %+v calls=%d", result, calls)
+	}
+	if result := assess(context.Background(), "今天天气不错", 0.7, 0.3, reviewer); result.Triggered || calls != 0 {
+		t.Fatalf("score below review line should skip the model, got %+v calls=%d", result, calls)
+	}
+	result := assess(context.Background(), "好想解脱", 0.7, 0.3, reviewer)
+	if !result.Triggered || result.Source != SourceModel || result.Score != 0.9 || !result.ModelChecked || calls != 1 {
+		t.Fatalf("model should raise the score, got %+v calls=%d", result, calls)
+	}
+
+	failing := func(ctx context.Context, message string) (float64, string, error) {
+		return 0, "", errors.New("timeout")
+	}
+	result = assess(context.Background(), "好想解脱", 0.7, 0.3, failing)
+	if result.Triggered || result.Score != 0.4 || result.ModelError == "" {
+		t.Fatalf("model failure should fall back to lexicon, got %+v", result)
+	}
+	if result := assess(context.Background(), "好想解脱", 0.3, 0.3, nil); !result.Triggered {
+		t.Fatalf("lower trigger score should trigger on lexicon alone, got %+v", result)
+	}
+}
+
+func TestParseCrisisReview(t *testing.T) {
+	score, reason, err := parseCrisisReview("```json\n{\"risk\":\"high\",\"confidence\":0.8,\"reason\":\"明确说想结束生命\"}\n```")
+	if err != nil || score != 0.8 || reason != "明确说想结束生命" {
+		t.Fatalf("unexpected review: %v %q %v", score, reason, err)
+	}
+	if _, _, err := parseCrisisReview(`{"risk":"maybe","confidence":0.5}`); err == nil {
+		t.Fatalf("unknown risk should fail")
+	}
+}
@@ -0,0 +1,237 @@
+package safety
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/storage"
+	"project-yume/internal/utils"
+)
+
+// eventLimit 保留的触发记录条数，超出后丢弃最早的。
+const eventLimit = 500
+
+const EventsSnapshotName = "safety/crisis_events.json"
+const EventsFlushTaskName = "crisis_events"
+
+// AlertResult 一次通知的结果，channel 为 qq 或 webhook。
+type AlertResult struct {
+	Channel string    `json:"channel"`
+	OK      bool      `json:"ok"`
+	Skipped bool      `json:"skipped,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Event 一次危机触发。不受 ENABLE_AI_AUDIT 影响，始终保存。
+type Event struct {
+	ID           string        `json:"id"`
+	Time         time.Time     `json:"time"`
+	RequestID    string        `json:"request_id,omitempty"`
+	SessionID    string        `json:"session_id"`
+	UserID       int64         `json:"user_id"`
+	GroupID      int64         `json:"group_id,omitempty"`
+	Message      string        `json:"message"`
+	Assessment   Assessment    `json:"assessment"`
+	Reply        string        `json:"reply"`
+	GuardedUntil time.Time     `json:"guarded_until"`
+	Alerts       []AlertResult `json:"alerts,omitempty"`
+}
+
+// EventManager 保存最近的危机触发记录，按时间升序。
+type EventManager struct {
+	mu     sync.RWMutex
+	events []Event
+	// reserved 已占用通知名额、结果还没写回的时间，避免并发触发重复通知。
+	reserved map[int64]time.Time
+	store    storage.SnapshotStore
+	dirty    storage.DirtyMarker
+}
+
+var eventManager *EventManager
+
+func init() {
+	eventManager = &EventManager{reserved: make(map[int64]time.Time)}
+}
+
+func GetEventManager() *EventManager {
+	return eventManager
+}
+
+// Record 追加一条触发记录，ID 为空时自动生成。
+func (em *EventManager) Record(event Event) Event {
+	if event.ID == "" {
+		event.ID = utils.NewRequestID("crisis")
+	}
+	if event.Time.IsZero() {
+		event.Time = clock.Now()
+	}
+
+	em.mu.Lock()
+	em.events = append(em.events, cloneEvent(event))
+	if overflow := len(em.events) - eventLimit; overflow > 0 {
+		em.events = append([]Event(nil), em.events[overflow:]...)
+	}
+	em.mu.Unlock()
+
+	em.markDirty()
+	return event
+}
+
+// SetAlerts 记下某次触发的通知结果。
+func (em *EventManager) SetAlerts(id string, alerts []AlertResult) {
+	em.mu.Lock()
+	found := false
+	for i := len(em.events) - 1; i >= 0; i-- {
+		if em.events[i].ID == id {
+			em.events[i].Alerts = append([]AlertResult(nil), alerts...)
+			found = true
+			break
+		}
+	}
+	em.mu.Unlock()
+
+	if found {
+		em.markDirty()
+	}
+}
+
+// Events 返回最近的触发记录，最新的在前。userID 为 0 表示全部用户，limit<=0 表示不限。
+func (em *EventManager) Events(userID int64, limit int) []Event {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+
+	result := make([]Event, 0)
+	for i := len(em.events) - 1; i >= 0; i-- {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		if userID != 0 && em.events[i].UserID != userID {
+			continue
+		}
+		result = append(result, cloneEvent(em.events[i]))
+	}
+	return result
+}
+
+// ReserveAlert 检查通知冷却并占用名额，冷却期内返回 false。检查和占用在同一把锁内完成。
+func (em *EventManager) ReserveAlert(userID int64, at time.Time) bool {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	last := em.reserved[userID]
+	if sent := em.lastAlertAtLocked(userID); sent.After(last) {
+		last = sent
+	}
+	if !last.IsZero() && at.Sub(last) < alertCooldown {
+		return false
+	}
+	em.reserved[userID] = at
+	return true
+}
+
+// lastAlertAtLocked 返回最近一次真正发出通知的时间，重启后冷却靠它延续。
+func (em *EventManager) lastAlertAtLocked(userID int64) time.Time {
+	for i := len(em.events) - 1; i >= 0; i-- {
+		if em.events[i].UserID != userID {
+			continue
+		}
+		for _, alert := range em.events[i].Alerts {
+			if !alert.Skipped {
+				return em.events[i].Time
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// DeleteUser 删除用户的全部触发记录，返回删除的条数。
+func (em *EventManager) DeleteUser(userID int64) int {
+	em.mu.Lock()
+	kept := make([]Event, 0, len(em.events))
+	for _, event := range em.events {
+		if event.UserID != userID {
+			kept = append(kept, event)
+		}
+	}
+	deleted := len(em.events) - len(kept)
+	em.events = kept
+	delete(em.reserved, userID)
+	em.mu.Unlock()
+
+	if deleted > 0 {
+		em.markDirty()
+	}
+	return deleted
+}
+
+func (em *EventManager) ConfigurePersistence(store storage.SnapshotStore, dirty storage.DirtyMarker) error {
+	em.mu.Lock()
+	em.store = store
+	em.dirty = dirty
+	em.mu.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	data, err := store.Load(EventsSnapshotName)
+	if err != nil {
+		return fmt.Errorf("load crisis events failed: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	var loaded []Event
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("unmarshal crisis events failed: %w", err)
+	}
+
+	em.mu.Lock()
+	em.events = loaded
+	em.mu.Unlock()
+	return nil
+}
+
+func (em *EventManager) Flush() error {
+	em.mu.RLock()
+	store := em.store
+	snapshot := make([]Event, len(em.events))
+	for i, event := range em.events {
+		snapshot[i] = cloneEvent(event)
+	}
+	em.mu.RUnlock()
+
+	if store == nil {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal crisis events failed: %w", err)
+	}
+	if err := store.Save(EventsSnapshotName, data); err != nil {
+		return fmt.Errorf("save crisis events failed: %w", err)
+	}
+	return nil
+}
+
+func (em *EventManager) markDirty() {
+	em.mu.RLock()
+	dirty := em.dirty
+	em.mu.RUnlock()
+
+	if dirty != nil {
+		dirty.MarkDirty(EventsFlushTaskName)
+	}
+}
+
+func cloneEvent(event Event) Event {
+	event.Assessment.Matches = append([]string(nil), event.Assessment.Matches...)
+	event.Alerts = append([]AlertResult(nil), event.Alerts...)
+	return event
+}
@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"project-yume/internal/aifunction"
+	"project-yume/internal/audit"
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/memory"
+	"project-yume/internal/service"
+	"project-yume/internal/state"
+	"project-yume/internal/usage"
+	"project-yume/internal/utils"
+)
+
+const moodCheckInComposeTimeout = 15 * time.Second
+
+// moodCheckInFallbacks 模型不可用时的关心，只问不劝。
+var moodCheckInFallbacks = map[string]string{
+	"难过": "这几天感觉你都不太开心，还好吗？$想说的话我都在",
+	"生气": "这几天好像总有事让你烦，还好吗？$想吐槽的话我听着",
+}
+
+// sendMoodCheckIn 用一条温和的关心代替本次的主动消息。
+func (ns *NaturalScheduler) sendMoodCheckIn(c *websocket.Conn, sessionID string, targetUserID int64, pattern memory.MoodPattern) error {
+	message := composeMoodCheckIn(sessionID, targetUserID, pattern, clock.Now())
+	if err := service.SendMsg(c, targetUserID, message); err != nil {
+		service.RecordMoodCheckIn(targetUserID, pattern, message, clock.Now(), "error")
+		return err
+	}
+
+	sentAt := clock.Now()
+	sm := state.GetManager()
+	sm.RecordAssistantTurn(sessionID, service.BuildAssistantTranscript(message), sentAt, true)
+	// 不切到 need_comfort：默认路由里没有处理该状态的处理器，用户回复会落到兜底的 "?"
+	sm.UpdateLastReplyMode(sessionID, "mood_checkin")
+	service.RecordMoodCheckIn(targetUserID, pattern, message, sentAt, "sent")
+	next := ns.RescheduleFrom(sessionID, sentAt)
+	utils.Infow("mood check-in sent",
+		utils.String("session_id", sessionID),
+		utils.String("emotion", pattern.Emotion),
+		utils.Int("days", pattern.Days),
+		utils.String("next", next.Format(time.RFC3339)),
+	)
+	return nil
+}
+
+// composeMoodCheckIn 请模型按角色设定和关系阶段写一句关心，失败时退回固定文案。
+func composeMoodCheckIn(sessionID string, userID int64, pattern memory.MoodPattern, now time.Time) string {
+	fallback, ok := moodCheckInFallbacks[pattern.Emotion]
+	if !ok {
+		fallback = moodCheckInFallbacks["难过"]
+	}
+	cfg := config.GetConfig()
+
+	relationship := ""
+	if stage := service.RelationshipStage(userID); stage != "" {
+		relationship = fmt.Sprintf("你们现在的关系：%s，关心的分寸要和关系相称。\n", service.RelationshipStageLabel(stage))
+	}
+	prompt := cfg.AiPrompt + `
+
+` + service.BuildTimeContext(now) + `
+
+` + relationship + `用户已经连续几天情绪不太好，你想主动问候一下。
+请用你的角色语气发一句温和的关心：不要提到你记录或统计了对方的情绪，不要说教、不要给建议，让对方愿意说就说、不想说也没关系。
+只输出要发给用户的话，一到两句，不要解释，可以用 $ 分段。`
+	ctx := audit.WithRequestID(usage.WithScope(context.Background(), sessionID, userID), fmt.Sprintf("mood-checkin-%d", now.Unix()))
+	ctx, cancel := context.WithTimeout(ctx, moodCheckInComposeTimeout)
+	defer cancel()
+
+	reply, err := aifunction.Queryai(ctx, config.AITaskProactive, prompt, fmt.Sprintf("最近 %d 天（%s 至 %s）用户多数时候：%s", pattern.Days, pattern.From, pattern.To, pattern.Emotion))
+	if err != nil {
+		utils.Warn("生成情绪关心文案失败，使用默认文案: %v", err)
+		return fallback
+	}
+	if reply = strings.TrimSpace(reply); reply == "" {
+		return fallback
+	}
+	return reply
+}
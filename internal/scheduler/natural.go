@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"project-yume/internal/config"
+	"project-yume/internal/memory"
 	"project-yume/internal/service"
 	"project-yume/internal/state"
 	"project-yume/internal/utils"
@@ -175,6 +176,12 @@ func (ns *NaturalScheduler) SelectMessage(sessionID string) string {
 		weights["question"] += 10 // 长时间未联系，增加问候
 	}
 
+	// 还不熟时不说想念之类的话
+	switch service.RelationshipStage(state.GetManager().GetUserID(sessionID)) {
+	case memory.AffinityStageStranger, memory.AffinityStageAcquaintance:
+		weights["emotional"] = 0
+	}
+
 	// 加权随机选择
 	messageType := ns.weightedRandomSelect(weights)
 	return ns.selectFromPool(messageType)
@@ -260,9 +267,20 @@ func (ns *NaturalScheduler) EnsureScheduled(sessionID string, now time.Time) tim
 	return ns.RescheduleFrom(sessionID, baseTime)
 }
 
+// stageIntervalFactors 关系越远主动找得越少。
+var stageIntervalFactors = map[string]float64{
+	memory.AffinityStageStranger:     2.0,
+	memory.AffinityStageAcquaintance: 1.4,
+	memory.AffinityStageFamiliar:     1.0,
+	memory.AffinityStageClose:        0.8,
+}
+
 func (ns *NaturalScheduler) GetNextIntervalForSession(sessionID string) time.Duration {
 	sm := state.GetManager()
 	interval := ns.GetNextInterval()
+	if factor, ok := stageIntervalFactors[service.RelationshipStage(sm.GetUserID(sessionID))]; ok {
+		interval = time.Duration(float64(interval) * factor)
+	}
 
 	switch sm.GetState(sessionID) {
 	case state.StateLongChat:
@@ -281,6 +299,21 @@ func (ns *NaturalScheduler) SendScheduledMessage(c *websocket.Conn, sessionID st
 		utils.Info("主动消息发送前检查未到时间, next=%s", nextAt.Format(time.RFC3339))
 		return nil
 	}
+	// 危机守护期间不发闲聊式的主动消息，也不发情绪关心
+	if until, guarded := state.GetManager().Guarded(sessionID); guarded {
+		next := ns.RescheduleFrom(sessionID, until)
+		utils.Info("会话处于守护状态，跳过主动消息，下一次主动触达时间: %s", next.Format(time.RFC3339))
+		return nil
+	}
+	if state.GetManager().ProactiveUnanswered(sessionID) {
+		service.RecordIgnoredProactive(targetUserID)
+	}
+	// 连续几天情绪低落时，这次改为问候一句；深夜不打扰
+	if now := time.Now(); !ns.isSleepHour(now.Hour()) {
+		if pattern, ok := service.DueMoodCheckIn(targetUserID, now); ok {
+			return ns.sendMoodCheckIn(c, sessionID, targetUserID, pattern)
+		}
+	}
 	message := ns.SelectMessage(sessionID)
 
 	// 根据消息类型设置状态
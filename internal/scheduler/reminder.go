@@ -0,0 +1,132 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"project-yume/internal/aifunction"
+	"project-yume/internal/audit"
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/metrics"
+	"project-yume/internal/reminder"
+	"project-yume/internal/service"
+	"project-yume/internal/state"
+	"project-yume/internal/usage"
+	"project-yume/internal/utils"
+)
+
+const (
+	defaultReminderSweepInterval = 15 * time.Second
+	// maxReminderLateness 停机等原因错过太久的提醒不再补发，避免半夜收到早上的提醒。
+	maxReminderLateness    = 2 * time.Hour
+	reminderComposeTimeout = 15 * time.Second
+)
+
+// ReminderScheduler 定期检查到期提醒，用角色的语气发给对应用户。
+type ReminderScheduler struct {
+	sweepInterval time.Duration
+}
+
+func NewReminderScheduler() *ReminderScheduler {
+	return &ReminderScheduler{sweepInterval: defaultReminderSweepInterval}
+}
+
+// Run 阻塞运行直到 ctx 结束。
+func (rs *ReminderScheduler) Run(ctx context.Context, c *websocket.Conn) {
+	ticker := time.NewTicker(rs.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			utils.Info("提醒调度已停止")
+			return
+		case <-ticker.C:
+			if !config.GetConfig().EnableReminders {
+				continue
+			}
+			rs.DeliverDue(ctx, c, clock.Now())
+		}
+	}
+}
+
+// DeliverDue 投递所有已到期的提醒。发送失败的提醒保留到下一轮重试。
+func (rs *ReminderScheduler) DeliverDue(ctx context.Context, c *websocket.Conn, now time.Time) {
+	location, _ := service.TimeContextLocation()
+	manager := reminder.GetManager()
+
+	for _, item := range manager.Due(now) {
+		if now.Sub(item.DueAt) > maxReminderLateness {
+			manager.MarkFired(item.UserID, item.ID, now, false, location)
+			recordReminderDelivery("missed")
+			utils.Warn("提醒已错过超过 %v，不再补发: id=%s due=%s", maxReminderLateness, item.ID, item.DueAt.Format(time.RFC3339))
+			continue
+		}
+
+		message := composeReminderMessage(ctx, item, now)
+		if _, err := service.SendMsgWithContext(ctx, c, item.UserID, message); err != nil {
+			recordReminderDelivery("error")
+			utils.Error("提醒发送失败: id=%s err=%v", item.ID, err)
+			continue
+		}
+
+		sentAt := clock.Now()
+		sessionID := reminderSessionID(item)
+		state.GetManager().RecordAssistantTurn(sessionID, service.BuildAssistantTranscript(message), sentAt, true)
+		state.GetManager().UpdateLastReplyMode(sessionID, "reminder")
+		manager.MarkFired(item.UserID, item.ID, sentAt, true, location)
+		recordReminderDelivery("delivered")
+		utils.Infow("reminder delivered",
+			utils.String("session_id", sessionID),
+			utils.String("reminder_id", item.ID),
+			utils.String("repeat", string(item.Repeat)),
+		)
+	}
+}
+
+// reminderSessionID 旧数据没有会话号，按私聊会话处理。
+func reminderSessionID(item reminder.Reminder) string {
+	if item.SessionID != "" {
+		return item.SessionID
+	}
+	return state.PrivateSessionID(item.UserID)
+}
+
+// composeReminderMessage 请模型按角色设定写一句提醒，失败时退回固定模板。
+func composeReminderMessage(ctx context.Context, item reminder.Reminder, now time.Time) string {
+	fallback := "到时间啦，记得" + item.Content
+	cfg := config.GetConfig()
+
+	prompt := cfg.AiPrompt + `
+
+` + service.BuildTimeContext(now) + `
+
+现在到了用户之前让你提醒的时间。请用你的角色语气提醒用户下面这件事。
+只输出要发给用户的话，一到两句，不要解释，可以用 $ 分段。`
+	composeCtx := audit.WithRequestID(usage.WithScope(ctx, reminderSessionID(item), item.UserID), item.ID)
+	composeCtx, cancel := context.WithTimeout(composeCtx, reminderComposeTimeout)
+	defer cancel()
+
+	reply, err := aifunction.Queryai(composeCtx, config.AITaskProactive, prompt, fmt.Sprintf("提醒内容：%s", item.Content))
+	if err != nil {
+		utils.Warn("生成提醒文案失败，使用默认模板: %v", err)
+		return fallback
+	}
+	if reply = strings.TrimSpace(reply); reply == "" {
+		return fallback
+	}
+	return reply
+}
+
+func recordReminderDelivery(result string) {
+	metrics.IncCounter(
+		"bot_reminders_total",
+		"Total reminder deliveries by result.",
+		map[string]string{"result": result},
+	)
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/memory"
+	"project-yume/internal/metrics"
+	"project-yume/internal/utils"
+)
+
+// relationshipStageLabels 关系阶段的中文名。
+var relationshipStageLabels = map[string]string{
+	memory.AffinityStageStranger:     "陌生",
+	memory.AffinityStageAcquaintance: "认识",
+	memory.AffinityStageFamiliar:     "熟悉",
+	memory.AffinityStageClose:        "亲近",
+}
+
+// relationshipStageGuides 各阶段的说话分寸，具体口吻仍以角色设定为准。
+var relationshipStageGuides = map[string]string{
+	memory.AffinityStageStranger:     "还不熟，礼貌客气、保持距离，不主动聊私事，也不要撒娇或说想念",
+	memory.AffinityStageAcquaintance: "有点熟了，可以放松一些、偶尔开个玩笑，但还不会吐露心事",
+	memory.AffinityStageFamiliar:     "已经是熟人，说话随意、情绪外露，可以吐槽和小小地闹别扭",
+	memory.AffinityStageClose:        "非常亲近，依赖对方，会主动关心、分享心事和表达想念",
+}
+
+// RelationshipStage 返回用户当前的关系阶段，关闭好感度时为空。
+func RelationshipStage(userID int64) string {
+	if !config.GetConfig().EnableAffinity || userID == 0 {
+		return ""
+	}
+	return memory.GetAffinityManager().Stage(userID)
+}
+
+// RelationshipStageLabel 返回关系阶段的中文名。
+func RelationshipStageLabel(stage string) string {
+	if label, ok := relationshipStageLabels[stage]; ok {
+		return label
+	}
+	return stage
+}
+
+// UpdateAffinity 按用户的一条消息更新好感度。
+func UpdateAffinity(userID int64, message, emotion, intention string) {
+	if !config.GetConfig().EnableAffinity {
+		return
+	}
+	recordAffinityChange(userID, memory.GetAffinityManager().RecordMessage(userID, message, emotion, intention, clock.Now()))
+}
+
+// RecordIgnoredProactive 上一条主动消息没等到回复。
+func RecordIgnoredProactive(userID int64) {
+	if !config.GetConfig().EnableAffinity {
+		return
+	}
+	recordAffinityChange(userID, memory.GetAffinityManager().RecordIgnoredProactive(userID, clock.Now()))
+}
+
+func recordAffinityChange(userID int64, change memory.AffinityChange) {
+	for _, reason := range change.Reasons {
+		metrics.IncCounter(
+			"bot_affinity_events_total",
+			"Total affinity score changes by reason.",
+			map[string]string{"reason": reason},
+		)
+	}
+	if change.Stage == "" || change.Stage == change.Previous {
+		return
+	}
+	metrics.IncCounter(
+		"bot_affinity_stage_changes_total",
+		"Total relationship stage changes by new stage.",
+		map[string]string{"stage": change.Stage},
+	)
+	utils.Infow("relationship stage changed",
+		utils.Int64("user_id", userID),
+		utils.String("from", change.Previous),
+		utils.String("to", change.Stage),
+		utils.Any("score", change.Score),
+	)
+}
+
+// formatRelationshipMemory 写出当前关系阶段和该阶段的说话分寸，并指向角色配置里对应的回复示例。
+func formatRelationshipMemory(stage string, score float64) string {
+	if stage == "" {
+		return ""
+	}
+
+	lines := []string{
+		fmt.Sprintf("当前和用户的关系：%s（好感 %.0f/100）", relationshipStageLabels[stage], score),
+		"分寸：" + relationshipStageGuides[stage],
+	}
+	if pool := config.GetCharacterConfig().StageResponsePool(stage); pool != "" {
+		lines = append(lines, fmt.Sprintf("口吻参考「%s时的回复示例」", pool))
+	}
+	return "【关系阶段】\n" + strings.Join(lines, "\n")
+}
@@ -1,12 +1,15 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"project-yume/internal/aifunction"
+	"project-yume/internal/audit"
 	"project-yume/internal/config"
 	"project-yume/internal/metrics"
 	"project-yume/internal/state"
@@ -20,6 +23,8 @@ type AnalysisMode string
 const (
 	AnalysisModeDefault  AnalysisMode = "default"
 	AnalysisModeLongChat AnalysisMode = "long_chat"
+	// AnalysisModeGuarded 危机守护期间，安全要求优先于角色设定。
+	AnalysisModeGuarded AnalysisMode = "guarded"
 )
 
 type ReplyMode string
@@ -37,6 +42,10 @@ type AnalysisInput struct {
 	Message       string
 	Conversation  []openai.ChatCompletionMessage
 	ReferenceTime time.Time
+	// OnReplyDelta 非空时以流式方式请求模型，visible_reply 一边生成一边回调。
+	OnReplyDelta func(delta string)
+	// Tools 非空时允许模型在给出结论前调用工具。
+	Tools aifunction.ToolExecutor
 }
 
 type MessageAnalysis struct {
@@ -51,6 +60,12 @@ type MessageAnalysis struct {
 	UserNeed         string    `json:"user_need"`
 	VisibleReply     string    `json:"visible_reply"`
 	Confidence       float64   `json:"confidence"`
+
+	// Outcome 结果来源：ok/repaired/reasked/reasked_repaired/fallback_reply/fallback_ai/fallback_parse。
+	Outcome string `json:"-"`
+
+	// ToolMessages 是本轮产生的工具调用与结果，调用方负责记入会话历史。
+	ToolMessages []openai.ChatCompletionMessage `json:"-"`
 }
 
 var (
@@ -99,7 +114,8 @@ var (
 )
 
 // AnalyzeMessage 单次调用模型，返回结构化分析与回复决策。
-func AnalyzeMessage(input AnalysisInput) (MessageAnalysis, error) {
+// ctx 被取消时直接返回 ctx 错误，不会退化为兜底回复。
+func AnalyzeMessage(ctx context.Context, input AnalysisInput) (MessageAnalysis, error) {
 	startedAt := time.Now()
 	defer func() {
 		metrics.ObserveDuration(
@@ -110,40 +126,164 @@ func AnalyzeMessage(input AnalysisInput) (MessageAnalysis, error) {
 		)
 	}()
 
-	prompt := buildAnalysisPrompt(input)
-	raw, err := aifunction.Queryai(prompt, buildAnalysisPayload(input))
+	deferReply := splitReplyRoute()
+	prompt := buildAnalysisPrompt(input, deferReply)
+	payload := buildAnalysisPayload(input)
+	var raw string
+	var toolMessages []openai.ChatCompletionMessage
+	var err error
+	if !deferReply && (input.OnReplyDelta != nil || input.Tools != nil) {
+		var onDelta aifunction.StreamHandler
+		if input.OnReplyDelta != nil {
+			extractor := newVisibleReplyExtractor()
+			onDelta = func(delta string) {
+				if text := extractor.Push(delta); text != "" {
+					input.OnReplyDelta(text)
+				}
+			}
+		}
+		raw, toolMessages, err = aifunction.QueryaiStructured(ctx, config.AITaskClassify, prompt, payload, analysisSchema, input.Tools, onDelta)
+	} else {
+		raw, _, err = aifunction.QueryaiStructured(ctx, config.AITaskClassify, prompt, payload, analysisSchema, nil, nil)
+	}
 	if err != nil {
+		if ctx.Err() != nil {
+			metrics.IncCounter(
+				"bot_ai_requests_total",
+				"Total AI requests by kind and result.",
+				map[string]string{"kind": "classify_reply", "mode": string(input.Mode), "result": "canceled"},
+			)
+			return MessageAnalysis{}, ctx.Err()
+		}
 		metrics.IncCounter(
 			"bot_ai_requests_total",
 			"Total AI requests by kind and result.",
 			map[string]string{"kind": "classify_reply", "mode": string(input.Mode), "result": "fallback_ai"},
 		)
 		utils.Warn("AnalyzeMessage fallback due to AI error: %v", err)
-		return fallbackAnalysis(input.Mode), nil
+		result := fallbackAnalysis(input.Mode)
+		result.Outcome = "fallback_ai"
+		result.ToolMessages = toolMessages
+		return result, nil
 	}
 
+	outcome := "ok"
 	result, err := parseMessageAnalysis(raw, input.Mode)
 	if err != nil {
+		if repaired, repairErr := repairMessageAnalysis(raw, input.Mode); repairErr == nil {
+			result, err, outcome = repaired, nil, "repaired"
+		}
+	}
+	if err != nil {
+		// 只重问一次，把校验错误附上；流式已下发的内容由调用方对照最终结果处理。
+		utils.Warn("AnalyzeMessage parse failed, re-asking once: %v", err)
+		reaskRaw, _, reaskErr := aifunction.QueryaiStructured(ctx, config.AITaskClassify, prompt, buildReaskPayload(payload, raw, err), analysisSchema, nil, nil)
+		if ctx.Err() != nil {
+			return MessageAnalysis{}, ctx.Err()
+		}
+		if reaskErr == nil {
+			if reasked, reaskParseErr := parseMessageAnalysis(reaskRaw, input.Mode); reaskParseErr == nil {
+				result, err, outcome = reasked, nil, "reasked"
+			} else if repaired, repairErr := repairMessageAnalysis(reaskRaw, input.Mode); repairErr == nil {
+				result, err, outcome = repaired, nil, "reasked_repaired"
+			} else {
+				raw, err = reaskRaw, reaskParseErr
+			}
+		}
+	}
+	if err != nil {
+		recordAnalysisParse(ctx, "fallback_parse", MessageAnalysis{}, err)
 		metrics.IncCounter(
 			"bot_ai_requests_total",
 			"Total AI requests by kind and result.",
 			map[string]string{"kind": "classify_reply", "mode": string(input.Mode), "result": "fallback_parse"},
 		)
 		utils.Warn("AnalyzeMessage fallback due to parse error: %v, raw=%q", err, raw)
-		return fallbackAnalysis(input.Mode), nil
+		result := fallbackAnalysis(input.Mode)
+		result.Outcome = "fallback_parse"
+		result.ToolMessages = toolMessages
+		return result, nil
+	}
+	recordAnalysisParse(ctx, outcome, result, nil)
+	result.ToolMessages = toolMessages
+
+	if deferReply && result.ReplyMode == ReplyModeFullReply {
+		reply, replyToolMessages, replyErr := aifunction.QueryaiWithTools(ctx, config.AITaskReply, buildReplyPrompt(input, result), payload, input.Tools, input.OnReplyDelta)
+		result.ToolMessages = replyToolMessages
+		switch {
+		case ctx.Err() != nil:
+			return MessageAnalysis{}, ctx.Err()
+		case replyErr != nil || strings.TrimSpace(reply) == "":
+			// 保留分类模型给出的草稿作为兜底。
+			outcome = "fallback_reply"
+			utils.Warn("AnalyzeMessage reply generation failed, use classifier draft: %v", replyErr)
+		default:
+			result.VisibleReply = strings.TrimSpace(reply)
+		}
 	}
 
 	metrics.IncCounter(
 		"bot_ai_requests_total",
 		"Total AI requests by kind and result.",
-		map[string]string{"kind": "classify_reply", "mode": string(input.Mode), "result": "ok"},
+		map[string]string{"kind": "classify_reply", "mode": string(input.Mode), "result": outcome},
 	)
+	result.Outcome = outcome
 	return result, nil
 }
 
-func buildAnalysisPrompt(input AnalysisInput) string {
+// recordAnalysisParse 把分析结果的解析情况记入审计，和同一请求下的 classify 调用对照查看。
+func recordAnalysisParse(ctx context.Context, outcome string, result MessageAnalysis, err error) {
+	record := audit.NewRecord(ctx, audit.KindParse, config.AITaskClassify)
+	record.Parse = &audit.Parse{Outcome: outcome}
+	if err != nil {
+		record.Parse.Error = err.Error()
+	} else if data, marshalErr := json.Marshal(result); marshalErr == nil {
+		record.Parse.Result = data
+	}
+	audit.GetManager().Write(record)
+}
+
+// splitReplyRoute 判断 classify 与 reply 是否指向不同配置。
+// 指向不同配置时先用分类模型做判断，需要完整回复时再用回复模型生成 visible_reply。
+func splitReplyRoute() bool {
+	classifyProfile, _ := config.GetAIRoute(config.AITaskClassify)
+	replyProfile, _ := config.GetAIRoute(config.AITaskReply)
+	return classifyProfile != replyProfile
+}
+
+// buildReplyPrompt 分开路由时给回复模型的提示，带上分类结果作为参考。
+func buildReplyPrompt(input AnalysisInput, analysis MessageAnalysis) string {
 	cfg := config.GetConfig()
-	baseRules := `
+	hints := []string{
+		"用户情绪：" + analysis.Emotion,
+		"用户意图：" + analysis.Intention,
+		"支持策略：" + analysis.SupportStrategy,
+	}
+	if analysis.Topic != "" {
+		hints = append(hints, "当前主题："+analysis.Topic)
+	}
+	if analysis.UserNeed != "" {
+		hints = append(hints, "用户需要："+analysis.UserNeed)
+	}
+
+	prompt := cfg.AiPrompt + `
+
+【本轮判断】
+` + strings.Join(hints, "\n") + `
+
+请根据上面的判断和对话内容直接回复用户。只输出给用户看的回复文本，不要输出 JSON，不要解释。`
+	if input.Mode == AnalysisModeGuarded {
+		prompt += "\n" + guardedReplyRules()
+	}
+	if input.Tools != nil && cfg.EnableAITools {
+		prompt += `
+需要查询长期记忆、记下用户的新信息、发图片、设置提醒、确认当前时间或切换对话状态时，可以先调用工具；回复里不要提到工具本身。`
+	}
+	return prompt
+}
+
+// defaultAnalysisRules 分析提示词中与场景无关的通用规则，后面接角色设定。
+const defaultAnalysisRules = `
 你是一个对话引擎的内部决策器。你需要同时完成：
 1. 分析用户当前说话方式与情绪
 2. 判断此刻是否该回复，以及回复强度
@@ -166,6 +306,7 @@ func buildAnalysisPrompt(input AnalysisInput) string {
 
 额外要求：
 - 所有字段都必须出现。
+- 按上面列出的字段顺序输出，visible_reply 放在最后。
 - 如果意图不明确，intention 选择 "想和对方聊天"。
 - 如果情感不明确，emotion 选择 "中性"。
 - 如果用户更像在继续表达自己、补充观点、并未明显把话头交给你，可以选择 no_reply 或 light_ack。
@@ -176,9 +317,55 @@ func buildAnalysisPrompt(input AnalysisInput) string {
 - 只返回单个 JSON 对象。
 
 角色与回复风格要求：
-` + cfg.AiPrompt + `
 `
 
+var analysisRulesOverride atomic.Pointer[string]
+
+// SetAnalysisRules 替换分析提示词的通用规则，传空字符串恢复内置版本。供评测工具对比不同版本。
+func SetAnalysisRules(rules string) {
+	if strings.TrimSpace(rules) == "" {
+		analysisRulesOverride.Store(nil)
+		return
+	}
+	analysisRulesOverride.Store(&rules)
+}
+
+// AnalysisRules 返回当前生效的通用规则。
+func AnalysisRules() string {
+	if rules := analysisRulesOverride.Load(); rules != nil {
+		return *rules
+	}
+	return defaultAnalysisRules
+}
+
+// buildAnalysisPrompt deferReply 为 true 时回复由回复模型另行生成，这里只要求草稿，也不提供工具。
+func buildAnalysisPrompt(input AnalysisInput, deferReply bool) string {
+	cfg := config.GetConfig()
+	baseRules := AnalysisRules() + cfg.AiPrompt + `
+`
+	if deferReply {
+		baseRules += `
+- full_reply 时 visible_reply 只需一句简短草稿，正式回复会另外生成。
+`
+	} else if input.Tools != nil && cfg.EnableAITools {
+		baseRules += `
+工具使用：
+- 需要查询长期记忆、记下用户的新信息、发图片、设置提醒、确认当前时间或切换对话状态时，可以先调用工具。
+- 拿到工具结果后，再按上面的要求输出 JSON；不要在 visible_reply 里提到工具本身。
+`
+	}
+
+	if input.Mode == AnalysisModeGuarded {
+		return baseRules + `
+当前场景：用户不久前流露过伤害自己或不想活下去的念头，对话处于守护状态。
+` + guardedReplyRules() + `
+- reply_mode 只能选 light_ack 或 full_reply，不要 no_reply；wanna_bye 返回 "想继续"；support_strategy 优先 comfort。
+
+输出示例：
+{"emotion":"难过","intention":"想和对方倾诉","wanna_bye":"想继续","reply_mode":"full_reply","reply_expectation":"high","turn_status":"handoff_to_ai","support_strategy":"comfort","topic":"最近很难熬","user_need":"被倾听和陪伴","confidence":0.8,"visible_reply":"谢谢你愿意告诉我。$现在身边有人陪着你吗？"}
+`
+	}
+
 	if input.Mode == AnalysisModeLongChat {
 		return baseRules + `
 当前场景：用户正在和 AI 进行长对话。
@@ -212,6 +399,15 @@ reply_mode 判断标准：
 `
 }
 
+// guardedReplyRules 守护状态下的回复要求，优先于角色设定和输出风格。
+func guardedReplyRules() string {
+	return `以下要求优先于角色设定和输出风格：
+- 语气认真、温和，不评判、不说教，不开玩笑，不撒娇、不调侃、不敷衍。
+- 不讨论、不描述任何伤害自己的方式、工具或细节，对方追问时温和地拒绝并把话题带回对方的感受。
+- 不承诺保密，不假装能替代专业帮助；合适时鼓励对方联系信任的人或求助热线：` + config.GetConfig().CrisisHotlines + `
+- 对方说正在伤害自己或处于危险中时，请对方立刻拨打 110 或 120，或马上告诉身边的人。`
+}
+
 func parseMessageAnalysis(raw string, mode AnalysisMode) (MessageAnalysis, error) {
 	jsonText, err := extractFirstJSONObject(raw)
 	if err != nil {
@@ -223,6 +419,15 @@ func parseMessageAnalysis(raw string, mode AnalysisMode) (MessageAnalysis, error
 		return MessageAnalysis{}, fmt.Errorf("unmarshal analysis json failed: %w", err)
 	}
 
+	trimMessageAnalysis(&result, mode)
+	if err := validateMessageAnalysis(result, mode); err != nil {
+		return MessageAnalysis{}, err
+	}
+
+	return result, nil
+}
+
+func trimMessageAnalysis(result *MessageAnalysis, mode AnalysisMode) {
 	result.Emotion = strings.TrimSpace(result.Emotion)
 	result.Intention = strings.TrimSpace(result.Intention)
 	result.WannaBye = strings.TrimSpace(result.WannaBye)
@@ -237,12 +442,6 @@ func parseMessageAnalysis(raw string, mode AnalysisMode) (MessageAnalysis, error
 	if mode != AnalysisModeLongChat && result.WannaBye == "" {
 		result.WannaBye = "想继续"
 	}
-
-	if err := validateMessageAnalysis(result, mode); err != nil {
-		return MessageAnalysis{}, err
-	}
-
-	return result, nil
 }
 
 func extractFirstJSONObject(raw string) (string, error) {
@@ -325,6 +524,10 @@ func fallbackAnalysis(mode AnalysisMode) MessageAnalysis {
 		VisibleReply:     "嗯。",
 		Confidence:       0.3,
 	}
+	if mode == AnalysisModeGuarded {
+		result.SupportStrategy = "comfort"
+		result.VisibleReply = "我在，你慢慢说。"
+	}
 	if mode == AnalysisModeLongChat {
 		return result
 	}
@@ -410,9 +613,19 @@ func formatRecentConversation(conversation []openai.ChatCompletionMessage) strin
 }
 
 func chatMessagePlainTextForAnalysis(msg openai.ChatCompletionMessage) string {
+	if msg.Role == openai.ChatMessageRoleTool {
+		return fmt.Sprintf("[%s 返回] %s", msg.Name, msg.Content)
+	}
 	if strings.TrimSpace(msg.Content) != "" {
 		return msg.Content
 	}
+	if len(msg.ToolCalls) > 0 {
+		calls := make([]string, 0, len(msg.ToolCalls))
+		for _, call := range msg.ToolCalls {
+			calls = append(calls, fmt.Sprintf("%s(%s)", call.Function.Name, call.Function.Arguments))
+		}
+		return "[调用工具] " + strings.Join(calls, "; ")
+	}
 	if len(msg.MultiContent) == 0 {
 		return ""
 	}
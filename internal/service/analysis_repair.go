@@ -0,0 +1,236 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"project-yume/internal/aifunction"
+)
+
+// analysisSchema 分析结果的 JSON schema，随 response_format 发给支持的服务端。
+var analysisSchema = &aifunction.ResponseSchema{
+	Name:   "message_analysis",
+	Schema: buildAnalysisSchema(),
+}
+
+func buildAnalysisSchema() json.RawMessage {
+	enum := func(values []string) map[string]any {
+		return map[string]any{"type": "string", "enum": values}
+	}
+	replyModes := make([]string, 0, len(validReplyModes))
+	for mode := range validReplyModes {
+		replyModes = append(replyModes, string(mode))
+	}
+	sort.Strings(replyModes)
+
+	properties := map[string]any{
+		"emotion":           enum(sortedKeys(validEmotions)),
+		"intention":         enum(sortedKeys(validIntentions)),
+		"wanna_bye":         enum(sortedKeys(validWannaBye)),
+		"reply_mode":        enum(replyModes),
+		"reply_expectation": enum(sortedKeys(validReplyExpectations)),
+		"turn_status":       enum(sortedKeys(validTurnStatus)),
+		"support_strategy":  enum(sortedKeys(validSupportStrategy)),
+		"topic":             map[string]any{"type": "string"},
+		"user_need":         map[string]any{"type": "string"},
+		"confidence":        map[string]any{"type": "number"},
+		"visible_reply":     map[string]any{"type": "string"},
+	}
+	// 与提示里的字段顺序一致，visible_reply 放最后便于流式提取。
+	required := []string{
+		"emotion", "intention", "wanna_bye", "reply_mode", "reply_expectation", "turn_status",
+		"support_strategy", "topic", "user_need", "confidence", "visible_reply",
+	}
+	data, err := json.Marshal(map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// repairMessageAnalysis 修复常见的格式问题后再解析：代码块、单引号、尾逗号、
+// 被截断的结尾，以及“开心的”这类接近合法取值的枚举。
+func repairMessageAnalysis(raw string, mode AnalysisMode) (MessageAnalysis, error) {
+	var result MessageAnalysis
+	if err := json.Unmarshal([]byte(repairJSONText(raw)), &result); err != nil {
+		return MessageAnalysis{}, fmt.Errorf("unmarshal repaired analysis json failed: %w", err)
+	}
+	trimMessageAnalysis(&result, mode)
+
+	result.Emotion = nearestEnum(result.Emotion, validEmotions)
+	result.Intention = nearestEnum(result.Intention, validIntentions)
+	result.WannaBye = nearestEnum(result.WannaBye, validWannaBye)
+	result.ReplyExpectation = nearestEnum(strings.ToLower(result.ReplyExpectation), validReplyExpectations)
+	result.TurnStatus = nearestEnum(normalizeEnumToken(result.TurnStatus), validTurnStatus)
+	result.SupportStrategy = nearestEnum(normalizeEnumToken(result.SupportStrategy), validSupportStrategy)
+	replyModes := make(map[string]struct{}, len(validReplyModes))
+	for replyMode := range validReplyModes {
+		replyModes[string(replyMode)] = struct{}{}
+	}
+	result.ReplyMode = ReplyMode(nearestEnum(normalizeEnumToken(string(result.ReplyMode)), replyModes))
+	if result.Confidence < 0 {
+		result.Confidence = 0
+	}
+	if result.Confidence > 1 {
+		result.Confidence = 1
+	}
+
+	if err := validateMessageAnalysis(result, mode); err != nil {
+		return MessageAnalysis{}, err
+	}
+	return result, nil
+}
+
+func normalizeEnumToken(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	return strings.NewReplacer("-", "_", " ", "_").Replace(value)
+}
+
+// nearestEnum 取值不合法时，找互相包含的合法取值；只有唯一的最长匹配才替换。
+func nearestEnum(value string, valid map[string]struct{}) string {
+	if _, ok := valid[value]; ok || value == "" {
+		return value
+	}
+	best := ""
+	ambiguous := false
+	for candidate := range valid {
+		if !strings.Contains(value, candidate) && !strings.Contains(candidate, value) {
+			continue
+		}
+		switch {
+		case len(candidate) > len(best):
+			best, ambiguous = candidate, false
+		case len(candidate) == len(best):
+			ambiguous = true
+		}
+	}
+	if best == "" || ambiguous {
+		return value
+	}
+	return best
+}
+
+// repairJSONText 提取第一个 JSON 对象并修正非标准写法。
+// 逐字符扫描，只改动字符串之外的部分；单引号字符串转成双引号字符串。
+func repairJSONText(raw string) string {
+	text := stripCodeFences(raw)
+	if start := strings.Index(text, "{"); start >= 0 {
+		text = text[start:]
+	}
+
+	var builder strings.Builder
+	var stack []byte
+	var quote rune
+	escaped := false
+	for _, r := range text {
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+				if quote == '\'' && r == '\'' {
+					// \' 在 JSON 里不合法，去掉反斜杠。
+					str := builder.String()
+					builder.Reset()
+					builder.WriteString(strings.TrimSuffix(str, `\`))
+				}
+				builder.WriteRune(r)
+			case r == '\\':
+				escaped = true
+				builder.WriteRune(r)
+			case r == quote:
+				quote = 0
+				builder.WriteByte('"')
+			case r == '"':
+				builder.WriteString(`\"`)
+			case r == '\n':
+				builder.WriteString(`\n`)
+			default:
+				builder.WriteRune(r)
+			}
+			continue
+		}
+
+		switch r {
+		case '"', '\'':
+			quote = r
+			builder.WriteByte('"')
+		case '{', '[':
+			stack = append(stack, byte(r))
+			builder.WriteRune(r)
+		case '}', ']':
+			dropTrailingComma(&builder)
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			builder.WriteRune(r)
+			if len(stack) == 0 {
+				return builder.String()
+			}
+		default:
+			builder.WriteRune(r)
+		}
+	}
+
+	// 输出被截断：补齐未闭合的字符串和括号。
+	if quote != 0 {
+		builder.WriteByte('"')
+	}
+	dropTrailingComma(&builder)
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] == '{' {
+			builder.WriteByte('}')
+		} else {
+			builder.WriteByte(']')
+		}
+	}
+	return builder.String()
+}
+
+func dropTrailingComma(builder *strings.Builder) {
+	current := builder.String()
+	trimmed := strings.TrimRight(current, " \t\r\n")
+	if strings.HasSuffix(trimmed, ",") {
+		builder.Reset()
+		builder.WriteString(strings.TrimSuffix(trimmed, ","))
+	}
+}
+
+func stripCodeFences(raw string) string {
+	lines := strings.Split(strings.TrimSpace(raw), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
+
+// buildReaskPayload 把上一次输出和校验错误附在原始输入后面，请模型重新输出。
+func buildReaskPayload(payload string, previous string, parseErr error) string {
+	return payload + `
+
+【上次输出】
+` + strings.TrimSpace(previous) + `
+
+【格式问题】
+` + parseErr.Error() + `
+请修正后重新输出完整的单个 JSON 对象，所有字段都要符合取值要求。`
+}
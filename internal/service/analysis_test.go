@@ -24,3 +24,29 @@ func TestParseMessageAnalysisRejectsVisibleReplyForNoReply(t *testing.T) {
 		t.Fatalf("expected parseMessageAnalysis to reject visible_reply when reply_mode=no_reply")
 	}
 }
+
+func TestRepairMessageAnalysis(t *testing.T) {
+	cases := map[string]string{
+		"code fence and trailing comma": "```json\n{\"emotion\":\"中性\",\"intention\":\"想和对方聊天\",\"wanna_bye\":\"想继续\",\"reply_mode\":\"full_reply\",\"reply_expectation\":\"high\",\"turn_status\":\"handoff_to_ai\",\"support_strategy\":\"continue_chat\",\"topic\":\"\",\"user_need\":\"\",\"confidence\":0.8,\"visible_reply\":\"好呀\",}\n```",
+		"single quotes":                 `{'emotion':'中性','intention':'想和对方聊天','wanna_bye':'想继续','reply_mode':'full_reply','reply_expectation':'high','turn_status':'handoff_to_ai','support_strategy':'continue_chat','topic':'','user_need':'','confidence':0.8,'visible_reply':'他说"好"'}`,
+		"enum near misses":              `{"emotion":"开心的","intention":"想和对方聊天","wanna_bye":"想继续","reply_mode":"Full-Reply","reply_expectation":"High","turn_status":"handoff_to_ai","support_strategy":"continue_chat","topic":"","user_need":"","confidence":1.2,"visible_reply":"好呀"}`,
+		"truncated tail":                `{"emotion":"中性","intention":"想和对方聊天","wanna_bye":"想继续","reply_mode":"full_reply","reply_expectation":"high","turn_status":"handoff_to_ai","support_strategy":"continue_chat","topic":"","user_need":"","confidence":0.8,"visible_reply":"好呀`,
+	}
+	for name, raw := range cases {
+		if _, err := parseMessageAnalysis(raw, AnalysisModeDefault); err == nil {
+			t.Fatalf("%s: strict parser should reject input", name)
+		}
+		result, err := repairMessageAnalysis(raw, AnalysisModeDefault)
+		if err != nil {
+			t.Fatalf("%s: repair failed: %v", name, err)
+		}
+		if result.ReplyMode != ReplyModeFullReply || result.VisibleReply == "" {
+			t.Fatalf("%s: unexpected result %+v", name, result)
+		}
+	}
+
+	result, _ := repairMessageAnalysis(cases["enum near misses"], AnalysisModeDefault)
+	if result.Emotion != "开心" || result.ReplyExpectation != "high" || result.Confidence != 1 {
+		t.Fatalf("enum near misses not normalized: %+v", result)
+	}
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"project-yume/internal/aifunction"
+	"project-yume/internal/audit"
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/memory"
+	"project-yume/internal/metrics"
+	"project-yume/internal/privacy"
+	"project-yume/internal/state"
+	"project-yume/internal/usage"
+	"project-yume/internal/utils"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	episodeSweepInterval  = time.Minute
+	episodeSummaryTimeout = 60 * time.Second
+	// episodeMaxMessages 一直没有空闲的长对话也按该条数切一段。
+	episodeMaxMessages   = 80
+	episodeMaxTranscript = 4000
+	episodeMaxSummary    = 120
+	episodeMaxTopics     = 3
+	episodeExcerptLength = 40
+)
+
+var episodeSummarySchema = &aifunction.ResponseSchema{
+	Name:   "episode_summary",
+	Schema: buildEpisodeSummarySchema(),
+}
+
+func buildEpisodeSummarySchema() json.RawMessage {
+	emotions := make([]string, 0, len(validEmotions))
+	for emotion := range validEmotions {
+		emotions = append(emotions, emotion)
+	}
+	sort.Strings(emotions)
+	data, err := json.Marshal(map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"summary": map[string]any{"type": "string"},
+			"topics":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"emotion": map[string]any{"type": "string", "enum": emotions},
+			"skip":    map[string]any{"type": "boolean"},
+		},
+		"required":             []string{"summary", "topics", "emotion", "skip"},
+		"additionalProperties": false,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// episodeSummary 模型返回的片段摘要。
+type episodeSummary struct {
+	Summary string   `json:"summary"`
+	Topics  []string `json:"topics"`
+	Emotion string   `json:"emotion"`
+	Skip    bool     `json:"skip"`
+}
+
+// EpisodeSummarizer 定期把空闲下来的私聊片段总结成情景记忆。
+type EpisodeSummarizer struct{}
+
+var episodeSummarizer = &EpisodeSummarizer{}
+
+func GetEpisodeSummarizer() *EpisodeSummarizer {
+	return episodeSummarizer
+}
+
+// Run 每分钟检查一次，直到 ctx 结束。开关关闭时不切分，游标保持不动。
+func (s *EpisodeSummarizer) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(episodeSweepInterval):
+		}
+		s.Sweep(ctx)
+	}
+}
+
+// Sweep 取出所有到期片段并逐个总结。
+func (s *EpisodeSummarizer) Sweep(ctx context.Context) {
+	cfg := config.GetConfig()
+	if !cfg.EnableEpisodicMemory {
+		return
+	}
+	idleGap := time.Duration(max(cfg.EpisodeIdleGapMin, 1)) * time.Minute
+	for _, segment := range state.GetManager().TakeEpisodeSegments(clock.Now(), idleGap, episodeMaxMessages) {
+		if ctx.Err() != nil {
+			return
+		}
+		s.summarize(ctx, segment)
+	}
+}
+
+func (s *EpisodeSummarizer) summarize(ctx context.Context, segment state.EpisodeSegment) {
+	userTurns := 0
+	for _, msg := range segment.Messages {
+		if msg.Role == openai.ChatMessageRoleUser {
+			userTurns++
+		}
+	}
+	if userTurns == 0 || userTurns < config.GetConfig().EpisodeMinUserTurns {
+		recordEpisodeResult("too_short", 0)
+		return
+	}
+
+	startedAt := time.Now()
+	callCtx, cancel := context.WithTimeout(ctx, episodeSummaryTimeout)
+	defer cancel()
+	callCtx = audit.WithRequestID(usage.WithScope(callCtx, segment.SessionID, segment.UserID), utils.NewRequestID("episode"))
+
+	episode := memory.Episode{
+		UserID:    segment.UserID,
+		SessionID: segment.SessionID,
+		StartedAt: segment.StartedAt,
+		EndedAt:   segment.EndedAt,
+	}
+	raw, _, err := aifunction.QueryaiStructured(callCtx, config.AITaskSummary, episodeSummaryPrompt, buildEpisodeTranscript(segment), episodeSummarySchema, nil, nil)
+	result := "ok"
+	if err != nil {
+		result = "fallback_ai"
+		utils.Warn("episode summary fallback to excerpt due to AI error: %v", err)
+	} else {
+		var summary episodeSummary
+		summary, err = parseEpisodeSummary(raw)
+		if err != nil {
+			result = "fallback_parse"
+			utils.Warn("episode summary fallback to excerpt due to parse error: %v, raw=%q", err, raw)
+		} else if summary.Skip {
+			result = "skipped"
+		}
+		recordEpisodeParse(callCtx, result, err)
+		episode.Summary, episode.Topics, episode.Emotion = summary.Summary, summary.Topics, summary.Emotion
+		episode.Source = memory.EpisodeSourceAI
+	}
+	recordEpisodeResult(result, time.Since(startedAt))
+
+	// 总结期间用户删除了数据
+	if privacy.GetTombstoneManager().Blocks(segment.UserID, segment.EndedAt) {
+		return
+	}
+	switch result {
+	case "skipped":
+		return
+	case "fallback_ai", "fallback_parse":
+		episode.Summary = episodeExcerpt(segment.Messages)
+		episode.Topics = nil
+		episode.Emotion = ""
+		episode.Source = memory.EpisodeSourceExcerpt
+	}
+	memory.GetEpisodeManager().AddEpisode(episode)
+}
+
+const episodeSummaryPrompt = `你是对话回忆记录员。把下面这段已经结束的聊天总结成一条日后能回想起来的记录，只返回 JSON。
+- summary：一两句话，不超过 60 个字，写清聊了什么、发生了什么、有没有约定或没说完的事；称呼对方为"用户"，称呼自己为"我"，不要用他、她等代词。
+- topics：1 到 3 个简短的话题词，如 考试、猫、加班。
+- emotion：用户在这段对话里的主要情绪。
+- skip：只是寒暄、测试或没有任何值得记住的内容时为 true，其余字段照常填写。`
+
+func buildEpisodeTranscript(segment state.EpisodeSegment) string {
+	location, _ := TimeContextLocation()
+	lines := make([]string, 0, len(segment.Messages)+1)
+	lines = append(lines, fmt.Sprintf("【对话时间】%s", segment.StartedAt.In(location).Format("2006-01-02 15:04")))
+	lines = append(lines, "【对话】")
+	for _, msg := range segment.Messages {
+		speaker := "用户"
+		if msg.Role == openai.ChatMessageRoleAssistant {
+			speaker = "我"
+		}
+		lines = append(lines, speaker+"："+normalizeMemoryText(state.MessagePlainText(msg)))
+	}
+
+	// 太长时保留开头两行和最近的对话
+	transcript := strings.Join(lines, "\n")
+	if runes := []rune(transcript); len(runes) > episodeMaxTranscript {
+		head := strings.Join(lines[:2], "\n")
+		transcript = head + "\n……\n" + string(runes[len(runes)-episodeMaxTranscript:])
+	}
+	return transcript
+}
+
+// parseEpisodeSummary 校验模型输出，summary 为空且未标记 skip 时视为失败。
+func parseEpisodeSummary(raw string) (episodeSummary, error) {
+	jsonText, err := extractFirstJSONObject(raw)
+	if err != nil {
+		return episodeSummary{}, err
+	}
+	var summary episodeSummary
+	if err := json.Unmarshal([]byte(jsonText), &summary); err != nil {
+		return episodeSummary{}, fmt.Errorf("invalid episode summary json: %w", err)
+	}
+	summary.Summary = truncateRunes(normalizeMemoryText(summary.Summary), episodeMaxSummary)
+	if summary.Summary == "" && !summary.Skip {
+		return episodeSummary{}, fmt.Errorf("empty episode summary")
+	}
+	if _, ok := validEmotions[summary.Emotion]; !ok {
+		summary.Emotion = ""
+	}
+	topics := make([]string, 0, episodeMaxTopics)
+	for _, topic := range summary.Topics {
+		if topic = shortText(cleanMemoryObject(topic), memoryExtractMaxStyle); topic != "" {
+			topics = append(topics, topic)
+		}
+		if len(topics) == episodeMaxTopics {
+			break
+		}
+	}
+	summary.Topics = topics
+	return summary, nil
+}
+
+// episodeExcerpt 模型不可用时用用户的第一句话兜底，保证这段对话至少留下痕迹。
+func episodeExcerpt(messages []openai.ChatCompletionMessage) string {
+	for _, msg := range messages {
+		if msg.Role == openai.ChatMessageRoleUser {
+			return "用户聊到：" + truncateRunes(normalizeMemoryText(state.MessagePlainText(msg)), episodeExcerptLength)
+		}
+	}
+	return ""
+}
+
+func truncateRunes(value string, limit int) string {
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+	return string(runes[:limit]) + "…"
+}
+
+func recordEpisodeResult(result string, elapsed time.Duration) {
+	metrics.IncCounter(
+		"bot_episode_summaries_total",
+		"Total episode summaries by result.",
+		map[string]string{"result": result},
+	)
+	if elapsed > 0 {
+		metrics.ObserveDuration(
+			"bot_episode_summary_duration_seconds",
+			"Episode summary latency.",
+			elapsed,
+			map[string]string{"result": result},
+		)
+	}
+}
+
+func recordEpisodeParse(ctx context.Context, outcome string, err error) {
+	record := audit.NewRecord(ctx, audit.KindParse, config.AITaskSummary)
+	record.Parse = &audit.Parse{Outcome: outcome}
+	if err != nil {
+		record.Parse.Error = err.Error()
+	}
+	audit.GetManager().Write(record)
+}
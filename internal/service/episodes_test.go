@@ -0,0 +1,102 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"project-yume/internal/memory"
+	"project-yume/internal/state"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestTakeEpisodeSegmentsSplitsOnIdleGap(t *testing.T) {
+	sm := state.GetManager()
+	sessionID := "private:episode-test"
+	sm.EnsureSession(sessionID, 4242, 0, 0)
+	defer sm.ResetSession(sessionID)
+
+	start := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+	sm.RecordUserTurn(sessionID, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "明天面试好紧张"}, start)
+	sm.RecordAssistantTurn(sessionID, "准备得怎么样了", start.Add(time.Minute), false)
+	// 处理器会在开头插入 system 提示，不应影响切分位置
+	sm.SetConversation(sessionID, append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "persona"}}, sm.GetConversation(sessionID)...))
+
+	if segments := sm.TakeEpisodeSegments(start.Add(10*time.Minute), 30*time.Minute, 80); len(segments) != 0 {
+		t.Fatalf("expected no segment before idle gap, got %+v", segments)
+	}
+	segments := sm.TakeEpisodeSegments(start.Add(time.Hour), 30*time.Minute, 80)
+	if len(segments) != 1 || len(segments[0].Messages) != 2 || !segments[0].StartedAt.Equal(start) {
+		t.Fatalf("unexpected segments: %+v", segments)
+	}
+	if segments := sm.TakeEpisodeSegments(start.Add(2*time.Hour), 30*time.Minute, 80); len(segments) != 0 {
+		t.Fatalf("segmented messages should not be taken twice, got %+v", segments)
+	}
+
+	next := start.Add(3 * time.Hour)
+	sm.RecordUserTurn(sessionID, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "面试过了"}, next)
+	segments = sm.TakeEpisodeSegments(next.Add(time.Hour), 30*time.Minute, 80)
+	if len(segments) != 1 || len(segments[0].Messages) != 1 || segments[0].Messages[0].Content != "面试过了" || !segments[0].StartedAt.Equal(next) {
+		t.Fatalf("unexpected second segment: %+v", segments)
+	}
+}
+
+func TestParseEpisodeSummary(t *testing.T) {
+	summary, err := parseEpisodeSummary(`{"summary":"用户说明天面试很紧张，我陪用户过了一遍自我介绍","topics":["面试","自我介绍","",  "紧张","加班"],"emotion":"难过","skip":false}`)
+	if err != nil {
+		t.Fatalf("parseEpisodeSummary returned error: %v", err)
+	}
+	if len(summary.Topics) != 3 || summary.Topics[2] != "紧张" || summary.Emotion != "难过" {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+
+	if _, err := parseEpisodeSummary(`{"summary":"","topics":[],"emotion":"中性","skip":false}`); err == nil {
+		t.Fatalf("expected error for empty summary")
+	}
+	if summary, err := parseEpisodeSummary(`{"summary":"","topics":[],"emotion":"未知","skip":true}`); err != nil || !summary.Skip || summary.Emotion != "" {
+		t.Fatalf("skip should be accepted without summary: %+v, %v", summary, err)
+	}
+}
+
+func TestFormatEpisodeMemory(t *testing.T) {
+	now := time.Date(2026, 3, 8, 12, 0, 0, 0, time.Local)
+	formatted := formatEpisodeMemory([]memory.Episode{
+		{Summary: "用户说面试很紧张", EndedAt: now.AddDate(0, 0, -7)},
+		{Summary: "用户养了新猫", EndedAt: now.Add(-24 * time.Hour)},
+	}, now)
+	if !strings.HasPrefix(formatted, "【过往片段】") || !strings.Contains(formatted, "（7天前）：用户说面试很紧张") || !strings.Contains(formatted, "（昨天）：用户养了新猫") {
+		t.Fatalf("unexpected episode memory: %q", formatted)
+	}
+	if formatEpisodeMemory(nil, now) != "" {
+		t.Fatalf("expected empty output without episodes")
+	}
+}
+
+func TestEpisodeSegmentKeepsImageTurns(t *testing.T) {
+	sm := state.GetManager()
+	sessionID := "private:episode-image-test"
+	sm.EnsureSession(sessionID, 4243, 0, 0)
+	defer sm.ResetSession(sessionID)
+
+	start := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+	sm.RecordUserTurn(sessionID, openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleUser,
+		MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "看我家的猫"},
+			{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "https://example.com/cat.jpg"}},
+		},
+	}, start)
+	sm.RecordAssistantTurn(sessionID, "好可爱", start.Add(time.Minute), false)
+
+	segments := sm.TakeEpisodeSegments(start.Add(time.Hour), 30*time.Minute, 80)
+	if len(segments) != 1 || len(segments[0].Messages) != 2 {
+		t.Fatalf("image turn should stay in the segment, got %+v", segments)
+	}
+	if transcript := buildEpisodeTranscript(segments[0]); !strings.Contains(transcript, "用户：看我家的猫 [图片]") {
+		t.Fatalf("transcript should include the image turn text, got %q", transcript)
+	}
+	if excerpt := episodeExcerpt(segments[0].Messages); excerpt != "用户聊到：看我家的猫 [图片]" {
+		t.Fatalf("unexpected excerpt: %q", excerpt)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/memory"
+	"project-yume/internal/metrics"
+	"project-yume/internal/utils"
+)
+
+const factMaintenanceInterval = time.Hour
+
+// FactMaintainer 定期衰减事实置信度，把过期和低于阈值的事实标为过时。
+type FactMaintainer struct{}
+
+var factMaintainer = &FactMaintainer{}
+
+func GetFactMaintainer() *FactMaintainer {
+	return factMaintainer
+}
+
+// Run 启动时先维护一次，之后每小时一次，直到 ctx 结束。
+func (m *FactMaintainer) Run(ctx context.Context) {
+	for {
+		m.Sweep()
+		select {
+		case <-ctx.Done():
+			return
+		case <-clock.After(factMaintenanceInterval):
+		}
+	}
+}
+
+// Sweep 维护一次全部用户的事实。
+func (m *FactMaintainer) Sweep() memory.FactMaintenance {
+	result := memory.GetFactManager().MaintainFacts(clock.Now(), config.GetConfig().FactMinConfidence)
+	for name, count := range map[string]int{"decayed": result.Decayed, "stale": result.Stale, "expired": result.Expired} {
+		if count > 0 {
+			metrics.AddCounter(
+				"bot_fact_maintenance_facts_total",
+				"Total facts changed by the periodic maintenance job.",
+				float64(count),
+				map[string]string{"result": name},
+			)
+		}
+	}
+	if result.Stale > 0 || result.Expired > 0 {
+		utils.Info("事实维护: 衰减 %d 条, 过时 %d 条, 过期 %d 条", result.Decayed, result.Stale, result.Expired)
+	}
+	return result
+}
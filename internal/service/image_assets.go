@@ -263,9 +263,6 @@ func normalizeImageAsset(asset ImageAsset) ImageAsset {
 	if asset.Tags == nil {
 		asset.Tags = []string{}
 	}
-	if !asset.Enabled {
-		asset.Enabled = asset.Enabled
-	}
 	return asset
 }
 
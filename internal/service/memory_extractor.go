@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"project-yume/internal/clock"
 	"project-yume/internal/memory"
 )
 
@@ -22,12 +23,12 @@ var (
 
 func UpdateLongTermMemory(sessionID string, userID int64, userMsg, botReply, emotion, intention string) {
 	memory.GetManager().RecordInteraction(userID, userMsg, botReply, emotion, intention)
-
-	profilePatch, factCandidates := ExtractStructuredMemory(userMsg)
-	memory.GetProfileManager().ApplyPatch(userID, profilePatch)
-	memory.GetFactManager().UpsertFacts(userID, sessionID, factCandidates)
+	RecordMood(userID, emotion, intention)
+	memory.GetFactManager().ReinforceMentions(userID, userMsg)
+	GetMemoryExtractor().Enqueue(sessionID, userID, userMsg)
 }
 
+// ExtractStructuredMemory 正则抽取器，只认以固定句式开头的消息；模型提取关闭或失败时使用。
 func ExtractStructuredMemory(message string) (memory.ProfilePatch, []memory.FactMemory) {
 	trimmed := normalizeMemoryText(message)
 	if trimmed == "" {
@@ -89,19 +90,19 @@ func ExtractStructuredMemory(message string) (memory.ProfilePatch, []memory.Fact
 
 	if match := firstMatch(currentPlanPattern, trimmed); match != "" {
 		object := cleanMemoryObject(match)
-		expiresAt := time.Now().Add(7 * 24 * time.Hour)
+		expiresAt := clock.Now().Add(7 * 24 * time.Hour)
 		facts = append(facts, newFact("current_plan", object, "用户最近在"+object, trimmed, &expiresAt, "recent", "plan"))
 	}
 
 	if match := firstMatch(todayPlanPattern, trimmed); match != "" {
 		object := cleanMemoryObject(match)
-		expiresAt := time.Now().Add(36 * time.Hour)
+		expiresAt := clock.Now().Add(36 * time.Hour)
 		facts = append(facts, newFact("today_plan", object, "用户今天要"+object, trimmed, &expiresAt, "today", "plan"))
 	}
 
 	if match := firstMatch(tomorrowPlanPattern, trimmed); match != "" {
 		object := cleanMemoryObject(match)
-		expiresAt := time.Now().Add(48 * time.Hour)
+		expiresAt := clock.Now().Add(48 * time.Hour)
 		facts = append(facts, newFact("tomorrow_plan", object, "用户明天要"+object, trimmed, &expiresAt, "tomorrow", "plan"))
 	}
 
@@ -0,0 +1,535 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"project-yume/internal/aifunction"
+	"project-yume/internal/audit"
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/memory"
+	"project-yume/internal/metrics"
+	"project-yume/internal/privacy"
+	"project-yume/internal/usage"
+	"project-yume/internal/utils"
+)
+
+const (
+	memoryExtractTimeout     = 60 * time.Second
+	memoryExtractKnownFacts  = 20
+	memoryExtractMaxObject   = 40
+	memoryExtractMaxStyle    = 12
+	memoryExtractMaxListItem = 5
+	memoryExtractMaxTTL      = 90 * 24 * time.Hour
+)
+
+// factSummaryPrefix 模型没给摘要时按谓词拼一句，与正则抽取器的写法一致。
+var factSummaryPrefix = map[string]string{
+	"likes":         "用户喜欢",
+	"dislikes":      "用户不喜欢",
+	"name":          "用户名字是",
+	"identity":      "用户身份是",
+	"location":      "用户住在",
+	"pet":           "用户养了",
+	"current_plan":  "用户最近在",
+	"today_plan":    "用户今天要",
+	"tomorrow_plan": "用户明天要",
+}
+
+var factPredicateTag = map[string]string{
+	"likes":         "preference",
+	"dislikes":      "preference",
+	"name":          "identity",
+	"identity":      "identity",
+	"location":      "location",
+	"pet":           "pet",
+	"current_plan":  "plan",
+	"today_plan":    "plan",
+	"tomorrow_plan": "plan",
+}
+
+var memoryExtractSchema = &aifunction.ResponseSchema{
+	Name:   "memory_extraction",
+	Schema: buildMemoryExtractSchema(),
+}
+
+func buildMemoryExtractSchema() json.RawMessage {
+	str := map[string]any{"type": "string"}
+	list := map[string]any{"type": "array", "items": str}
+	fact := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"predicate":        map[string]any{"type": "string", "enum": memory.FactPredicates()},
+			"object":           str,
+			"summary":          str,
+			"confidence":       map[string]any{"type": "number"},
+			"expires_in_hours": map[string]any{"type": "integer"},
+			"source":           str,
+		},
+		"required":             []string{"predicate", "object", "summary", "confidence", "expires_in_hours", "source"},
+		"additionalProperties": false,
+	}
+	profile := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"preferred_tone":     str,
+			"reply_style":        str,
+			"relationship_style": str,
+			"likes":              list,
+			"dislikes":           list,
+			"taboos":             list,
+		},
+		"required":             []string{"preferred_tone", "reply_style", "relationship_style", "likes", "dislikes", "taboos"},
+		"additionalProperties": false,
+	}
+	data, err := json.Marshal(map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"facts":   map[string]any{"type": "array", "items": fact},
+			"profile": profile,
+		},
+		"required":             []string{"facts", "profile"},
+		"additionalProperties": false,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// memoryExtraction 模型返回的提取结果。
+type memoryExtraction struct {
+	Facts []struct {
+		Predicate      string  `json:"predicate"`
+		Object         string  `json:"object"`
+		Summary        string  `json:"summary"`
+		Confidence     float64 `json:"confidence"`
+		ExpiresInHours int     `json:"expires_in_hours"`
+		Source         string  `json:"source"`
+	} `json:"facts"`
+	Profile struct {
+		PreferredTone     string   `json:"preferred_tone"`
+		ReplyStyle        string   `json:"reply_style"`
+		RelationshipStyle string   `json:"relationship_style"`
+		Likes             []string `json:"likes"`
+		Dislikes          []string `json:"dislikes"`
+		Taboos            []string `json:"taboos"`
+	} `json:"profile"`
+}
+
+type memoryBatch struct {
+	userID    int64
+	sessionID string
+	messages  []string
+	firstAt   time.Time
+}
+
+// MemoryExtractor 按用户攒批，在回复链路之外调用模型提取长期记忆。
+// Run 未启动或开关关闭时直接走正则抽取。
+type MemoryExtractor struct {
+	mu      sync.Mutex
+	pending map[int64]*memoryBatch
+	wake    chan struct{}
+	running atomic.Bool
+	// query 为空时调用 memory_extract 路由的模型。
+	query memoryQueryFunc
+}
+
+// memoryQueryFunc 请模型从一批消息中提取记忆，返回原始 JSON。
+type memoryQueryFunc func(ctx context.Context, userID int64, messages []string) (string, error)
+
+func queryMemoryExtract(ctx context.Context, userID int64, messages []string) (string, error) {
+	raw, _, err := aifunction.QueryaiStructured(ctx, config.AITaskMemoryExtract, buildMemoryExtractPrompt(userID), buildMemoryExtractPayload(messages), memoryExtractSchema, nil, nil)
+	return raw, err
+}
+
+var memoryExtractor = &MemoryExtractor{
+	pending: make(map[int64]*memoryBatch),
+	wake:    make(chan struct{}, 1),
+}
+
+func GetMemoryExtractor() *MemoryExtractor {
+	return memoryExtractor
+}
+
+// Enqueue 把一条用户消息加入该用户的批次，批次满了立即唤醒提取。
+func (e *MemoryExtractor) Enqueue(sessionID string, userID int64, message string) {
+	message = normalizeMemoryText(message)
+	if userID == 0 || message == "" {
+		return
+	}
+	cfg := config.GetConfig()
+	if !cfg.EnableLLMMemoryExtract || !e.running.Load() {
+		applyRegexMemory(sessionID, userID, message)
+		return
+	}
+
+	e.mu.Lock()
+	batch := e.pending[userID]
+	if batch == nil {
+		batch = &memoryBatch{userID: userID, firstAt: clock.Now()}
+		e.pending[userID] = batch
+	}
+	batch.sessionID = sessionID
+	batch.messages = append(batch.messages, message)
+	full := len(batch.messages) >= max(cfg.MemoryExtractBatchSize, 1)
+	e.mu.Unlock()
+
+	if full {
+		e.signal()
+	}
+}
+
+// Run 处理到期的批次，直到 ctx 结束。退出时剩余批次交给 Drain。
+func (e *MemoryExtractor) Run(ctx context.Context) {
+	e.running.Store(true)
+	defer e.running.Store(false)
+
+	for {
+		var timer <-chan time.Time
+		if delay, ok := e.nextDue(clock.Now()); ok {
+			timer = clock.After(delay)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.wake:
+		case <-timer:
+		}
+		for _, batch := range e.takeDue(clock.Now(), false) {
+			e.process(ctx, batch)
+		}
+	}
+}
+
+// Drain 用正则处理所有未提取的批次，退出前调用，避免丢失已入队的消息。
+func (e *MemoryExtractor) Drain() {
+	for _, batch := range e.takeDue(clock.Now(), true) {
+		if forgottenBatch(batch) {
+			continue
+		}
+		for _, message := range batch.messages {
+			applyRegexMemory(batch.sessionID, batch.userID, message)
+		}
+	}
+}
+
+func (e *MemoryExtractor) signal() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (e *MemoryExtractor) batchLimits() (int, time.Duration) {
+	cfg := config.GetConfig()
+	wait := time.Duration(cfg.MemoryExtractBatchWaitSec) * time.Second
+	if wait <= 0 {
+		wait = time.Second
+	}
+	return max(cfg.MemoryExtractBatchSize, 1), wait
+}
+
+func (e *MemoryExtractor) nextDue(now time.Time) (time.Duration, bool) {
+	size, wait := e.batchLimits()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var earliest time.Time
+	for _, batch := range e.pending {
+		if len(batch.messages) >= size {
+			return 0, true
+		}
+		if due := batch.firstAt.Add(wait); earliest.IsZero() || due.Before(earliest) {
+			earliest = due
+		}
+	}
+	if earliest.IsZero() {
+		return 0, false
+	}
+	return max(earliest.Sub(now), 0), true
+}
+
+func (e *MemoryExtractor) takeDue(now time.Time, all bool) []*memoryBatch {
+	size, wait := e.batchLimits()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var due []*memoryBatch
+	for userID, batch := range e.pending {
+		if all || len(batch.messages) >= size || !now.Before(batch.firstAt.Add(wait)) {
+			due = append(due, batch)
+			delete(e.pending, userID)
+		}
+	}
+	return due
+}
+
+// process 调用模型提取一批消息，失败时逐条退回正则。
+func (e *MemoryExtractor) process(ctx context.Context, batch *memoryBatch) {
+	if forgottenBatch(batch) {
+		return
+	}
+	startedAt := time.Now()
+	callCtx, cancel := context.WithTimeout(ctx, memoryExtractTimeout)
+	defer cancel()
+	callCtx = audit.WithRequestID(usage.WithScope(callCtx, batch.sessionID, batch.userID), utils.NewRequestID("memx"))
+
+	query := e.query
+	if query == nil {
+		query = queryMemoryExtract
+	}
+	raw, err := query(callCtx, batch.userID, batch.messages)
+	result := "ok"
+	var patch memory.ProfilePatch
+	var facts []memory.FactMemory
+	if err != nil {
+		result = "fallback_ai"
+		utils.Warn("memory extraction fallback to regex due to AI error: %v", err)
+	} else {
+		var rejected int
+		patch, facts, rejected, err = parseMemoryExtraction(raw, batch.messages, clock.Now())
+		if err != nil {
+			result = "fallback_parse"
+			utils.Warn("memory extraction fallback to regex due to parse error: %v, raw=%q", err, raw)
+		}
+		recordMemoryExtractParse(callCtx, result, err)
+		if rejected > 0 {
+			metrics.AddCounter(
+				"bot_memory_extract_candidates_total",
+				"Total memory candidates returned by the extractor, by validation result.",
+				float64(rejected),
+				map[string]string{"result": "rejected"},
+			)
+		}
+	}
+	// 模型调用期间用户可能确认了删除数据，写入前再查一次
+	if forgottenBatch(batch) {
+		return
+	}
+	metrics.IncCounter(
+		"bot_memory_extract_total",
+		"Total memory extraction batches by result.",
+		map[string]string{"result": result},
+	)
+	metrics.ObserveDuration(
+		"bot_memory_extract_duration_seconds",
+		"Memory extraction batch latency.",
+		time.Since(startedAt),
+		map[string]string{"result": result},
+	)
+
+	if result != "ok" {
+		for _, message := range batch.messages {
+			applyRegexMemory(batch.sessionID, batch.userID, message)
+		}
+		return
+	}
+	if len(facts) > 0 {
+		metrics.AddCounter(
+			"bot_memory_extract_candidates_total",
+			"Total memory candidates returned by the extractor, by validation result.",
+			float64(len(facts)),
+			map[string]string{"result": "accepted"},
+		)
+	}
+	memory.GetProfileManager().ApplyPatch(batch.userID, patch)
+	memory.GetFactManager().UpsertFacts(batch.userID, batch.sessionID, facts)
+}
+
+// forgottenBatch 批次在用户删除数据前入队时整批丢弃。
+func forgottenBatch(batch *memoryBatch) bool {
+	if !privacy.GetTombstoneManager().Blocks(batch.userID, batch.firstAt) {
+		return false
+	}
+	metrics.IncCounter(
+		"bot_memory_extract_total",
+		"Total memory extraction batches by result.",
+		map[string]string{"result": "forgotten"},
+	)
+	return true
+}
+
+func applyRegexMemory(sessionID string, userID int64, message string) {
+	patch, facts := ExtractStructuredMemory(message)
+	memory.GetProfileManager().ApplyPatch(userID, patch)
+	memory.GetFactManager().UpsertFacts(userID, sessionID, facts)
+}
+
+func buildMemoryExtractPrompt(userID int64) string {
+	var builder strings.Builder
+	builder.WriteString(`你是长期记忆提取器。从用户最近的几条消息里找出值得长期记住的信息，只返回 JSON。
+
+facts：关于用户本人的事实，每条一个谓词：
+- likes / dislikes：喜欢、不喜欢的事物
+- name：名字或希望被怎么称呼
+- identity：身份、职业、学校、年龄段等
+- location：常住地
+- pet：养的宠物
+- current_plan：最近一段时间在做的事
+- today_plan / tomorrow_plan：今天、明天要做的事
+要求：
+- object 用简短名词短语，不超过 20 个字，不要带"我"。
+- summary 以"用户"开头的一句话。
+- confidence 0 到 1：明确陈述 0.8 以上，推测 0.5 左右，玩笑、假设、转述别人的事不要提取。
+- expires_in_hours：会过时的事实填有效小时数，长期有效填 0。
+- source 填出处那条消息的原文。
+- 已知信息里已有且没有变化的不用重复；信息变了就按新的写。
+
+profile：用户对聊天方式的要求，只在用户明确提出时填写，否则留空：
+- preferred_tone：希望的语气，如 温柔、直接
+- reply_style：希望的回复形式，如 简短
+- relationship_style：希望的相处方式，如 朋友式
+- likes / dislikes：与 facts 一致的喜好
+- taboos：用户明确不希望再出现的话题或说法
+
+没有可提取的内容时返回 {"facts":[],"profile":{"preferred_tone":"","reply_style":"","relationship_style":"","likes":[],"dislikes":[],"taboos":[]}}。
+`)
+
+	known := memory.GetFactManager().FindRelevantFacts(userID, "", memoryExtractKnownFacts)
+	if len(known) > 0 {
+		builder.WriteString("\n已知信息：\n")
+		for _, fact := range known {
+			builder.WriteString(fmt.Sprintf("- %s: %s\n", fact.Predicate, fact.Object))
+		}
+	}
+	if pending := memory.GetFactManager().PendingFacts(userID, memoryExtractKnownFacts); len(pending) > 0 {
+		builder.WriteString("\n待确认信息（用户确认时按确认后的值写出，confidence 0.9；否认时写出正确的值）：\n")
+		for _, fact := range pending {
+			builder.WriteString(fmt.Sprintf("- %s: %s\n", fact.Predicate, fact.Object))
+		}
+	}
+	return builder.String()
+}
+
+func buildMemoryExtractPayload(messages []string) string {
+	var builder strings.Builder
+	builder.WriteString("【用户消息】\n")
+	for index, message := range messages {
+		builder.WriteString(fmt.Sprintf("%d. %s\n", index+1, message))
+	}
+	return builder.String()
+}
+
+// parseMemoryExtraction 校验模型输出：谓词须在白名单内，置信度不足或字段过长的候选丢弃。
+// 返回被丢弃的候选数，整体不是合法 JSON 时返回错误。
+func parseMemoryExtraction(raw string, messages []string, now time.Time) (memory.ProfilePatch, []memory.FactMemory, int, error) {
+	jsonText, err := extractFirstJSONObject(raw)
+	if err != nil {
+		return memory.ProfilePatch{}, nil, 0, err
+	}
+	var extraction memoryExtraction
+	if err := json.Unmarshal([]byte(jsonText), &extraction); err != nil {
+		return memory.ProfilePatch{}, nil, 0, fmt.Errorf("invalid memory extraction json: %w", err)
+	}
+
+	minConfidence := config.GetConfig().MemoryExtractMinConfidence
+	patch := memory.ProfilePatch{
+		PreferredTone:     shortText(extraction.Profile.PreferredTone, memoryExtractMaxStyle),
+		ReplyStyle:        shortText(extraction.Profile.ReplyStyle, memoryExtractMaxStyle),
+		RelationshipStyle: shortText(extraction.Profile.RelationshipStyle, memoryExtractMaxStyle),
+		Likes:             shortList(extraction.Profile.Likes),
+		Dislikes:          shortList(extraction.Profile.Dislikes),
+		Taboos:            shortList(extraction.Profile.Taboos),
+	}
+
+	facts := make([]memory.FactMemory, 0, len(extraction.Facts))
+	rejected := 0
+	for _, candidate := range extraction.Facts {
+		predicate := strings.TrimSpace(candidate.Predicate)
+		object := cleanMemoryObject(candidate.Object)
+		if !memory.IsKnownFactPredicate(predicate) || object == "" || len([]rune(object)) > memoryExtractMaxObject {
+			rejected++
+			continue
+		}
+		if candidate.Confidence <= 0 || candidate.Confidence < minConfidence {
+			rejected++
+			continue
+		}
+
+		summary := strings.TrimSpace(candidate.Summary)
+		if summary == "" {
+			summary = factSummaryPrefix[predicate] + object
+		}
+		var expiresAt *time.Time
+		if ttl, ok := factTTL(predicate, candidate.ExpiresInHours); ok {
+			value := now.Add(ttl)
+			expiresAt = &value
+		}
+		facts = append(facts, memory.FactMemory{
+			Predicate:     predicate,
+			Object:        object,
+			Summary:       summary,
+			Tags:          []string{factPredicateTag[predicate], "llm"},
+			Confidence:    min(candidate.Confidence, 1),
+			SourceMessage: factSource(candidate.Source, messages),
+			Status:        memory.FactStatusActive,
+			ExpiresAt:     expiresAt,
+		})
+
+		switch predicate {
+		case "likes":
+			patch.Likes = append(patch.Likes, object)
+		case "dislikes":
+			patch.Dislikes = append(patch.Dislikes, object)
+		}
+	}
+	return patch, facts, rejected, nil
+}
+
+// factTTL 模型给的有效期优先，没给时用谓词默认值，上限 90 天。
+func factTTL(predicate string, hours int) (time.Duration, bool) {
+	if hours > 0 {
+		return min(time.Duration(hours)*time.Hour, memoryExtractMaxTTL), true
+	}
+	return memory.FactPredicateTTL(predicate)
+}
+
+// factSource 出处须是本批消息之一，否则用整批消息。
+func factSource(source string, messages []string) string {
+	source = strings.TrimSpace(source)
+	if source != "" {
+		for _, message := range messages {
+			if strings.Contains(message, source) {
+				return message
+			}
+		}
+	}
+	return strings.Join(messages, " / ")
+}
+
+func shortText(value string, limit int) string {
+	value = strings.TrimSpace(value)
+	if len([]rune(value)) > limit {
+		return ""
+	}
+	return value
+}
+
+func shortList(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = shortText(cleanMemoryObject(value), memoryExtractMaxObject); value != "" {
+			result = append(result, value)
+		}
+		if len(result) == memoryExtractMaxListItem {
+			break
+		}
+	}
+	return result
+}
+
+func recordMemoryExtractParse(ctx context.Context, outcome string, err error) {
+	record := audit.NewRecord(ctx, audit.KindParse, config.AITaskMemoryExtract)
+	record.Parse = &audit.Parse{Outcome: outcome}
+	if err != nil {
+		record.Parse.Error = err.Error()
+	}
+	audit.GetManager().Write(record)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/memory"
+	"project-yume/internal/privacy"
+)
+
+func TestParseMemoryExtractionValidatesCandidates(t *testing.T) {
+	raw := `{"facts":[
+		{"predicate":"likes","object":"猫","summary":"","confidence":0.9,"expires_in_hours":0,"source":"猫是我最喜欢的动物"},
+		{"predicate":"tomorrow_plan","object":"去医院复查","summary":"用户明天要去医院复查","confidence":0.8,"expires_in_hours":0,"source":"明天"},
+		{"predicate":"hobby","object":"钓鱼","summary":"用户爱钓鱼","confidence":0.9,"expires_in_hours":0,"source":""},
+		{"predicate":"location","object":"上海","summary":"用户住在上海","confidence":0.3,"expires_in_hours":0,"source":""}
+	],"profile":{"preferred_tone":"温柔","reply_style":"","relationship_style":"","likes":[],"dislikes":[],"taboos":["别提前任"]}}`
+	messages := []string{"其实猫是我最喜欢的动物", "明天还得去医院复查"}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	patch, facts, rejected, err := parseMemoryExtraction(raw, messages, now)
+	if err != nil {
+		t.Fatalf("parseMemoryExtraction returned error: %v", err)
+	}
+	if rejected != 2 || len(facts) != 2 {
+		t.Fatalf("expected 2 accepted and 2 rejected, got %d/%d: %+v", len(facts), rejected, facts)
+	}
+	if facts[0].Summary != "用户喜欢猫" || facts[0].SourceMessage != messages[0] || facts[0].ExpiresAt != nil {
+		t.Fatalf("unexpected likes fact: %+v", facts[0])
+	}
+	if facts[1].ExpiresAt == nil || !facts[1].ExpiresAt.Equal(now.Add(48*time.Hour)) {
+		t.Fatalf("tomorrow_plan should use the default ttl: %+v", facts[1].ExpiresAt)
+	}
+	if len(patch.Likes) != 1 || patch.Likes[0] != "猫" || patch.PreferredTone != "温柔" || len(patch.Taboos) != 1 {
+		t.Fatalf("unexpected profile patch: %+v", patch)
+	}
+
+	if _, _, _, err := parseMemoryExtraction("抱歉，我无法提取", messages, now); err == nil {
+		t.Fatalf("expected error for non-json output")
+	}
+}
+
+func TestProcessDropsBatchForgottenDuringExtraction(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	t.Cleanup(func() { *cfg = previous })
+	// 提取会写审计记录，放进临时目录
+	cfg.DataDir = t.TempDir()
+
+	cases := []struct {
+		name   string
+		userID int64
+		raw    string
+		err    error
+	}{
+		{name: "model result", userID: 45101, raw: `{"facts":[{"predicate":"likes","object":"猫","summary":"用户喜欢猫","confidence":0.9,"expires_in_hours":0,"source":"我喜欢猫"}],"profile":{"preferred_tone":"温柔","reply_style":"","relationship_style":"","likes":["猫"],"dislikes":[],"taboos":[]}}`},
+		{name: "regex fallback", userID: 45102, err: errors.New("timeout")},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				memory.GetFactManager().DeleteUserFacts(tc.userID)
+				memory.GetProfileManager().DeleteProfile(tc.userID)
+			})
+			extractor := &MemoryExtractor{
+				pending: make(map[int64]*memoryBatch),
+				wake:    make(chan struct{}, 1),
+				// 模型还在提取时，用户确认了删除数据
+				query: func(ctx context.Context, userID int64, messages []string) (string, error) {
+					privacy.GetTombstoneManager().Record(userID, privacy.RequestedByUser, clock.Now())
+					return tc.raw, tc.err
+				},
+			}
+			batch := &memoryBatch{sessionID: "private:forgotten", userID: tc.userID, messages: []string{"我喜欢猫"}, firstAt: clock.Now().Add(-time.Minute)}
+			extractor.process(context.Background(), batch)
+
+			if facts := memory.GetFactManager().ListFacts(tc.userID); len(facts) != 0 {
+				t.Fatalf("forgotten batch should not write facts, got %+v", facts)
+			}
+			if profile := memory.GetProfileManager().GetProfile(tc.userID); len(profile.Likes) != 0 || profile.PreferredTone != "" {
+				t.Fatalf("forgotten batch should not write the profile, got %+v", profile)
+			}
+		})
+	}
+}
@@ -2,26 +2,39 @@ package service
 
 import (
 	"fmt"
+	"math"
 	"strings"
+	"time"
 
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
 	"project-yume/internal/memory"
 	"project-yume/internal/state"
 )
 
+// promptPendingFacts 提示词里最多带几条待确认的事实，多了模型会一次问一串。
+const promptPendingFacts = 1
+
 type PromptMemory struct {
 	ShortTermSummary string
 	ActiveTopics     []string
 	Profile          memory.UserProfile
 	Facts            []memory.FactMemory
-	EmotionalPattern string
-	RecentEmotions   []string
+	FactChanges      []memory.FactTransition
+	PendingFacts     []memory.FactMemory
+	Episodes         []memory.Episode
+	// RelationshipStage 为空表示关闭了好感度。
+	RelationshipStage string
+	AffinityScore     float64
+	EmotionalPattern  string
+	RecentEmotions    []string
 }
 
 func BuildPromptMemory(userID int64, sessionID, currentMessage string) PromptMemory {
 	stateManager := state.GetManager()
 	emotionalManager := memory.GetManager()
 
-	return PromptMemory{
+	promptMemory := PromptMemory{
 		ShortTermSummary: stateManager.GetConversationSummary(sessionID),
 		ActiveTopics:     stateManager.GetActiveTopics(sessionID),
 		Profile:          memory.GetProfileManager().GetProfile(userID),
@@ -29,6 +42,17 @@ func BuildPromptMemory(userID int64, sessionID, currentMessage string) PromptMem
 		EmotionalPattern: emotionalManager.GetConversationPattern(userID),
 		RecentEmotions:   emotionalManager.GetRecentEmotions(userID, 5),
 	}
+	if stage := RelationshipStage(userID); stage != "" {
+		promptMemory.RelationshipStage = stage
+		promptMemory.AffinityScore = memory.GetAffinityManager().Score(userID)
+	}
+	facts := memory.GetFactManager()
+	promptMemory.FactChanges = facts.RecentTransitions(userID, currentMessage, promptMemory.Facts)
+	promptMemory.PendingFacts = facts.PendingFacts(userID, promptPendingFacts)
+	if cfg := config.GetConfig(); cfg.EnableEpisodicMemory {
+		promptMemory.Episodes = memory.GetEpisodeManager().FindRelevantEpisodes(userID, currentMessage, cfg.EpisodePromptLimit)
+	}
+	return promptMemory
 }
 
 func FormatPromptMemory(promptMemory PromptMemory) string {
@@ -38,14 +62,26 @@ func FormatPromptMemory(promptMemory PromptMemory) string {
 		parts = append(parts, shortTerm)
 	}
 
+	if relationship := formatRelationshipMemory(promptMemory.RelationshipStage, promptMemory.AffinityScore); relationship != "" {
+		parts = append(parts, relationship)
+	}
+
 	if profile := formatProfileMemory(promptMemory.Profile); profile != "" {
 		parts = append(parts, profile)
 	}
 
-	if facts := formatFactMemory(promptMemory.Facts); facts != "" {
+	if facts := formatFactMemory(promptMemory.Facts, promptMemory.FactChanges); facts != "" {
 		parts = append(parts, facts)
 	}
 
+	if pending := formatPendingFacts(promptMemory.PendingFacts); pending != "" {
+		parts = append(parts, pending)
+	}
+
+	if episodes := formatEpisodeMemory(promptMemory.Episodes, clock.Now()); episodes != "" {
+		parts = append(parts, episodes)
+	}
+
 	if emotional := BuildEmotionalContext(promptMemory.EmotionalPattern, promptMemory.RecentEmotions); emotional != "" {
 		parts = append(parts, emotional)
 	}
@@ -93,15 +129,71 @@ func formatProfileMemory(profile memory.UserProfile) string {
 	return "【长期偏好】\n" + strings.Join(lines, "\n")
 }
 
-func formatFactMemory(facts []memory.FactMemory) string {
-	if len(facts) == 0 {
+// formatFactMemory 先列当前事实，再列相关的变化，让模型能说出"你不是搬去北京了吗"。
+func formatFactMemory(facts []memory.FactMemory, changes []memory.FactTransition) string {
+	if len(facts) == 0 && len(changes) == 0 {
 		return ""
 	}
 
-	lines := make([]string, 0, len(facts))
+	lines := make([]string, 0, len(facts)+len(changes))
 	for _, fact := range facts {
 		lines = append(lines, fmt.Sprintf("- %s", fact.Summary))
 	}
+	location, _ := TimeContextLocation()
+	for _, change := range changes {
+		lines = append(lines, fmt.Sprintf("- 以前：%s；%s 起：%s", change.From.Summary, change.At.In(location).Format("2006-01-02"), change.To.Summary))
+	}
 
 	return "【事实记忆】\n" + strings.Join(lines, "\n")
 }
+
+// formatPendingFacts 与已知信息冲突但没把握的说法，交给模型找机会问清楚。
+func formatPendingFacts(pending []memory.FactMemory) string {
+	if len(pending) == 0 {
+		return ""
+	}
+
+	lines := make([]string, 0, len(pending))
+	for _, fact := range pending {
+		line := "- 用户似乎" + strings.TrimPrefix(fact.Summary, "用户")
+		if current, ok := memory.GetFactManager().CurrentFact(fact.UserID, fact.Predicate); ok {
+			line += fmt.Sprintf("（之前记得%s）", strings.TrimPrefix(current.Summary, "用户"))
+		}
+		lines = append(lines, line)
+	}
+
+	return "【待确认】\n" + strings.Join(lines, "\n") + "\n不确定的事先别当真，合适的时候顺口问一句确认，不要生硬追问。"
+}
+
+// formatEpisodeMemory 按配置时区写出日期和相隔天数，方便模型说出"上周你提过……"。
+func formatEpisodeMemory(episodes []memory.Episode, now time.Time) string {
+	if len(episodes) == 0 {
+		return ""
+	}
+
+	location, _ := TimeContextLocation()
+	today := localDate(now, location)
+	lines := make([]string, 0, len(episodes))
+	for _, episode := range episodes {
+		day := localDate(episode.EndedAt, location)
+		lines = append(lines, fmt.Sprintf("- %s（%s）：%s", day.Format("2006-01-02"), describeDaysAgo(int(math.Round(today.Sub(day).Hours()/24))), episode.Summary))
+	}
+
+	return "【过往片段】\n" + strings.Join(lines, "\n")
+}
+
+func localDate(t time.Time, location *time.Location) time.Time {
+	local := t.In(location)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+}
+
+func describeDaysAgo(days int) string {
+	switch {
+	case days <= 0:
+		return "今天"
+	case days == 1:
+		return "昨天"
+	default:
+		return fmt.Sprintf("%d天前", days)
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/memory"
+	"project-yume/internal/metrics"
+)
+
+// moodCheckInCooldown 关心过之后至少隔多久才会再问，低落一直持续也不天天追问。
+const moodCheckInCooldown = 72 * time.Hour
+
+// moodMinDistressDays 配置过小时的下限，一天的低落不算持续。
+const moodMinDistressDays = 2
+
+// RecordMood 把用户的一条消息计入当天的情绪汇总，日期按 TIME_CONTEXT_TIMEZONE 划分。
+func RecordMood(userID int64, emotion, intention string) {
+	location, _ := TimeContextLocation()
+	memory.GetMoodManager().Record(userID, emotion, intention, clock.Now().In(location))
+}
+
+// DueMoodCheckIn 用户连续多天低落、且最近没有关心过时返回这段低落。
+func DueMoodCheckIn(userID int64, now time.Time) (memory.MoodPattern, bool) {
+	cfg := config.GetConfig()
+	if !cfg.EnableMoodCheckIn || userID == 0 {
+		return memory.MoodPattern{}, false
+	}
+
+	location, _ := TimeContextLocation()
+	pattern, ok := memory.GetMoodManager().DistressPattern(userID, now.In(location).Format("2006-01-02"))
+	if !ok || pattern.Days < max(moodMinDistressDays, cfg.MoodDistressDays) {
+		return memory.MoodPattern{}, false
+	}
+	if last, ok := memory.GetMoodManager().LastCheckIn(userID); ok && now.Sub(last.At) < moodCheckInCooldown {
+		return memory.MoodPattern{}, false
+	}
+	return pattern, true
+}
+
+// RecordMoodCheckIn 记下发出的关心，result 为 sent 或 error。
+func RecordMoodCheckIn(userID int64, pattern memory.MoodPattern, message string, at time.Time, result string) {
+	metrics.IncCounter(
+		"bot_mood_checkins_total",
+		"Total proactive check-ins after several low-mood days.",
+		map[string]string{"emotion": pattern.Emotion, "result": result},
+	)
+	if result != "sent" {
+		return
+	}
+	memory.GetMoodManager().RecordCheckIn(userID, memory.MoodCheckIn{
+		At:      at,
+		Emotion: pattern.Emotion,
+		Days:    pattern.Days,
+		Message: message,
+	})
+}
@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+
+	"project-yume/internal/config"
+)
+
+const (
+	thinkOpenTag  = "<think>"
+	thinkCloseTag = "</think>"
+)
+
+// ReplySegmenter 把流式增量切成可以立即发送的片段：以 $ 结尾的文本段，
+// 或完整的 [[image:...]] 指令。未闭合的 <think> 内容会被暂存并最终丢弃。
+type ReplySegmenter struct {
+	buf string
+}
+
+// Push 追加增量，返回已经完整的片段。
+func (s *ReplySegmenter) Push(delta string) []string {
+	s.buf += delta
+	return s.drain(false)
+}
+
+// Flush 返回剩余内容（最后一段通常没有 $ 结尾）。
+func (s *ReplySegmenter) Flush() []string {
+	return s.drain(true)
+}
+
+func (s *ReplySegmenter) drain(final bool) []string {
+	var pieces []string
+	directiveFrom := 0
+
+	for {
+		limit := len(s.buf)
+		if open := strings.Index(s.buf, thinkOpenTag); open >= 0 {
+			if closeIdx := strings.Index(s.buf[open:], thinkCloseTag); closeIdx >= 0 {
+				s.buf = s.buf[:open] + s.buf[open+closeIdx+len(thinkCloseTag):]
+				continue
+			}
+			if final {
+				s.buf = s.buf[:open]
+				limit = len(s.buf)
+			} else {
+				limit = open
+			}
+		}
+		region := s.buf[:limit]
+
+		dollar := strings.Index(region, "$")
+		open := -1
+		if directiveFrom < len(region) {
+			if idx := strings.Index(region[directiveFrom:], "[["); idx >= 0 {
+				open = directiveFrom + idx
+			}
+		}
+
+		if open >= 0 && (dollar < 0 || open < dollar) {
+			closeIdx := strings.Index(region[open:], "]]")
+			if closeIdx < 0 {
+				if !final {
+					break
+				}
+				directiveFrom = len(region)
+				continue
+			}
+			end := open + closeIdx + 2
+			directive := region[open:end]
+			if !imageDirectivePattern.MatchString(directive) {
+				// 不是图片指令，按普通文本处理
+				directiveFrom = end
+				continue
+			}
+			if text := strings.TrimSpace(region[:open]); text != "" {
+				pieces = append(pieces, text)
+			}
+			pieces = append(pieces, directive)
+			s.buf = s.buf[end:]
+			directiveFrom = 0
+			continue
+		}
+
+		if dollar >= 0 {
+			if text := strings.TrimSpace(region[:dollar]); text != "" {
+				pieces = append(pieces, text)
+			}
+			s.buf = s.buf[dollar+1:]
+			directiveFrom = 0
+			continue
+		}
+
+		if final {
+			if text := strings.TrimSpace(region); text != "" {
+				pieces = append(pieces, text)
+			}
+			s.buf = ""
+		}
+		break
+	}
+	return pieces
+}
+
+var (
+	streamReplyModePattern    = regexp.MustCompile(`"reply_mode"\s*:\s*"([a-z_]+)"`)
+	streamVisibleReplyPattern = regexp.MustCompile(`"visible_reply"\s*:\s*"`)
+)
+
+// visibleReplyExtractor 从结构化分析的流式 JSON 中增量解码 visible_reply 字段。
+// 只有在 reply_mode 已知且不是 no_reply 时才放行文本，否则一直暂存。
+type visibleReplyExtractor struct {
+	raw       string
+	replyMode ReplyMode
+	start     int
+	pos       int
+	done      bool
+	held      strings.Builder
+}
+
+func newVisibleReplyExtractor() *visibleReplyExtractor {
+	return &visibleReplyExtractor{start: -1}
+}
+
+// Push 追加原始增量，返回本次可以下发的 visible_reply 文本。
+func (e *visibleReplyExtractor) Push(delta string) string {
+	e.raw += delta
+	if e.replyMode == "" {
+		if match := streamReplyModePattern.FindStringSubmatch(e.raw); match != nil {
+			e.replyMode = ReplyMode(match[1])
+		}
+	}
+	if e.start < 0 {
+		if loc := streamVisibleReplyPattern.FindStringIndex(e.raw); loc != nil {
+			e.start = loc[1]
+			e.pos = loc[1]
+		}
+	}
+	if e.start >= 0 && !e.done {
+		e.decode()
+	}
+
+	if e.replyMode == "" || e.replyMode == ReplyModeNoReply || e.held.Len() == 0 {
+		return ""
+	}
+	text := e.held.String()
+	e.held.Reset()
+	return text
+}
+
+// decode 解码 JSON 字符串内容，遇到不完整的转义或多字节字符时等待更多输入。
+func (e *visibleReplyExtractor) decode() {
+	for e.pos < len(e.raw) {
+		ch := e.raw[e.pos]
+		switch {
+		case ch == '"':
+			e.done = true
+			return
+		case ch == '\\':
+			if e.pos+1 >= len(e.raw) {
+				return
+			}
+			escape := e.raw[e.pos+1]
+			if escape == 'u' {
+				r, width, ok := decodeJSONUnicodeEscape(e.raw[e.pos:])
+				if !ok {
+					return
+				}
+				e.held.WriteRune(r)
+				e.pos += width
+				continue
+			}
+			e.held.WriteString(decodeJSONSimpleEscape(escape))
+			e.pos += 2
+		default:
+			if !utf8.FullRuneInString(e.raw[e.pos:]) {
+				return
+			}
+			r, width := utf8.DecodeRuneInString(e.raw[e.pos:])
+			e.held.WriteRune(r)
+			e.pos += width
+		}
+	}
+}
+
+func decodeJSONSimpleEscape(escape byte) string {
+	switch escape {
+	case 'n':
+		return "\n"
+	case 't':
+		return "\t"
+	case 'r':
+		return "\r"
+	case 'b':
+		return "\b"
+	case 'f':
+		return "\f"
+	default:
+		return string(escape)
+	}
+}
+
+// decodeJSONUnicodeEscape 解码 \uXXXX（含代理对），输入不足时 ok=false。
+func decodeJSONUnicodeEscape(s string) (rune, int, bool) {
+	if len(s) < 6 {
+		return 0, 0, false
+	}
+	code, err := strconv.ParseUint(s[2:6], 16, 32)
+	if err != nil {
+		return utf8.RuneError, 6, true
+	}
+	r := rune(code)
+	if !utf16.IsSurrogate(r) {
+		return r, 6, true
+	}
+	if len(s) < 12 {
+		return 0, 0, false
+	}
+	if s[6] != '\\' || s[7] != 'u' {
+		return utf8.RuneError, 6, true
+	}
+	low, err := strconv.ParseUint(s[8:12], 16, 32)
+	if err != nil {
+		return utf8.RuneError, 6, true
+	}
+	return utf16.DecodeRune(r, rune(low)), 12, true
+}
+
+// ReplyStreamer 在后台协程里按顺序发送流式片段，避免打字延迟阻塞模型流的读取。
+type ReplyStreamer struct {
+	ctx       context.Context
+	conn      *websocket.Conn
+	userID    int64
+	segmenter ReplySegmenter
+	queue     chan string
+	done      chan struct{}
+
+	// queueMu 保护 closed 与入队，入队途中 Close 不会关闭队列。
+	queueMu sync.Mutex
+	closed  bool
+
+	mu      sync.Mutex
+	written strings.Builder
+	sent    []string
+	err     error
+	started bool
+}
+
+// NewReplyStreamer 创建流式发送器；未启用流式输出时返回 nil，调用方按非流式路径处理。
+func NewReplyStreamer(ctx context.Context, c *websocket.Conn, userID int64) *ReplyStreamer {
+	if !config.GetConfig().EnableAIStream {
+		return nil
+	}
+	s := &ReplyStreamer{
+		ctx:    ctx,
+		conn:   c,
+		userID: userID,
+		queue:  make(chan string, 64),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *ReplyStreamer) run() {
+	defer close(s.done)
+	for piece := range s.queue {
+		s.mu.Lock()
+		failed := s.err != nil
+		s.mu.Unlock()
+		if failed {
+			continue
+		}
+
+		sent, err := SendMsgWithContext(s.ctx, s.conn, s.userID, piece)
+		s.mu.Lock()
+		s.sent = append(s.sent, sent...)
+		if err != nil {
+			s.err = err
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Callback 返回可以传给 AnalysisInput.OnReplyDelta 的回调；nil 发送器返回 nil。
+func (s *ReplyStreamer) Callback() func(string) {
+	if s == nil {
+		return nil
+	}
+	return s.Write
+}
+
+// Write 追加回复文本增量，完整的片段会立即排队发送。
+func (s *ReplyStreamer) Write(text string) {
+	s.mu.Lock()
+	s.written.WriteString(text)
+	s.mu.Unlock()
+	s.enqueue(s.segmenter.Push(text))
+}
+
+func (s *ReplyStreamer) enqueue(pieces []string) {
+	if len(pieces) == 0 {
+		return
+	}
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	if s.closed {
+		return
+	}
+	s.mu.Lock()
+	s.started = true
+	s.mu.Unlock()
+	for _, piece := range pieces {
+		s.queue <- piece
+	}
+}
+
+// Streamed 返回目前写入的全部回复文本，包括还没凑成完整片段的部分。
+func (s *ReplyStreamer) Streamed() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.written.String()
+}
+
+// Started 表示是否已有片段进入发送队列。
+func (s *ReplyStreamer) Started() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+// Close 等待队列发送完毕。flush 为 true 时先把最后一段未结束的文本也发出去。
+// 返回实际发出的片段以及发送过程中遇到的第一个错误。
+func (s *ReplyStreamer) Close(flush bool) ([]string, error) {
+	if s == nil {
+		return nil, nil
+	}
+	if flush {
+		s.enqueue(s.segmenter.Flush())
+	}
+
+	s.queueMu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.queueMu.Unlock()
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.sent...), s.err
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"project-yume/internal/config"
+)
+
+func TestReplySegmenterSplitsSegmentsAndDirectives(t *testing.T) {
+	var segmenter ReplySegmenter
+	var pieces []string
+	for _, delta := range []string{"你好", "呀$今天", "[[ima", "ge:cat_01]]", "去哪$<think>想想", "</think>", "[[note]]最后一段"} {
+		pieces = append(pieces, segmenter.Push(delta)...)
+	}
+	if got := strings.Join(pieces, "|"); got != "你好呀|今天|[[image:cat_01]]|去哪" {
+		t.Fatalf("unexpected streamed pieces: %q", got)
+	}
+
+	pieces = segmenter.Flush()
+	if len(pieces) != 1 || pieces[0] != "[[note]]最后一段" {
+		t.Fatalf("unexpected flushed pieces: %q", pieces)
+	}
+}
+
+func TestVisibleReplyExtractorWaitsForReplyMode(t *testing.T) {
+	extractor := newVisibleReplyExtractor()
+	raw := `{"emotion":"开心","reply_mode":"full_reply","confidence":0.9,"visible_reply":"第一段\"引号\"$第二段啦"}`
+
+	var builder strings.Builder
+	for _, r := range raw {
+		builder.WriteString(extractor.Push(string(r)))
+	}
+	if got := builder.String(); got != `第一段"引号"$第二段啦` {
+		t.Fatalf("unexpected extracted reply: %q", got)
+	}
+}
+
+func TestVisibleReplyExtractorSuppressesNoReply(t *testing.T) {
+	extractor := newVisibleReplyExtractor()
+	if text := extractor.Push(`{"visible_reply":"不该发出"`); text != "" {
+		t.Fatalf("expected text to be held until reply_mode is known, got %q", text)
+	}
+	if text := extractor.Push(`,"reply_mode":"no_reply"}`); text != "" {
+		t.Fatalf("expected no_reply to suppress streaming, got %q", text)
+	}
+}
+
+func TestReplyStreamerCloseDuringWrite(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := cfg.EnableAIStream
+	t.Cleanup(func() { cfg.EnableAIStream = previous })
+	cfg.EnableAIStream = true
+
+	// 已取消的上下文让发送立即失败，只验证入队与关闭并发时不会向已关闭的队列发送。
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 50; i++ {
+		streamer := NewReplyStreamer(ctx, nil, 1)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				streamer.Write("一段$")
+			}
+		}()
+		streamer.Close(false)
+		wg.Wait()
+		if streamed := streamer.Streamed(); streamed != strings.Repeat("一段$", 100) {
+			t.Fatalf("streamed text should keep every write, got %d bytes", len(streamed))
+		}
+	}
+}
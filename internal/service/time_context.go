@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"project-yume/internal/clock"
 	"project-yume/internal/config"
 )
 
@@ -17,7 +18,7 @@ func BuildTimeContext(referenceTime time.Time) string {
 	}
 
 	if referenceTime.IsZero() {
-		referenceTime = time.Now()
+		referenceTime = clock.Now()
 	}
 
 	location, locationName := resolveTimeContextLocation(cfg.TimeContextTimezone)
@@ -38,6 +39,34 @@ func BuildTimeContext(referenceTime time.Time) string {
 	return "【时间上下文】\n" + strings.Join(lines, "\n")
 }
 
+// LocalTimeInfo 描述按 TIME_CONTEXT_TIMEZONE 换算后的本地时间。
+type LocalTimeInfo struct {
+	Time     string `json:"time"`
+	Timezone string `json:"timezone"`
+	Weekday  string `json:"weekday"`
+	Period   string `json:"period"`
+}
+
+// TimeContextLocation 返回配置的时区，配置无效时回退到本机时区。
+func TimeContextLocation() (*time.Location, string) {
+	return resolveTimeContextLocation(config.GetConfig().TimeContextTimezone)
+}
+
+// DescribeLocalTime 把时间换算到配置时区并给出星期与时段。
+func DescribeLocalTime(referenceTime time.Time) LocalTimeInfo {
+	if referenceTime.IsZero() {
+		referenceTime = clock.Now()
+	}
+	location, locationName := TimeContextLocation()
+	localTime := referenceTime.In(location)
+	return LocalTimeInfo{
+		Time:     localTime.Format(defaultTimeContextFormat),
+		Timezone: locationName,
+		Weekday:  chineseWeekday(localTime.Weekday()),
+		Period:   describeDayPeriod(localTime.Hour()),
+	}
+}
+
 func resolveTimeContextLocation(raw string) (*time.Location, string) {
 	timezone := strings.TrimSpace(raw)
 	if timezone == "" {
@@ -1,12 +1,14 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
 	"strings"
 	"time"
 
+	"project-yume/internal/clock"
 	"project-yume/internal/connect"
 	"project-yume/internal/model"
 	"project-yume/internal/utils"
@@ -15,6 +17,14 @@ import (
 )
 
 func SendMsg(c *websocket.Conn, userID int64, msg string) error {
+	_, err := SendMsgWithContext(context.Background(), c, userID, msg)
+	return err
+}
+
+// SendMsgWithContext 按 $ 分段发送回复。ctx 取消后会在下一个分段边界停止，
+// 返回值为已经实际发出的分段（图片素材以指令形式保留），便于调用方记录半截回复。
+func SendMsgWithContext(ctx context.Context, c *websocket.Conn, userID int64, msg string) ([]string, error) {
+	sent := make([]string, 0, 4)
 	chunks := ParseReplyChunks(msg)
 	for _, chunk := range chunks {
 		if text := strings.TrimSpace(chunk.Text); text != "" {
@@ -23,19 +33,31 @@ func SendMsg(c *websocket.Conn, userID int64, msg string) error {
 				if trimmed == "" {
 					continue
 				}
-				if err := sendPrivateRawMessage(c, userID, trimmed); err != nil {
-					return err
+				if err := ctx.Err(); err != nil {
+					return sent, err
 				}
+				if err := sendPrivateRawMessage(ctx, c, userID, trimmed); err != nil {
+					return sent, err
+				}
+				sent = append(sent, trimmed)
 			}
 		}
 
 		if chunk.ImageAssetID != "" {
-			if err := sendPrivateImageAsset(c, userID, chunk.ImageAssetID); err != nil {
+			if err := ctx.Err(); err != nil {
+				return sent, err
+			}
+			if err := SendImageAssetWithContext(ctx, c, userID, chunk.ImageAssetID); err != nil {
+				if ctx.Err() != nil {
+					return sent, ctx.Err()
+				}
 				utils.Warn("send image asset failed: %v", err)
+				continue
 			}
+			sent = append(sent, "[[image:"+chunk.ImageAssetID+"]]")
 		}
 	}
-	return nil
+	return sent, nil
 }
 
 func BuildAssistantTranscript(reply string) string {
@@ -58,7 +80,8 @@ func BuildAssistantTranscript(reply string) string {
 	return strings.Join(parts, " ")
 }
 
-func sendPrivateImageAsset(c *websocket.Conn, userID int64, assetID string) error {
+// SendImageAssetWithContext 按素材 ID 发送一张图片。
+func SendImageAssetWithContext(ctx context.Context, c *websocket.Conn, userID int64, assetID string) error {
 	asset, err := LookupImageAsset(assetID)
 	if err != nil {
 		return err
@@ -69,10 +92,10 @@ func sendPrivateImageAsset(c *websocket.Conn, userID int64, assetID string) erro
 		return err
 	}
 
-	return sendPrivateRawMessage(c, userID, fmt.Sprintf("[CQ:image,file=%s]", fileValue))
+	return sendPrivateRawMessage(ctx, c, userID, fmt.Sprintf("[CQ:image,file=%s]", fileValue))
 }
 
-func sendPrivateRawMessage(c *websocket.Conn, userID int64, msg string) error {
+func sendPrivateRawMessage(ctx context.Context, c *websocket.Conn, userID int64, msg string) error {
 	wsMsg := model.Message{
 		Action: "send_private_msg",
 		Params: model.UserMessageParams{
@@ -87,7 +110,12 @@ func sendPrivateRawMessage(c *websocket.Conn, userID int64, msg string) error {
 		return err
 	}
 
-	time.Sleep(time.Duration(rand.Intn(2000)+1000) * time.Millisecond)
+	// 模拟打字间隔；期间被打断则放弃这一段。
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-clock.After(time.Duration(rand.Intn(2000)+1000) * time.Millisecond):
+	}
 	err = connect.WriteMessage(c, websocket.TextMessage, jsonData)
 	if err != nil {
 		utils.Error("Write Error: %v", err)
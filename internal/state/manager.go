@@ -3,12 +3,14 @@ package state
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/sashabaranov/go-openai"
 
+	"project-yume/internal/clock"
 	"project-yume/internal/storage"
 )
 
@@ -27,8 +29,44 @@ const (
 	StatePerfunctory
 	// 忙碌状态
 	StateBusy
+	// 危机守护状态，只能由危机检测进入
+	StateGuarded
 )
 
+var botStateNames = map[BotState]string{
+	StateIdle:          "idle",
+	StateNeedComfort:   "need_comfort",
+	StateNeedEncourage: "need_encourage",
+	StateLongChat:      "long_chat",
+	StatePerfunctory:   "perfunctory",
+	StateBusy:          "busy",
+	StateGuarded:       "guarded",
+}
+
+// String 返回状态的配置名，用于路由表与管理后台展示。
+func (s BotState) String() string {
+	if name, ok := botStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("state_%d", int(s))
+}
+
+// ParseBotState 按配置名解析状态，大小写不敏感。
+func ParseBotState(name string) (BotState, bool) {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	for state, stateName := range botStateNames {
+		if stateName == normalized {
+			return state, true
+		}
+	}
+	return StateIdle, false
+}
+
+// AllBotStates 按枚举顺序返回全部状态。
+func AllBotStates() []BotState {
+	return []BotState{StateIdle, StateNeedComfort, StateNeedEncourage, StateLongChat, StatePerfunctory, StateBusy, StateGuarded}
+}
+
 // Session 保存单个用户/会话的运行态。
 type Session struct {
 	ID                     string                         `json:"id"`
@@ -49,6 +87,9 @@ type Session struct {
 	Summary                string                         `json:"summary"`
 	ActiveTopics           []string                       `json:"active_topics"`
 	DialogueState          DialogueState                  `json:"dialogue_state"`
+	EpisodeCursor          int                            `json:"episode_cursor,omitempty"`
+	EpisodeStartedAt       time.Time                      `json:"episode_started_at,omitempty"`
+	GuardedUntil           time.Time                      `json:"guarded_until,omitempty"`
 	LastUpdated            time.Time                      `json:"last_updated"`
 }
 
@@ -125,18 +166,24 @@ func (sm *StateManager) EnsureSession(sessionID string, userID, groupID int64, c
 	sm.ensureSessionLocked(sessionID, userID, groupID, chatType)
 }
 
-// SetState 设置当前状态
+// SetState 设置当前状态。守护期间不响应切换，需等到期或调用 ReleaseGuard。
 func (sm *StateManager) SetState(sessionID string, state BotState) {
 	sm.mu.Lock()
 	session := sm.ensureSessionLocked(sessionID, 0, 0, 0)
+	now := clock.Now()
+	if guardActive(session, now) {
+		sm.mu.Unlock()
+		return
+	}
 	session.CurrentState = state
-	session.LastUpdated = time.Now()
+	session.GuardedUntil = time.Time{}
+	session.LastUpdated = now
 	sm.mu.Unlock()
 
 	sm.markDirty()
 }
 
-// GetState 获取当前状态
+// GetState 获取当前状态，守护到期后视为 idle。
 func (sm *StateManager) GetState(sessionID string) BotState {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
@@ -145,14 +192,65 @@ func (sm *StateManager) GetState(sessionID string) BotState {
 	if session == nil {
 		return StateIdle
 	}
+	if session.CurrentState == StateGuarded && !guardActive(session, clock.Now()) {
+		return StateIdle
+	}
 	return session.CurrentState
 }
 
+// Guard 把会话切到守护状态直到 until，再次触发时顺延。
+func (sm *StateManager) Guard(sessionID string, until time.Time) {
+	sm.mu.Lock()
+	session := sm.ensureSessionLocked(sessionID, 0, 0, 0)
+	session.CurrentState = StateGuarded
+	if until.After(session.GuardedUntil) {
+		session.GuardedUntil = until
+	}
+	session.LastUpdated = clock.Now()
+	sm.mu.Unlock()
+
+	sm.markDirty()
+}
+
+// Guarded 返回会话是否处于守护期以及到期时间。
+func (sm *StateManager) Guarded(sessionID string) (time.Time, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session := sm.sessions[sessionID]
+	if session == nil || !guardActive(session, clock.Now()) {
+		return time.Time{}, false
+	}
+	return session.GuardedUntil, true
+}
+
+// ReleaseGuard 提前解除守护并回到 idle，返回会话原本是否在守护中。
+func (sm *StateManager) ReleaseGuard(sessionID string) bool {
+	sm.mu.Lock()
+	session := sm.sessions[sessionID]
+	if session == nil || session.CurrentState != StateGuarded {
+		sm.mu.Unlock()
+		return false
+	}
+	active := guardActive(session, clock.Now())
+	session.CurrentState = StateIdle
+	session.GuardedUntil = time.Time{}
+	session.LastUpdated = clock.Now()
+	sm.mu.Unlock()
+
+	sm.markDirty()
+	return active
+}
+
+func guardActive(session *Session, now time.Time) bool {
+	return session.CurrentState == StateGuarded && now.Before(session.GuardedUntil)
+}
+
 func (sm *StateManager) IncrementCounter(sessionID, key string) {
 	sm.mu.Lock()
 	session := sm.ensureSessionLocked(sessionID, 0, 0, 0)
 	session.Counters[key]++
-	session.LastUpdated = time.Now()
+	session.LastUpdated = clock.Now()
 	sm.mu.Unlock()
 
 	sm.markDirty()
@@ -172,7 +270,7 @@ func (sm *StateManager) GetCounter(sessionID, key string) int {
 func (sm *StateManager) UpdateLastReply(sessionID string) {
 	sm.mu.Lock()
 	session := sm.ensureSessionLocked(sessionID, 0, 0, 0)
-	now := time.Now()
+	now := clock.Now()
 	session.LastReply = now
 	session.LastUpdated = now
 	sm.mu.Unlock()
@@ -184,7 +282,7 @@ func (sm *StateManager) UpdateLastReplyMode(sessionID, mode string) {
 	sm.mu.Lock()
 	session := sm.ensureSessionLocked(sessionID, 0, 0, 0)
 	session.LastReplyMode = mode
-	session.LastUpdated = time.Now()
+	session.LastUpdated = clock.Now()
 	sm.mu.Unlock()
 
 	sm.markDirty()
@@ -196,11 +294,14 @@ func (sm *StateManager) RecordUserTurn(sessionID string, msg openai.ChatCompleti
 	session.Conversation = append(session.Conversation, msg)
 	refreshSessionDerivedMemory(session)
 	if at.IsZero() {
-		at = time.Now()
+		at = clock.Now()
 	}
 	session.LastUserMessageAt = at
 	session.LastInteractionAt = at
 	session.LastUpdated = at
+	if session.EpisodeStartedAt.IsZero() {
+		session.EpisodeStartedAt = at
+	}
 	sm.mu.Unlock()
 
 	sm.markDirty()
@@ -217,7 +318,7 @@ func (sm *StateManager) RecordAssistantTurn(sessionID, content string, at time.T
 		refreshSessionDerivedMemory(session)
 	}
 	if at.IsZero() {
-		at = time.Now()
+		at = clock.Now()
 	}
 	session.LastAssistantMessageAt = at
 	session.LastReply = at
@@ -226,6 +327,9 @@ func (sm *StateManager) RecordAssistantTurn(sessionID, content string, at time.T
 		session.LastProactiveAt = at
 	}
 	session.LastUpdated = at
+	if session.EpisodeStartedAt.IsZero() {
+		session.EpisodeStartedAt = at
+	}
 	sm.mu.Unlock()
 
 	sm.markDirty()
@@ -235,7 +339,7 @@ func (sm *StateManager) SetNextScheduledAt(sessionID string, at time.Time) {
 	sm.mu.Lock()
 	session := sm.ensureSessionLocked(sessionID, 0, 0, 0)
 	session.NextScheduledAt = at
-	session.LastUpdated = time.Now()
+	session.LastUpdated = clock.Now()
 	sm.mu.Unlock()
 
 	sm.markDirty()
@@ -263,6 +367,30 @@ func (sm *StateManager) GetLastInteractionAt(sessionID string) time.Time {
 	return session.LastInteractionAt
 }
 
+// GetUserID 返回会话所属用户，会话不存在时为 0。
+func (sm *StateManager) GetUserID(sessionID string) int64 {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session := sm.sessions[sessionID]
+	if session == nil {
+		return 0
+	}
+	return session.UserID
+}
+
+// ProactiveUnanswered 上一条主动消息之后用户还没说过话。
+func (sm *StateManager) ProactiveUnanswered(sessionID string) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session := sm.sessions[sessionID]
+	if session == nil || session.LastProactiveAt.IsZero() {
+		return false
+	}
+	return session.LastUserMessageAt.Before(session.LastProactiveAt)
+}
+
 func (sm *StateManager) GetTimeSinceLastInteraction(sessionID string) time.Duration {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
@@ -271,13 +399,13 @@ func (sm *StateManager) GetTimeSinceLastInteraction(sessionID string) time.Durat
 	if session == nil || session.LastInteractionAt.IsZero() {
 		return 0
 	}
-	return time.Since(session.LastInteractionAt)
+	return clock.Since(session.LastInteractionAt)
 }
 
 func (sm *StateManager) SetDialogueState(sessionID string, dialogueState DialogueState) {
 	sm.mu.Lock()
 	session := sm.ensureSessionLocked(sessionID, 0, 0, 0)
-	dialogueState.UpdatedAt = time.Now()
+	dialogueState.UpdatedAt = clock.Now()
 	session.DialogueState = dialogueState
 	session.LastUpdated = dialogueState.UpdatedAt
 	sm.mu.Unlock()
@@ -305,7 +433,23 @@ func (sm *StateManager) GetTimeSinceLastReply(sessionID string) time.Duration {
 	if session == nil || session.LastReply.IsZero() {
 		return 0
 	}
-	return time.Since(session.LastReply)
+	return clock.Since(session.LastReply)
+}
+
+// RecordToolTurns 按顺序追加一轮回复中的工具调用与工具结果，供后续轮次参考。
+func (sm *StateManager) RecordToolTurns(sessionID string, msgs []openai.ChatCompletionMessage) {
+	if len(msgs) == 0 {
+		return
+	}
+
+	sm.mu.Lock()
+	session := sm.ensureSessionLocked(sessionID, 0, 0, 0)
+	session.Conversation = append(session.Conversation, msgs...)
+	refreshSessionDerivedMemory(session)
+	session.LastUpdated = clock.Now()
+	sm.mu.Unlock()
+
+	sm.markDirty()
 }
 
 // AddToConversation 追加对话历史。
@@ -314,7 +458,7 @@ func (sm *StateManager) AddToConversation(sessionID string, msg openai.ChatCompl
 	session := sm.ensureSessionLocked(sessionID, 0, 0, 0)
 	session.Conversation = append(session.Conversation, msg)
 	refreshSessionDerivedMemory(session)
-	session.LastUpdated = time.Now()
+	session.LastUpdated = clock.Now()
 	sm.mu.Unlock()
 
 	sm.markDirty()
@@ -341,7 +485,7 @@ func (sm *StateManager) SetConversation(sessionID string, conversation []openai.
 	session := sm.ensureSessionLocked(sessionID, 0, 0, 0)
 	session.Conversation = append([]openai.ChatCompletionMessage(nil), conversation...)
 	refreshSessionDerivedMemory(session)
-	session.LastUpdated = time.Now()
+	session.LastUpdated = clock.Now()
 	sm.mu.Unlock()
 
 	sm.markDirty()
@@ -355,7 +499,9 @@ func (sm *StateManager) ClearConversation(sessionID string) {
 		session.Conversation = []openai.ChatCompletionMessage{}
 		session.Summary = ""
 		session.ActiveTopics = []string{}
-		session.LastUpdated = time.Now()
+		session.EpisodeCursor = 0
+		session.EpisodeStartedAt = time.Time{}
+		session.LastUpdated = clock.Now()
 	}
 	sm.mu.Unlock()
 
@@ -376,7 +522,7 @@ func (sm *StateManager) ResetCounter(sessionID, key string) {
 	sm.mu.Lock()
 	session := sm.ensureSessionLocked(sessionID, 0, 0, 0)
 	session.Counters[key] = 0
-	session.LastUpdated = time.Now()
+	session.LastUpdated = clock.Now()
 	sm.mu.Unlock()
 
 	sm.markDirty()
@@ -387,7 +533,7 @@ func (sm *StateManager) SetCounter(sessionID, key string, value int) {
 	sm.mu.Lock()
 	session := sm.ensureSessionLocked(sessionID, 0, 0, 0)
 	session.Counters[key] = value
-	session.LastUpdated = time.Now()
+	session.LastUpdated = clock.Now()
 	sm.mu.Unlock()
 
 	sm.markDirty()
@@ -414,14 +560,20 @@ func (sm *StateManager) ResetSession(sessionID string) {
 	sm.mu.Lock()
 	session := sm.sessions[sessionID]
 	if session != nil {
-		session.CurrentState = StateIdle
+		// 守护期内重置对话不解除守护
+		if !guardActive(session, clock.Now()) {
+			session.CurrentState = StateIdle
+			session.GuardedUntil = time.Time{}
+		}
 		session.Flags = make(map[string]bool)
 		session.Counters = make(map[string]int)
 		session.Conversation = []openai.ChatCompletionMessage{}
 		session.Summary = ""
 		session.ActiveTopics = []string{}
 		session.DialogueState = DialogueState{}
-		now := time.Now()
+		session.EpisodeCursor = 0
+		session.EpisodeStartedAt = time.Time{}
+		now := clock.Now()
 		session.LastReply = now
 		session.LastReplyMode = ""
 		session.LastUserMessageAt = time.Time{}
@@ -436,10 +588,44 @@ func (sm *StateManager) ResetSession(sessionID string) {
 	sm.markDirty()
 }
 
+// UserSessions 返回属于该用户的全部会话副本（私聊与群内会话），按 ID 排序。
+func (sm *StateManager) UserSessions(userID int64) []Session {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	result := make([]Session, 0)
+	for _, session := range sm.sessions {
+		if session != nil && session.UserID == userID {
+			result = append(result, *cloneSession(session))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// DeleteUserSessions 删除属于该用户的全部会话，返回被删除的会话 ID。
+func (sm *StateManager) DeleteUserSessions(userID int64) []string {
+	sm.mu.Lock()
+	deleted := make([]string, 0)
+	for sessionID, session := range sm.sessions {
+		if session != nil && session.UserID == userID {
+			delete(sm.sessions, sessionID)
+			deleted = append(deleted, sessionID)
+		}
+	}
+	sm.mu.Unlock()
+
+	if len(deleted) > 0 {
+		sort.Strings(deleted)
+		sm.markDirty()
+	}
+	return deleted
+}
+
 func (sm *StateManager) ensureSessionLocked(sessionID string, userID, groupID int64, chatType int) *Session {
 	session := sm.sessions[sessionID]
 	if session == nil {
-		now := time.Now()
+		now := clock.Now()
 		session = &Session{
 			ID:                     sessionID,
 			UserID:                 userID,
@@ -500,7 +686,7 @@ func (sm *StateManager) ensureSessionLocked(sessionID string, userID, groupID in
 		session.LastAssistantMessageAt = session.LastReply
 	}
 	if session.LastReply.IsZero() {
-		session.LastReply = time.Now()
+		session.LastReply = clock.Now()
 	}
 	if session.LastUpdated.IsZero() {
 		session.LastUpdated = session.LastReply
@@ -639,7 +825,7 @@ func (sm *StateManager) normalizeSession(sessionID string, session *Session) {
 	}
 	if session.LastReply.IsZero() {
 		if session.LastUpdated.IsZero() {
-			session.LastReply = time.Now()
+			session.LastReply = clock.Now()
 		} else {
 			session.LastReply = session.LastUpdated
 		}
@@ -663,7 +849,7 @@ func migrateLegacyConversations(conversations map[int64]*legacyConversationData)
 		sessionID := PrivateSessionID(userID)
 		lastUpdated := conversation.LastUpdated
 		if lastUpdated.IsZero() {
-			lastUpdated = time.Now()
+			lastUpdated = clock.Now()
 		}
 
 		sessions[sessionID] = &Session{
@@ -703,32 +889,40 @@ func (sm *StateManager) snapshotLocked() map[string]*Session {
 		if session == nil {
 			continue
 		}
-		result[sessionID] = &Session{
-			ID:                     session.ID,
-			UserID:                 session.UserID,
-			GroupID:                session.GroupID,
-			ChatType:               session.ChatType,
-			CurrentState:           session.CurrentState,
-			Flags:                  cloneBoolMap(session.Flags),
-			Counters:               cloneIntMap(session.Counters),
-			LastReply:              session.LastReply,
-			LastReplyMode:          session.LastReplyMode,
-			LastUserMessageAt:      session.LastUserMessageAt,
-			LastAssistantMessageAt: session.LastAssistantMessageAt,
-			LastInteractionAt:      session.LastInteractionAt,
-			LastProactiveAt:        session.LastProactiveAt,
-			NextScheduledAt:        session.NextScheduledAt,
-			Conversation:           append([]openai.ChatCompletionMessage(nil), session.Conversation...),
-			Summary:                session.Summary,
-			ActiveTopics:           append([]string(nil), session.ActiveTopics...),
-			DialogueState:          session.DialogueState,
-			LastUpdated:            session.LastUpdated,
-		}
+		result[sessionID] = cloneSession(session)
 	}
 
 	return result
 }
 
+// cloneSession 复制会话，消息内容只读共享。
+func cloneSession(session *Session) *Session {
+	return &Session{
+		ID:                     session.ID,
+		UserID:                 session.UserID,
+		GroupID:                session.GroupID,
+		ChatType:               session.ChatType,
+		CurrentState:           session.CurrentState,
+		Flags:                  cloneBoolMap(session.Flags),
+		Counters:               cloneIntMap(session.Counters),
+		LastReply:              session.LastReply,
+		LastReplyMode:          session.LastReplyMode,
+		LastUserMessageAt:      session.LastUserMessageAt,
+		LastAssistantMessageAt: session.LastAssistantMessageAt,
+		LastInteractionAt:      session.LastInteractionAt,
+		LastProactiveAt:        session.LastProactiveAt,
+		NextScheduledAt:        session.NextScheduledAt,
+		Conversation:           append([]openai.ChatCompletionMessage(nil), session.Conversation...),
+		Summary:                session.Summary,
+		ActiveTopics:           append([]string(nil), session.ActiveTopics...),
+		DialogueState:          session.DialogueState,
+		EpisodeCursor:          session.EpisodeCursor,
+		EpisodeStartedAt:       session.EpisodeStartedAt,
+		GuardedUntil:           session.GuardedUntil,
+		LastUpdated:            session.LastUpdated,
+	}
+}
+
 func cloneBoolMap(source map[string]bool) map[string]bool {
 	result := make(map[string]bool, len(source))
 	for key, value := range source {
@@ -767,6 +961,75 @@ func (sm *StateManager) GetActiveTopics(sessionID string) []string {
 	return append([]string(nil), session.ActiveTopics...)
 }
 
+// EpisodeSegment 一段待总结的私聊对话，只含用户与助手的文本消息。
+type EpisodeSegment struct {
+	SessionID string
+	UserID    int64
+	Messages  []openai.ChatCompletionMessage
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+// TakeEpisodeSegments 取出已空闲超过 idleGap、或未切分消息超过 maxMessages 的私聊片段，并推进游标。
+// 群聊不切分；取出即视为已处理，调用方失败时自行兜底。
+func (sm *StateManager) TakeEpisodeSegments(now time.Time, idleGap time.Duration, maxMessages int) []EpisodeSegment {
+	sm.mu.Lock()
+	var segments []EpisodeSegment
+	for sessionID, session := range sm.sessions {
+		if session.GroupID != 0 || session.UserID == 0 {
+			continue
+		}
+		pending := make([]openai.ChatCompletionMessage, 0)
+		index := 0
+		for _, msg := range session.Conversation {
+			if msg.Role == openai.ChatMessageRoleSystem {
+				continue
+			}
+			if index >= session.EpisodeCursor {
+				pending = append(pending, msg)
+			}
+			index++
+		}
+		if session.EpisodeCursor > index {
+			session.EpisodeCursor = index
+		}
+		if len(pending) == 0 {
+			continue
+		}
+		idle := !session.LastInteractionAt.IsZero() && now.Sub(session.LastInteractionAt) >= idleGap
+		if !idle && (maxMessages <= 0 || len(pending) < maxMessages) {
+			continue
+		}
+
+		messages := make([]openai.ChatCompletionMessage, 0, len(pending))
+		for _, msg := range pending {
+			// 带图片的消息只有 MultiContent，按纯文本判断才不会被漏掉
+			if (msg.Role == openai.ChatMessageRoleUser || msg.Role == openai.ChatMessageRoleAssistant) && len(msg.ToolCalls) == 0 && strings.TrimSpace(chatMessagePlainText(msg)) != "" {
+				messages = append(messages, msg)
+			}
+		}
+		startedAt := session.EpisodeStartedAt
+		if startedAt.IsZero() {
+			startedAt = session.LastInteractionAt
+		}
+		segments = append(segments, EpisodeSegment{
+			SessionID: sessionID,
+			UserID:    session.UserID,
+			Messages:  messages,
+			StartedAt: startedAt,
+			EndedAt:   session.LastInteractionAt,
+		})
+		session.EpisodeCursor = index
+		session.EpisodeStartedAt = time.Time{}
+	}
+	sm.mu.Unlock()
+
+	if len(segments) > 0 {
+		sm.markDirty()
+	}
+	return segments
+}
+
 func refreshSessionDerivedMemory(session *Session) {
 	session.Summary = summarizeConversation(session.Conversation)
 	session.ActiveTopics = extractActiveTopics(session.Conversation)
@@ -825,10 +1088,22 @@ func extractActiveTopics(conversation []openai.ChatCompletionMessage) []string {
 	return topics
 }
 
+// MessagePlainText 返回消息的纯文本，MultiContent 里的图片记为 [图片]。
+func MessagePlainText(msg openai.ChatCompletionMessage) string {
+	return chatMessagePlainText(msg)
+}
+
 func chatMessagePlainText(msg openai.ChatCompletionMessage) string {
 	if strings.TrimSpace(msg.Content) != "" {
 		return msg.Content
 	}
+	if len(msg.ToolCalls) > 0 {
+		names := make([]string, 0, len(msg.ToolCalls))
+		for _, call := range msg.ToolCalls {
+			names = append(names, call.Function.Name)
+		}
+		return "[调用工具 " + strings.Join(names, ",") + "]"
+	}
 	if len(msg.MultiContent) == 0 {
 		return ""
 	}
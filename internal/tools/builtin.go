@@ -0,0 +1,304 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/memory"
+	"project-yume/internal/privacy"
+	"project-yume/internal/reminder"
+	"project-yume/internal/service"
+	"project-yume/internal/state"
+)
+
+const (
+	ToolSearchFacts = "search_facts"
+	ToolRecordFact  = "record_fact"
+	ToolSendImage   = "send_image"
+	ToolSetReminder = "set_reminder"
+	ToolCurrentTime = "current_time"
+	ToolSetState    = "set_state"
+)
+
+const (
+	maxFactSearchLimit = 10
+	reminderTimeLayout = "2006-01-02 15:04"
+)
+
+// settableStates 模型可以切换到的状态。只开放默认路由里有处理器的状态，
+// 否则切过去之后的消息都会落到兜底回复；守护状态只能由危机检测进入。
+var settableStates = []state.BotState{state.StateIdle, state.StateLongChat}
+
+func init() {
+	defaultRegistry.MustRegister(Tool{
+		Name:        ToolSearchFacts,
+		Description: "检索关于当前用户的长期记忆事实，例如喜好、身份、住址、宠物、近期计划。",
+		Parameters: mustSchema(map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"query": map[string]any{"type": "string", "description": "要查找的关键词，留空返回最相关的若干条"},
+				"limit": map[string]any{"type": "integer", "minimum": 1, "maximum": maxFactSearchLimit},
+			},
+		}),
+		Run: runSearchFacts,
+	})
+	defaultRegistry.MustRegister(Tool{
+		Name:        ToolRecordFact,
+		Description: "记下用户明确告诉你的关于他自己的新信息。只记录用户亲口说的事实，不要记录猜测。",
+		Parameters: mustSchema(map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"predicate": map[string]any{"type": "string", "enum": memory.FactPredicates()},
+				"object":    map[string]any{"type": "string", "description": "事实内容，例如“猫”“北京”"},
+				"summary":   map[string]any{"type": "string", "description": "一句话描述，例如“用户养了一只猫”"},
+			},
+			"required": []string{"predicate", "object"},
+		}),
+		Run: runRecordFact,
+	})
+	defaultRegistry.MustRegister(Tool{
+		Name:        ToolSendImage,
+		Description: "立即给用户发送一张图片素材。asset_id 必须来自提示中的图片素材列表。",
+		Parameters: mustSchema(map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"asset_id": map[string]any{"type": "string"},
+			},
+			"required": []string{"asset_id"},
+		}),
+		Timeout: 10 * time.Second,
+		Enabled: func() bool { return config.GetConfig().EnableImageAssetReply },
+		Run:     runSendImage,
+	})
+	defaultRegistry.MustRegister(Tool{
+		Name:        ToolSetReminder,
+		Description: "在指定时间提醒用户某件事，到点后会主动发消息。time 使用用户所在时区，可以是 YYYY-MM-DD HH:MM，也可以是“明天早上八点”“半小时后”这样的说法。",
+		Parameters: mustSchema(map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"content": map[string]any{"type": "string", "description": "提醒内容"},
+				"time":    map[string]any{"type": "string", "description": "提醒时间，例如 2026-01-02 21:30 或 明天早上八点"},
+				"repeat":  map[string]any{"type": "string", "enum": reminder.RepeatNames(), "description": "重复方式，不重复时省略"},
+			},
+			"required": []string{"content", "time"},
+		}),
+		Run: runSetReminder,
+	})
+	defaultRegistry.MustRegister(Tool{
+		Name:        ToolCurrentTime,
+		Description: "查询用户所在时区的当前时间、星期和时段。",
+		Run:         runCurrentTime,
+	})
+	defaultRegistry.MustRegister(Tool{
+		Name:        ToolSetState,
+		Description: "切换当前对话状态：进入长聊，或结束长聊回到空闲。",
+		Parameters: mustSchema(map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"state": map[string]any{"type": "string", "enum": stateNamesOf(settableStates)},
+			},
+			"required": []string{"state"},
+		}),
+		Run: runSetState,
+	})
+}
+
+func runSearchFacts(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+	var params struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	if params.Limit <= 0 || params.Limit > maxFactSearchLimit {
+		params.Limit = 5
+	}
+
+	type factView struct {
+		Predicate string  `json:"predicate"`
+		Object    string  `json:"object"`
+		Summary   string  `json:"summary"`
+		Updated   string  `json:"updated"`
+		Score     float64 `json:"confidence"`
+	}
+	facts := memory.GetFactManager().FindRelevantFacts(inv.UserID, params.Query, params.Limit)
+	views := make([]factView, 0, len(facts))
+	for _, fact := range facts {
+		views = append(views, factView{
+			Predicate: fact.Predicate,
+			Object:    fact.Object,
+			Summary:   fact.Summary,
+			Updated:   fact.LastConfirmedAt.Format("2006-01-02"),
+			Score:     fact.Confidence,
+		})
+	}
+	return toolResult(map[string]any{"facts": views})
+}
+
+func runRecordFact(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+	var params struct {
+		Predicate string `json:"predicate"`
+		Object    string `json:"object"`
+		Summary   string `json:"summary"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	params.Predicate = strings.TrimSpace(params.Predicate)
+	params.Object = strings.TrimSpace(params.Object)
+	params.Summary = strings.TrimSpace(params.Summary)
+	if !memory.IsKnownFactPredicate(params.Predicate) {
+		return "", fmt.Errorf("predicate must be one of %s", strings.Join(memory.FactPredicates(), ", "))
+	}
+	if params.Object == "" {
+		return "", fmt.Errorf("object is required")
+	}
+	if params.Summary == "" {
+		params.Summary = fmt.Sprintf("用户 %s: %s", params.Predicate, params.Object)
+	}
+
+	fact := memory.FactMemory{
+		Predicate:     params.Predicate,
+		Object:        params.Object,
+		Summary:       params.Summary,
+		Tags:          []string{"tool"},
+		Confidence:    0.7,
+		SourceMessage: inv.Message,
+		Status:        memory.FactStatusActive,
+	}
+	// 用户已要求删除数据时，删除之前的消息不再写回记忆
+	if privacy.GetTombstoneManager().Blocks(inv.UserID, inv.now()) {
+		return "", fmt.Errorf("user data was deleted, fact not recorded")
+	}
+	if ttl, ok := memory.FactPredicateTTL(params.Predicate); ok {
+		expiresAt := clock.Now().Add(ttl)
+		fact.ExpiresAt = &expiresAt
+	}
+	memory.GetFactManager().UpsertFacts(inv.UserID, inv.SessionID, []memory.FactMemory{fact})
+	return toolResult(map[string]any{"recorded": true, "summary": params.Summary})
+}
+
+func runSendImage(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+	var params struct {
+		AssetID string `json:"asset_id"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	if inv.Conn == nil {
+		return "", fmt.Errorf("no active connection")
+	}
+	asset, err := service.LookupImageAsset(params.AssetID)
+	if err != nil {
+		return "", err
+	}
+	if err := service.SendImageAssetWithContext(ctx, inv.Conn, inv.UserID, asset.ID); err != nil {
+		return "", err
+	}
+	return toolResult(map[string]any{"sent": asset.ID, "description": asset.Description})
+}
+
+func runSetReminder(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+	var params struct {
+		Content string `json:"content"`
+		Time    string `json:"time"`
+		Repeat  string `json:"repeat"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	params.Content = strings.TrimSpace(params.Content)
+	if params.Content == "" {
+		return "", fmt.Errorf("content is required")
+	}
+
+	now := inv.now()
+	location, _ := service.TimeContextLocation()
+	dueAt, repeat, err := resolveReminderTime(strings.TrimSpace(params.Time), now, location)
+	if err != nil {
+		return "", err
+	}
+	if params.Repeat != "" {
+		parsed, ok := reminder.ParseRepeat(params.Repeat)
+		if !ok {
+			return "", fmt.Errorf("repeat must be one of %s", strings.Join(reminder.RepeatNames(), ", "))
+		}
+		repeat = parsed
+	}
+
+	created, err := reminder.GetManager().Add(reminder.Reminder{
+		UserID:        inv.UserID,
+		SessionID:     inv.SessionID,
+		Content:       params.Content,
+		DueAt:         dueAt,
+		Repeat:        repeat,
+		SourceMessage: inv.Message,
+	})
+	if err != nil {
+		return "", err
+	}
+	return toolResult(map[string]any{
+		"id":      created.ID,
+		"when":    reminder.DescribeTime(created.DueAt, created.Repeat, now, location),
+		"content": created.Content,
+	})
+}
+
+// resolveReminderTime 先按固定格式解析，再按中文口语解析。
+func resolveReminderTime(text string, now time.Time, location *time.Location) (time.Time, reminder.Repeat, error) {
+	if dueAt, err := time.ParseInLocation(reminderTimeLayout, text, location); err == nil {
+		return dueAt, reminder.RepeatNone, nil
+	}
+	if parsed, ok := reminder.ParseTime(text, now, location); ok {
+		if parsed.InvalidDate {
+			return time.Time{}, reminder.RepeatNone, fmt.Errorf("date in %q does not exist, ask the user which day they mean", text)
+		}
+		return parsed.At, parsed.Repeat, nil
+	}
+	return time.Time{}, reminder.RepeatNone, fmt.Errorf("cannot understand time %q, use YYYY-MM-DD HH:MM", text)
+}
+
+func runCurrentTime(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+	return toolResult(service.DescribeLocalTime(inv.now()))
+}
+
+func runSetState(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+	var params struct {
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	botState, ok := state.ParseBotState(params.State)
+	if !ok || !slices.Contains(settableStates, botState) {
+		return "", fmt.Errorf("state must be one of %s", strings.Join(stateNamesOf(settableStates), ", "))
+	}
+	if _, guarded := state.GetManager().Guarded(inv.SessionID); guarded {
+		return "", fmt.Errorf("session is guarded, state cannot be changed")
+	}
+	state.GetManager().SetState(inv.SessionID, botState)
+	return toolResult(map[string]any{"state": botState.String()})
+}
+
+func stateNamesOf(states []state.BotState) []string {
+	names := make([]string, 0, len(states))
+	for _, botState := range states {
+		names = append(names, botState.String())
+	}
+	return names
+}
+
+func mustSchema(schema map[string]any) json.RawMessage {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
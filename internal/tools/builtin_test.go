@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/memory"
+	"project-yume/internal/privacy"
+	"project-yume/internal/reminder"
+	"project-yume/internal/service"
+	"project-yume/internal/state"
+)
+
+func TestBuiltinToolsRejectInvalidArguments(t *testing.T) {
+	const userID = 70301
+	now := time.Now()
+	inv := Invocation{SessionID: "private:70301", UserID: userID, Message: "我养了一只猫", ReferenceTime: now}
+	state.GetManager().EnsureSession(inv.SessionID, userID, 0, 1)
+
+	if _, err := runSetState(context.Background(), inv, json.RawMessage(`{"state":"need_comfort"}`)); err == nil {
+		t.Fatalf("state without a routed handler should be rejected")
+	}
+	if _, err := runSetState(context.Background(), inv, json.RawMessage(`{"state":"long_chat"}`)); err != nil {
+		t.Fatalf("long_chat should be settable: %v", err)
+	}
+	if got := state.GetManager().GetState(inv.SessionID); got != state.StateLongChat {
+		t.Fatalf("expected long_chat, got %s", got)
+	}
+
+	due := now.Add(48 * time.Hour).Format(reminderTimeLayout)
+	_, err := runSetReminder(context.Background(), inv, json.RawMessage(`{"content":"交房租","time":"`+due+`","repeat":"monthly"}`))
+	if err == nil || !strings.Contains(err.Error(), "repeat must be one of") {
+		t.Fatalf("unsupported repeat should be rejected, got %v", err)
+	}
+
+	privacy.GetTombstoneManager().Record(userID, privacy.RequestedByUser, now.Add(time.Second))
+	t.Cleanup(func() { memory.GetFactManager().DeleteUserFacts(userID) })
+	if _, err := runRecordFact(context.Background(), inv, json.RawMessage(`{"predicate":"pet","object":"猫"}`)); err == nil {
+		t.Fatalf("facts from before the deletion should not be recorded")
+	}
+	if facts := memory.GetFactManager().ListFacts(userID); len(facts) != 0 {
+		t.Fatalf("no fact should be written, got %+v", facts)
+	}
+}
+
+func TestTimeToolsUseReferenceTime(t *testing.T) {
+	recorded := time.Date(2025, 3, 1, 8, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	fake := clock.NewFake(recorded.Add(24 * time.Hour))
+	clock.Set(fake)
+	t.Cleanup(func() { clock.Set(nil) })
+
+	var info service.LocalTimeInfo
+	raw, err := runCurrentTime(context.Background(), Invocation{ReferenceTime: recorded}, nil)
+	if err != nil || json.Unmarshal([]byte(raw), &info) != nil {
+		t.Fatalf("current_time failed: %q %v", raw, err)
+	}
+	if want := service.DescribeLocalTime(recorded); info != want {
+		t.Fatalf("current_time should report the message time, got %+v want %+v", info, want)
+	}
+	raw, _ = runCurrentTime(context.Background(), Invocation{}, nil)
+	if json.Unmarshal([]byte(raw), &info) != nil || info != service.DescribeLocalTime(fake.Now()) {
+		t.Fatalf("current_time without a reference should use the clock, got %q", raw)
+	}
+
+	const userID = 70302
+	t.Cleanup(func() { reminder.GetManager().DeleteUser(userID) })
+	// 录制时的"明天九点"，相对真实时间早已过去
+	inv := Invocation{SessionID: "private:70302", UserID: userID, ReferenceTime: recorded}
+	if _, err := runSetReminder(context.Background(), inv, json.RawMessage(`{"content":"开会","time":"明天九点"}`)); err != nil {
+		t.Fatalf("set_reminder should resolve time from the message time: %v", err)
+	}
+	items := reminder.GetManager().List(userID)
+	if len(items) != 1 || !items[0].DueAt.Equal(time.Date(2025, 3, 2, 9, 0, 0, 0, recorded.Location())) {
+		t.Fatalf("unexpected reminders: %+v", items)
+	}
+}
@@ -0,0 +1,262 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	openai "github.com/sashabaranov/go-openai"
+
+	"project-yume/internal/aifunction"
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/metrics"
+	"project-yume/internal/utils"
+)
+
+const defaultToolTimeout = 5 * time.Second
+
+// Invocation 描述一次工具调用所处的会话，工具通过它知道在替谁做事。
+type Invocation struct {
+	RequestID     string
+	SessionID     string
+	UserID        int64
+	Message       string
+	Conn          *websocket.Conn
+	ReferenceTime time.Time
+}
+
+// now 返回消息的参考时间，没有时取时钟当前时间。回放和评测都靠它得到录制时的"现在"。
+func (inv Invocation) now() time.Time {
+	if inv.ReferenceTime.IsZero() {
+		return clock.Now()
+	}
+	return inv.ReferenceTime
+}
+
+// Tool 一个可以被模型调用的工具。Parameters 是 JSON Schema，
+// Run 的返回值会作为工具结果交给模型，通常是一段 JSON。
+// Enabled 非空且返回 false 时，本轮不向模型暴露该工具。
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+	Timeout     time.Duration
+	Enabled     func() bool
+	Run         func(ctx context.Context, inv Invocation, args json.RawMessage) (string, error)
+}
+
+// Registry 按名称管理工具。
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+}
+
+var defaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]Tool)}
+}
+
+// DefaultRegistry 返回包含内置工具的全局注册表。
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Register 注册工具，同名工具会返回错误。
+func (r *Registry) Register(tool Tool) error {
+	tool.Name = strings.TrimSpace(tool.Name)
+	if tool.Name == "" {
+		return fmt.Errorf("tool name is required")
+	}
+	if tool.Run == nil {
+		return fmt.Errorf("tool %s has no Run function", tool.Name)
+	}
+	if len(tool.Parameters) == 0 {
+		tool.Parameters = json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	if !json.Valid(tool.Parameters) {
+		return fmt.Errorf("tool %s has invalid parameters schema", tool.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.tools[tool.Name]; exists {
+		return fmt.Errorf("tool %s already registered", tool.Name)
+	}
+	r.tools[tool.Name] = tool
+	return nil
+}
+
+// MustRegister 同 Register，失败时 panic，用于 init 中注册内置工具。
+func (r *Registry) MustRegister(tool Tool) {
+	if err := r.Register(tool); err != nil {
+		panic(err)
+	}
+}
+
+// Names 返回已注册的工具名，按字母排序。
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) lookup(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tool, ok := r.tools[name]
+	return tool, ok
+}
+
+// Executor 返回绑定到当前会话的执行器；未启用工具或没有注册工具时返回 nil。
+func (r *Registry) Executor(inv Invocation) aifunction.ToolExecutor {
+	if !config.GetConfig().EnableAITools || len(r.Names()) == 0 {
+		return nil
+	}
+	return &executor{registry: r, inv: inv}
+}
+
+type executor struct {
+	registry *Registry
+	inv      Invocation
+}
+
+func (e *executor) Definitions() []openai.Tool {
+	names := e.registry.Names()
+	definitions := make([]openai.Tool, 0, len(names))
+	for _, name := range names {
+		tool, ok := e.registry.lookup(name)
+		if !ok || (tool.Enabled != nil && !tool.Enabled()) {
+			continue
+		}
+		definitions = append(definitions, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return definitions
+}
+
+// Execute 在超时限制内运行工具。任何失败都编码成 {"error": "..."} 交给模型，
+// 由模型决定如何向用户解释，而不是中断整轮回复。
+func (e *executor) Execute(ctx context.Context, call openai.ToolCall) string {
+	name := call.Function.Name
+	tool, ok := e.registry.lookup(name)
+	if !ok || (tool.Enabled != nil && !tool.Enabled()) {
+		recordToolCall(name, "unknown")
+		return toolError(fmt.Errorf("unknown tool: %s", name))
+	}
+
+	args := json.RawMessage(strings.TrimSpace(call.Function.Arguments))
+	if len(args) == 0 {
+		args = json.RawMessage(`{}`)
+	}
+	if !json.Valid(args) {
+		recordToolCall(name, "bad_args")
+		return toolError(fmt.Errorf("arguments must be a JSON object"))
+	}
+
+	timeout := tool.Timeout
+	if timeout <= 0 {
+		timeout = configuredToolTimeout()
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	startedAt := time.Now()
+	output, err := runTool(runCtx, tool, e.inv, args)
+	metrics.ObserveDuration(
+		"bot_tool_call_duration",
+		"Tool call duration.",
+		time.Since(startedAt),
+		map[string]string{"tool": name},
+	)
+
+	result := "ok"
+	switch {
+	case err != nil && runCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil:
+		result = "timeout"
+		err = fmt.Errorf("tool %s timed out after %v", name, timeout)
+	case err != nil:
+		result = "error"
+	}
+	recordToolCall(name, result)
+	utils.Infow("tool call finished",
+		utils.String("request_id", e.inv.RequestID),
+		utils.String("session_id", e.inv.SessionID),
+		utils.String("tool", name),
+		utils.String("result", result),
+	)
+	if err != nil {
+		return toolError(err)
+	}
+	return output
+}
+
+// runTool 在独立协程中运行工具，超时后立即返回，不等待不响应 ctx 的实现。
+func runTool(ctx context.Context, tool Tool, inv Invocation, args json.RawMessage) (string, error) {
+	type outcome struct {
+		output string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- outcome{err: fmt.Errorf("tool %s panicked: %v", tool.Name, recovered)}
+			}
+		}()
+		output, err := tool.Run(ctx, inv, args)
+		done <- outcome{output: output, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case result := <-done:
+		return result.output, result.err
+	}
+}
+
+func configuredToolTimeout() time.Duration {
+	if ms := config.GetConfig().AiToolTimeoutMs; ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return defaultToolTimeout
+}
+
+func toolError(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
+
+func toolResult(value any) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func recordToolCall(tool, result string) {
+	metrics.IncCounter(
+		"bot_tool_calls_total",
+		"Total tool calls by tool and result.",
+		map[string]string{"tool": tool, "result": result},
+	)
+}
@@ -0,0 +1,85 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func toolCall(name, args string) openai.ToolCall {
+	return openai.ToolCall{
+		ID:       "call_1",
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: name, Arguments: args},
+	}
+}
+
+func TestExecuteReturnsToolOutput(t *testing.T) {
+	registry := NewRegistry()
+	registry.MustRegister(Tool{
+		Name: "echo",
+		Run: func(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+			return string(args), nil
+		},
+	})
+	exec := &executor{registry: registry}
+
+	if got := exec.Execute(context.Background(), toolCall("echo", `{"a":1}`)); got != `{"a":1}` {
+		t.Fatalf("unexpected output: %s", got)
+	}
+	if got := exec.Execute(context.Background(), toolCall("echo", "")); got != `{}` {
+		t.Fatalf("empty arguments should become {}, got %s", got)
+	}
+}
+
+func TestExecuteEncodesFailures(t *testing.T) {
+	registry := NewRegistry()
+	registry.MustRegister(Tool{
+		Name:    "slow",
+		Timeout: 20 * time.Millisecond,
+		Run: func(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+			time.Sleep(time.Second)
+			return "late", nil
+		},
+	})
+	registry.MustRegister(Tool{
+		Name:    "hidden",
+		Enabled: func() bool { return false },
+		Run: func(ctx context.Context, inv Invocation, args json.RawMessage) (string, error) {
+			return "ok", nil
+		},
+	})
+	exec := &executor{registry: registry}
+
+	cases := map[string]openai.ToolCall{
+		"timed out":          toolCall("slow", `{}`),
+		"unknown tool":       toolCall("missing", `{}`),
+		"arguments must be":  toolCall("slow", `{not json`),
+		"unknown tool: hidd": toolCall("hidden", `{}`),
+	}
+	for want, call := range cases {
+		got := exec.Execute(context.Background(), call)
+		var decoded map[string]string
+		if err := json.Unmarshal([]byte(got), &decoded); err != nil || !strings.Contains(decoded["error"], want) {
+			t.Fatalf("call %s: expected error containing %q, got %s", call.Function.Name, want, got)
+		}
+	}
+
+	if defs := exec.Definitions(); len(defs) != 1 || defs[0].Function.Name != "slow" {
+		t.Fatalf("disabled tools should not be exposed: %+v", defs)
+	}
+}
+
+func TestBuiltinToolsHaveValidSchemas(t *testing.T) {
+	for _, name := range DefaultRegistry().Names() {
+		tool, _ := DefaultRegistry().lookup(name)
+		var schema map[string]any
+		if err := json.Unmarshal(tool.Parameters, &schema); err != nil || schema["type"] != "object" {
+			t.Fatalf("tool %s has invalid schema: %s", name, tool.Parameters)
+		}
+	}
+}
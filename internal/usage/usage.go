@@ -0,0 +1,464 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"project-yume/internal/clock"
+	"project-yume/internal/config"
+	"project-yume/internal/metrics"
+	"project-yume/internal/storage"
+	"project-yume/internal/utils"
+)
+
+const SnapshotName = "usage/usage.json"
+const FlushTaskName = "usage"
+
+// retentionDays 按天汇总保留的天数，至少要覆盖一个完整自然月。
+const retentionDays = 93
+
+// 超出预算后的降级方式。
+const (
+	PolicyCheapProfile = "cheap_profile"
+	PolicyPresetOnly   = "preset_only"
+)
+
+// Totals 一组请求的用量合计。Cost 按配置里的单价折算，单位与单价一致。
+type Totals struct {
+	Requests          int     `json:"requests"`
+	PromptTokens      int     `json:"prompt_tokens"`
+	CompletionTokens  int     `json:"completion_tokens"`
+	EstimatedRequests int     `json:"estimated_requests,omitempty"`
+	Cost              float64 `json:"cost"`
+}
+
+func (t Totals) Tokens() int {
+	return t.PromptTokens + t.CompletionTokens
+}
+
+func (t *Totals) add(record Record) {
+	t.Requests++
+	t.PromptTokens += record.PromptTokens
+	t.CompletionTokens += record.CompletionTokens
+	t.Cost += record.Cost
+	if record.Estimated {
+		t.EstimatedRequests++
+	}
+}
+
+func (t *Totals) merge(other Totals) {
+	t.Requests += other.Requests
+	t.PromptTokens += other.PromptTokens
+	t.CompletionTokens += other.CompletionTokens
+	t.EstimatedRequests += other.EstimatedRequests
+	t.Cost += other.Cost
+}
+
+// Day 某一天的用量，按任务、配置、用户和会话分别汇总。
+type Day struct {
+	Date      string            `json:"date"`
+	Total     Totals            `json:"total"`
+	ByTask    map[string]Totals `json:"by_task"`
+	ByProfile map[string]Totals `json:"by_profile"`
+	ByUser    map[int64]Totals  `json:"by_user"`
+	BySession map[string]Totals `json:"by_session"`
+}
+
+func newDay(date string) *Day {
+	return &Day{
+		Date:      date,
+		ByTask:    make(map[string]Totals),
+		ByProfile: make(map[string]Totals),
+		ByUser:    make(map[int64]Totals),
+		BySession: make(map[string]Totals),
+	}
+}
+
+// Record 一次模型调用的用量。Estimated 表示服务端没有返回 usage，按字数估算。
+type Record struct {
+	At               time.Time
+	SessionID        string
+	UserID           int64
+	Task             string
+	Profile          string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        bool
+	Cost             float64
+}
+
+// Cost 按每百万 token 的单价计算费用。
+func Cost(inputPrice, outputPrice float64, promptTokens, completionTokens int) float64 {
+	return (inputPrice*float64(promptTokens) + outputPrice*float64(completionTokens)) / 1_000_000
+}
+
+// BudgetStatus 当前预算使用情况。Exceeded 时 Policy 是实际生效的降级方式：
+// cheap_profile 但没有可用的降级配置时按 preset_only 处理。
+type BudgetStatus struct {
+	Exceeded           bool    `json:"exceeded"`
+	Reason             string  `json:"reason,omitempty"`
+	Policy             string  `json:"policy"`
+	Profile            string  `json:"profile,omitempty"`
+	Today              Totals  `json:"today"`
+	Month              Totals  `json:"month"`
+	DailyTokenBudget   int     `json:"daily_token_budget"`
+	MonthlyTokenBudget int     `json:"monthly_token_budget"`
+	DailyCostBudget    float64 `json:"daily_cost_budget"`
+	MonthlyCostBudget  float64 `json:"monthly_cost_budget"`
+}
+
+// PresetOnly 预算超出且只能使用预设回复。
+func (s BudgetStatus) PresetOnly() bool {
+	return s.Exceeded && s.Policy == PolicyPresetOnly
+}
+
+// Manager 保存按天汇总的模型用量。
+type Manager struct {
+	mu       sync.RWMutex
+	days     map[string]*Day
+	exceeded bool
+	store    storage.SnapshotStore
+	dirty    storage.DirtyMarker
+}
+
+var manager *Manager
+
+func init() {
+	manager = &Manager{
+		days: make(map[string]*Day),
+	}
+}
+
+func GetManager() *Manager {
+	return manager
+}
+
+// Add 记录一次调用，同时累加 token 与费用指标。
+func (m *Manager) Add(record Record) {
+	if record.At.IsZero() {
+		record.At = clock.Now()
+	}
+	date := record.At.In(location()).Format(time.DateOnly)
+
+	m.mu.Lock()
+	day, ok := m.days[date]
+	if !ok {
+		day = newDay(date)
+		m.days[date] = day
+		m.pruneLocked(record.At)
+	}
+	day.Total.add(record)
+	addTo(day.ByTask, record.Task, record)
+	addTo(day.ByProfile, record.Profile, record)
+	if record.UserID != 0 {
+		totals := day.ByUser[record.UserID]
+		totals.add(record)
+		day.ByUser[record.UserID] = totals
+	}
+	addTo(day.BySession, record.SessionID, record)
+	m.mu.Unlock()
+
+	labels := map[string]string{"route": record.Task, "profile": record.Profile}
+	metrics.AddCounter("bot_ai_prompt_tokens_total", "Total prompt tokens by route and profile.", float64(record.PromptTokens), labels)
+	metrics.AddCounter("bot_ai_completion_tokens_total", "Total completion tokens by route and profile.", float64(record.CompletionTokens), labels)
+	if record.Cost > 0 {
+		metrics.AddCounter("bot_ai_cost_total", "Total AI cost by route and profile, in configured price units.", record.Cost, labels)
+	}
+	if record.Estimated {
+		metrics.IncCounter("bot_ai_usage_estimated_total", "Total AI calls whose token usage was estimated locally.", labels)
+	}
+	m.markDirty()
+}
+
+func addTo(bucket map[string]Totals, key string, record Record) {
+	if key == "" {
+		return
+	}
+	totals := bucket[key]
+	totals.add(record)
+	bucket[key] = totals
+}
+
+// UserTotals 返回用户每天的用量，键为日期。
+func (m *Manager) UserTotals(userID int64) map[string]Totals {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]Totals)
+	for date, day := range m.days {
+		if totals, ok := day.ByUser[userID]; ok {
+			result[date] = totals
+		}
+	}
+	return result
+}
+
+// ForgetUser 删除用户及其会话的分项用量，当天总量和按任务、配置的汇总保留。返回涉及的天数。
+func (m *Manager) ForgetUser(userID int64, sessionIDs []string) int {
+	m.mu.Lock()
+	count := 0
+	for _, day := range m.days {
+		changed := false
+		if _, ok := day.ByUser[userID]; ok {
+			delete(day.ByUser, userID)
+			changed = true
+		}
+		for _, sessionID := range sessionIDs {
+			if _, ok := day.BySession[sessionID]; ok {
+				delete(day.BySession, sessionID)
+				changed = true
+			}
+		}
+		if changed {
+			count++
+		}
+	}
+	m.mu.Unlock()
+
+	if count > 0 {
+		m.markDirty()
+	}
+	return count
+}
+
+// Days 返回最近 n 天（含今天）的用量，最新的在前；没有调用的日期不返回。
+func (m *Manager) Days(now time.Time, n int) []Day {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	local := now.In(location())
+	result := make([]Day, 0, n)
+	for i := 0; i < n; i++ {
+		date := local.AddDate(0, 0, -i).Format(time.DateOnly)
+		if day, ok := m.days[date]; ok {
+			result = append(result, copyDay(day))
+		}
+	}
+	return result
+}
+
+// Budget 按当前配置计算今天与本月的预算使用情况。
+func (m *Manager) Budget(now time.Time) BudgetStatus {
+	cfg := config.GetConfig()
+	local := now.In(location())
+	today := local.Format(time.DateOnly)
+	monthPrefix := local.Format("2006-01-")
+
+	status := BudgetStatus{
+		Policy:             cfg.AiBudgetPolicy,
+		DailyTokenBudget:   cfg.AiDailyTokenBudget,
+		MonthlyTokenBudget: cfg.AiMonthlyTokenBudget,
+		DailyCostBudget:    cfg.AiDailyCostBudget,
+		MonthlyCostBudget:  cfg.AiMonthlyCostBudget,
+	}
+	m.mu.RLock()
+	for date, day := range m.days {
+		if date == today {
+			status.Today = day.Total
+		}
+		if strings.HasPrefix(date, monthPrefix) {
+			status.Month.merge(day.Total)
+		}
+	}
+	m.mu.RUnlock()
+
+	switch {
+	case status.DailyTokenBudget > 0 && status.Today.Tokens() >= status.DailyTokenBudget:
+		status.Reason = "daily_tokens"
+	case status.MonthlyTokenBudget > 0 && status.Month.Tokens() >= status.MonthlyTokenBudget:
+		status.Reason = "monthly_tokens"
+	case status.DailyCostBudget > 0 && status.Today.Cost >= status.DailyCostBudget:
+		status.Reason = "daily_cost"
+	case status.MonthlyCostBudget > 0 && status.Month.Cost >= status.MonthlyCostBudget:
+		status.Reason = "monthly_cost"
+	}
+	status.Exceeded = status.Reason != ""
+
+	if status.Policy != PolicyPresetOnly {
+		status.Policy = PolicyCheapProfile
+		if _, ok := config.GetAIProfile(cfg.AiBudgetProfile); ok {
+			status.Profile = strings.TrimSpace(cfg.AiBudgetProfile)
+		} else {
+			status.Policy = PolicyPresetOnly
+		}
+	}
+	m.noteTransition(status)
+	return status
+}
+
+// noteTransition 预算状态变化时记录日志与指标。
+func (m *Manager) noteTransition(status BudgetStatus) {
+	m.mu.Lock()
+	changed := m.exceeded != status.Exceeded
+	m.exceeded = status.Exceeded
+	m.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	if status.Exceeded {
+		utils.Warnw("ai budget exceeded, degrading",
+			utils.String("reason", status.Reason),
+			utils.String("policy", status.Policy),
+			utils.String("profile", status.Profile),
+		)
+	} else {
+		utils.Infow("ai budget back within limits")
+	}
+	state := "ok"
+	if status.Exceeded {
+		state = "exceeded"
+	}
+	metrics.IncCounter(
+		"bot_ai_budget_transitions_total",
+		"Total AI budget state changes.",
+		map[string]string{"state": state, "reason": status.Reason},
+	)
+}
+
+func (m *Manager) ConfigurePersistence(store storage.SnapshotStore, dirty storage.DirtyMarker) error {
+	m.mu.Lock()
+	m.store = store
+	m.dirty = dirty
+	m.mu.Unlock()
+
+	if store == nil {
+		return nil
+	}
+
+	data, err := store.Load(SnapshotName)
+	if err != nil {
+		return fmt.Errorf("load usage failed: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	var loaded []*Day
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("unmarshal usage failed: %w", err)
+	}
+
+	m.mu.Lock()
+	m.days = make(map[string]*Day, len(loaded))
+	for _, day := range loaded {
+		if day == nil || day.Date == "" {
+			continue
+		}
+		restored := copyDay(day)
+		m.days[day.Date] = &restored
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Manager) Flush() error {
+	m.mu.RLock()
+	store := m.store
+	days := make([]Day, 0, len(m.days))
+	for _, day := range m.days {
+		days = append(days, copyDay(day))
+	}
+	m.mu.RUnlock()
+
+	if store == nil {
+		return nil
+	}
+
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	data, err := json.MarshalIndent(days, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal usage failed: %w", err)
+	}
+	if err := store.Save(SnapshotName, data); err != nil {
+		return fmt.Errorf("save usage failed: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) pruneLocked(now time.Time) {
+	cutoff := now.In(location()).AddDate(0, 0, -retentionDays).Format(time.DateOnly)
+	for date := range m.days {
+		if date < cutoff {
+			delete(m.days, date)
+		}
+	}
+}
+
+func (m *Manager) markDirty() {
+	m.mu.RLock()
+	dirty := m.dirty
+	m.mu.RUnlock()
+	if dirty != nil {
+		dirty.MarkDirty(FlushTaskName)
+	}
+}
+
+func copyDay(day *Day) Day {
+	copied := *newDay(day.Date)
+	copied.Total = day.Total
+	for key, value := range day.ByTask {
+		copied.ByTask[key] = value
+	}
+	for key, value := range day.ByProfile {
+		copied.ByProfile[key] = value
+	}
+	for key, value := range day.ByUser {
+		copied.ByUser[key] = value
+	}
+	for key, value := range day.BySession {
+		copied.BySession[key] = value
+	}
+	return copied
+}
+
+var locationCache struct {
+	sync.Mutex
+	timezone string
+	loc      *time.Location
+}
+
+// location 按天汇总使用的时区，与时间上下文保持一致。按配置原文缓存，避免每次调用都读时区文件。
+func location() *time.Location {
+	timezone := strings.TrimSpace(config.GetConfig().TimeContextTimezone)
+	if timezone == "" {
+		timezone = "Asia/Shanghai"
+	}
+
+	locationCache.Lock()
+	defer locationCache.Unlock()
+	if locationCache.loc != nil && locationCache.timezone == timezone {
+		return locationCache.loc
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.Local
+	}
+	locationCache.timezone = timezone
+	locationCache.loc = loc
+	return loc
+}
+
+type scopeKey struct{}
+
+// Scope 用量归属的会话与用户。
+type Scope struct {
+	SessionID string
+	UserID    int64
+}
+
+// WithScope 把会话与用户挂到 ctx 上，之后的模型调用按此归属用量。
+func WithScope(ctx context.Context, sessionID string, userID int64) context.Context {
+	return context.WithValue(ctx, scopeKey{}, Scope{SessionID: sessionID, UserID: userID})
+}
+
+func ScopeFrom(ctx context.Context) Scope {
+	scope, _ := ctx.Value(scopeKey{}).(Scope)
+	return scope
+}
@@ -0,0 +1,73 @@
+package usage
+
+import (
+	"testing"
+	"time"
+
+	"project-yume/internal/config"
+)
+
+type memoryStore map[string][]byte
+
+func (s memoryStore) Save(name string, data []byte) error {
+	s[name] = data
+	return nil
+}
+
+func (s memoryStore) Load(name string) ([]byte, error) {
+	return s[name], nil
+}
+
+func TestBudgetExceededFallsBackToPresetOnly(t *testing.T) {
+	cfg := config.GetConfig()
+	previous := *cfg
+	t.Cleanup(func() { *cfg = previous })
+	cfg.TimeContextTimezone = "Asia/Shanghai"
+	cfg.AiDailyTokenBudget = 100
+	cfg.AiBudgetPolicy = PolicyCheapProfile
+	cfg.AiBudgetProfile = "missing"
+
+	m := &Manager{days: make(map[string]*Day)}
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	m.Add(Record{At: now, SessionID: "private:1", UserID: 1, Task: "reply", Profile: "default", PromptTokens: 40, CompletionTokens: 20})
+	if status := m.Budget(now); status.Exceeded {
+		t.Fatalf("budget should not be exceeded yet: %+v", status)
+	}
+
+	m.Add(Record{At: now, SessionID: "private:2", UserID: 2, Task: "classify", Profile: "fast", PromptTokens: 30, CompletionTokens: 10, Estimated: true})
+	status := m.Budget(now)
+	if !status.Exceeded || status.Reason != "daily_tokens" || !status.PresetOnly() {
+		t.Fatalf("unknown budget profile should degrade to preset_only: %+v", status)
+	}
+
+	days := m.Days(now, 1)
+	if len(days) != 1 {
+		t.Fatalf("expected one day, got %d", len(days))
+	}
+	day := days[0]
+	if day.Total.Requests != 2 || day.Total.EstimatedRequests != 1 || day.ByUser[2].Tokens() != 40 || day.ByTask["reply"].Tokens() != 60 {
+		t.Fatalf("unexpected aggregates: %+v", day)
+	}
+}
+
+func TestFlushAndReload(t *testing.T) {
+	store := memoryStore{}
+	m := &Manager{days: make(map[string]*Day)}
+	if err := m.ConfigurePersistence(store, nil); err != nil {
+		t.Fatalf("configure failed: %v", err)
+	}
+	now := time.Now()
+	m.Add(Record{At: now, Task: "reply", Profile: "default", PromptTokens: 1000, CompletionTokens: 500, Cost: Cost(2, 8, 1000, 500)})
+	if err := m.Flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+
+	reloaded := &Manager{days: make(map[string]*Day)}
+	if err := reloaded.ConfigurePersistence(store, nil); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	days := reloaded.Days(now, 1)
+	if len(days) != 1 || days[0].ByProfile["default"].Cost != 0.006 {
+		t.Fatalf("unexpected reloaded usage: %+v", days)
+	}
+}
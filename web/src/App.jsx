@@ -4,6 +4,7 @@ import { OverviewPage } from "./pages/OverviewPage";
 import { AIConfigPage } from "./pages/AIConfigPage";
 import { PromptPage } from "./pages/PromptPage";
 import { LogsPage } from "./pages/LogsPage";
+import { MemoryPage } from "./pages/MemoryPage";
 import { useAdminPanel } from "./hooks/useAdminPanel";
 
 const MENU_ITEMS = [
@@ -28,6 +29,13 @@ const MENU_ITEMS = [
     note: "声音设计",
     description: "维护人格文件、补充系统提示词，并检查最终真正送给模型的完整 Prompt。"
   },
+  {
+    key: "memory",
+    label: "记忆",
+    icon: "◎",
+    note: "档案室",
+    description: "查看并修正机器人记住的事实、画像偏好和情绪轨迹，改动会走正常的刷盘流程。"
+  },
   {
     key: "logs",
     label: "日志流",
@@ -111,6 +119,7 @@ export default function App() {
           {active === "overview" ? <OverviewPage panel={panel} /> : null}
           {active === "ai" ? <AIConfigPage panel={panel} /> : null}
           {active === "prompt" ? <PromptPage panel={panel} /> : null}
+          {active === "memory" ? <MemoryPage panel={panel} /> : null}
           {active === "logs" ? <LogsPage panel={panel} /> : null}
         </section>
       </main>
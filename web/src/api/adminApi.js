@@ -56,6 +56,73 @@ export const adminApi = {
       body: JSON.stringify({ name, config })
     });
   },
+  getMemoryUsers() {
+    return fetchJSON("/api/admin/memory/users", { cache: "no-store" });
+  },
+  getMemoryFacts(filters) {
+    const params = new URLSearchParams();
+    Object.entries(filters || {}).forEach(([key, value]) => {
+      if (value !== undefined && value !== null && String(value).trim() !== "") {
+        params.set(key, String(value).trim());
+      }
+    });
+    return fetchJSON(`/api/admin/memory/facts?${params.toString()}`, { cache: "no-store" });
+  },
+  updateMemoryFact(id, payload) {
+    return fetchJSON(`/api/admin/memory/facts/${encodeURIComponent(id)}`, {
+      method: "PUT",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(payload)
+    });
+  },
+  deleteMemoryFact(id) {
+    return fetchJSON(`/api/admin/memory/facts/${encodeURIComponent(id)}`, {
+      method: "DELETE"
+    });
+  },
+  getMemoryProfile(userId) {
+    return fetchJSON(`/api/admin/memory/profiles/${encodeURIComponent(userId)}`, { cache: "no-store" });
+  },
+  updateMemoryProfile(userId, payload) {
+    return fetchJSON(`/api/admin/memory/profiles/${encodeURIComponent(userId)}`, {
+      method: "PUT",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify(payload)
+    });
+  },
+  getEmotionalMemory(userId) {
+    return fetchJSON(`/api/admin/memory/emotional/${encodeURIComponent(userId)}`, { cache: "no-store" });
+  },
+  getAffinity(userId) {
+    return fetchJSON(`/api/admin/memory/affinity/${encodeURIComponent(userId)}`, { cache: "no-store" });
+  },
+  getMood(userId, days) {
+    const query = days ? `?days=${encodeURIComponent(days)}` : "";
+    return fetchJSON(`/api/admin/memory/mood/${encodeURIComponent(userId)}${query}`, { cache: "no-store" });
+  },
+  getCrisisEvents(filters) {
+    const params = new URLSearchParams();
+    Object.entries(filters || {}).forEach(([key, value]) => {
+      if (value !== undefined && value !== null && String(value).trim() !== "") {
+        params.set(key, String(value).trim());
+      }
+    });
+    return fetchJSON(`/api/admin/safety/events?${params.toString()}`, { cache: "no-store" });
+  },
+  releaseCrisisGuard(userId) {
+    return fetchJSON(`/api/admin/safety/guard/${encodeURIComponent(userId)}`, {
+      method: "DELETE"
+    });
+  },
+  userExportUrl(userId, format) {
+    const query = format ? `?format=${encodeURIComponent(format)}` : "";
+    return `/api/admin/privacy/users/${encodeURIComponent(userId)}/export${query}`;
+  },
+  forgetUser(userId) {
+    return fetchJSON(`/api/admin/privacy/users/${encodeURIComponent(userId)}`, {
+      method: "DELETE"
+    });
+  },
   getLogFiles() {
     return fetchJSON("/api/admin/logs/files");
   },
@@ -2,6 +2,8 @@ import { useCallback, useEffect, useMemo, useState } from "react";
 import { adminApi } from "../api/adminApi";
 
 const defaultConfig = {
+  aiProvider: "openai",
+  aiProviders: ["openai", "anthropic", "gemini", "ollama"],
   aiBaseUrl: "",
   aiModel: "",
   aiProfile: "default",
@@ -151,6 +153,7 @@ export function useAdminPanel() {
       setConfig((prev) => ({
         ...prev,
         aiProfile: data.name || target,
+        aiProvider: data.aiProvider || "openai",
         aiBaseUrl: data.aiBaseUrl || "",
         aiModel: data.aiModel || "",
         aiTemperature: data.aiTemperature ?? prev.aiTemperature,
@@ -405,6 +408,7 @@ function normalizeCharacterConfig(raw) {
 
 function buildConfigPayload(config) {
   return {
+    aiProvider: String(config.aiProvider || "").trim(),
     aiBaseUrl: String(config.aiBaseUrl || "").trim(),
     aiModel: String(config.aiModel || "").trim(),
     aiProfile: String(config.aiProfile || "").trim(),
@@ -77,8 +77,16 @@ export function AIConfigPage({ panel }) {
 
       <Panel eyebrow="Transport" title="入口与采样" subtitle="先决定接到哪路模型，再决定回答的自由度。">
         <div className="form-grid">
+          <SelectField
+            label="Provider"
+            value={cfg.aiProvider}
+            options={cfg.aiProviders}
+            hint="openai 适用于所有兼容接口；其余走各家原生协议。"
+            onChange={(v) => updateField(panel, "aiProvider", v)}
+          />
           <InputField
             label="AI Base URL"
+            hint="anthropic / gemini / ollama 留空时使用官方默认地址。"
             value={cfg.aiBaseUrl}
             onChange={(v) => updateField(panel, "aiBaseUrl", v)}
           />
@@ -0,0 +1,649 @@
+import { useCallback, useEffect, useState } from "react";
+import { adminApi } from "../api/adminApi";
+import { Panel } from "../components/common/Panel";
+import { InputField, SelectField } from "../components/common/FormField";
+
+const FACT_STATUSES = ["active", "pending", "stale", "contradicted"];
+
+const emptyFilters = { status: "", predicate: "", q: "" };
+
+const STAGE_LABELS = { stranger: "陌生", acquaintance: "认识", familiar: "熟悉", close: "亲近" };
+
+const MOOD_EMOTIONS = ["开心", "中性", "哲学", "敷衍", "难过", "生气"];
+
+const MOOD_DAYS = 90;
+
+const CRISIS_EVENT_LIMIT = 50;
+
+function splitList(text) {
+  return String(text || "")
+    .split(/[,，、\n]/)
+    .map((item) => item.trim())
+    .filter(Boolean);
+}
+
+function formatTime(value) {
+  if (!value || value.startsWith("0001-")) {
+    return "-";
+  }
+  return new Date(value).toLocaleString();
+}
+
+function getErrMsg(err) {
+  return err instanceof Error ? err.message : String(err);
+}
+
+export function MemoryPage({ panel }) {
+  const [users, setUsers] = useState([]);
+  const [userId, setUserId] = useState("");
+  const [filters, setFilters] = useState(emptyFilters);
+  const [facts, setFacts] = useState([]);
+  const [profileDraft, setProfileDraft] = useState({ likes: "", dislikes: "", taboos: "" });
+  const [emotional, setEmotional] = useState(null);
+  const [affinity, setAffinity] = useState(null);
+  const [mood, setMood] = useState(null);
+  const [crisis, setCrisis] = useState({ events: [], guarded: {} });
+  const [loading, setLoading] = useState(false);
+
+  const { setError, setStatus } = panel;
+
+  const loadUsers = useCallback(async () => {
+    try {
+      const data = await adminApi.getMemoryUsers();
+      setUsers(data.users || []);
+    } catch (err) {
+      setError(getErrMsg(err));
+    }
+  }, [setError]);
+
+  const loadFacts = useCallback(async () => {
+    setLoading(true);
+    try {
+      const data = await adminApi.getMemoryFacts({ user_id: userId, ...filters });
+      setFacts(data.facts || []);
+    } catch (err) {
+      setError(getErrMsg(err));
+    } finally {
+      setLoading(false);
+    }
+  }, [filters, setError, userId]);
+
+  const loadUserDetail = useCallback(async (target) => {
+    if (!target) {
+      setEmotional(null);
+      setAffinity(null);
+      setMood(null);
+      setProfileDraft({ likes: "", dislikes: "", taboos: "" });
+      return;
+    }
+    const [profileResult, emotionalResult, affinityResult, moodResult] = await Promise.allSettled([
+      adminApi.getMemoryProfile(target),
+      adminApi.getEmotionalMemory(target),
+      adminApi.getAffinity(target),
+      adminApi.getMood(target, MOOD_DAYS)
+    ]);
+    if (profileResult.status === "fulfilled") {
+      const profile = profileResult.value;
+      setProfileDraft({
+        likes: (profile.likes || []).join("、"),
+        dislikes: (profile.dislikes || []).join("、"),
+        taboos: (profile.taboos || []).join("、")
+      });
+    } else {
+      setError(getErrMsg(profileResult.reason));
+    }
+    setEmotional(emotionalResult.status === "fulfilled" ? emotionalResult.value : null);
+    setAffinity(affinityResult.status === "fulfilled" ? affinityResult.value : null);
+    setMood(moodResult.status === "fulfilled" ? moodResult.value : null);
+  }, [setError]);
+
+  const loadCrisis = useCallback(async () => {
+    try {
+      const data = await adminApi.getCrisisEvents({ user_id: userId, limit: CRISIS_EVENT_LIMIT });
+      setCrisis({ events: data.events || [], guarded: data.guarded || {} });
+    } catch (err) {
+      setError(getErrMsg(err));
+    }
+  }, [setError, userId]);
+
+  useEffect(() => {
+    void loadUsers();
+  }, [loadUsers]);
+
+  useEffect(() => {
+    void loadCrisis();
+  }, [loadCrisis]);
+
+  useEffect(() => {
+    void loadFacts();
+  }, [loadFacts]);
+
+  useEffect(() => {
+    void loadUserDetail(userId);
+  }, [loadUserDetail, userId]);
+
+  const saveFact = async (fact, patch) => {
+    setError("");
+    try {
+      const data = await adminApi.updateMemoryFact(fact.id, patch);
+      setFacts((prev) => prev.map((item) => (item.id === fact.id ? data.fact : item)));
+      setStatus("事实已更新");
+      void loadFacts();
+    } catch (err) {
+      setError(getErrMsg(err));
+    }
+  };
+
+  const deleteFact = async (fact) => {
+    if (!window.confirm(`删除事实「${fact.summary}」？`)) {
+      return;
+    }
+    setError("");
+    try {
+      await adminApi.deleteMemoryFact(fact.id);
+      setFacts((prev) => prev.filter((item) => item.id !== fact.id));
+      setStatus("事实已删除");
+      void loadUsers();
+    } catch (err) {
+      setError(getErrMsg(err));
+    }
+  };
+
+  const saveProfile = async () => {
+    setError("");
+    try {
+      await adminApi.updateMemoryProfile(userId, {
+        likes: splitList(profileDraft.likes),
+        dislikes: splitList(profileDraft.dislikes),
+        taboos: splitList(profileDraft.taboos)
+      });
+      setStatus("画像偏好已保存");
+      await loadUserDetail(userId);
+      void loadUsers();
+    } catch (err) {
+      setError(getErrMsg(err));
+    }
+  };
+
+  const releaseGuard = async (target) => {
+    if (!window.confirm(`确认用户 ${target} 已经安全，提前解除守护状态？`)) {
+      return;
+    }
+    setError("");
+    try {
+      const data = await adminApi.releaseCrisisGuard(target);
+      setStatus(`已解除用户 ${target} 的守护：${(data.released || []).join("、")}`);
+      void loadCrisis();
+    } catch (err) {
+      setError(getErrMsg(err));
+    }
+  };
+
+  const forgetUser = async () => {
+    if (!window.confirm(`彻底删除用户 ${userId} 的会话、记忆、提醒、审计记录和日志行？此操作不可撤销。`)) {
+      return;
+    }
+    setError("");
+    try {
+      const report = await adminApi.forgetUser(userId);
+      setStatus(`已删除用户 ${userId}：事实 ${report.facts} 条，审计 ${report.audit_records} 条，日志 ${report.log_lines} 行`);
+      setUserId("");
+      void loadUsers();
+    } catch (err) {
+      setError(getErrMsg(err));
+    }
+  };
+
+  return (
+    <div className="stack">
+      <div className="memory-layout">
+        <Panel
+          eyebrow="Archive index"
+          title="用户"
+          subtitle={`${users.length} 个用户有记忆`}
+          actions={
+            <button type="button" className="btn-ghost" onClick={() => void loadUsers()}>
+              刷新
+            </button>
+          }
+        >
+          <div className="memory-user-list">
+            <button
+              type="button"
+              className={`memory-user ${userId === "" ? "active" : ""}`}
+              onClick={() => setUserId("")}
+            >
+              <strong>全部用户</strong>
+              <span>只搜索事实</span>
+            </button>
+            {users.map((user) => (
+              <button
+                key={user.user_id}
+                type="button"
+                className={`memory-user ${String(user.user_id) === userId ? "active" : ""}`}
+                onClick={() => setUserId(String(user.user_id))}
+              >
+                <strong className="mono">{user.user_id}</strong>
+                <span>
+                  事实 {user.active_facts}/{user.facts} · 交互 {user.interactions} · 片段 {user.episodes}
+                  {user.stage ? ` · ${STAGE_LABELS[user.stage] || user.stage} ${Math.round(user.affinity)}` : ""}
+                </span>
+              </button>
+            ))}
+          </div>
+        </Panel>
+
+        <div className="stack">
+          <Panel
+            eyebrow="Fact ledger"
+            title="事实记忆"
+            subtitle={loading ? "加载中..." : `${facts.length} 条`}
+          >
+            <div className="logs-toolbar memory-filters">
+              <SelectField
+                label="Status"
+                value={filters.status}
+                options={["", ...FACT_STATUSES]}
+                onChange={(value) => setFilters((prev) => ({ ...prev, status: value }))}
+              />
+              <InputField
+                label="Predicate"
+                value={filters.predicate}
+                placeholder="likes / name / current_plan"
+                onChange={(value) => setFilters((prev) => ({ ...prev, predicate: value }))}
+              />
+              <InputField
+                label="Keyword"
+                value={filters.q}
+                onChange={(value) => setFilters((prev) => ({ ...prev, q: value }))}
+              />
+            </div>
+
+            <div className="fact-list">
+              {facts.length === 0 ? <div className="probe-check empty">没有匹配的事实</div> : null}
+              {facts.map((fact) => (
+                <FactCard key={fact.id} fact={fact} onSave={saveFact} onDelete={deleteFact} />
+              ))}
+            </div>
+          </Panel>
+
+          <Panel
+            eyebrow="Crisis events"
+            title="危机记录"
+            subtitle={
+              Object.keys(crisis.guarded).length > 0
+                ? `${Object.keys(crisis.guarded).length} 个会话守护中 · 共 ${crisis.events.length} 条`
+                : `${crisis.events.length} 条触发记录`
+            }
+            actions={
+              <button type="button" className="btn-ghost" onClick={() => void loadCrisis()}>
+                刷新
+              </button>
+            }
+          >
+            <CrisisEvents crisis={crisis} onRelease={releaseGuard} />
+          </Panel>
+
+          {userId ? (
+            <Panel
+              eyebrow="Privacy"
+              title="用户数据"
+              subtitle="导出该用户的全部数据，或彻底删除并写入删除记录"
+              actions={
+                <>
+                  <a className="btn-ghost" href={adminApi.userExportUrl(userId)}>
+                    导出 JSON
+                  </a>
+                  <a className="btn-ghost" href={adminApi.userExportUrl(userId, "zip")}>
+                    导出 ZIP
+                  </a>
+                  <button type="button" className="btn-ghost" onClick={() => void forgetUser()}>
+                    删除全部数据
+                  </button>
+                </>
+              }
+            />
+          ) : null}
+
+          {userId ? (
+            <div className="split-layout">
+              <Panel
+                eyebrow="Profile"
+                title="画像偏好"
+                subtitle="用顿号或逗号分隔，保存时整体覆盖"
+                actions={
+                  <button type="button" className="btn-primary" onClick={() => void saveProfile()}>
+                    保存
+                  </button>
+                }
+              >
+                <div className="form-grid memory-profile">
+                  <InputField
+                    label="Likes"
+                    value={profileDraft.likes}
+                    onChange={(value) => setProfileDraft((prev) => ({ ...prev, likes: value }))}
+                  />
+                  <InputField
+                    label="Dislikes"
+                    value={profileDraft.dislikes}
+                    onChange={(value) => setProfileDraft((prev) => ({ ...prev, dislikes: value }))}
+                  />
+                  <InputField
+                    label="Taboos"
+                    value={profileDraft.taboos}
+                    onChange={(value) => setProfileDraft((prev) => ({ ...prev, taboos: value }))}
+                  />
+                </div>
+              </Panel>
+
+              <Panel
+                eyebrow="Emotional trace"
+                title="情绪记忆"
+                subtitle={emotional ? `共 ${emotional.total} 次交互 · 最近 ${formatTime(emotional.last_seen)}` : "暂无记录"}
+              >
+                {emotional ? <EmotionalSummary emotional={emotional} /> : null}
+              </Panel>
+            </div>
+          ) : null}
+
+          {userId ? (
+            <Panel
+              eyebrow="Relationship"
+              title="关系阶段"
+              subtitle={
+                affinity
+                  ? `${STAGE_LABELS[affinity.stage] || affinity.stage} · 好感 ${affinity.score.toFixed(1)}/100 · 更新于 ${formatTime(affinity.updated_at)}`
+                  : "暂无记录"
+              }
+            >
+              {affinity ? <AffinitySummary affinity={affinity} /> : null}
+            </Panel>
+          ) : null}
+
+          {userId ? (
+            <Panel
+              eyebrow="Mood timeline"
+              title="情绪日历"
+              subtitle={
+                mood
+                  ? mood.distress
+                    ? `已连续 ${mood.distress.days} 天以${mood.distress.emotion}为主（${mood.distress.from} 起）`
+                    : `最近 ${MOOD_DAYS} 天的每日情绪`
+                  : "暂无记录"
+              }
+            >
+              {mood ? <MoodTimeline mood={mood} /> : null}
+            </Panel>
+          ) : null}
+        </div>
+      </div>
+    </div>
+  );
+}
+
+function FactCard({ fact, onSave, onDelete }) {
+  const [draft, setDraft] = useState(fact);
+
+  useEffect(() => {
+    setDraft(fact);
+  }, [fact]);
+
+  const tagsText = Array.isArray(draft.tags) ? draft.tags.join("、") : draft.tags;
+
+  const save = () =>
+    onSave(fact, {
+      object: draft.object,
+      summary: draft.summary,
+      status: draft.status,
+      confidence: Number(draft.confidence),
+      tags: splitList(tagsText)
+    });
+
+  return (
+    <article className="fact-card">
+      <div className="fact-card-head">
+        <span className="mono">
+          {fact.user_id} · {fact.predicate}
+        </span>
+        <span className={`inline-status ${fact.status === "active" ? "good" : "idle"}`}>{fact.status}</span>
+      </div>
+      <div className="form-grid fact-fields">
+        <InputField
+          label="Summary"
+          value={draft.summary}
+          onChange={(value) => setDraft((prev) => ({ ...prev, summary: value }))}
+        />
+        <InputField
+          label="Object"
+          value={draft.object}
+          onChange={(value) => setDraft((prev) => ({ ...prev, object: value }))}
+        />
+        <SelectField
+          label="Status"
+          value={draft.status}
+          options={FACT_STATUSES}
+          onChange={(value) => setDraft((prev) => ({ ...prev, status: value }))}
+        />
+        <InputField
+          label="Confidence"
+          type="number"
+          step="0.05"
+          value={draft.confidence}
+          onChange={(value) => setDraft((prev) => ({ ...prev, confidence: value }))}
+        />
+        <InputField
+          label="Tags"
+          value={tagsText}
+          onChange={(value) => setDraft((prev) => ({ ...prev, tags: value }))}
+        />
+      </div>
+      {fact.confidence_history?.length ? (
+        <details className="fact-history">
+          <summary className="field-hint">置信度变化 {fact.confidence_history.length} 次</summary>
+          <ul className="artifact-list">
+            {[...fact.confidence_history].reverse().map((change, index) => (
+              <li key={index} className="mono">
+                {Number(change.confidence).toFixed(2)} · {change.reason} · {formatTime(change.at)}
+              </li>
+            ))}
+          </ul>
+        </details>
+      ) : null}
+      <div className="fact-card-foot">
+        <span className="field-hint">
+          来源：{fact.source_message || "-"} · 确认于 {formatTime(fact.last_confirmed_at)}
+          {fact.expires_at ? ` · 有效至 ${formatTime(fact.expires_at)}` : ""}
+          {fact.superseded_at ? ` · 生效 ${formatTime(fact.valid_from)} 至 ${formatTime(fact.superseded_at)}` : ""}
+        </span>
+        <div className="action-row">
+          {fact.expires_at ? (
+            <button type="button" className="btn-ghost" onClick={() => void onSave(fact, { clear_expires_at: true })}>
+              取消有效期
+            </button>
+          ) : null}
+          <button type="button" className="btn-ghost" onClick={() => void onDelete(fact)}>
+            删除
+          </button>
+          <button type="button" className="btn-primary" onClick={() => void save()}>
+            保存
+          </button>
+        </div>
+      </div>
+    </article>
+  );
+}
+
+function AffinitySummary({ affinity }) {
+  const trend = affinity.trend || [];
+  const width = 600;
+  const height = 120;
+  const step = trend.length > 1 ? width / (trend.length - 1) : 0;
+  const points = trend.map((point, index) => `${(index * step).toFixed(1)},${(height - (point.score / 100) * height).toFixed(1)}`).join(" ");
+
+  return (
+    <div className="stack">
+      {trend.length > 1 ? (
+        <svg className="affinity-trend" viewBox={`0 0 ${width} ${height}`} preserveAspectRatio="none">
+          <polyline points={points} />
+        </svg>
+      ) : null}
+      <span className="field-hint">
+        {trend.length > 0 ? `${trend[0].day} 至 ${trend[trend.length - 1].day}，每天一个点` : "还没有趋势"}
+      </span>
+      <ul className="artifact-list interaction-list">
+        {[...(affinity.events || [])].reverse().map((event, index) => (
+          <li key={`${event.at}-${index}`}>
+            <span>
+              <span className="field-hint">{formatTime(event.at)}</span>
+              <br />
+              {event.reason}
+            </span>
+            <span className="mono">
+              {event.delta > 0 ? "+" : ""}
+              {event.delta} → {event.score}
+            </span>
+          </li>
+        ))}
+      </ul>
+    </div>
+  );
+}
+
+function MoodTimeline({ mood }) {
+  const days = mood.days || [];
+  const width = 600;
+  const height = 120;
+  const maxMessages = Math.max(1, ...days.map((day) => day.messages));
+  const barWidth = width / Math.max(days.length, 1);
+
+  return (
+    <div className="stack">
+      {days.length > 0 ? (
+        <svg className="mood-timeline" viewBox={`0 0 ${width} ${height}`} preserveAspectRatio="none">
+          {days.map((day, index) => {
+            const total = (day.messages / maxMessages) * height;
+            let offset = height;
+            return (
+              <g key={day.day}>
+                <title>
+                  {`${day.day} · ${day.messages} 条 · 强度 ${day.intensity} · ${Object.entries(day.emotions || {})
+                    .map(([emotion, count]) => `${emotion} ${count}`)
+                    .join("、")}`}
+                </title>
+                {MOOD_EMOTIONS.filter((emotion) => day.emotions?.[emotion]).map((emotion) => {
+                  const segment = (day.emotions[emotion] / Math.max(day.rated, 1)) * total;
+                  offset -= segment;
+                  return (
+                    <rect
+                      key={emotion}
+                      className={`mood-${MOOD_EMOTIONS.indexOf(emotion)}`}
+                      x={index * barWidth + 1}
+                      y={offset}
+                      width={Math.max(barWidth - 2, 1)}
+                      height={segment}
+                    />
+                  );
+                })}
+              </g>
+            );
+          })}
+        </svg>
+      ) : null}
+      <div className="mood-legend">
+        {MOOD_EMOTIONS.map((emotion, index) => (
+          <span key={emotion} className={`mood-${index}`}>
+            {emotion}
+          </span>
+        ))}
+      </div>
+      <span className="field-hint">
+        {days.length > 0 ? `${days[0].day} 至 ${days[days.length - 1].day}，柱高为当天消息数` : "还没有每日汇总"}
+      </span>
+      <ul className="artifact-list interaction-list">
+        {[...(mood.check_ins || [])].reverse().map((checkIn, index) => (
+          <li key={`${checkIn.at}-${index}`}>
+            <span>
+              <span className="field-hint">
+                {formatTime(checkIn.at)} · 连续 {checkIn.days} 天{checkIn.emotion}
+              </span>
+              <br />
+              {checkIn.message}
+            </span>
+          </li>
+        ))}
+      </ul>
+    </div>
+  );
+}
+
+function CrisisEvents({ crisis, onRelease }) {
+  if (crisis.events.length === 0) {
+    return <div className="probe-check empty">没有触发记录</div>;
+  }
+  return (
+    <ul className="artifact-list interaction-list">
+      {crisis.events.map((event) => {
+        const guardedUntil = crisis.guarded[event.session_id];
+        const alerts = (event.alerts || [])
+          .map((alert) => `${alert.channel} ${alert.skipped ? "冷却中" : alert.ok ? "已通知" : "失败"}`)
+          .join(" · ");
+        return (
+          <li key={event.id}>
+            <span>
+              <span className="field-hint">
+                {formatTime(event.time)} · <span className="mono">{event.user_id}</span> · 分数{" "}
+                {event.assessment.score.toFixed(2)}（{event.assessment.source}
+                {event.assessment.matches?.length ? `：${event.assessment.matches.join("、")}` : ""}）
+                {alerts ? ` · ${alerts}` : ""}
+              </span>
+              <br />
+              {event.message}
+              {event.assessment.reason ? <span className="field-hint"> · 模型：{event.assessment.reason}</span> : null}
+            </span>
+            {guardedUntil ? (
+              <button type="button" className="btn-ghost" onClick={() => void onRelease(event.user_id)}>
+                守护至 {formatTime(guardedUntil)} · 解除
+              </button>
+            ) : (
+              <span className="field-hint">守护已结束</span>
+            )}
+          </li>
+        );
+      })}
+    </ul>
+  );
+}
+
+function EmotionalSummary({ emotional }) {
+  const counts = [
+    ...Object.entries(emotional.emotion_count || {}).map(([key, value]) => [`emotion · ${key}`, value]),
+    ...Object.entries(emotional.intention_count || {}).map(([key, value]) => [`intention · ${key}`, value])
+  ].sort((a, b) => b[1] - a[1]);
+
+  return (
+    <div className="stack">
+      <ul className="artifact-list">
+        {counts.map(([label, value]) => (
+          <li key={label}>
+            <span>{label}</span>
+            <span>{value}</span>
+          </li>
+        ))}
+      </ul>
+      <ul className="artifact-list interaction-list">
+        {(emotional.interactions || []).map((item, index) => (
+          <li key={`${item.timestamp}-${index}`}>
+            <span>
+              <span className="field-hint">{formatTime(item.timestamp)}</span>
+              <br />
+              {item.user_msg}
+            </span>
+            <span>
+              {item.emotion} / {item.intention}
+            </span>
+          </li>
+        ))}
+      </ul>
+    </div>
+  );
+}
@@ -6,6 +6,15 @@ export function OverviewPage({ panel }) {
   const logCount = panel.logFiles?.length || 0;
   const configChecks = Object.entries(panel.ready.checks || {});
   const healthChecks = Object.entries(panel.health.checks || {});
+  const breakerChecks = (panel.ready.aiProfiles || []).map((item) => [
+    item.profile,
+    item.consecutiveFailures > 0 ? `${item.state} · ${item.consecutiveFailures} failures` : item.state
+  ]);
+  const breakerStatus = breakerChecks.length === 0
+    ? "unknown"
+    : (panel.ready.aiProfiles || []).every((item) => item.state === "closed")
+      ? "ok"
+      : "degraded";
 
   return (
     <div className="stack">
@@ -81,6 +90,7 @@ export function OverviewPage({ panel }) {
           <div className="probe-report">
             <ProbeBlock title="Health / process" status={panel.health.status} checks={healthChecks} />
             <ProbeBlock title="Ready / dependencies" status={panel.ready.status} checks={configChecks} />
+            <ProbeBlock title="AI providers / breakers" status={breakerStatus} checks={breakerChecks} />
           </div>
         </Panel>
       </div>